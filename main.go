@@ -4,321 +4,1131 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
 	sesv2 "github.com/aws/aws-sdk-go-v2/service/sesv2"
 	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/talentmaker/lambda-ses/sesmail"
 
 	_ "github.com/joho/godotenv/autoload"
 )
 
-var ses *sesv2.Client
+// The client emails are sent with, which may be any sesmail.Client
+var ses sesmail.Client
 
-type Test struct {
-	ConfigurationSetName *string
+// Creates the client for a region, recording the Retry-After hints and request IDs of its
+// responses. Replace it to run the handler against another sesmail.Client, such as a mock which
+// doesn't call SES.
+var newClient = func(options sesv2.Options) sesmail.Client {
+	options.APIOptions = append(options.APIOptions, sesmail.RecordRetryAfter, sesmail.RecordRequestIDs)
+
+	return sesv2.New(options)
 }
 
-func createEmailTags(inputTags MessageTag) []types.MessageTag {
-	var emailTags []types.MessageTag
+// When the settings and clients were last loaded
+var configLoadedAt time.Time
 
-	for key, value := range inputTags {
-		emailTags = append(emailTags, types.MessageTag{
-			Name:  aws.String(key),
-			Value: aws.String(value),
-		})
-	}
+// Guards the settings and clients loadConfig assigns. Invocations hold it for reading while they
+// use them, so a reload waits for them to finish instead of swapping them out mid-send.
+var configLock sync.RWMutex
+
+// The region emails are sent through unless they set one
+var defaultRegion string
+
+// Sends messages to an SQS queue, implemented by *sqs.Client
+type QueueClient interface {
+	SendMessage(
+		ctx context.Context,
+		params *sqs.SendMessageInput,
+		optFns ...func(*sqs.Options),
+	) (*sqs.SendMessageOutput, error)
+}
+
+// The client async emails are queued on ASYNC_QUEUE_URL with. Async emails are rejected when nil.
+var asyncQueue QueueClient
+
+type HandlerInput struct {
+	Email     *sesmail.SendEmailInput     `json:"email"`
+	Emails    []*sesmail.SendEmailInput   `json:"emails"`
+	BulkEmail *sesmail.SendBulkEmailInput `json:"bulkEmail"`
+
+	// Return as soon as the single email is validated and queued on ASYNC_QUEUE_URL, which the
+	// function sends it from once SQS delivers it, logging the result. Rejected for emails and
+	// bulkEmail.
+	Async bool `json:"async"`
+
+	// Validate the single email and return a preview of its subject and body instead of sending it.
+	Preview bool `json:"preview"`
+
+	// Reload the settings and clients without sending anything.
+	RefreshConfig bool `json:"refreshConfig"`
+
+	CreateEventDestination *sesmail.CreateEventDestinationInput `json:"createEventDestination"`
+
+	// Create or delete a configuration set, or set its suppression options.
+	CreateConfigSet                *sesmail.CreateConfigurationSetInput             `json:"createConfigSet"`
+	DeleteConfigSet                *sesmail.DeleteConfigurationSetInput             `json:"deleteConfigSet"`
+	PutConfigSetSuppressionOptions *sesmail.ConfigurationSetSuppressionOptionsInput `json:"putConfigSetSuppressionOptions"`
+
+	// Report the effective settings in the output, for debugging the deployment's configuration.
+	DebugConfig bool `json:"debugConfig"`
+
+	// Create, update, or delete the template, as templateAction says.
+	Template       *sesmail.TemplateInput `json:"template"`
+	TemplateAction sesmail.TemplateAction `json:"templateAction"`
+
+	// Look up the account's sending quota without sending anything.
+	GetAccount bool `json:"getAccount"`
+
+	// Add, remove, look up, or list addresses on the account suppression list, as
+	// suppressionAction says.
+	Suppression       *sesmail.SuppressionInput `json:"suppression"`
+	SuppressionAction sesmail.SuppressionAction `json:"suppressionAction"`
+
+	// Create or delete a contact list, or add, update, remove, or list its contacts, as
+	// contactAction says.
+	Contacts      *sesmail.ContactInput `json:"contacts"`
+	ContactAction sesmail.ContactAction `json:"contactAction"`
+
+	// Whether the input was loaded from the payload store, so its emails are sent instead of being
+	// offloaded again.
+	offloaded bool
+}
+
+type HandlerOutput struct {
+	Operation      string                       `json:"operation"`
+	Email          *sesmail.SendEmailOutput     `json:"email"`
+	EmailError     *sesmail.APIError            `json:"error"`
+	Emails         []*sesmail.SendEmailOutput   `json:"emails"`
+	EmailsErrors   []*sesmail.APIError          `json:"errors"`
+	ErrorSummary   map[string]int               `json:"errorSummary,omitempty"`
+	BulkEmail      *sesmail.SendBulkEmailOutput `json:"bulkEmail"`
+	BulkEmailError *sesmail.APIError            `json:"bulkEmailError"`
+	Usage          *sesmail.Usage               `json:"usage"`
+	Warnings       []string                     `json:"warnings,omitempty"`
+
+	// A stable code summarising the outcome, such as OK, PARTIAL, or THROTTLED. See
+	// sesmail.ResultCode for every value.
+	ResultCode sesmail.ResultCode `json:"resultCode"`
+
+	// Whether every email was accepted by SES. False if any email failed, including a single
+	// failed entry of an otherwise successful bulk email. Bulk entries skipped as duplicates
+	// don't count as failures.
+	Success bool `json:"success"`
+
+	// The errors as RFC 7807 problem details. Only set when PROBLEM_DETAILS is enabled.
+	Problems []*sesmail.Problem `json:"problems,omitempty"`
+
+	// Where an oversized emails array was written. Its emails are sent by the invocation S3
+	// triggers once it's stored, and their results are logged.
+	OffloadLocation string `json:"offloadLocation,omitempty"`
+
+	// Milliseconds spent in each phase of the invocation.
+	PhaseTimings *PhaseTimings `json:"phaseTimings"`
+
+	// The number of SES API calls made, including bulk chunks, retries, failover, and quota and
+	// suppression list checks.
+	ApiCallCount int64 `json:"apiCallCount"`
+
+	// The Retry-After hints SES returned in seconds, such as while throttling, including those of
+	// attempts retried internally by the AWS SDK.
+	RetryAfterSeconds []float64 `json:"retryAfterSeconds,omitempty"`
 
-	return emailTags
+	// The AWS request IDs of every SES call made, including bulk chunks, retries, and failover,
+	// for support escalations.
+	RequestIds []string `json:"requestIds,omitempty"`
+
+	// The effective settings and default region, if debugConfig was set.
+	DebugConfig map[string]interface{} `json:"debugConfig,omitempty"`
+
+	// The account's sending quota, if getAccount was set.
+	Account *sesmail.AccountQuota `json:"account,omitempty"`
+
+	// The subject and start of the body of the single email, if preview was set.
+	Preview *sesmail.EmailPreview `json:"preview,omitempty"`
+
+	// The addresses looked up or listed on the suppression list.
+	Suppression *sesmail.SuppressionOutput `json:"suppression,omitempty"`
+
+	// The contacts listed on a contact list.
+	Contacts *sesmail.ContactOutput `json:"contacts,omitempty"`
+
+	// An input which resends only the emails or bulk entries that failed with a retryable error,
+	// such as throttling, if any did.
+	RetryPayload *HandlerInput `json:"retryPayload,omitempty"`
 }
 
-func sendEmailWithContext(ctx context.Context, input *SendEmailInput) (*sesv2.SendEmailOutput, error) {
-	if input.Content == nil {
-		return nil, errors.New("Content is required")
-	} else if input.Destination == nil {
-		return nil, errors.New("Destination is required")
+// Adds a warning to the output if the daily quota is nearly used up
+func (output *HandlerOutput) checkQuota(ctx context.Context) {
+	warning, err := sesmail.CheckQuota(ctx, ses)
+
+	if err != nil {
+		log.Printf("failed to check sending quota, %v", err)
+	} else if warning != "" {
+		output.Warnings = append(output.Warnings, warning)
 	}
+}
 
-	emailTags := createEmailTags(input.EmailTags)
+// Adds a warning to the output for each template without a text part
+func (output *HandlerOutput) checkTemplateText(ctx context.Context, templates ...*sesmail.Template) {
+	checked := map[string]bool{}
 
-	functionInput := &sesv2.SendEmailInput{
-		Content: &types.EmailContent{},
+	for _, template := range templates {
+		if template == nil || template.TemplateName == nil || checked[*template.TemplateName] {
+			continue
+		}
 
-		ConfigurationSetName: input.ConfigurationSetName,
+		checked[*template.TemplateName] = true
+		warning, err := sesmail.CheckTemplateText(ctx, ses, *template.TemplateName)
 
-		Destination: &types.Destination{
-			BccAddresses: input.Destination.BccAddresses,
-			CcAddresses:  input.Destination.CcAddresses,
-			ToAddresses:  input.Destination.ToAddresses,
-		},
+		if err != nil {
+			log.Printf("failed to check template %s for a text part, %v", *template.TemplateName, err)
+		} else if warning != "" {
+			output.Warnings = append(output.Warnings, warning)
+		}
+	}
+}
 
-		EmailTags:                                 emailTags,
-		FeedbackForwardingEmailAddress:            input.FeedbackForwardingEmailAddress,
-		FeedbackForwardingEmailAddressIdentityArn: input.FeedbackForwardingEmailAddressIdentityArn,
-		FromEmailAddress:                          input.FromEmailAddress,
-		FromEmailAddressIdentityArn:               input.FromEmailAddressIdentityArn,
+// The prefix of the keys offloaded emails arrays are stored under
+const offloadPrefix = "emails/"
+
+// Whether an event's emails array is too long to send, and should be offloaded instead. Emails
+// loaded from the payload store are always sent.
+func shouldOffload(event HandlerInput) bool {
+	return sesmail.Offload != nil && sesmail.Settings.OffloadThreshold > 0 && !event.offloaded &&
+		len(event.Emails) > sesmail.Settings.OffloadThreshold
+}
 
-		ListManagementOptions: nil,
+// Writes an emails array to the payload store in the handler's input format, returning where it
+// was written
+func offloadEmails(ctx context.Context, emails []*sesmail.SendEmailInput) (string, error) {
+	payload, err := json.Marshal(HandlerInput{Emails: emails})
 
-		ReplyToAddresses: input.ReplyToAddresses,
+	if err != nil {
+		return "", err
 	}
 
-	if input.Content.Body != nil && input.Content.Subject != nil {
-		var htmlContent *types.Content
-		var textContent *types.Content
+	key := fmt.Sprintf("%s%d.json", offloadPrefix, time.Now().UnixNano())
 
-		if input.Content.Body.Html != nil {
-			htmlContent = &types.Content{
-				Data:    input.Content.Body.Html.Data,
-				Charset: input.Content.Body.Html.Charset,
-			}
-		} else if input.Content.Body.Text != nil {
-			textContent = &types.Content{
-				Data:    input.Content.Body.Text.Data,
-				Charset: input.Content.Body.Text.Charset,
-			}
+	return sesmail.Offload.Store(ctx, key, payload)
+}
+
+// Returns the template an email is sent with, if any
+func emailTemplate(input *sesmail.SendEmailInput) *sesmail.Template {
+	if input == nil || input.Content == nil {
+		return nil
+	}
+
+	return input.Content.Template
+}
+
+// Returns the template a bulk email is sent with, which is the default bulk template when none is
+// given
+func bulkEmailTemplate(input *sesmail.SendBulkEmailInput) *sesmail.Template {
+	if input.DefaultContent != nil && input.DefaultContent.Template != nil {
+		return input.DefaultContent.Template
+	}
+
+	return &sesmail.Template{TemplateName: &sesmail.Settings.DefaultBulkTemplate}
+}
+
+// Adds a warning to the output for each attachment whose content doesn't match its declared type,
+// and each recipient found in only one of a raw message's headers and its Destination
+func (output *HandlerOutput) addMismatchWarnings(emails ...*sesmail.SendEmailOutput) {
+	for _, email := range emails {
+		if email == nil {
+			continue
 		}
 
-		functionInput.Content.Simple = &types.Message{
-			Body: &types.Body{
-				Html: htmlContent,
-				Text: textContent,
-			},
-			Subject: &types.Content{
-				Data:    input.Content.Subject.Data,
-				Charset: input.Content.Subject.Charset,
-			},
-		}
-	} else if input.Content.Simple != nil && input.Content.Simple.Body != nil && input.Content.Simple.Subject != nil {
-		var htmlContent *types.Content
-		var textContent *types.Content
-
-		if input.Content.Simple.Body.Html != nil {
-			htmlContent = &types.Content{
-				Data:    input.Content.Simple.Body.Html.Data,
-				Charset: input.Content.Simple.Body.Html.Charset,
-			}
-		} else if input.Content.Simple.Body.Text != nil {
-			textContent = &types.Content{
-				Data:    input.Content.Simple.Body.Text.Data,
-				Charset: input.Content.Simple.Body.Text.Charset,
-			}
+		for _, mismatch := range email.ContentTypeMismatches {
+			output.Warnings = append(output.Warnings, mismatch.String())
 		}
 
-		functionInput.Content.Simple = &types.Message{
-			Body: &types.Body{
-				Html: htmlContent,
-				Text: textContent,
-			},
-			Subject: &types.Content{
-				Data:    input.Content.Simple.Subject.Data,
-				Charset: input.Content.Simple.Subject.Charset,
-			},
+		for _, mismatch := range email.RecipientMismatches {
+			output.Warnings = append(output.Warnings, mismatch.String())
 		}
 	}
+}
 
-	if input.Content.Raw != nil {
-		functionInput.Content.Raw = &types.RawMessage{
-			Data: input.Content.Raw.Data,
+// Describes errors as problem details if enabled
+func (output *HandlerOutput) addProblems(errs ...error) {
+	if !sesmail.Settings.ProblemDetails {
+		return
+	}
+
+	for _, err := range errs {
+		if err != nil {
+			output.Problems = append(output.Problems, sesmail.NewProblem(err))
 		}
 	}
+}
+
+// Records the SES calls an invocation makes, which every operation reports in its output
+type callRecorder struct {
+	calls      *sesmail.APICallCounter
+	retryAfter *sesmail.RetryAfterHints
+	requestIDs *sesmail.RequestIDs
+}
+
+// Returns a context whose SES calls are recorded by the returned recorder
+func recordCalls(ctx context.Context) (context.Context, *callRecorder) {
+	recorder := &callRecorder{
+		calls:      &sesmail.APICallCounter{},
+		retryAfter: &sesmail.RetryAfterHints{},
+		requestIDs: &sesmail.RequestIDs{},
+	}
+
+	ctx = sesmail.WithAPICallCounter(ctx, recorder.calls)
+	ctx = sesmail.WithRetryAfterHints(ctx, recorder.retryAfter)
+	ctx = sesmail.WithRequestIDs(ctx, recorder.requestIDs)
 
-	if input.Content.Template != nil {
-		functionInput.Content.Template = &types.Template{
-			TemplateArn:  input.Content.Template.TemplateArn,
-			TemplateData: input.Content.Template.TemplateData,
-			TemplateName: input.Content.Template.TemplateName,
+	return ctx, recorder
+}
+
+// Fills in the parts of an output every operation shares: the errors as problem details, and the
+// SES calls made so far
+func (recorder *callRecorder) finishOutput(output *HandlerOutput, errs ...error) {
+	output.addProblems(errs...)
+	output.ApiCallCount = recorder.calls.Count()
+	output.RetryAfterSeconds = recorder.retryAfter.Seconds()
+	output.RequestIds = recorder.requestIDs.IDs()
+}
+
+// Whether SES accepted every entry of a bulk email
+func bulkEmailSucceeded(output *sesmail.SendBulkEmailOutput) bool {
+	if output == nil {
+		return false
+	}
+
+	for _, result := range output.BulkEmailEntryResults {
+		if result.Status != sesmail.BulkEmailStatus(types.BulkEmailStatusSuccess) {
+			return false
 		}
 	}
 
-	if input.ListManagementOptions != nil {
-		functionInput.ListManagementOptions = &types.ListManagementOptions{
-			ContactListName: input.ListManagementOptions.ContactListName,
-			TopicName:       input.ListManagementOptions.TopicName,
+	return true
+}
+
+// Returns the name of the operation an event requests
+func eventOperation(event HandlerInput) string {
+	if event.Email != nil {
+		return "email"
+	} else if len(event.Emails) > 0 {
+		return "emails"
+	} else if event.BulkEmail != nil {
+		return "bulkEmail"
+	} else if event.RefreshConfig {
+		return "refreshConfig"
+	} else if event.CreateEventDestination != nil {
+		return "createEventDestination"
+	} else if event.CreateConfigSet != nil {
+		return "createConfigSet"
+	} else if event.DeleteConfigSet != nil {
+		return "deleteConfigSet"
+	} else if event.PutConfigSetSuppressionOptions != nil {
+		return "putConfigSetSuppressionOptions"
+	} else if event.Template != nil {
+		return "template"
+	} else if event.GetAccount {
+		return "getAccount"
+	} else if event.Suppression != nil {
+		return "suppression"
+	} else if event.Contacts != nil {
+		return "contacts"
+	}
+
+	return ""
+}
+
+// Emits the metrics of an invocation as EMF documents, one for each configuration set sent through
+func flushMetrics(metrics *sesmail.Metrics, operation string) {
+	err := metrics.Flush(os.Stdout, sesmail.Settings.EmfNamespace, map[string]string{"Operation": operation})
+
+	if err != nil {
+		log.Printf("failed to emit metrics, %v", err)
+	}
+}
+
+// Queues an email on ASYNC_QUEUE_URL as an input of its own, so the function sends it once SQS
+// delivers it, and SQS delivers it again if no recipient was accepted
+func queueEmail(ctx context.Context, input *sesmail.SendEmailInput) error {
+	if asyncQueue == nil {
+		return errors.New("Async emails require ASYNC_QUEUE_URL")
+	}
+
+	body, err := json.Marshal(HandlerInput{Email: input})
+
+	if err != nil {
+		return err
+	}
+
+	_, err = asyncQueue.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:    aws.String(sesmail.Settings.AsyncQueueURL),
+		MessageBody: aws.String(string(body)),
+	})
+
+	if err != nil {
+		return fmt.Errorf("Failed to queue email: %w", err)
+	}
+
+	return nil
+}
+
+func LambdaHandler(ctx context.Context, payload json.RawMessage) (HandlerOutput, error) {
+	return handlePayload(ctx, payload, false)
+}
+
+// Handles an input, which was loaded from the payload store if offloaded is set
+func handlePayload(ctx context.Context, payload json.RawMessage, offloaded bool) (HandlerOutput, error) {
+	timings := &PhaseTimings{}
+	decodeStartTime := time.Now()
+
+	var event HandlerInput
+
+	payload, migrations, err := sesmail.MigrateDeprecatedKeys(payload)
+
+	if err != nil {
+		return HandlerOutput{ResultCode: sesmail.ResultValidationError}, err
+	} else if err := json.Unmarshal(payload, &event); err != nil {
+		return HandlerOutput{ResultCode: sesmail.ResultValidationError}, err
+	}
+
+	event.offloaded = offloaded
+
+	timings.DecodeMillis = time.Since(decodeStartTime).Milliseconds()
+	clientInitStartTime := time.Now()
+	var refreshErr error
+
+	if event.RefreshConfig {
+		refreshErr = loadConfig(ctx)
+	} else {
+		refreshExpiredConfig(ctx)
+	}
+
+	timings.ClientInitMillis = time.Since(clientInitStartTime).Milliseconds()
+
+	configLock.RLock()
+	defer configLock.RUnlock()
+
+	ctx, cancel := invocationContext(ctx)
+	defer cancel()
+
+	var output HandlerOutput
+
+	if event.RefreshConfig {
+		output = HandlerOutput{
+			Operation:  "refreshConfig",
+			ResultCode: sesmail.ErrorResultCode(refreshErr),
+			Success:    refreshErr == nil,
 		}
+		err = refreshErr
+	} else {
+		output, err = handleEvent(ctx, event, timings)
+	}
+
+	err = output.checkTimeout(ctx, err)
+	output.PhaseTimings = timings.finish(&output)
+	output.Warnings = append(migrations, output.Warnings...)
+
+	if warning := sesmail.EnforcementWarning(); warning != "" && !event.RefreshConfig {
+		output.Warnings = append(output.Warnings, warning)
+	}
+
+	if warning := sesmail.FaultInjectionWarning(); warning != "" {
+		output.Warnings = append(output.Warnings, warning)
+	}
+
+	if event.DebugConfig {
+		output.DebugConfig = sesmail.DebugConfig()
+		output.DebugConfig["region"] = defaultRegion
 	}
 
-	return ses.SendEmail(ctx, functionInput)
+	return output, err
 }
 
-func sendEmail(input *SendEmailInput) (*sesv2.SendEmailOutput, error) {
-	return sendEmailWithContext(context.TODO(), input)
+// A failed record of an SQS batch, which SQS delivers again
+type SQSBatchItemFailure struct {
+	ItemIdentifier string `json:"itemIdentifier"`
 }
 
-func sendEmails(inputs []*SendEmailInput) ([]*sesv2.SendEmailOutput, []error) {
-	var outputs []*sesv2.SendEmailOutput
-	var errors []error
-	currentContext := context.TODO()
+// The response to an SQS batch, reporting the records which failed so that only they are retried.
+// The event source mapping needs ReportBatchItemFailures enabled, otherwise SQS ignores it.
+type SQSBatchResponse struct {
+	BatchItemFailures []SQSBatchItemFailure `json:"batchItemFailures"`
+}
 
-	for _, input := range inputs {
-		output, err := sendEmailWithContext(currentContext, input)
+// Handles each record of an SQS batch as a separate invocation whose input is the record's body. A
+// record fails, so SQS delivers it again, only if none of its emails were accepted. Records which
+// were partly accepted are logged instead, like offloaded emails in S3Handler, since retrying them
+// would resend the emails and bulk entries SES already accepted.
+func SQSHandler(ctx context.Context, event events.SQSEvent) SQSBatchResponse {
+	response := SQSBatchResponse{BatchItemFailures: []SQSBatchItemFailure{}}
 
-		if err == nil {
-			outputs = append(outputs, output)
-		} else {
-			errors = append(errors, err)
+	for _, record := range event.Records {
+		output, err := LambdaHandler(ctx, json.RawMessage(record.Body))
+
+		if err == nil && output.ResultCode == sesmail.ResultPartial {
+			log.Printf("SQS message %s was partly accepted, so its failures aren't retried", record.MessageId)
+		} else if err != nil || !output.Success {
+			log.Printf("SQS message %s failed with result %s, %s", record.MessageId, output.ResultCode, sesmail.LogSafeError(err))
+
+			response.BatchItemFailures = append(
+				response.BatchItemFailures,
+				SQSBatchItemFailure{ItemIdentifier: record.MessageId},
+			)
+		} else if output.Email != nil {
+			log.Printf("SQS message %s was sent as %s", record.MessageId, aws.ToString(output.Email.MessageId))
 		}
 	}
 
-	return outputs, errors
+	return response
 }
 
-func sendBulkEmail(input *SendBulkEmailInput) (*sesv2.SendBulkEmailOutput, error) {
-	var bulkEmailEntries []types.BulkEmailEntry
+// Returns the SQS batch a payload holds, if it's one
+func sqsEvent(payload json.RawMessage) (events.SQSEvent, bool) {
+	var event events.SQSEvent
 
-	for _, entry := range input.BulkEmailEntries {
-		replacementEmailTags := createEmailTags(entry.ReplacementTags)
+	if err := json.Unmarshal(payload, &event); err != nil || len(event.Records) == 0 {
+		return event, false
+	}
 
-		if entry.Destination == nil {
-			return nil, errors.New("Destination is required")
+	for _, record := range event.Records {
+		if record.EventSource != "aws:sqs" {
+			return event, false
 		}
+	}
 
-		functionInput := &types.BulkEmailEntry{
-			Destination: &types.Destination{
-				BccAddresses: entry.Destination.BccAddresses,
-				CcAddresses:  entry.Destination.CcAddresses,
-				ToAddresses:  entry.Destination.ToAddresses,
-			},
+	return event, true
+}
+
+// Sends the emails arrays offloaded to OFFLOAD_BUCKET once S3 reports they were stored, logging
+// the result of each. Objects outside the bucket or the offload prefix, such as offloaded bulk
+// results, are ignored. Returns an error if a payload couldn't be loaded, so Lambda retries the
+// event, but not if its emails failed, since retrying would resend those which were accepted.
+func S3Handler(ctx context.Context, event events.S3Event) error {
+	store, bucket := offloadConfig()
 
-			ReplacementEmailContent: nil,
+	for _, record := range event.Records {
+		key := record.S3.Object.URLDecodedKey
 
-			ReplacementTags: replacementEmailTags,
+		if record.S3.Bucket.Name != bucket || !strings.HasPrefix(key, offloadPrefix) {
+			continue
 		}
 
-		if entry.ReplacementEmailContent != nil &&
-			entry.ReplacementEmailContent.ReplacementTemplate != nil &&
-			entry.ReplacementEmailContent.ReplacementTemplate.ReplacementTemplateData != nil {
+		payload, err := store.Load(ctx, key)
 
-			functionInput.ReplacementEmailContent = &types.ReplacementEmailContent{
-				ReplacementTemplate: &types.ReplacementTemplate{
-					ReplacementTemplateData: entry.ReplacementEmailContent.ReplacementTemplate.ReplacementTemplateData,
-				},
-			}
+		if err != nil {
+			return err
 		}
 
-		bulkEmailEntries = append(bulkEmailEntries, *functionInput)
+		output, err := handlePayload(ctx, payload, true)
+		log.Printf("offloaded emails %s finished with result %s, %s", key, output.ResultCode, sesmail.LogSafeError(err))
 	}
 
-	defaultEmailTags := createEmailTags(input.DefaultEmailTags)
+	return nil
+}
 
-	functionInput := &sesv2.SendBulkEmailInput{
-		BulkEmailEntries: bulkEmailEntries,
+// Returns the payload store and the bucket emails are offloaded to, as last loaded
+func offloadConfig() (sesmail.PayloadStore, string) {
+	configLock.RLock()
+	defer configLock.RUnlock()
 
-		DefaultContent: &types.BulkEmailContent{},
+	return sesmail.Offload, sesmail.Settings.OffloadBucket
+}
 
-		ConfigurationSetName:                      input.ConfigurationSetName,
-		DefaultEmailTags:                          defaultEmailTags,
-		FeedbackForwardingEmailAddress:            input.FeedbackForwardingEmailAddress,
-		FeedbackForwardingEmailAddressIdentityArn: input.FeedbackForwardingEmailAddressIdentityArn,
-		FromEmailAddress:                          input.FeedbackForwardingEmailAddress,
-		FromEmailAddressIdentityArn:               input.FromEmailAddressIdentityArn,
-		ReplyToAddresses:                          input.ReplyToAddresses,
+// Returns the S3 notification a payload holds, if it's one
+func s3Event(payload json.RawMessage) (events.S3Event, bool) {
+	var event events.S3Event
+
+	if err := json.Unmarshal(payload, &event); err != nil || len(event.Records) == 0 {
+		return event, false
 	}
-	if input.DefaultContent != nil && input.DefaultContent.Template != nil {
-		functionInput.DefaultContent.Template = &types.Template{
-			TemplateArn:  input.DefaultContent.Template.TemplateArn,
-			TemplateData: input.DefaultContent.Template.TemplateData,
-			TemplateName: input.DefaultContent.Template.TemplateName,
+
+	for _, record := range event.Records {
+		if record.EventSource != "aws:s3" {
+			return event, false
 		}
 	}
 
-	return ses.SendBulkEmail(context.TODO(), functionInput)
+	return event, true
 }
 
-type HandlerInput struct {
-	Email     *SendEmailInput     `json:"email"`
-	Emails    []*SendEmailInput   `json:"emails"`
-	BulkEmail *SendBulkEmailInput `json:"bulkEmail"`
+// Handles an invocation from SQS with SQSHandler, a notification from S3 with S3Handler, and any
+// other with LambdaHandler
+func invocationHandler(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+	if event, isSQS := sqsEvent(payload); isSQS {
+		return SQSHandler(ctx, event), nil
+	} else if event, isS3 := s3Event(payload); isS3 {
+		if store, _ := offloadConfig(); store != nil {
+			return nil, S3Handler(ctx, event)
+		}
+	}
+
+	return LambdaHandler(ctx, payload)
 }
 
-type HandlerOutput struct {
-	Email          *SendEmailOutput     `json:"email"`
-	EmailError     error                `json:"error"`
-	Emails         []*SendEmailOutput   `json:"emails"`
-	EmailsErrors   []error              `json:"errors"`
-	BulkEmail      *SendBulkEmailOutput `json:"bulkEmail"`
-	BulkEmailError error                `json:"bulkEmailError"`
+// Milliseconds spent in each phase of an invocation
+type PhaseTimings struct {
+
+	// Decoding the event.
+	DecodeMillis int64 `json:"decode"`
+
+	// Reloading settings and clients if they expired or the event asked to.
+	ClientInitMillis int64 `json:"clientInit"`
+
+	// Local processing before sending, such as validating emails and waiting on rate limits.
+	ValidateMillis int64 `json:"validate"`
+
+	// Waiting on SES.
+	SendMillis int64 `json:"send"`
+
+	// Building the output after sending, such as checking the quota. Excludes encoding the output,
+	// which happens after it's built.
+	RespondMillis int64 `json:"respond"`
+
+	sendStartTime time.Time
+	sentTime      time.Time
 }
 
-func convertSendEmailOutput(output *sesv2.SendEmailOutput) *SendEmailOutput {
-	if output == nil {
-		return &SendEmailOutput{}
+func (timings *PhaseTimings) startSending() {
+	timings.sendStartTime = time.Now()
+}
+
+func (timings *PhaseTimings) finishSending() {
+	timings.sentTime = time.Now()
+	timings.SendMillis = timings.sentTime.Sub(timings.sendStartTime).Milliseconds()
+}
+
+// Splits the time spent sending into local processing and waiting on SES, and records the time
+// spent responding
+func (timings *PhaseTimings) finish(output *HandlerOutput) *PhaseTimings {
+	if timings.sentTime.IsZero() {
+		return timings
 	}
 
-	return &SendEmailOutput{
-		MessageId:      output.MessageId,
-		ResultMetadata: output.ResultMetadata,
+	timings.RespondMillis = time.Since(timings.sentTime).Milliseconds()
+
+	if output.Email != nil {
+		timings.ValidateMillis += output.Email.ProcessingMillis
+	}
+
+	for _, email := range output.Emails {
+		timings.ValidateMillis += email.ProcessingMillis
+	}
+
+	if output.BulkEmail != nil {
+		timings.ValidateMillis += output.BulkEmail.ProcessingMillis
 	}
+
+	if timings.ValidateMillis > timings.SendMillis {
+		timings.ValidateMillis = timings.SendMillis
+	}
+
+	timings.SendMillis -= timings.ValidateMillis
+
+	return timings
 }
 
-func LambdaHandler(event HandlerInput) (HandlerOutput, error) {
-	if event.Email != nil {
-		output, err := sendEmail(event.Email)
-		convertedOutput := convertSendEmailOutput(output)
+// Returns a context which ends DeadlineMargin before the invocation's deadline, so the invocation
+// stops waiting on SES in time to report the timeout
+func invocationContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if deadline, ok := ctx.Deadline(); ok {
+		return context.WithDeadline(ctx, deadline.Add(-sesmail.Settings.DeadlineMargin))
+	}
+
+	return context.WithCancel(ctx)
+}
+
+// Reports an invocation which reached its deadline before every email was sent as timed out,
+// returning its error wrapped in ErrInvocationTimeout
+func (output *HandlerOutput) checkTimeout(ctx context.Context, err error) error {
+	if output.Success || !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return err
+	}
+
+	output.ResultCode = sesmail.ResultTimeout
+
+	if err == nil {
+		output.Warnings = append(output.Warnings, sesmail.ErrInvocationTimeout.Error())
+
+		return nil
+	}
+
+	return fmt.Errorf("%w: %v", sesmail.ErrInvocationTimeout, err)
+}
+
+// Handles a decoded event other than refreshConfig, recording the time spent in each phase. The
+// caller holds configLock for reading.
+func handleEvent(ctx context.Context, event HandlerInput, timings *PhaseTimings) (HandlerOutput, error) {
+	ctx, recorder := recordCalls(ctx)
+
+	if sesmail.Settings.EmfMetrics {
+		metrics := &sesmail.Metrics{}
+		ctx = sesmail.WithMetrics(ctx, metrics)
+
+		defer flushMetrics(metrics, eventOperation(event))
+	}
+
+	timings.startSending()
+
+	if event.Async && event.Email == nil {
+		err := &sesmail.ValidationError{Err: errors.New("Only a single email can be sent async")}
+		timings.finishSending()
+		handlerOutput := HandlerOutput{
+			Operation:  eventOperation(event),
+			ResultCode: sesmail.ErrorResultCode(err),
+		}
+
+		recorder.finishOutput(&handlerOutput, err)
+
+		return handlerOutput, err
+	} else if event.Email != nil && event.Preview {
+		preview, err := sesmail.PreviewEmail(ctx, ses, event.Email)
+		timings.finishSending()
+		handlerOutput := HandlerOutput{
+			Operation:  "email",
+			Preview:    preview,
+			EmailError: sesmail.NewAPIError(err),
+			ResultCode: sesmail.ErrorResultCode(err),
+			Success:    err == nil,
+		}
+
+		recorder.finishOutput(&handlerOutput, err)
+
+		return handlerOutput, err
+	} else if event.Email != nil && event.Async {
+		err := sesmail.ValidateSendEmailInput(event.Email)
+
+		if err == nil && sesmail.Settings.SendingDisabled {
+			err = sesmail.ErrSendingDisabled
+		} else if err == nil {
+			err = queueEmail(ctx, event.Email)
+		}
+
+		timings.finishSending()
+		handlerOutput := HandlerOutput{
+			Operation:  "email",
+			EmailError: sesmail.NewAPIError(err),
+			ResultCode: sesmail.ErrorResultCode(err),
+			Success:    err == nil,
+		}
+
+		if err == nil {
+			handlerOutput.Email = &sesmail.SendEmailOutput{Status: sesmail.SendStatusQueued}
+		}
 
-		return HandlerOutput{
-			Email:      convertedOutput,
-			EmailError: err,
-		}, err
+		recorder.finishOutput(&handlerOutput, err)
+
+		return handlerOutput, err
+	} else if event.Email != nil {
+		output, err := sesmail.SendEmail(ctx, ses, event.Email)
+		timings.finishSending()
+
+		if output == nil {
+			output = &sesmail.SendEmailOutput{Status: sesmail.SendStatusFailed}
+		}
+
+		handlerOutput := HandlerOutput{
+			Operation:  "email",
+			Email:      output,
+			EmailError: sesmail.NewAPIError(err),
+			Usage:      sesmail.EmailsUsage(output),
+			ResultCode: sesmail.ErrorResultCode(err),
+			Success:    err == nil && output.Status != sesmail.SendStatusFailed,
+		}
+
+		if sesmail.IsRetryable(err) {
+			handlerOutput.RetryPayload = &HandlerInput{Email: event.Email}
+		}
+
+		handlerOutput.checkTemplateText(ctx, emailTemplate(event.Email))
+		handlerOutput.addMismatchWarnings(output)
+		recorder.finishOutput(&handlerOutput, err)
+
+		return handlerOutput, err
+	} else if shouldOffload(event) {
+		location, err := offloadEmails(ctx, event.Emails)
+		timings.finishSending()
+		handlerOutput := HandlerOutput{
+			Operation:       "emails",
+			OffloadLocation: location,
+			ResultCode:      sesmail.ErrorResultCode(err),
+			Success:         err == nil,
+		}
+
+		recorder.finishOutput(&handlerOutput, err)
+
+		return handlerOutput, err
 	} else if len(event.Emails) > 0 {
-		output, errs := sendEmails(event.Emails)
-		var convertedOutput []*SendEmailOutput
+		output, errs := sesmail.SendEmails(ctx, ses, event.Emails)
+		timings.finishSending()
+		handlerOutput := HandlerOutput{
+			Operation:  "emails",
+			Emails:     output,
+			Usage:      sesmail.EmailsUsage(output...),
+			ResultCode: sesmail.NewResultCode(len(output), errs...),
+			Success:    len(errs) == 0 && len(output) == len(event.Emails),
+		}
 
-		for _, arrayItem := range output {
-			convertedOutput = append(convertedOutput, convertSendEmailOutput(arrayItem))
+		if len(errs) > 0 {
+			handlerOutput.EmailsErrors = sesmail.NewAPIErrors(errs)
+			handlerOutput.ErrorSummary = sesmail.SummarizeErrors(errs)
+
+			if retryable := sesmail.RetryableEmails(event.Emails, errs); len(retryable) > 0 {
+				handlerOutput.RetryPayload = &HandlerInput{Emails: retryable}
+			}
 		}
 
-		if len(errs) == 0 {
-			return HandlerOutput{
-				Emails: convertedOutput,
-			}, nil
-		} else {
-			return HandlerOutput{
-				Emails:       convertedOutput,
-				EmailsErrors: errs,
-			}, nil
+		var templates []*sesmail.Template
+
+		for _, input := range event.Emails {
+			templates = append(templates, emailTemplate(input))
 		}
+
+		handlerOutput.checkTemplateText(ctx, templates...)
+		handlerOutput.addMismatchWarnings(output...)
+
+		handlerOutput.checkQuota(ctx)
+		recorder.finishOutput(&handlerOutput, errs...)
+
+		return handlerOutput, nil
 	} else if event.BulkEmail != nil {
-		output, err := sendBulkEmail(event.BulkEmail)
-		var bulkEmailEntryResults []BulkEmailEntryResult
+		output, err := sesmail.SendBulkEmail(ctx, ses, event.BulkEmail)
+		timings.finishSending()
+		handlerOutput := HandlerOutput{
+			Operation:      "bulkEmail",
+			BulkEmail:      output,
+			BulkEmailError: sesmail.NewAPIError(err),
+			Usage:          sesmail.BulkEmailUsage(event.BulkEmail, output),
+			ResultCode:     sesmail.BulkResultCode(output, err),
+			Success:        err == nil && bulkEmailSucceeded(output),
+		}
+
+		if retryable := sesmail.RetryableBulkEmail(event.BulkEmail, output, err); retryable != nil {
+			handlerOutput.RetryPayload = &HandlerInput{BulkEmail: retryable}
+		}
+
+		if output == nil {
+			// Keep the output's shape when the send failed outright, so callers can always read
+			// the results.
+			handlerOutput.BulkEmail = &sesmail.SendBulkEmailOutput{
+				BulkEmailEntryResults: []sesmail.BulkEmailEntryResult{},
+			}
+		} else {
+			for _, duplicate := range output.DuplicateRecipients {
+				handlerOutput.Warnings = append(handlerOutput.Warnings, fmt.Sprintf(
+					"Entry %d is sent to %s, like entry %d", duplicate.Index, duplicate.EmailAddress, duplicate.FirstIndex,
+				))
+			}
 
-		for _, arrayItem := range output.BulkEmailEntryResults {
-			bulkEmailEntryResults = append(bulkEmailEntryResults, BulkEmailEntryResult{
-				Error:     arrayItem.Error,
-				MessageId: arrayItem.MessageId,
-				Status:    BulkEmailStatus(arrayItem.Status),
-			})
+			for _, index := range output.EntriesMissingData {
+				handlerOutput.Warnings = append(handlerOutput.Warnings, fmt.Sprintf(
+					"Entry %d has no replacement template data, but the template uses variables", index,
+				))
+			}
 		}
 
-		convertedOutput := &SendBulkEmailOutput{
-			BulkEmailEntryResults: bulkEmailEntryResults,
-			ResultMetadata:        output.ResultMetadata,
+		handlerOutput.checkTemplateText(ctx, bulkEmailTemplate(event.BulkEmail))
+		handlerOutput.checkQuota(ctx)
+
+		if err := sesmail.OffloadBulkResults(ctx, output); err != nil {
+			log.Printf("failed to offload bulk email results, %v", err)
+			handlerOutput.Warnings = append(handlerOutput.Warnings, "Results were returned inline, since offloading them failed")
 		}
 
-		return HandlerOutput{
-			BulkEmail:      convertedOutput,
-			BulkEmailError: err,
-		}, err
+		recorder.finishOutput(&handlerOutput, err)
+
+		return handlerOutput, err
+	} else if event.CreateEventDestination != nil {
+		err := sesmail.CreateEventDestination(ctx, ses, event.CreateEventDestination)
+		timings.finishSending()
+		handlerOutput := HandlerOutput{
+			Operation:  "createEventDestination",
+			ResultCode: sesmail.ErrorResultCode(err),
+			Success:    err == nil,
+		}
+
+		recorder.finishOutput(&handlerOutput, err)
+
+		return handlerOutput, err
+	} else if event.CreateConfigSet != nil {
+		err := sesmail.CreateConfigurationSet(ctx, ses, event.CreateConfigSet)
+		timings.finishSending()
+		handlerOutput := HandlerOutput{
+			Operation:  "createConfigSet",
+			ResultCode: sesmail.ErrorResultCode(err),
+			Success:    err == nil,
+		}
+
+		recorder.finishOutput(&handlerOutput, err)
+
+		return handlerOutput, err
+	} else if event.DeleteConfigSet != nil {
+		err := sesmail.DeleteConfigurationSet(ctx, ses, event.DeleteConfigSet)
+		timings.finishSending()
+		handlerOutput := HandlerOutput{
+			Operation:  "deleteConfigSet",
+			ResultCode: sesmail.ErrorResultCode(err),
+			Success:    err == nil,
+		}
+
+		recorder.finishOutput(&handlerOutput, err)
+
+		return handlerOutput, err
+	} else if event.PutConfigSetSuppressionOptions != nil {
+		err := sesmail.PutConfigurationSetSuppressionOptions(ctx, ses, event.PutConfigSetSuppressionOptions)
+		timings.finishSending()
+		handlerOutput := HandlerOutput{
+			Operation:  "putConfigSetSuppressionOptions",
+			ResultCode: sesmail.ErrorResultCode(err),
+			Success:    err == nil,
+		}
+
+		recorder.finishOutput(&handlerOutput, err)
+
+		return handlerOutput, err
+	} else if event.Template != nil {
+		err := sesmail.ManageTemplate(ctx, ses, event.TemplateAction, event.Template)
+		timings.finishSending()
+		handlerOutput := HandlerOutput{
+			Operation:  "template",
+			ResultCode: sesmail.ErrorResultCode(err),
+			Success:    err == nil,
+		}
+
+		recorder.finishOutput(&handlerOutput, err)
+
+		return handlerOutput, err
+	} else if event.GetAccount {
+		account, err := sesmail.GetAccountQuota(ctx, ses)
+		timings.finishSending()
+		handlerOutput := HandlerOutput{
+			Operation:  "getAccount",
+			Account:    account,
+			ResultCode: sesmail.ErrorResultCode(err),
+			Success:    err == nil,
+		}
+
+		recorder.finishOutput(&handlerOutput, err)
+
+		return handlerOutput, err
+	} else if event.Suppression != nil {
+		output, err := sesmail.ManageSuppression(ctx, ses, event.SuppressionAction, event.Suppression)
+		timings.finishSending()
+		handlerOutput := HandlerOutput{
+			Operation:   "suppression",
+			Suppression: output,
+			ResultCode:  sesmail.ErrorResultCode(err),
+			Success:     err == nil,
+		}
+
+		recorder.finishOutput(&handlerOutput, err)
+
+		return handlerOutput, err
+	} else if event.Contacts != nil {
+		output, err := sesmail.ManageContacts(ctx, ses, event.ContactAction, event.Contacts)
+		timings.finishSending()
+		handlerOutput := HandlerOutput{
+			Operation:  "contacts",
+			Contacts:   output,
+			ResultCode: sesmail.ErrorResultCode(err),
+			Success:    err == nil,
+		}
+
+		recorder.finishOutput(&handlerOutput, err)
+
+		return handlerOutput, err
 	}
 
 	return HandlerOutput{}, nil
 }
 
-func main() {
-	cfg, err := config.LoadDefaultConfig(context.TODO())
+// Loads the settings from the environment and creates the SES clients they call for, once no
+// invocation is using the current ones
+func loadConfig(ctx context.Context) error {
+	configLock.Lock()
+	defer configLock.Unlock()
+
+	settings := sesmail.ConfigFromEnv()
+	cfg, err := config.LoadDefaultConfig(ctx)
 
 	if err != nil {
-		log.Fatalf("failed to load configuration, %v", err)
+		return err
 	}
 
-	ses = sesv2.New(sesv2.Options{
+	sesmail.Settings = settings
+	configLoadedAt = time.Now()
+	defaultRegion = cfg.Region
+
+	ses = &sesmail.CountingClient{Client: newClient(sesv2.Options{
 		Region:      cfg.Region,
 		Credentials: cfg.Credentials,
-	})
+	})}
+
+	if sesmail.Settings.FallbackRegion != "" {
+		ses = &sesmail.FailoverClient{
+			Primary:       ses,
+			PrimaryRegion: cfg.Region,
+
+			Fallback: &sesmail.CountingClient{Client: newClient(sesv2.Options{
+				Region:      sesmail.Settings.FallbackRegion,
+				Credentials: cfg.Credentials,
+			})},
+			FallbackRegion: sesmail.Settings.FallbackRegion,
+		}
+	}
+
+	if sesmail.Settings.FaultInjection {
+		log.Printf(
+			"WARNING: FAULT_INJECTION is set, so no emails will be sent and %.0f%% of sends will fail. "+
+				"Never set it in production.",
+			sesmail.Settings.FaultInjectionRate*100,
+		)
+
+		ses = faultInjected(ses)
+	}
+
+	sesmail.RegionalClients = regionalClients(cfg.Credentials)
+
+	if err := sesmail.LoadEnforcementStatus(ctx, ses); err != nil {
+		log.Printf("failed to check the account's enforcement status, %v", err)
+	}
+
+	if sesmail.Settings.OffloadBucket != "" {
+		sesmail.Offload = &sesmail.S3PayloadStore{
+			Bucket: sesmail.Settings.OffloadBucket,
+			Client: s3.New(s3.Options{
+				Region:      cfg.Region,
+				Credentials: cfg.Credentials,
+			}),
+		}
+	} else {
+		sesmail.Offload = nil
+	}
+
+	if sesmail.Settings.AsyncQueueURL != "" {
+		asyncQueue = sqs.New(sqs.Options{
+			Region:      cfg.Region,
+			Credentials: cfg.Credentials,
+		})
+	} else {
+		asyncQueue = nil
+	}
+
+	if sesmail.Settings.AuditLog && sesmail.Settings.AuditLogS3 && sesmail.Offload != nil {
+		sesmail.Audit = &sesmail.PayloadStoreAuditSink{Store: sesmail.Offload}
+	} else if sesmail.Settings.AuditLog {
+		if sesmail.Settings.AuditLogS3 {
+			log.Print("AUDIT_LOG_S3 is set without OFFLOAD_BUCKET, writing audit receipts to stdout")
+		}
+
+		sesmail.Audit = &sesmail.JSONAuditSink{Writer: os.Stdout}
+	} else {
+		sesmail.Audit = sesmail.NoopAuditSink{}
+	}
+
+	return nil
+}
+
+// Returns a provider of clients for sends which set a region, creating each region's client once
+// and sharing the given credentials
+func regionalClients(credentials aws.CredentialsProvider) sesmail.RegionalClientProvider {
+	var lock sync.Mutex
+	clients := map[string]sesmail.Client{}
+
+	return func(region string) (sesmail.Client, error) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		if client, ok := clients[region]; ok {
+			return client, nil
+		}
+
+		var client sesmail.Client = &sesmail.CountingClient{Client: newClient(sesv2.Options{
+			Region:      region,
+			Credentials: credentials,
+		})}
+
+		if sesmail.Settings.FaultInjection {
+			client = faultInjected(client)
+		}
+
+		clients[region] = client
+
+		return client, nil
+	}
+}
+
+// Wraps a client so its sends fail as FAULT_INJECTION_RATE and FAULT_INJECTION_STATUSES say,
+// instead of calling SES
+func faultInjected(client sesmail.Client) sesmail.Client {
+	return &sesmail.FaultInjectionClient{
+		Client:   client,
+		Rate:     sesmail.Settings.FaultInjectionRate,
+		Statuses: sesmail.Settings.FaultInjectionStatuses,
+	}
+}
+
+// Reloads the settings and clients once CONFIG_TTL has passed since they were last loaded. A failed
+// reload keeps the current ones.
+func refreshExpiredConfig(ctx context.Context) {
+	configLock.RLock()
+	ttl, loadedAt := sesmail.Settings.ConfigTTL, configLoadedAt
+	configLock.RUnlock()
+
+	if ttl <= 0 || time.Since(loadedAt) < ttl {
+		return
+	}
 
-	lambda.Start(LambdaHandler)
+	if err := loadConfig(ctx); err != nil {
+		log.Printf("failed to refresh configuration, %v", err)
+	}
+}
+
+// A Lambda handler which indents the JSON output of another handler
+type prettyHandler struct {
+	lambda.Handler
+}
+
+func (handler prettyHandler) Invoke(ctx context.Context, payload []byte) ([]byte, error) {
+	response, err := handler.Handler.Invoke(ctx, payload)
+
+	if err != nil {
+		return response, err
+	}
+
+	var indented bytes.Buffer
+
+	if err := json.Indent(&indented, response, "", "    "); err != nil {
+		return nil, err
+	}
+
+	return indented.Bytes(), nil
+}
+
+func main() {
+	if err := loadConfig(context.TODO()); err != nil {
+		log.Fatalf("failed to load configuration, %v", err)
+	}
+
+	if sesmail.Settings.PrettyOutput {
+		lambda.StartHandler(prettyHandler{lambda.NewHandler(invocationHandler)})
+	} else {
+		lambda.Start(invocationHandler)
+	}
 }
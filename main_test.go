@@ -0,0 +1,1612 @@
+// Tests for the Lambda handler
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sesv2 "github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/talentmaker/lambda-ses/sesmail"
+)
+
+func TestLambdaHandlerOperation(t *testing.T) {
+	useFakeSES(acceptAll)
+
+	for _, test := range []struct {
+		operation string
+		event     HandlerInput
+	}{
+		{"email", HandlerInput{Email: simpleEmail("a@example.com")}},
+		{"emails", HandlerInput{Emails: []*sesmail.SendEmailInput{simpleEmail("a@example.com")}}},
+		{"bulkEmail", HandlerInput{BulkEmail: bulkEmail("a@example.com")}},
+	} {
+		t.Run(test.operation, func(t *testing.T) {
+			output, err := invoke(t, test.event)
+
+			if err != nil {
+				t.Fatal(err)
+			} else if output.Operation != test.operation {
+				t.Errorf("expected operation %q, got %q", test.operation, output.Operation)
+			}
+		})
+	}
+}
+
+func TestLambdaHandlerSendStatus(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		status   int
+		response string
+		expected sesmail.SendStatus
+	}{
+		{"accepted", 200, `{"MessageId":"message-id"}`, sesmail.SendStatusAccepted},
+		{"accepted without a message ID", 200, `{}`, sesmail.SendStatusAcceptedPendingId},
+		{"rejected", 400, `{"message":"Email address is not verified."}`, sesmail.SendStatusFailed},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			useFakeSES(func(fakeRequest) (int, string) { return test.status, test.response })
+			output, _ := invoke(t, HandlerInput{Email: simpleEmail("a@example.com")})
+
+			if output.Email.Status != test.expected {
+				t.Errorf("expected status %s, got %s", test.expected, output.Email.Status)
+			} else if test.expected == sesmail.SendStatusAcceptedPendingId && output.Email.MessageId != nil {
+				t.Errorf("expected no message ID, got %q", *output.Email.MessageId)
+			}
+		})
+	}
+}
+
+func TestLambdaHandlerQuotaWarning(t *testing.T) {
+	previous := sesmail.Settings
+	sesmail.Settings = sesmail.Config{QuotaWarningPercent: 80}
+	t.Cleanup(func() { sesmail.Settings = previous })
+
+	useFakeSES(func(request fakeRequest) (int, string) {
+		if request.Path == "/v2/email/account" {
+			return 200, `{"SendQuota":{"Max24HourSend":1000,"SentLast24Hours":900}}`
+		}
+
+		return acceptAll(request)
+	})
+
+	output, err := invoke(t, HandlerInput{BulkEmail: bulkEmail("a@example.com")})
+
+	if err != nil {
+		t.Fatal(err)
+	} else if len(output.Warnings) != 1 {
+		t.Errorf("expected a quota warning, got %v", output.Warnings)
+	}
+}
+
+// Rejects every email sent to b@example.com, answering bulk sends with a failed result for it
+func rejectB(request fakeRequest) (int, string) {
+	if strings.HasSuffix(request.Path, "/outbound-bulk-emails") {
+		return 200, `{"BulkEmailEntryResults":[{"Status":"SUCCESS","MessageId":"bulk-id"},{"Status":"FAILED","Error":"rejected"}]}`
+	} else if strings.Contains(request.Body, "b@example.com") {
+		return 400, `{"message":"Email address is not verified."}`
+	}
+
+	return acceptAll(request)
+}
+
+func rejectAll(fakeRequest) (int, string) {
+	return 400, `{"message":"Email address is not verified."}`
+}
+
+func TestLambdaHandlerSuccess(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		respond  func(fakeRequest) (int, string)
+		expected bool
+	}{
+		{"full success", acceptAll, true},
+		{"partial success", rejectB, false},
+		{"total failure", rejectAll, false},
+	} {
+		for _, event := range []HandlerInput{
+			{Email: simpleEmail("b@example.com")},
+			{Emails: []*sesmail.SendEmailInput{simpleEmail("a@example.com"), simpleEmail("b@example.com")}},
+			{BulkEmail: bulkEmail("a@example.com", "b@example.com")},
+		} {
+			useFakeSES(test.respond)
+			output, _ := invoke(t, event)
+
+			// The single email goes to b@example.com, so it fails whenever some emails fail
+			if output.Success != test.expected {
+				t.Errorf("%s: expected %s success to be %t, got %t", test.name, output.Operation, test.expected, output.Success)
+			}
+		}
+	}
+}
+
+func TestLambdaHandlerProblems(t *testing.T) {
+	previous := sesmail.Settings
+	sesmail.Settings = sesmail.Config{ProblemDetails: true}
+	t.Cleanup(func() { sesmail.Settings = previous })
+
+	useFakeSES(func(fakeRequest) (int, string) {
+		return 400, `{"__type":"MessageRejected","message":"Email address is not verified."}`
+	})
+
+	output, _ := invoke(t, HandlerInput{Emails: []*sesmail.SendEmailInput{
+		simpleEmail("a@example.com"),
+		{Content: &sesmail.EmailContent{}},
+	}})
+
+	titles := map[string]int{}
+
+	for _, problem := range output.Problems {
+		titles[problem.Title] = problem.Status
+	}
+
+	if expected := map[string]int{"MessageRejected": 400, "Invalid input": 400}; !reflect.DeepEqual(titles, expected) {
+		t.Errorf("expected problems %v, got %v", expected, titles)
+	}
+}
+
+// Returns what the function writes to stdout
+func captureStdout(t *testing.T, function func()) string {
+	reader, writer, err := os.Pipe()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := os.Stdout
+	os.Stdout = writer
+
+	function()
+
+	os.Stdout = stdout
+	writer.Close()
+
+	output, err := io.ReadAll(reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(output)
+}
+
+func TestLambdaHandlerFlushesMetricsOnError(t *testing.T) {
+	previous := sesmail.Settings
+	sesmail.Settings = sesmail.Config{EmfMetrics: true, EmfNamespace: "lambda-ses"}
+	t.Cleanup(func() { sesmail.Settings = previous })
+
+	useFakeSES(rejectAll)
+
+	var err error
+	stdout := captureStdout(t, func() {
+		_, err = invoke(t, HandlerInput{Email: simpleEmail("a@example.com")})
+	})
+
+	var document struct {
+		Sent      int
+		Failed    int
+		Operation string
+	}
+
+	if err == nil {
+		t.Fatal("expected the send to fail")
+	} else if strings.Count(stdout, "\n") != 1 {
+		t.Fatalf("expected a single EMF document, got %q", stdout)
+	} else if err := json.Unmarshal([]byte(stdout), &document); err != nil {
+		t.Fatal(err)
+	} else if document.Sent != 0 || document.Failed != 1 || document.Operation != "email" {
+		t.Errorf("expected 1 failed email, got %+v", document)
+	}
+}
+
+// Sets the environment loadConfig reads, restoring what it loads afterwards
+func useConfigEnv(t *testing.T, env map[string]string) {
+	settings, client, audit, loadedAt := sesmail.Settings, ses, sesmail.Audit, configLoadedAt
+	regional, region, offload := sesmail.RegionalClients, defaultRegion, sesmail.Offload
+	t.Cleanup(func() {
+		sesmail.Settings, ses, sesmail.Audit, configLoadedAt = settings, client, audit, loadedAt
+		sesmail.RegionalClients, defaultRegion, sesmail.Offload = regional, region, offload
+	})
+
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+
+	for key, value := range env {
+		t.Setenv(key, value)
+	}
+}
+
+func TestLambdaHandlerRefreshConfig(t *testing.T) {
+	useConfigEnv(t, map[string]string{"SENDING_DISABLED": "true"})
+	sesmail.Settings = sesmail.Config{}
+
+	output, err := invoke(t, HandlerInput{RefreshConfig: true})
+
+	if err != nil {
+		t.Fatal(err)
+	} else if output.Operation != "refreshConfig" || !output.Success {
+		t.Errorf("expected a successful refreshConfig, got %+v", output)
+	} else if !sesmail.Settings.SendingDisabled {
+		t.Errorf("expected the settings to be reloaded")
+	}
+}
+
+func TestLambdaHandlerRefreshesConfigDuringInvocations(t *testing.T) {
+	useConfigEnv(t, map[string]string{"SENDING_DISABLED": "true"})
+
+	if err := loadConfig(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var wait sync.WaitGroup
+	errs := make(chan error, 20)
+
+	for index := 0; index < 10; index++ {
+		wait.Add(2)
+
+		go func() {
+			defer wait.Done()
+
+			_, err := invoke(t, HandlerInput{RefreshConfig: true})
+			errs <- err
+		}()
+
+		go func() {
+			defer wait.Done()
+
+			_, err := invoke(t, HandlerInput{Email: simpleEmail("a@example.com")})
+
+			if !errors.Is(err, sesmail.ErrSendingDisabled) {
+				errs <- fmt.Errorf("expected %v, got %v", sesmail.ErrSendingDisabled, err)
+			}
+		}()
+	}
+
+	wait.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestLoadConfigAuditSink(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		env      map[string]string
+		expected sesmail.AuditSink
+	}{
+		{"disabled", map[string]string{}, sesmail.NoopAuditSink{}},
+		{"stdout", map[string]string{"AUDIT_LOG": "true"}, &sesmail.JSONAuditSink{}},
+		{"s3", map[string]string{"AUDIT_LOG": "true", "AUDIT_LOG_S3": "true", "OFFLOAD_BUCKET": "bucket"}, &sesmail.PayloadStoreAuditSink{}},
+		{"s3 without a bucket", map[string]string{"AUDIT_LOG": "true", "AUDIT_LOG_S3": "true"}, &sesmail.JSONAuditSink{}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			useConfigEnv(t, test.env)
+
+			if err := loadConfig(context.Background()); err != nil {
+				t.Fatal(err)
+			} else if reflect.TypeOf(sesmail.Audit) != reflect.TypeOf(test.expected) {
+				t.Errorf("expected a %T, got %T", test.expected, sesmail.Audit)
+			}
+		})
+	}
+}
+
+func TestLambdaHandlerRefreshesConfigAfterTTL(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		loadedAt time.Time
+		expected bool
+	}{
+		{"expired", time.Now().Add(-2 * time.Minute), true},
+		{"fresh", time.Now(), false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			useConfigEnv(t, map[string]string{"SENDING_DISABLED": "true", "CONFIG_TTL": "1m"})
+			useFakeSES(acceptAll)
+			sesmail.Settings = sesmail.Config{ConfigTTL: time.Minute}
+			configLoadedAt = test.loadedAt
+
+			_, err := invoke(t, HandlerInput{Email: simpleEmail("a@example.com")})
+
+			if refreshed := errors.Is(err, sesmail.ErrSendingDisabled); refreshed != test.expected {
+				t.Errorf("expected refreshed to be %t, got %t with %v", test.expected, refreshed, err)
+			}
+		})
+	}
+}
+
+func TestPrettyHandler(t *testing.T) {
+	useFakeSES(acceptAll)
+
+	payload, err := json.Marshal(HandlerInput{Email: simpleEmail("a@example.com")})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compact, err := lambda.NewHandler(LambdaHandler).Invoke(context.Background(), payload)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	indented, err := prettyHandler{lambda.NewHandler(LambdaHandler)}.Invoke(context.Background(), payload)
+
+	if err != nil {
+		t.Fatal(err)
+	} else if bytes.Contains(compact, []byte("\n")) {
+		t.Errorf("expected compact output by default, got %s", compact)
+	} else if !bytes.Contains(indented, []byte("\n    \"operation\": \"email\"")) {
+		t.Errorf("expected indented output, got %s", indented)
+	}
+
+	var compactOutput, indentedOutput interface{}
+
+	if err := json.Unmarshal(compact, &compactOutput); err != nil {
+		t.Fatal(err)
+	} else if err := json.Unmarshal(indented, &indentedOutput); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the timings can differ between sends
+	for _, output := range []interface{}{compactOutput, indentedOutput} {
+		delete(output.(map[string]interface{}), "phaseTimings")
+		delete(output.(map[string]interface{})["email"].(map[string]interface{}), "processingMillis")
+		delete(output.(map[string]interface{})["email"].(map[string]interface{}), "serviceMillis")
+	}
+
+	if !reflect.DeepEqual(compactOutput, indentedOutput) {
+		t.Errorf("expected the same structure, got %v and %v", compactOutput, indentedOutput)
+	}
+}
+
+// Returns what the function logs
+func captureLog(t *testing.T, run func()) string {
+	var buffer bytes.Buffer
+
+	log.SetOutput(&buffer)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	run()
+
+	return buffer.String()
+}
+
+// Records the messages sent to it, failing every send with err if it's set
+type fakeQueue struct {
+	messages []*sqs.SendMessageInput
+	err      error
+}
+
+func (queue *fakeQueue) SendMessage(
+	_ context.Context,
+	params *sqs.SendMessageInput,
+	_ ...func(*sqs.Options),
+) (*sqs.SendMessageOutput, error) {
+	if queue.err != nil {
+		return nil, queue.err
+	}
+
+	queue.messages = append(queue.messages, params)
+
+	return &sqs.SendMessageOutput{MessageId: aws.String("queued-id")}, nil
+}
+
+// Makes async emails queue on a fake queue for the rest of the test
+func useFakeQueue(t *testing.T, queue *fakeQueue) {
+	previousSettings, previousQueue := sesmail.Settings, asyncQueue
+	t.Cleanup(func() { sesmail.Settings, asyncQueue = previousSettings, previousQueue })
+
+	sesmail.Settings = sesmail.Config{AsyncQueueURL: "https://sqs.us-east-1.amazonaws.com/123456789012/emails"}
+	asyncQueue = queue
+}
+
+func TestLambdaHandlerAsyncEmail(t *testing.T) {
+	queue := &fakeQueue{}
+	useFakeQueue(t, queue)
+	fake := useFakeSES(acceptAll)
+
+	output, err := invoke(t, HandlerInput{Email: simpleEmail("a@example.com"), Async: true})
+
+	if err != nil {
+		t.Fatal(err)
+	} else if output.Email.Status != sesmail.SendStatusQueued || !output.Success {
+		t.Errorf("expected a queued acknowledgment, got %+v", output.Email)
+	} else if len(fake.Requests()) != 0 {
+		t.Errorf("expected nothing to be sent before the email is delivered, got %+v", fake.Requests())
+	} else if len(queue.messages) != 1 || aws.ToString(queue.messages[0].QueueUrl) != sesmail.Settings.AsyncQueueURL {
+		t.Fatalf("expected the email to be queued on ASYNC_QUEUE_URL, got %+v", queue.messages)
+	}
+
+	// The queued message is an input which sends the email once SQS delivers it
+	event := events.SQSEvent{Records: []events.SQSMessage{
+		{MessageId: "queued-id", Body: aws.ToString(queue.messages[0].MessageBody), EventSource: "aws:sqs"},
+	}}
+
+	if response := SQSHandler(context.Background(), event); len(response.BatchItemFailures) != 0 {
+		t.Errorf("expected the queued email to be sent, got %+v", response.BatchItemFailures)
+	} else if requests := fake.Requests(); len(requests) != 1 || !strings.Contains(requests[0].Body, "a@example.com") {
+		t.Errorf("expected the email to be sent once delivered, got %+v", requests)
+	}
+}
+
+func TestLambdaHandlerAsyncEmailQueueFailures(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		queue    QueueClient
+		expected string
+	}{
+		{"no queue", nil, "Async emails require ASYNC_QUEUE_URL"},
+		{"send failed", &fakeQueue{err: errors.New("access denied")}, "Failed to queue email: access denied"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			useFakeQueue(t, nil)
+			asyncQueue = test.queue
+			fake := useFakeSES(acceptAll)
+
+			output, err := invoke(t, HandlerInput{Email: simpleEmail("a@example.com"), Async: true})
+
+			if err == nil || err.Error() != test.expected {
+				t.Errorf("expected %q, got %v", test.expected, err)
+			} else if output.Success || output.Email != nil {
+				t.Errorf("expected no acknowledgment, got %+v", output)
+			} else if len(fake.Requests()) != 0 {
+				t.Errorf("expected nothing to be sent, got %+v", fake.Requests())
+			}
+		})
+	}
+}
+
+func TestLambdaHandlerAsyncEmailValidates(t *testing.T) {
+	queue := &fakeQueue{}
+	useFakeQueue(t, queue)
+	fake := useFakeSES(acceptAll)
+
+	output, err := invoke(t, HandlerInput{Email: &sesmail.SendEmailInput{}, Async: true})
+
+	if err == nil || output.EmailError == nil {
+		t.Error("expected the invalid email to be rejected")
+	} else if len(queue.messages) != 0 || len(fake.Requests()) != 0 {
+		t.Errorf("expected nothing to be queued or sent, got %+v and %+v", queue.messages, fake.Requests())
+	}
+}
+
+func TestLambdaHandlerRejectsAsyncBatches(t *testing.T) {
+	queue := &fakeQueue{}
+	useFakeQueue(t, queue)
+	fake := useFakeSES(acceptAll)
+
+	for _, event := range []HandlerInput{
+		{Emails: []*sesmail.SendEmailInput{simpleEmail("a@example.com")}, Async: true},
+		{BulkEmail: bulkEmail("a@example.com"), Async: true},
+	} {
+		output, err := invoke(t, event)
+		operation := eventOperation(event)
+
+		if expected := "Only a single email can be sent async"; err == nil || err.Error() != expected {
+			t.Errorf("expected %q for %s, got %v", expected, operation, err)
+		} else if output.ResultCode != sesmail.ResultValidationError || output.Operation != operation {
+			t.Errorf("expected a %s validation error, got %+v", operation, output)
+		}
+	}
+
+	if len(queue.messages) != 0 || len(fake.Requests()) != 0 {
+		t.Errorf("expected nothing to be queued or sent, got %+v and %+v", queue.messages, fake.Requests())
+	}
+}
+
+func TestSQSHandlerLogsSentEmails(t *testing.T) {
+	useFakeSES(acceptAll)
+
+	event := events.SQSEvent{Records: []events.SQSMessage{
+		sqsRecord(t, "queued", HandlerInput{Email: simpleEmail("a@example.com")}),
+	}}
+	logged := captureLog(t, func() { SQSHandler(context.Background(), event) })
+
+	if !strings.Contains(logged, "SQS message queued was sent as message-id") {
+		t.Errorf("expected the message ID to be logged, got %q", logged)
+	}
+}
+
+func TestSQSHandlerRedactsLoggedErrors(t *testing.T) {
+	previous := sesmail.Settings
+	t.Cleanup(func() { sesmail.Settings = previous })
+
+	sesmail.Settings = sesmail.Config{LogRedactPII: true}
+	useFakeSES(func(fakeRequest) (int, string) {
+		return 400, `{"message":"Email address is not verified: b@example.com"}`
+	})
+
+	event := events.SQSEvent{Records: []events.SQSMessage{
+		sqsRecord(t, "rejected", HandlerInput{Email: simpleEmail("b@example.com")}),
+	}}
+	logged := captureLog(t, func() { SQSHandler(context.Background(), event) })
+
+	if !strings.Contains(logged, "SQS message rejected failed") || strings.Contains(logged, "b@example.com") {
+		t.Errorf("expected the failure to be logged with the address masked, got %q", logged)
+	}
+}
+
+// Keeps stored payloads in memory
+type memoryPayloadStore map[string][]byte
+
+func (store memoryPayloadStore) Store(_ context.Context, key string, payload []byte) (string, error) {
+	store[key] = payload
+
+	return "memory://" + key, nil
+}
+
+func (store memoryPayloadStore) Load(_ context.Context, key string) ([]byte, error) {
+	payload, ok := store[key]
+
+	if !ok {
+		return nil, fmt.Errorf("%s isn't stored", key)
+	}
+
+	return payload, nil
+}
+
+func TestLambdaHandlerOffloadsOversizedEmails(t *testing.T) {
+	previousSettings, previousOffload := sesmail.Settings, sesmail.Offload
+	t.Cleanup(func() { sesmail.Settings, sesmail.Offload = previousSettings, previousOffload })
+
+	store := memoryPayloadStore{}
+	sesmail.Settings = sesmail.Config{OffloadThreshold: 2}
+	sesmail.Offload = store
+
+	for _, test := range []struct {
+		name    string
+		emails  int
+		offload bool
+	}{
+		{"at the threshold", 2, false},
+		{"above the threshold", 3, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			fake := useFakeSES(acceptAll)
+
+			var emails []*sesmail.SendEmailInput
+
+			for index := 0; index < test.emails; index++ {
+				emails = append(emails, simpleEmail("a@example.com"))
+			}
+
+			output, err := invoke(t, HandlerInput{Emails: emails})
+
+			if err != nil {
+				t.Fatal(err)
+			} else if !test.offload {
+				if output.OffloadLocation != "" || len(fake.Requests()) != test.emails {
+					t.Errorf("expected the emails to be sent, got %q and %d requests", output.OffloadLocation, len(fake.Requests()))
+				}
+
+				return
+			} else if len(fake.Requests()) != 0 {
+				t.Errorf("expected nothing to be sent, got %d requests", len(fake.Requests()))
+			}
+
+			payload, ok := store[strings.TrimPrefix(output.OffloadLocation, "memory://")]
+
+			var stored HandlerInput
+
+			if !ok || !output.Success {
+				t.Fatalf("expected the emails to be offloaded, got %+v", output)
+			} else if err := json.Unmarshal(payload, &stored); err != nil {
+				t.Fatal(err)
+			} else if len(stored.Emails) != test.emails {
+				t.Errorf("expected %d stored emails, got %d", test.emails, len(stored.Emails))
+			}
+		})
+	}
+}
+
+// Fails every store and load, like an unreachable bucket
+type unavailablePayloadStore struct{}
+
+func (unavailablePayloadStore) Store(context.Context, string, []byte) (string, error) {
+	return "", errors.New("Failed to store payload in S3: access denied")
+}
+
+func (unavailablePayloadStore) Load(context.Context, string) ([]byte, error) {
+	return nil, errors.New("Failed to load payload from S3: access denied")
+}
+
+func TestLambdaHandlerReportsOffloadFailuresAsInternal(t *testing.T) {
+	previousSettings, previousOffload := sesmail.Settings, sesmail.Offload
+	t.Cleanup(func() { sesmail.Settings, sesmail.Offload = previousSettings, previousOffload })
+
+	sesmail.Settings = sesmail.Config{OffloadThreshold: 1}
+	sesmail.Offload = unavailablePayloadStore{}
+	useFakeSES(acceptAll)
+
+	output, err := invoke(t, HandlerInput{Emails: []*sesmail.SendEmailInput{
+		simpleEmail("a@example.com"),
+		simpleEmail("b@example.com"),
+	}})
+
+	if err == nil || output.Success || output.ResultCode != sesmail.ResultInternalError {
+		t.Errorf("expected %s, got %s and %v", sesmail.ResultInternalError, output.ResultCode, err)
+	}
+}
+
+// An S3 notification that each key was stored in the bucket
+func s3Notification(t *testing.T, bucket string, keys ...string) json.RawMessage {
+	var event events.S3Event
+
+	for _, key := range keys {
+		record := events.S3EventRecord{EventSource: "aws:s3", EventName: "ObjectCreated:Put"}
+		record.S3.Bucket.Name = bucket
+		record.S3.Object.Key = key
+		event.Records = append(event.Records, record)
+	}
+
+	payload, err := json.Marshal(event)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return payload
+}
+
+func TestS3HandlerSendsOffloadedEmails(t *testing.T) {
+	previousSettings, previousOffload := sesmail.Settings, sesmail.Offload
+	t.Cleanup(func() { sesmail.Settings, sesmail.Offload = previousSettings, previousOffload })
+
+	store := memoryPayloadStore{}
+	sesmail.Settings = sesmail.Config{OffloadBucket: "payloads", OffloadThreshold: 2}
+	sesmail.Offload = store
+
+	fake := useFakeSES(acceptAll)
+	output, err := invoke(t, HandlerInput{Emails: []*sesmail.SendEmailInput{
+		simpleEmail("a@example.com"),
+		simpleEmail("b@example.com"),
+		simpleEmail("c@example.com"),
+	}})
+
+	if err != nil {
+		t.Fatal(err)
+	} else if output.OffloadLocation == "" || len(fake.Requests()) != 0 {
+		t.Fatalf("expected the emails to be offloaded, got %+v", output)
+	}
+
+	key := strings.TrimPrefix(output.OffloadLocation, "memory://")
+	store["results/1.json"] = []byte(`{"emails":[]}`)
+
+	// Only the offloaded emails in the offload bucket are sent, even though they're still over the
+	// threshold
+	for _, notification := range []json.RawMessage{
+		s3Notification(t, "other", key),
+		s3Notification(t, "payloads", "results/1.json"),
+		s3Notification(t, "payloads", key),
+	} {
+		var response interface{}
+
+		logged := captureLog(t, func() {
+			response, err = invocationHandler(context.Background(), notification)
+		})
+
+		if err != nil || response != nil {
+			t.Fatalf("expected the notification to be handled, got %+v and %v (%s)", response, err, logged)
+		}
+	}
+
+	if requests := fake.Requests(); len(requests) != 3 {
+		t.Errorf("expected the 3 offloaded emails to be sent, got %d requests", len(requests))
+	}
+}
+
+func TestS3HandlerRetriesMissingPayloads(t *testing.T) {
+	previousSettings, previousOffload := sesmail.Settings, sesmail.Offload
+	t.Cleanup(func() { sesmail.Settings, sesmail.Offload = previousSettings, previousOffload })
+
+	sesmail.Settings = sesmail.Config{OffloadBucket: "payloads"}
+	sesmail.Offload = memoryPayloadStore{}
+
+	if _, err := invocationHandler(context.Background(), s3Notification(t, "payloads", "emails/1.json")); err == nil {
+		t.Error("expected the missing payload to fail the invocation")
+	}
+}
+
+func TestLambdaHandlerPhaseTimings(t *testing.T) {
+	previous := sesmail.Settings
+	sesmail.Settings = sesmail.Config{DomainRateLimits: map[string]float64{"phases.example.com": 10}}
+	t.Cleanup(func() { sesmail.Settings = previous })
+
+	// Each send takes 30ms, and the rate limit holds the second one back for the rest of 100ms
+	useFakeSES(func(request fakeRequest) (int, string) {
+		time.Sleep(30 * time.Millisecond)
+
+		return acceptAll(request)
+	})
+
+	output, err := invoke(t, HandlerInput{Emails: []*sesmail.SendEmailInput{
+		simpleEmail("a@phases.example.com"),
+		simpleEmail("b@phases.example.com"),
+	}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	timings := output.PhaseTimings
+
+	if timings.SendMillis < 55 {
+		t.Errorf("expected about 60ms waiting on SES, got %dms", timings.SendMillis)
+	} else if timings.ValidateMillis < 50 {
+		t.Errorf("expected about 70ms waiting on the rate limit, got %dms", timings.ValidateMillis)
+	}
+
+	encoded, err := json.Marshal(timings)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var phases map[string]int64
+
+	if err := json.Unmarshal(encoded, &phases); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, phase := range []string{"decode", "clientInit", "validate", "send", "respond"} {
+		if _, ok := phases[phase]; !ok {
+			t.Errorf("expected the %s phase, got %v", phase, phases)
+		}
+	}
+}
+
+func TestLambdaHandlerDeprecatedKeys(t *testing.T) {
+	payload := json.RawMessage(`{"email":{
+		"from":"from@example.com",
+		"dest":{"to":["to@example.com"]},
+		"content":{"temaplte":{"name":"welcome"}}
+	}}`)
+
+	for _, strict := range []bool{false, true} {
+		previous := sesmail.Settings
+		sesmail.Settings = sesmail.Config{StrictMode: strict}
+
+		fake := useFakeSES(acceptAll)
+		output, err := LambdaHandler(context.Background(), payload)
+		sesmail.Settings = previous
+
+		var deprecated *sesmail.ErrDeprecatedKeys
+
+		if strict {
+			if !errors.As(err, &deprecated) {
+				t.Errorf("expected strict mode to reject the payload, got %v", err)
+			} else if len(fake.Requests()) != 0 {
+				t.Errorf("expected nothing to be sent, got %d requests", len(fake.Requests()))
+			}
+
+			continue
+		}
+
+		if err != nil || !output.Success {
+			t.Errorf("expected lenient mode to send the email, got %+v and %v", output, err)
+		} else if len(output.Warnings) != 1 || !strings.Contains(output.Warnings[0], `use "template"`) {
+			t.Errorf("expected a migration warning, got %q", output.Warnings)
+		} else if !strings.Contains(fake.Requests()[0].Body, `"TemplateName":"welcome"`) {
+			t.Errorf("expected the template to be sent, got %s", fake.Requests()[0].Body)
+		}
+	}
+}
+
+func TestLambdaHandlerSerializesErrors(t *testing.T) {
+	useFakeSES(func(fakeRequest) (int, string) {
+		return 400, `{"__type":"MessageRejected","message":"Email address is not verified."}`
+	})
+
+	for _, event := range []HandlerInput{
+		{Email: simpleEmail("a@example.com")},
+		{Emails: []*sesmail.SendEmailInput{simpleEmail("a@example.com")}},
+		{BulkEmail: bulkEmail("a@example.com")},
+	} {
+		output, _ := invoke(t, event)
+		encoded, err := json.Marshal(output)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var decoded struct {
+			Error          *sesmail.APIError   `json:"error"`
+			Errors         []*sesmail.APIError `json:"errors"`
+			BulkEmailError *sesmail.APIError   `json:"bulkEmailError"`
+		}
+
+		if err := json.Unmarshal(encoded, &decoded); err != nil {
+			t.Fatal(err)
+		}
+
+		serialized := decoded.Error
+
+		if len(decoded.Errors) > 0 {
+			serialized = decoded.Errors[0]
+		} else if decoded.BulkEmailError != nil {
+			serialized = decoded.BulkEmailError
+		}
+
+		if serialized == nil || serialized.Message == "" {
+			t.Errorf("%s: expected a readable error, got %s", output.Operation, encoded)
+		} else if serialized.Code != "MessageRejected" {
+			t.Errorf("%s: expected %q, got %q", output.Operation, "MessageRejected", serialized.Code)
+		}
+	}
+}
+
+func TestLambdaHandlerEnforcementWarning(t *testing.T) {
+	previous := sesmail.EnforcementStatus
+	t.Cleanup(func() { sesmail.EnforcementStatus = previous })
+	useFakeSES(acceptAll)
+
+	for _, status := range []string{"HEALTHY", "UNDER_REVIEW"} {
+		sesmail.EnforcementStatus = status
+		output, err := invoke(t, HandlerInput{Email: simpleEmail("a@example.com")})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		warned := len(output.Warnings) == 1 && strings.Contains(output.Warnings[0], status)
+
+		if warned != (status != "HEALTHY") {
+			t.Errorf("%s: unexpected warnings %q", status, output.Warnings)
+		}
+	}
+}
+
+func TestLambdaHandlerWithMockClient(t *testing.T) {
+	useConfigEnv(t, map[string]string{"FALLBACK_REGION": ""})
+	clients := useMockClients(t)
+
+	if _, err := invoke(t, HandlerInput{RefreshConfig: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	client := clients["us-east-1"]
+
+	if client == nil {
+		t.Fatalf("expected a client for us-east-1, got %v", clients)
+	}
+
+	output, err := invoke(t, HandlerInput{Email: simpleEmail("a@example.com")})
+
+	if err != nil {
+		t.Fatal(err)
+	} else if !output.Success || aws.ToString(output.Email.MessageId) != "us-east-1-message" {
+		t.Errorf("expected the mock to accept the email, got %+v", output.Email)
+	}
+
+	output, err = invoke(t, HandlerInput{BulkEmail: bulkEmail("a@example.com", "b@example.com")})
+
+	if err != nil {
+		t.Fatal(err)
+	} else if !output.Success || len(output.BulkEmail.BulkEmailEntryResults) != 2 {
+		t.Errorf("expected the mock to accept the bulk email, got %+v", output.BulkEmail)
+	}
+
+	if len(client.sentEmails) != 1 || len(client.sentBulkEmails) != 1 {
+		t.Errorf("expected 1 email and 1 bulk email, got %d and %d", len(client.sentEmails), len(client.sentBulkEmails))
+	}
+}
+
+func TestLambdaHandlerResultCode(t *testing.T) {
+	throttle := func(fakeRequest) (int, string) {
+		return 429, `{"__type":"TooManyRequestsException","message":"Rate exceeded"}`
+	}
+	reject := func(fakeRequest) (int, string) {
+		return 400, `{"__type":"MessageRejected","message":"Email address is not verified."}`
+	}
+
+	for _, test := range []struct {
+		name     string
+		respond  func(fakeRequest) (int, string)
+		event    HandlerInput
+		expected sesmail.ResultCode
+	}{
+		{"email accepted", acceptAll, HandlerInput{Email: simpleEmail("a@example.com")}, sesmail.ResultOK},
+		{"email invalid", acceptAll, HandlerInput{Email: &sesmail.SendEmailInput{}}, sesmail.ResultValidationError},
+		{"email throttled", throttle, HandlerInput{Email: simpleEmail("a@example.com")}, sesmail.ResultThrottled},
+		{
+			"emails partly rejected",
+			rejectB,
+			HandlerInput{Emails: []*sesmail.SendEmailInput{simpleEmail("a@example.com"), simpleEmail("b@example.com")}},
+			sesmail.ResultPartial,
+		},
+		{"emails all rejected", reject, HandlerInput{Emails: []*sesmail.SendEmailInput{simpleEmail("b@example.com")}}, sesmail.ResultRejected},
+		{"bulk accepted", acceptAll, HandlerInput{BulkEmail: bulkEmail("a@example.com", "b@example.com")}, sesmail.ResultOK},
+		{"bulk throttled", throttle, HandlerInput{BulkEmail: bulkEmail("a@example.com")}, sesmail.ResultThrottled},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			useFakeSES(test.respond)
+			output, _ := invoke(t, test.event)
+
+			if output.ResultCode != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, output.ResultCode)
+			}
+		})
+	}
+
+	if output, _ := LambdaHandler(context.Background(), json.RawMessage(`{"email":`)); output.ResultCode != sesmail.ResultValidationError {
+		t.Errorf("expected %s for a malformed payload, got %s", sesmail.ResultValidationError, output.ResultCode)
+	}
+}
+
+func TestLambdaHandlerRegionOverride(t *testing.T) {
+	useConfigEnv(t, map[string]string{"FALLBACK_REGION": ""})
+	clients := useMockClients(t)
+
+	if _, err := invoke(t, HandlerInput{RefreshConfig: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, region := range []string{"eu-west-1", "eu-west-1", ""} {
+		email := simpleEmail("a@example.com")
+
+		if region != "" {
+			email.Region = aws.String(region)
+		}
+
+		output, err := invoke(t, HandlerInput{Email: email})
+		expected := region
+
+		if expected == "" {
+			expected = "us-east-1"
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		} else if id := aws.ToString(output.Email.MessageId); id != expected+"-message" {
+			t.Errorf("expected the email to be sent through %s, got %s", expected, id)
+		}
+	}
+
+	// The regional client is created once and reused
+	if sent := len(clients["eu-west-1"].sentEmails); sent != 2 {
+		t.Errorf("expected 2 emails through one eu-west-1 client, got %d", sent)
+	}
+}
+
+func TestLambdaHandlerReportsRetryAfter(t *testing.T) {
+	previous := ses
+	t.Cleanup(func() { ses = previous })
+
+	// Only clients created by newClient record the hints
+	fake := &fakeSES{
+		respond: func(fakeRequest) (int, string) {
+			return 429, `{"__type":"TooManyRequestsException","message":"Rate exceeded"}`
+		},
+		header: http.Header{"Retry-After": {"7"}},
+	}
+	ses = newClient(sesv2.Options{
+		Region:     "us-east-1",
+		HTTPClient: fake,
+		Retryer:    aws.NopRetryer{},
+		Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "test", SecretAccessKey: "test"}, nil
+		}),
+	})
+
+	output, _ := invoke(t, HandlerInput{Emails: []*sesmail.SendEmailInput{
+		simpleEmail("a@example.com"),
+		simpleEmail("b@example.com"),
+	}})
+
+	if expected := []float64{7, 7}; !reflect.DeepEqual(output.RetryAfterSeconds, expected) {
+		t.Errorf("expected %v, got %v", expected, output.RetryAfterSeconds)
+	}
+
+	useFakeSES(acceptAll)
+
+	if output, _ := invoke(t, HandlerInput{Email: simpleEmail("a@example.com")}); output.RetryAfterSeconds != nil {
+		t.Errorf("expected no hints, got %v", output.RetryAfterSeconds)
+	}
+}
+
+func TestLambdaHandlerDebugConfig(t *testing.T) {
+	const secret = "wJalrXUtnFEMI-secret-key"
+
+	useConfigEnv(t, map[string]string{
+		"AWS_SECRET_ACCESS_KEY": secret,
+		"AWS_REGION":            "eu-west-1",
+		"DOMAIN_RATE_LIMITS":    "example.com=5",
+		"DEFAULT_REPLY_TO":      "reply@example.com",
+		"FALLBACK_REGION":       "",
+	})
+	useMockClients(t)
+
+	output, err := invoke(t, HandlerInput{RefreshConfig: true, DebugConfig: true})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encoded, err := json.Marshal(output)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded struct {
+		DebugConfig map[string]interface{} `json:"debugConfig"`
+	}
+
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, expected := range map[string]interface{}{
+		"region":           "eu-west-1",
+		"domainRateLimits": map[string]interface{}{"example.com": 5.0},
+		"defaultReplyTo":   []interface{}{"reply@example.com"},
+	} {
+		if value := decoded.DebugConfig[name]; !reflect.DeepEqual(value, expected) {
+			t.Errorf("expected %s to be %v, got %v", name, expected, value)
+		}
+	}
+
+	if bytes.Contains(encoded, []byte(secret)) {
+		t.Errorf("expected the secret key to be left out, got %s", encoded)
+	}
+
+	if output, _ := invoke(t, HandlerInput{RefreshConfig: true}); output.DebugConfig != nil {
+		t.Errorf("expected no settings without debugConfig, got %v", output.DebugConfig)
+	}
+}
+
+func TestLambdaHandlerBulkEmailFailsGracefully(t *testing.T) {
+	previous := ses
+	t.Cleanup(func() { ses = previous })
+
+	failure := errors.New("connection reset")
+	ses = &mockClient{err: failure}
+
+	output, err := invoke(t, HandlerInput{BulkEmail: bulkEmail("a@example.com", "b@example.com")})
+
+	if !errors.Is(err, failure) {
+		t.Errorf("expected %q, got %v", failure, err)
+	} else if output.Success || output.BulkEmailError == nil {
+		t.Errorf("expected a failed bulk email, got %+v", output)
+	} else if output.BulkEmail == nil || output.BulkEmail.BulkEmailEntryResults == nil ||
+		len(output.BulkEmail.BulkEmailEntryResults) != 0 {
+		t.Errorf("expected an empty result list, got %+v", output.BulkEmail)
+	}
+
+	encoded, _ := json.Marshal(output)
+
+	if !bytes.Contains(encoded, []byte(`"bulkEmail":{"result":[]`)) {
+		t.Errorf("expected an empty result list in the JSON, got %s", encoded)
+	}
+}
+
+func TestLambdaHandlerRetryPayload(t *testing.T) {
+	respond := func(request fakeRequest) (int, string) {
+		if strings.HasSuffix(request.Path, "/outbound-bulk-emails") {
+			return 200, `{"BulkEmailEntryResults":[` +
+				`{"Status":"SUCCESS","MessageId":"bulk-id"},` +
+				`{"Status":"ACCOUNT_THROTTLED","Error":"Rate exceeded"},` +
+				`{"Status":"MESSAGE_REJECTED","Error":"Email address is not verified."}]}`
+		} else if strings.Contains(request.Body, "b@example.com") {
+			return 429, `{"__type":"TooManyRequestsException","message":"Rate exceeded"}`
+		} else if strings.Contains(request.Body, "c@example.com") {
+			return 400, `{"__type":"MessageRejected","message":"Email address is not verified."}`
+		}
+
+		return acceptAll(request)
+	}
+	emails := []*sesmail.SendEmailInput{simpleEmail("a@example.com"), simpleEmail("b@example.com"), simpleEmail("c@example.com")}
+	bulk := bulkEmail("a@example.com", "b@example.com", "c@example.com")
+
+	for _, test := range []struct {
+		name     string
+		event    HandlerInput
+		expected *HandlerInput
+	}{
+		{"email accepted", HandlerInput{Email: simpleEmail("a@example.com")}, nil},
+		{"email throttled", HandlerInput{Email: emails[1]}, &HandlerInput{Email: emails[1]}},
+		{"email rejected", HandlerInput{Email: emails[2]}, nil},
+		{"emails", HandlerInput{Emails: emails}, &HandlerInput{Emails: emails[1:2]}},
+		{"bulk email", HandlerInput{BulkEmail: bulk}, &HandlerInput{BulkEmail: bulkEmail("b@example.com")}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			useFakeSES(respond)
+
+			output, _ := invoke(t, test.event)
+			expected, _ := json.Marshal(test.expected)
+			actual, _ := json.Marshal(output.RetryPayload)
+
+			if !bytes.Equal(actual, expected) {
+				t.Errorf("expected %s, got %s", expected, actual)
+			}
+		})
+	}
+}
+
+func TestLambdaHandlerManagesTemplates(t *testing.T) {
+	template := &sesmail.TemplateInput{
+		TemplateName: aws.String("welcome"),
+		Subject:      aws.String("Welcome"),
+		Text:         aws.String("Hi"),
+	}
+
+	for _, test := range []struct {
+		action sesmail.TemplateAction
+		method string
+		path   string
+	}{
+		{sesmail.TemplateCreate, http.MethodPost, "/v2/email/templates"},
+		{sesmail.TemplateUpdate, http.MethodPut, "/v2/email/templates/welcome"},
+		{sesmail.TemplateDelete, http.MethodDelete, "/v2/email/templates/welcome"},
+	} {
+		t.Run(string(test.action), func(t *testing.T) {
+			fake := useFakeSES(func(fakeRequest) (int, string) { return 200, `{}` })
+			output, err := invoke(t, HandlerInput{Template: template, TemplateAction: test.action})
+
+			if err != nil {
+				t.Fatal(err)
+			} else if output.Operation != "template" || !output.Success {
+				t.Errorf("expected a successful template operation, got %+v", output)
+			}
+
+			requests := fake.Requests()
+
+			if len(requests) != 1 || requests[0].Method != test.method || requests[0].Path != test.path {
+				t.Errorf("expected %s %s, got %+v", test.method, test.path, requests)
+			}
+		})
+	}
+
+	t.Run("missing template", func(t *testing.T) {
+		useFakeSES(func(fakeRequest) (int, string) {
+			return 404, `{"__type":"NotFoundException","message":"Template welcome does not exist."}`
+		})
+
+		output, err := invoke(t, HandlerInput{Template: template, TemplateAction: sesmail.TemplateDelete})
+
+		if err == nil || output.Success || output.ResultCode != sesmail.ResultTemplateNotFound {
+			t.Errorf("expected the template not to be found, got %+v and %v", output, err)
+		}
+	})
+}
+
+func TestLambdaHandlerGetAccount(t *testing.T) {
+	fake := useFakeSES(func(fakeRequest) (int, string) {
+		return 200, `{"SendQuota":{"Max24HourSend":50000,"MaxSendRate":14,"SentLast24Hours":1200},"SendingEnabled":true}`
+	})
+
+	output, err := invoke(t, HandlerInput{GetAccount: true})
+	expected := &sesmail.AccountQuota{Max24HourSend: 50000, MaxSendRate: 14, SentLast24Hours: 1200, SendingEnabled: true}
+
+	if err != nil {
+		t.Fatal(err)
+	} else if output.Operation != "getAccount" || !output.Success || !reflect.DeepEqual(output.Account, expected) {
+		t.Errorf("expected %+v, got %+v", expected, output)
+	} else if requests := fake.Requests(); len(requests) != 1 || requests[0].Path != "/v2/email/account" {
+		t.Errorf("expected only the account to be looked up, got %+v", requests)
+	}
+}
+
+func TestLambdaHandlerOffloadsLargeBulkResults(t *testing.T) {
+	previousSettings, previousOffload := sesmail.Settings, sesmail.Offload
+	t.Cleanup(func() { sesmail.Settings, sesmail.Offload = previousSettings, previousOffload })
+
+	store := memoryPayloadStore{}
+	sesmail.Settings = sesmail.Config{ResultOffloadThreshold: 2, ResultChunkSize: 2}
+	sesmail.Offload = store
+
+	useFakeSES(acceptAll)
+
+	output, err := invoke(t, HandlerInput{BulkEmail: bulkEmail("a@example.com", "b@example.com", "c@example.com")})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := output.BulkEmail
+
+	if result == nil || len(result.BulkEmailEntryResults) != 0 || len(result.ResultChunks) != 2 {
+		t.Fatalf("expected the results to be offloaded in 2 chunks, got %+v", result)
+	} else if result.ResultSummary.Total != 3 || result.ResultSummary.Succeeded != 3 {
+		t.Errorf("expected 3 accepted results in the summary, got %+v", result.ResultSummary)
+	}
+
+	for _, chunk := range result.ResultChunks {
+		if _, ok := store[strings.TrimPrefix(chunk.Location, "memory://")]; !ok {
+			t.Errorf("expected %s to be stored", chunk.Location)
+		}
+	}
+}
+
+func TestLambdaHandlerManagesSuppressionList(t *testing.T) {
+	for _, test := range []struct {
+		action   sesmail.SuppressionAction
+		input    *sesmail.SuppressionInput
+		method   string
+		path     string
+		response string
+		expected *sesmail.SuppressionOutput
+	}{
+		{
+			sesmail.SuppressionPut,
+			&sesmail.SuppressionInput{EmailAddress: aws.String("a@example.com"), Reason: "BOUNCE"},
+			http.MethodPut,
+			"/v2/email/suppression/addresses",
+			`{}`,
+			nil,
+		},
+		{
+			sesmail.SuppressionDelete,
+			&sesmail.SuppressionInput{EmailAddress: aws.String("a@example.com")},
+			http.MethodDelete,
+			"/v2/email/suppression/addresses/a@example.com",
+			`{}`,
+			nil,
+		},
+		{
+			sesmail.SuppressionList,
+			&sesmail.SuppressionInput{Reasons: []string{"COMPLAINT"}},
+			http.MethodGet,
+			"/v2/email/suppression/addresses",
+			`{"SuppressedDestinationSummaries":[{"EmailAddress":"a@example.com","Reason":"COMPLAINT"}],"NextToken":"page-2"}`,
+			&sesmail.SuppressionOutput{
+				Recipients: []sesmail.SuppressedRecipient{{EmailAddress: "a@example.com", Reason: "COMPLAINT"}},
+				NextToken:  aws.String("page-2"),
+			},
+		},
+	} {
+		t.Run(string(test.action), func(t *testing.T) {
+			fake := useFakeSES(func(fakeRequest) (int, string) { return 200, test.response })
+			output, err := invoke(t, HandlerInput{Suppression: test.input, SuppressionAction: test.action})
+
+			if err != nil {
+				t.Fatal(err)
+			} else if output.Operation != "suppression" || !output.Success || !reflect.DeepEqual(output.Suppression, test.expected) {
+				t.Errorf("expected %+v, got %+v", test.expected, output)
+			}
+
+			requests := fake.Requests()
+
+			if len(requests) != 1 || requests[0].Method != test.method || requests[0].Path != test.path {
+				t.Errorf("expected %s %s, got %+v", test.method, test.path, requests)
+			}
+		})
+	}
+}
+
+func TestLambdaHandlerListsContacts(t *testing.T) {
+	fake := useFakeSES(func(fakeRequest) (int, string) {
+		return 200, `{"Contacts":[{"EmailAddress":"a@example.com","UnsubscribeAll":true}]}`
+	})
+
+	output, err := invoke(t, HandlerInput{
+		Contacts:      &sesmail.ContactInput{ContactListName: aws.String("newsletter")},
+		ContactAction: sesmail.ContactList,
+	})
+	expected := &sesmail.ContactOutput{Contacts: []sesmail.Contact{
+		{EmailAddress: "a@example.com", TopicPreferences: []sesmail.TopicPreference{}, UnsubscribeAll: true},
+	}}
+
+	if err != nil {
+		t.Fatal(err)
+	} else if output.Operation != "contacts" || !output.Success || !reflect.DeepEqual(output.Contacts, expected) {
+		t.Errorf("expected %+v, got %+v", expected, output)
+	} else if requests := fake.Requests(); len(requests) != 1 || requests[0].Path != "/v2/email/contact-lists/newsletter/contacts/list" {
+		t.Errorf("expected the newsletter's contacts to be listed, got %+v", requests)
+	}
+}
+
+func TestLambdaHandlerReportsRequestIds(t *testing.T) {
+	previous := ses
+	t.Cleanup(func() { ses = previous })
+
+	// Only clients created by newClient record the request IDs
+	fake := &fakeSES{respond: acceptAll, header: http.Header{"X-Amzn-Requestid": {"request-id"}}}
+	ses = newClient(sesv2.Options{
+		Region:     "us-east-1",
+		HTTPClient: fake,
+		Retryer:    aws.NopRetryer{},
+		Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "test", SecretAccessKey: "test"}, nil
+		}),
+	})
+
+	for _, test := range []struct {
+		name     string
+		event    HandlerInput
+		expected []string
+	}{
+		{"email", HandlerInput{Email: simpleEmail("a@example.com")}, []string{"request-id"}},
+		{
+			"emails",
+			HandlerInput{Emails: []*sesmail.SendEmailInput{simpleEmail("a@example.com"), simpleEmail("b@example.com")}},
+			[]string{"request-id", "request-id"},
+		},
+		{"bulk email", HandlerInput{BulkEmail: bulkEmail("a@example.com", "b@example.com")}, []string{"request-id"}},
+		{"get account", HandlerInput{GetAccount: true}, []string{"request-id"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			output, err := invoke(t, test.event)
+
+			if err != nil {
+				t.Fatal(err)
+			} else if !reflect.DeepEqual(output.RequestIds, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, output.RequestIds)
+			}
+		})
+	}
+}
+
+func TestLambdaHandlerRawRecipientWarnings(t *testing.T) {
+	previous := sesmail.Settings
+	t.Cleanup(func() { sesmail.Settings = previous })
+
+	sesmail.Settings = sesmail.Config{RawRecipientCheck: sesmail.RawRecipientCheckWarn}
+	useFakeSES(acceptAll)
+
+	email := &sesmail.SendEmailInput{
+		Content: &sesmail.EmailContent{Raw: &sesmail.RawMessage{
+			Data: []byte("From: from@example.com\r\nTo: b@example.com\r\nSubject: Hi\r\n\r\nHello"),
+		}},
+		Destination:      &sesmail.Destination{ToAddresses: []string{"a@example.com"}},
+		FromEmailAddress: aws.String("from@example.com"),
+	}
+	output, err := invoke(t, HandlerInput{Email: email})
+	expected := []string{
+		"Recipient a@example.com is in the Destination but not the raw message's headers",
+		"Recipient b@example.com is in the raw message's headers but not the Destination",
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(output.Warnings, expected) {
+		t.Errorf("expected %q, got %q", expected, output.Warnings)
+	}
+}
+
+// An SQS record whose body is the event, or body itself if it's a string
+func sqsRecord(t *testing.T, id string, body interface{}) events.SQSMessage {
+	text, ok := body.(string)
+
+	if !ok {
+		encoded, err := json.Marshal(body)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		text = string(encoded)
+	}
+
+	return events.SQSMessage{MessageId: id, Body: text, EventSource: "aws:sqs"}
+}
+
+func TestSQSHandler(t *testing.T) {
+	useFakeSES(rejectB)
+
+	event := events.SQSEvent{Records: []events.SQSMessage{
+		sqsRecord(t, "accepted", HandlerInput{Email: simpleEmail("a@example.com")}),
+		sqsRecord(t, "rejected", HandlerInput{Email: simpleEmail("b@example.com")}),
+		sqsRecord(t, "partly rejected", HandlerInput{Emails: []*sesmail.SendEmailInput{
+			simpleEmail("a@example.com"),
+			simpleEmail("b@example.com"),
+		}}),
+		sqsRecord(t, "partly rejected bulk", HandlerInput{BulkEmail: bulkEmail("a@example.com", "b@example.com")}),
+		sqsRecord(t, "all rejected", HandlerInput{Emails: []*sesmail.SendEmailInput{
+			simpleEmail("b@example.com"),
+			simpleEmail("b@example.com"),
+		}}),
+		sqsRecord(t, "malformed", "{"),
+		sqsRecord(t, "also accepted", HandlerInput{Email: simpleEmail("c@example.com")}),
+	}}
+
+	// Partly accepted records aren't retried, since that would resend their accepted emails
+	expected := []SQSBatchItemFailure{{"rejected"}, {"all rejected"}, {"malformed"}}
+
+	if response := SQSHandler(context.Background(), event); !reflect.DeepEqual(response.BatchItemFailures, expected) {
+		t.Errorf("expected %+v, got %+v", expected, response.BatchItemFailures)
+	}
+}
+
+func TestInvocationHandlerDetectsSQS(t *testing.T) {
+	useFakeSES(rejectAll)
+
+	sqs, _ := json.Marshal(events.SQSEvent{Records: []events.SQSMessage{
+		sqsRecord(t, "message-1", HandlerInput{Email: simpleEmail("a@example.com")}),
+	}})
+	response, err := invocationHandler(context.Background(), sqs)
+
+	if err != nil {
+		t.Fatal(err)
+	} else if batch, ok := response.(SQSBatchResponse); !ok || len(batch.BatchItemFailures) != 1 {
+		t.Errorf("expected an SQS batch response with a failure, got %+v", response)
+	}
+
+	// Records from other sources aren't SQS messages
+	other, _ := json.Marshal(map[string]interface{}{
+		"Records": []map[string]string{{"eventSource": "aws:sns", "body": "{}"}},
+	})
+
+	if _, isSQS := sqsEvent(other); isSQS {
+		t.Error("expected records from SNS not to be handled as SQS messages")
+	}
+
+	direct, _ := json.Marshal(HandlerInput{Email: simpleEmail("a@example.com")})
+
+	if response, _ := invocationHandler(context.Background(), direct); reflect.TypeOf(response) != reflect.TypeOf(HandlerOutput{}) {
+		t.Errorf("expected a handler output, got %T", response)
+	}
+}
+
+func TestLambdaHandlerReportsFailedEmailIndexes(t *testing.T) {
+	useFakeSES(rejectB)
+
+	output, err := invoke(t, HandlerInput{Emails: []*sesmail.SendEmailInput{
+		simpleEmail("a@example.com"),
+		simpleEmail("b@example.com"),
+		simpleEmail("c@example.com"),
+	}})
+
+	if err != nil {
+		t.Fatal(err)
+	} else if len(output.EmailsErrors) != 1 {
+		t.Fatalf("expected one error, got %+v", output.EmailsErrors)
+	}
+
+	failed := output.EmailsErrors[0]
+
+	if failed.Index == nil || *failed.Index != 1 || !reflect.DeepEqual(failed.Destination.ToAddresses, []string{"b@example.com"}) {
+		t.Errorf("expected email 1 to b@example.com, got %+v", failed)
+	}
+}
+
+// Answers no request, waiting until its context ends
+type unresponsiveSES struct{}
+
+func (unresponsiveSES) Do(request *http.Request) (*http.Response, error) {
+	<-request.Context().Done()
+
+	return nil, request.Context().Err()
+}
+
+func TestLambdaHandlerStopsBeforeDeadline(t *testing.T) {
+	previousSettings, previousClient := sesmail.Settings, ses
+	t.Cleanup(func() { sesmail.Settings, ses = previousSettings, previousClient })
+
+	sesmail.Settings = sesmail.Config{DeadlineMargin: 200 * time.Millisecond}
+	ses = sesv2.New(sesv2.Options{
+		Region:     "us-east-1",
+		HTTPClient: unresponsiveSES{},
+		Retryer:    aws.NopRetryer{},
+		Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "test", SecretAccessKey: "test"}, nil
+		}),
+	})
+
+	payload, _ := json.Marshal(HandlerInput{Email: simpleEmail("a@example.com")})
+	deadline := time.Now().Add(300 * time.Millisecond)
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	output, err := LambdaHandler(ctx, payload)
+
+	if !errors.Is(err, sesmail.ErrInvocationTimeout) || output.ResultCode != sesmail.ResultTimeout || output.Success {
+		t.Errorf("expected the invocation to time out, got %+v and %v", output, err)
+	} else if remaining := time.Until(deadline); remaining < 100*time.Millisecond {
+		t.Errorf("expected the invocation to stop a margin before the deadline, %v was left", remaining)
+	}
+}
+
+func TestLambdaHandlerCancelledMidSend(t *testing.T) {
+	previousClient := ses
+	t.Cleanup(func() { ses = previousClient })
+
+	ses = sesv2.New(sesv2.Options{
+		Region:     "us-east-1",
+		HTTPClient: unresponsiveSES{},
+		Retryer:    aws.NopRetryer{},
+		Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "test", SecretAccessKey: "test"}, nil
+		}),
+	})
+
+	payload, _ := json.Marshal(HandlerInput{Email: simpleEmail("a@example.com")})
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	output, err := LambdaHandler(ctx, payload)
+
+	// A cancelled invocation fails without being reported as a timeout
+	if !errors.Is(err, context.Canceled) || errors.Is(err, sesmail.ErrInvocationTimeout) || output.Success {
+		t.Errorf("expected the send to be cancelled, got %+v and %v", output, err)
+	}
+}
+
+func TestLambdaHandlerPreview(t *testing.T) {
+	fake := useFakeSES(acceptAll)
+
+	output, err := invoke(t, HandlerInput{Email: simpleEmail("a@example.com"), Preview: true})
+	expected := &sesmail.EmailPreview{Subject: "Subject", Body: "Body"}
+
+	if err != nil {
+		t.Fatal(err)
+	} else if !output.Success || !reflect.DeepEqual(output.Preview, expected) {
+		t.Errorf("expected %+v, got %+v", expected, output)
+	} else if len(fake.Requests()) != 0 {
+		t.Errorf("expected nothing to be sent, got %d requests", len(fake.Requests()))
+	}
+}
+
+func TestLambdaHandlerManagesConfigurationSets(t *testing.T) {
+	previous := sesmail.Settings
+	sesmail.Settings = sesmail.Config{AllowAdminOperations: true}
+	t.Cleanup(func() { sesmail.Settings = previous })
+
+	for _, test := range []struct {
+		operation string
+		event     HandlerInput
+		method    string
+		path      string
+	}{
+		{
+			"createConfigSet",
+			HandlerInput{CreateConfigSet: &sesmail.CreateConfigurationSetInput{ConfigurationSetName: aws.String("tracking")}},
+			http.MethodPost,
+			"/v2/email/configuration-sets",
+		},
+		{
+			"deleteConfigSet",
+			HandlerInput{DeleteConfigSet: &sesmail.DeleteConfigurationSetInput{ConfigurationSetName: aws.String("tracking"), Confirm: true}},
+			http.MethodDelete,
+			"/v2/email/configuration-sets/tracking",
+		},
+		{
+			"putConfigSetSuppressionOptions",
+			HandlerInput{PutConfigSetSuppressionOptions: &sesmail.ConfigurationSetSuppressionOptionsInput{
+				ConfigurationSetName: aws.String("tracking"),
+				SuppressedReasons:    []string{"BOUNCE"},
+			}},
+			http.MethodPut,
+			"/v2/email/configuration-sets/tracking/suppression-options",
+		},
+	} {
+		t.Run(test.operation, func(t *testing.T) {
+			fake := useFakeSES(func(fakeRequest) (int, string) { return 200, `{}` })
+			output, err := invoke(t, test.event)
+
+			if err != nil {
+				t.Fatal(err)
+			} else if output.Operation != test.operation || !output.Success {
+				t.Errorf("expected %s to succeed, got %+v", test.operation, output)
+			}
+
+			requests := fake.Requests()
+
+			if len(requests) != 1 || requests[0].Method != test.method || requests[0].Path != test.path {
+				t.Errorf("expected %s %s, got %+v", test.method, test.path, requests)
+			}
+		})
+	}
+}
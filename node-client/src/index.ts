@@ -14,7 +14,23 @@ import {
     InvokeCommandOutput,
 } from "@aws-sdk/client-lambda"
 import {SendBulkEmailInput, SendBulkEmailOutput} from "./types_bulk"
-import {SendEmailInput, SendEmailOutput} from "./types"
+import {
+    ContactAction,
+    ContactInput,
+    ContactOutput,
+    ConfigSetSuppressionOptionsInput,
+    CreateConfigSetInput,
+    CreateEventDestinationInput,
+    DeleteConfigSetInput,
+    Destination,
+    SendEmailInput,
+    SendEmailOutput,
+    SuppressionAction,
+    SuppressionInput,
+    SuppressionOutput,
+    TemplateAction,
+    TemplateInput,
+} from "./types"
 import {type ResponseMetadata} from "@aws-sdk/types"
 
 export interface Input {
@@ -84,21 +100,284 @@ export interface Input {
 
     /** Send bulk emails with a AWS SES template */
     bulkEmail?: SendBulkEmailInput
+
+    /**
+     * Return as soon as the single `email` is validated and queued on the function's
+     * `ASYNC_QUEUE_URL`, which the function sends it from once SQS delivers it, logging the
+     * result. Rejected for `emails` and `bulkEmail`
+     */
+    async?: boolean
+
+    /** Validate the single `email` and return a preview of its subject and body instead of sending it */
+    preview?: boolean
+
+    /** Reload the function's settings and clients without sending anything */
+    refreshConfig?: boolean
+
+    /** Attach an SNS topic or CloudWatch event destination to a configuration set */
+    createEventDestination?: CreateEventDestinationInput
+
+    /** Create a configuration set */
+    createConfigSet?: CreateConfigSetInput
+
+    /** Delete a configuration set, which needs `ALLOW_ADMIN_OPERATIONS` and `confirm` */
+    deleteConfigSet?: DeleteConfigSetInput
+
+    /** Set why addresses are added to the account suppression list for a configuration set */
+    putConfigSetSuppressionOptions?: ConfigSetSuppressionOptionsInput
+
+    /** Report the effective settings in the output, for debugging the deployment's configuration */
+    debugConfig?: boolean
+
+    /** Create, update, or delete the template, as `templateAction` says */
+    template?: TemplateInput
+    templateAction?: TemplateAction
+
+    /** Look up the account's sending quota without sending anything */
+    getAccount?: boolean
+
+    /**
+     * Add, remove, look up, or list addresses on the account suppression list, as
+     * `suppressionAction` says
+     */
+    suppression?: SuppressionInput
+    suppressionAction?: SuppressionAction
+
+    /**
+     * Create or delete a contact list, or add, update, remove, or list its contacts, as
+     * `contactAction` says
+     */
+    contacts?: ContactInput
+    contactAction?: ContactAction
 }
 
-export interface EmailOutput {
+/** The operation which produced an output, matching the key used in {@link Input} */
+export type Operation =
+    | "email"
+    | "emails"
+    | "bulkEmail"
+    | "refreshConfig"
+    | "createEventDestination"
+    | "createConfigSet"
+    | "deleteConfigSet"
+    | "putConfigSetSuppressionOptions"
+    | "template"
+    | "getAccount"
+    | "suppression"
+    | "contacts"
+
+/** A stable code summarising the outcome of an invocation */
+export type ResultCode =
+    | "OK"
+    | "PARTIAL"
+    | "VALIDATION_ERROR"
+    | "INTERNAL_ERROR"
+    | "THROTTLED"
+    | "ACCOUNT_ERROR"
+    | "TEMPLATE_NOT_FOUND"
+    | "REJECTED"
+    | "VIRUS_DETECTED"
+    | "SENDING_DISABLED"
+    | "SERVICE_ERROR"
+    | "TIMEOUT"
+
+/** A rough estimate of how much SES was used, counting only emails SES accepted */
+export interface Usage {
+    /** The number of messages accepted. */
+    messages: number
+
+    /** The number of messages multiplied by their recipients, which is what SES charges for. */
+    recipientMessages: number
+
+    /**
+     * The approximate size of the accepted messages, excluding anything SES adds such as headers
+     * or template content.
+     */
+    bytes: number
+}
+
+/** The account's sending quota and whether it can send */
+export interface AccountQuota {
+    /** The most emails the account may send in 24 hours. -1 means unlimited. */
+    max24HourSend: number
+
+    /** The most emails the account may send per second. */
+    maxSendRate: number
+
+    /** How many emails the account sent in the last 24 hours. */
+    sentLast24Hours: number
+
+    /** Whether the account may send emails. */
+    sendingEnabled: boolean
+}
+
+/** The subject and start of the body of an email, as plain text */
+export interface EmailPreview {
+    /** The subject of the email, with template variables replaced. */
+    subject: string
+
+    /**
+     * The start of the body, taken from the text part or converted from the HTML part if there's
+     * none, with template variables replaced.
+     */
+    body: string
+
+    /** Whether the body was cut short at `PREVIEW_LENGTH` characters. */
+    truncated: boolean
+}
+
+/** An error returned by the function */
+export interface APIError {
+    /** The error message */
+    message: string
+
+    /** The SES error code, such as `MessageRejected`, if SES returned the error */
+    code?: string
+
+    /** The index of the email the error belongs to, when sending several */
+    index?: number
+
+    /** The recipients of the email the error belongs to, when sending several */
+    destination?: Destination
+}
+
+/** An error described as an RFC 7807 problem details object */
+export interface Problem {
+    /** A URI identifying the kind of problem, such as `urn:lambda-ses:problem:MessageRejected` */
+    type: string
+
+    /** A short summary of the kind of problem, which is the SES error code for SES errors */
+    title: string
+
+    /** The HTTP status code suited to the problem */
+    status: number
+
+    /** The full error message */
+    detail: string
+
+    /** A URI identifying this occurrence of the problem, which is the SES request ID when known */
+    instance?: string
+}
+
+/** Milliseconds spent in each phase of an invocation */
+export interface PhaseTimings {
+    /** Decoding the event */
+    decode: number
+
+    /** Reloading settings and clients if they expired or the event asked to */
+    clientInit: number
+
+    /** Local processing before sending, such as validating emails and waiting on rate limits */
+    validate: number
+
+    /** Waiting on SES */
+    send: number
+
+    /** Building the output after sending, such as checking the quota */
+    respond: number
+}
+
+export interface OperationOutput {
+    operation: Operation | ""
+    usage: Usage | null
+
+    /** Non-fatal problems noticed while handling the request, such as a nearly used up quota */
+    warnings?: string[]
+
+    /**
+     * A stable code summarising the outcome:
+     *
+     * - `OK`: every email was accepted
+     * - `PARTIAL`: some emails were accepted and others failed
+     * - `VALIDATION_ERROR`: the input was invalid, so nothing was sent
+     * - `INTERNAL_ERROR`: the function failed for a reason other than the input or SES, such as
+     *   failing to load its settings or to offload emails to S3. It may succeed when retried
+     * - `THROTTLED`: SES throttled the request, or the sending quota was used up
+     * - `ACCOUNT_ERROR`: the account can't send, such as because it is suspended or paused, or the
+     *   sender isn't verified
+     * - `TEMPLATE_NOT_FOUND`: the template doesn't exist
+     * - `REJECTED`: SES rejected the message, or every recipient opted out
+     * - `SENDING_DISABLED`: `SENDING_DISABLED` is set
+     * - `SERVICE_ERROR`: SES couldn't be reached, failed with a server error, or didn't answer a bulk
+     *   email chunk within `BULK_CHUNK_TIMEOUT`
+     */
+    resultCode: ResultCode
+
+    /**
+     * Whether every email was accepted by SES. False if any email failed, including a single failed
+     * entry of an otherwise successful bulk email. Bulk entries skipped as duplicates don't count
+     * as failures.
+     */
+    success: boolean
+
+    /** The errors as RFC 7807 problem details. Only set when `PROBLEM_DETAILS` is enabled. */
+    problems?: Problem[]
+
+    /**
+     * The number of SES API calls made, including bulk chunks, retries, failover, and quota and
+     * suppression list checks
+     */
+    apiCallCount: number
+
+    /**
+     * The Retry-After hints SES returned in seconds, such as while throttling, including those of
+     * attempts retried internally by the AWS SDK
+     */
+    retryAfterSeconds?: number[]
+
+    /**
+     * The AWS request IDs of every SES call made, including bulk chunks, retries, and failover, for
+     * support escalations
+     */
+    requestIds?: string[]
+
+    /** The effective settings and default region, if `debugConfig` was set */
+    debugConfig?: {[key: string]: unknown}
+
+    /** The account's sending quota, if `getAccount` was set */
+    account?: AccountQuota
+
+    /** The subject and start of the body of the single email, if `preview` was set */
+    preview?: EmailPreview
+
+    /** The addresses looked up or listed on the suppression list */
+    suppression?: SuppressionOutput
+
+    /** The contacts listed on a contact list */
+    contacts?: ContactOutput
+
+    /**
+     * An input which resends only the emails or bulk entries that failed with a retryable error,
+     * such as throttling, if any did
+     */
+    retryPayload?: Input
+
+    /** Milliseconds spent in each phase of the invocation */
+    phaseTimings: PhaseTimings | null
+}
+
+export interface EmailOutput extends OperationOutput {
     email: SendEmailOutput | null
-    error: string | null
+    error: APIError | null
 }
 
-export interface EmailsOutput {
+export interface EmailsOutput extends OperationOutput {
     emails: SendEmailOutput[] | null
-    errors: string[] | null
+    errors: APIError[] | null
+
+    /** Number of failed emails grouped by reason, such as an SES error code */
+    errorSummary?: {[reason: string]: number}
+
+    /**
+     * Where an oversized emails array was written. Its emails are sent by the invocation S3
+     * triggers once it's stored, and their results are logged
+     */
+    offloadLocation?: string
 }
 
-export interface BulkEmailOutput {
+export interface BulkEmailOutput extends OperationOutput {
     bulkEmail: SendBulkEmailOutput | null
-    bulkEmailError: string | null
+    bulkEmailError: APIError | null
 }
 
 export interface Output extends EmailOutput, EmailsOutput, BulkEmailOutput {}
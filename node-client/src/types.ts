@@ -22,7 +22,14 @@ export interface Content {
 
 /** Represents the raw content of an email message. */
 export interface RawMessage {
-    data: ArrayBuffer
+    /** The MIME message, either base64 encoded or plain. */
+    data: ArrayBuffer | string
+
+    /**
+     * Whether `data` is base64 encoded. When unset, `data` is decoded if it's valid base64, and
+     * used as plain MIME otherwise.
+     */
+    isBase64?: boolean
 }
 
 /** Represents the body of the email message. */
@@ -127,6 +134,55 @@ export interface EmailContent {
 
     /** The template to use for the email message. */
     template?: Template
+
+    /**
+     * Files to attach to a simple message. The message is sent as a multipart/mixed MIME message
+     * built from the subject, body, and attachments.
+     */
+    attachments?: Attachment[]
+
+    /**
+     * Custom headers of a simple message, such as `X-Priority` or `List-Unsubscribe`. They're sent
+     * as SES message headers, or included in the MIME message when there are attachments. Headers
+     * with their own fields, such as `From`, `To`, and `Subject`, can't be set.
+     */
+    headers?: {[name: string]: string}
+}
+
+/** An attachment whose content looks like a different type than it was declared as */
+export interface ContentTypeMismatch {
+    /** The index of the attachment. */
+    index: number
+
+    /** The name of the attachment. */
+    filename: string
+
+    /** The media type the attachment was declared as. */
+    declared: string
+
+    /** The media type detected from the attachment's content. */
+    detected: string
+}
+
+/** A recipient found in only one of a raw message's headers and its destination */
+export interface RecipientMismatch {
+    /** The address of the recipient. */
+    address: string
+
+    /** Where the recipient is missing from. */
+    missingFrom: "headers" | "destination"
+}
+
+/** A file attached to a simple email */
+export interface Attachment {
+    /** The name of the file shown to recipients. */
+    filename: string
+
+    /** The media type of the file, such as `application/pdf`. */
+    contentType: string
+
+    /** The content of the file, base64 encoded. */
+    data: string
 }
 
 /**
@@ -248,6 +304,115 @@ export interface SendEmailInput {
      * each Reply-to address receives the reply.
      */
     replyTo?: string[]
+
+    /**
+     * Return a description of the MIME structure of the email, without its content, for
+     * debugging. Only available for raw emails and simple emails with attachments or headers,
+     * which are sent as raw emails.
+     */
+    debugMime?: boolean
+
+    /** The region to send through instead of the default region, such as `eu-west-1`. */
+    region?: string
+}
+
+/** A recipient on the account suppression list, which SES will likely not deliver to */
+export interface SuppressedRecipient {
+    /** The suppressed email address. */
+    address: string
+
+    /** Why the address was suppressed. */
+    reason: "BOUNCE" | "COMPLAINT"
+
+    /** When the address was added to the suppression list. Only set when managing the list. */
+    lastUpdateTime?: string
+}
+
+/** A description of a part of a MIME message, without its content */
+export interface MimePart {
+    /** The media type of the part, such as text/html or multipart/alternative. */
+    contentType: string
+
+    /** The Content-Transfer-Encoding of the part, such as base64 or quoted-printable. */
+    encoding?: string
+
+    /** The Content-Disposition of the part, such as inline or attachment. */
+    disposition?: string
+
+    /** The filename of the part, if it is an attachment. */
+    filename?: string
+
+    /**
+     * The encoded size of the part's body in bytes. For multipart parts, this is the total size of
+     * their children.
+     */
+    size: number
+
+    /** The children of a multipart part. */
+    parts?: MimePart[]
+}
+
+/** Whether SES accepted an email for sending */
+export enum SendStatus {
+    /** SES accepted the email and returned its message ID. */
+    Accepted = "ACCEPTED",
+
+    /** SES accepted the email, but did not return a message ID. */
+    AcceptedPendingId = "ACCEPTED_PENDING_ID",
+
+    /** The email was not accepted, either because it was invalid or SES rejected it. */
+    Failed = "FAILED",
+
+    /** The email was valid, and was queued to be sent by a later invocation. */
+    Queued = "QUEUED",
+}
+
+/** Why a recipient was left out of a send */
+export enum DropReason {
+    /** The recipient opted out according to the configured opt-out checker. */
+    OptedOut = "OPTED_OUT",
+
+    /** The recipient's bulk entry was skipped as a duplicate of an earlier entry. */
+    DuplicateEntry = "DUPLICATE_ENTRY",
+}
+
+/** A recipient who was left out of a send */
+export interface DroppedRecipient {
+    /** The address of the recipient, masked if `MASK_DROPPED_RECIPIENTS` is enabled. */
+    address: string
+
+    /** Why the recipient was left out. */
+    reason: DropReason
+
+    /** The index of the recipient's bulk entry. Only set for bulk emails. */
+    index?: number
+}
+
+/** The feedback forwarding address and identity an email was actually sent with */
+export interface FeedbackForwarding {
+    /** The address bounces and complaints are forwarded to. */
+    emailAddress?: string
+
+    /** The ARN of the identity authorizing the feedback forwarding address. */
+    identityArn?: string
+
+    /** Whether the configured defaults were applied because the email specified neither. */
+    default: boolean
+}
+
+/**
+ * How many more tags fit on a message after its tags are applied, given SES's limits on the number
+ * of tags and the length of their names and values
+ */
+export interface TagCapacity {
+    /** How many more tags the message could have. */
+    remainingTags: number
+
+    /** The most characters a tag name may have. */
+    maxNameLength: number
+
+    /** The most characters a tag value may have. */
+    maxValueLength: number
 }
 
 /** A unique message ID that you receive when an email is accepted for sending. */
@@ -258,8 +423,352 @@ export interface SendEmailOutput {
      * message that you're trying to send has an attachment contains a virus, or when you send a
      * templated email that contains invalid personalization content, for example.
      */
-    messageId: string
+    messageId: string | null
+
+    /**
+     * Whether the email was accepted. An email can be accepted without a message ID, in which case
+     * `messageId` is null and the status is `ACCEPTED_PENDING_ID`.
+     */
+    status: SendStatus
+
+    /**
+     * The SES API operation the email was sent with, either `SendEmail`, or `SendBulkEmail` for
+     * templated emails batched by `BATCH_TEMPLATED_EMAILS`. Unset when the email never reached
+     * SES.
+     */
+    apiOperation?: "SendEmail" | "SendBulkEmail"
+
+    /**
+     * The region SES sent the email from. Only set when a fallback region is configured or the send
+     * set a region.
+     */
+    region?: string
+
+    /**
+     * The recipients the email was actually sent to, with domains converted to Punycode and
+     * repeated addresses removed.
+     */
+    resolvedDestination?: Destination
+
+    /** Every To, CC, and BCC recipient of the resolved destination, which the message ID covers. */
+    coveredRecipients?: string[]
+
+    /**
+     * Recipients on the account suppression list, which SES will likely not deliver to. Only
+     * checked when `CHECK_SUPPRESSION_LIST` is enabled.
+     */
+    suppressedRecipients?: SuppressedRecipient[]
+
+    /** The character set sent for each part of a simple email. */
+    charsets?: {
+        subject?: string
+        html?: string
+        text?: string
+    }
+
+    /**
+     * The Reply-To addresses the email was actually sent with, after defaults were applied and
+     * repeats were removed.
+     */
+    resolvedReplyTo?: string[]
+
+    /**
+     * The feedback forwarding address and identity actually used, after defaults were applied.
+     * Empty when SES forwards feedback to the From address.
+     */
+    feedbackForwardingResolved?: FeedbackForwarding
+
+    /** Recipients who opted out according to the configured opt-out checker, and weren't sent to. */
+    optedOutRecipients?: string[]
+
+    /**
+     * Attachments whose content looks like a different type than they were declared as. Only
+     * checked when `ATTACHMENT_SNIFF` is set.
+     */
+    contentTypeMismatches?: ContentTypeMismatch[]
+
+    /**
+     * Recipients found in only one of a raw message's headers and its destination. Only checked
+     * when `RAW_RECIPIENT_CHECK` is set.
+     */
+    recipientMismatches?: RecipientMismatch[]
+
+    /** The name, or ARN if no name was given, of the template the email was sent with. */
+    templateUsed?: string
+
+    /** How many more tags the email could have had, for callers building tags dynamically. */
+    tagCapacity?: TagCapacity
+
+    /**
+     * A hash of what the email sent to whom, which stays the same when an identical email is sent
+     * again, regardless of the order of addresses or the formatting of template data. Store it to
+     * detect duplicate sends across invocations.
+     */
+    fingerprint: string
+
+    /** Every recipient left out of the email, and why. */
+    droppedRecipients?: DroppedRecipient[]
+
+    /** The approximate size of the email's content in bytes, as supplied by the caller. */
+    sizeBytes: number
+
+    /** Milliseconds spent locally, such as validating the email and waiting on rate limits. */
+    processingMillis: number
+
+    /** Milliseconds spent waiting on SES. */
+    serviceMillis: number
+
+    /** The MIME structure of the email, if `debugMime` was set. */
+    mimeTree?: MimePart
+
+    /** The ID of the SES request, for tracing the send in SES and CloudTrail. */
+    requestId?: string
+}
+
+/** A CloudWatch dimension which sending metrics are published with */
+export interface CloudWatchDimension {
+    /** The name of the dimension. */
+    name: string
+
+    /** The value published when an email doesn't specify one. */
+    defaultValue: string
+
+    /** Where SES finds the value of the dimension. */
+    source: "MESSAGE_TAG" | "EMAIL_HEADER" | "LINK_TAG"
+}
+
+/**
+ * Attaches an SNS topic or CloudWatch destination to a configuration set, which receives the events
+ * of emails sent with the configuration set. Exactly one of `snsTopicArn` or `cloudWatchDimensions`
+ * is required.
+ */
+export interface CreateEventDestinationInput {
+    /** The name of the configuration set. */
+    configSetName: string
+
+    /** A name that identifies the event destination within the configuration set. */
+    name: string
+
+    /** The events sent to the destination. */
+    eventTypes: (
+        | "SEND"
+        | "REJECT"
+        | "BOUNCE"
+        | "COMPLAINT"
+        | "DELIVERY"
+        | "OPEN"
+        | "CLICK"
+        | "RENDERING_FAILURE"
+        | "DELIVERY_DELAY"
+        | "SUBSCRIPTION"
+    )[]
+
+    /** Whether the destination receives events. Defaults to true. */
+    enabled?: boolean
+
+    /** The ARN of the SNS topic events are published to. */
+    snsTopicArn?: string
+
+    /** The dimensions events are published to CloudWatch with. */
+    cloudWatchDimensions?: CloudWatchDimension[]
+}
+
+/** A configuration set to create, which emails are sent with to track their events */
+export interface CreateConfigSetInput {
+    /** The name of the configuration set. */
+    configSetName: string
+
+    /** The domain open and click tracking links point to, instead of an SES domain. */
+    customRedirectDomain?: string
+
+    /**
+     * Whether SES publishes the bounce and complaint rates of emails sent with the configuration
+     * set to CloudWatch.
+     */
+    reputationMetricsEnabled?: boolean
+
+    /** Whether emails can be sent with the configuration set. Defaults to true. */
+    sendingEnabled?: boolean
+
+    /**
+     * Why addresses are added to the account suppression list for emails sent with the
+     * configuration set. Leaving it out uses the account's settings, while an empty list adds no
+     * addresses.
+     */
+    suppressedReasons?: ("BOUNCE" | "COMPLAINT")[] | null
+}
+
+/**
+ * A configuration set to delete. Needs `ALLOW_ADMIN_OPERATIONS` to be set on the function, and
+ * `confirm` to prevent accidental deletion.
+ */
+export interface DeleteConfigSetInput {
+    /** The name of the configuration set. */
+    configSetName: string
+
+    /** Confirms deleting the configuration set and its event destinations. */
+    confirm: boolean
+}
+
+/** The suppression options to set on a configuration set */
+export interface ConfigSetSuppressionOptionsInput {
+    /** The name of the configuration set. */
+    configSetName: string
+
+    /**
+     * Why addresses are added to the account suppression list for emails sent with the
+     * configuration set. Leaving it out uses the account's settings, while an empty list adds no
+     * addresses.
+     */
+    suppressedReasons?: ("BOUNCE" | "COMPLAINT")[] | null
+}
+
+/** What to do with a template */
+export type TemplateAction = "create" | "update" | "delete"
+
+/**
+ * The content of a template to create or update, or the name of a template to delete. Creating or
+ * updating a template requires a subject and an HTML or text part.
+ */
+export interface TemplateInput {
+    /** The name of the template. */
+    name: string
+
+    /** The subject line of the email, which may contain replacement tags such as `{{name}}`. */
+    subject?: string
+
+    /** The HTML body of the email. */
+    html?: string
+
+    /** The body of the email for recipients whose email clients don't display HTML. */
+    text?: string
+}
+
+/** What to do with the account suppression list */
+export type SuppressionAction = "put" | "delete" | "get" | "list"
+
+/**
+ * An address to add to, remove from, or look up on the account suppression list, or a filter to list
+ * it with
+ */
+export interface SuppressionInput {
+    /** The address to add, remove, or look up. Required unless listing. */
+    address?: string
+
+    /** Why the address is added. Required when adding an address. */
+    reason?: "BOUNCE" | "COMPLAINT"
+
+    /** Only list addresses suppressed for these reasons. Lists every address when empty. */
+    reasons?: ("BOUNCE" | "COMPLAINT")[]
+
+    /** The token of the page to list, from the previous page's output. */
+    nextToken?: string
+
+    /** The most addresses to list in a page. */
+    pageSize?: number
+}
+
+/** The suppressed addresses which were looked up or listed */
+export interface SuppressionOutput {
+    /** The addresses found on the list. Empty when looking up an address which isn't suppressed. */
+    recipients: SuppressedRecipient[]
+
+    /** The token of the next page, if there are more addresses to list. */
+    nextToken?: string
+}
+
+/** What to do with a contact list */
+export type ContactAction = "createList" | "create" | "update" | "delete" | "list" | "deleteList"
+
+/** Whether contacts are subscribed to a topic */
+export type SubscriptionStatus = "OPT_IN" | "OPT_OUT"
+
+/** A topic of a contact list, which contacts subscribe to or unsubscribe from */
+export interface ContactTopic {
+    /** The name of the topic, as used by `listManagementOptions`. */
+    topicName: string
+
+    /** The name of the topic shown to contacts on the subscription preferences page. */
+    displayName: string
+
+    /** A description of the topic shown to contacts on the subscription preferences page. */
+    description?: string
+
+    /** Whether contacts are subscribed to the topic unless they say otherwise. */
+    defaultSubscriptionStatus: SubscriptionStatus
+}
+
+/** Whether a contact is subscribed to a topic */
+export interface TopicPreference {
+    /** The name of the topic. */
+    topicName: string
+
+    /** Whether the contact is subscribed to the topic. */
+    subscriptionStatus: SubscriptionStatus
+}
+
+/**
+ * A contact list to create or delete, a contact to add to, update on, or remove from a list, or a
+ * filter to list a list's contacts with
+ */
+export interface ContactInput {
+    /** The name of the contact list. */
+    contactListName: string
+
+    /** A description of the contact list. Only used when creating a list. */
+    description?: string
+
+    /** The topics of the contact list. Only used when creating a list. */
+    topics?: ContactTopic[]
+
+    /** The address of the contact. Required unless creating or listing a list. */
+    address?: string
+
+    /** Whether the contact is subscribed to each topic, overriding the topic's default. */
+    topicPreferences?: TopicPreference[]
+
+    /** Unsubscribe the contact from every topic of the list. */
+    unsubscribeAll?: boolean
+
+    /** Only list contacts with this subscription status. */
+    filteredStatus?: SubscriptionStatus
+
+    /** Only list contacts by their subscription to this topic, rather than to any topic. */
+    filteredTopicName?: string
+
+    /** The token of the page to list, from the previous page's output. */
+    nextToken?: string
+
+    /** The most contacts to list in a page. */
+    pageSize?: number
+
+    /**
+     * Confirms deleting the list and every contact on it, to prevent accidental deletion. Deleting
+     * a list also needs `ALLOW_ADMIN_OPERATIONS` to be set.
+     */
+    confirm?: boolean
+}
+
+/** A contact on a contact list */
+export interface Contact {
+    /** The address of the contact. */
+    address: string
+
+    /** Whether the contact is subscribed to each topic they set a preference for. */
+    topicPreferences: TopicPreference[]
+
+    /** Whether the contact is unsubscribed from every topic of the list. */
+    unsubscribeAll: boolean
+
+    /** When the contact was last updated. */
+    lastUpdatedTimestamp?: string
+}
+
+/** The contacts which were listed */
+export interface ContactOutput {
+    /** The contacts found on the list. */
+    contacts: Contact[]
 
-    /** Metadata pertaining to the operation's result. */
-    metaData?: {[key: string]: unknown}
+    /** The token of the next page, if there are more contacts to list. */
+    nextToken?: string
 }
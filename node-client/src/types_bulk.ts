@@ -7,7 +7,15 @@
  * @copyright 2021 - 2022 Luke Zhang
  */
 
-import {Destination, MessageTag, Template} from "./types"
+import {
+    Destination,
+    DroppedRecipient,
+    FeedbackForwarding,
+    MessageTag,
+    SuppressedRecipient,
+    TagCapacity,
+    Template,
+} from "./types"
 
 /** The status of a message sent using the SendBulkTemplatedEmail operation. */
 export enum BulkEmailStatus {
@@ -126,8 +134,11 @@ export interface SendBulkEmailInput {
     /** The list of bulk email entry objects. */
     entries: BulkEmailEntry[]
 
-    /** An object that contains the body of the message. You can specify a template message. */
-    defaultContent: BulkEmailContent
+    /**
+     * An object that contains the body of the message. You can specify a template message. Can be
+     * omitted if the function is configured with `DEFAULT_BULK_TEMPLATE`.
+     */
+    defaultContent?: BulkEmailContent
 
     /** The name of the configuration set to use when sending the email. */
     configSetName?: string
@@ -179,6 +190,9 @@ export interface SendBulkEmailInput {
      * each Reply-to address receives the reply.
      */
     replyTo?: string[]
+
+    /** The region to send through instead of the default region, such as `eu-west-1`. */
+    region?: string
 }
 
 /** The result of the SendBulkEmail operation of each specified BulkEmailEntry. */
@@ -194,9 +208,61 @@ export interface BulkEmailEntryResult {
 
     /** The status of a message sent using the SendBulkTemplatedEmail operation. */
     status: BulkEmailStatus
+
+    /**
+     * The approximate size of the entry's message in bytes, estimated from the default template data
+     * and the entry's replacement template data.
+     */
+    sizeBytes: number
+
+    /**
+     * The index of the entry in the bulk email's entries. Entries which weren't sent, such as
+     * duplicates, have no result, so this may differ from the result's own index.
+     */
+    index: number
+
+    /** The recipients the entry was sent to, after recipients who opted out were removed. */
+    recipients?: Destination
+
+    /**
+     * How many more tags the entry could have had after its replacement tags were merged with the
+     * default tags, for callers building tags dynamically.
+     */
+    tagCapacity?: TagCapacity
+
+    /**
+     * The entry's recipients on the account suppression list, which SES will likely not deliver
+     * to. Only checked when `CHECK_SUPPRESSION_LIST` is enabled.
+     */
+    suppressedRecipients?: SuppressedRecipient[]
 }
 
 /** The following data is returned in JSON format by the service. */
+export interface DuplicateRecipient {
+    /** The index of the duplicate entry. */
+    index: number
+
+    /** The index of the first entry sent to the same address. */
+    firstIndex: number
+
+    /** The duplicated address. */
+    address: string
+
+    /** Whether the entry was left out of the request. */
+    skipped: boolean
+}
+
+export interface OptedOutEntry {
+    /** The index of the entry. */
+    index: number
+
+    /** The recipients who opted out and were removed from the entry. */
+    addresses: string[]
+
+    /** Whether every recipient opted out, so the entry was left out of the request. */
+    skipped: boolean
+}
+
 export interface SendBulkEmailOutput {
     /**
      * One object per intended recipient. Check each response object and retry any messages with a
@@ -204,6 +270,99 @@ export interface SendBulkEmailOutput {
      */
     result: BulkEmailEntryResult[]
 
-    /** Metadata pertaining to the operation's result. */
-    metaData?: {[key: string]: unknown}
+    /**
+     * The region SES sent the emails from. Only set when a fallback region is configured or the send
+     * set a region.
+     */
+    region?: string
+
+    /**
+     * Entries sent to the same first To address as an earlier entry. Skipped entries have no
+     * result, so results only line up with the entries which were sent.
+     */
+    duplicateRecipients?: DuplicateRecipient[]
+
+    /**
+     * The indices of entries without replacement template data, even though the template uses
+     * variables. Only checked when `REPLACEMENT_DATA_CHECK` is set.
+     */
+    entriesMissingData?: number[]
+
+    /**
+     * The Reply-To addresses the emails were actually sent with, after defaults were applied and
+     * repeats were removed.
+     */
+    resolvedReplyTo?: string[]
+
+    /**
+     * The feedback forwarding address and identity actually used, after defaults were applied.
+     * Empty when SES forwards feedback to the From address.
+     */
+    feedbackForwardingResolved?: FeedbackForwarding
+
+    /**
+     * Entries with recipients who opted out according to the configured opt-out checker. Entries
+     * without any other recipients are skipped, like duplicates.
+     */
+    optedOutEntries?: OptedOutEntry[]
+
+    /**
+     * The name, or ARN if no name was given, of the template the emails were sent with, which is
+     * `DEFAULT_BULK_TEMPLATE` when no default content was given.
+     */
+    templateUsed?: string
+
+    /**
+     * A hash of what the emails sent to whom, which stays the same when identical emails are sent
+     * again, regardless of the order of addresses or the formatting of template data.
+     */
+    fingerprint: string
+
+    /** Every recipient left out of the emails, and why. */
+    droppedRecipients?: DroppedRecipient[]
+
+    /**
+     * Where the entry results were written in chunks, if there were more than
+     * `RESULT_OFFLOAD_THRESHOLD`. The results are left out of the output when they're offloaded.
+     */
+    resultChunks?: ResultChunk[]
+
+    /** A count of the offloaded entry results by status. */
+    resultSummary?: ResultSummary
+
+    /** Milliseconds spent locally, such as validating the email and waiting on rate limits. */
+    processingMillis: number
+
+    /** Milliseconds spent waiting on SES. */
+    serviceMillis: number
+
+    /** The ID of the SES request, for tracing the send in SES and CloudTrail. */
+    requestId?: string
+}
+
+/** A chunk of bulk entry results written to the payload store */
+export interface ResultChunk {
+    /** Where the chunk was written, such as an `s3://` URI. */
+    location: string
+
+    /** The index of the chunk's first result among every result. */
+    start: number
+
+    /** How many results the chunk has. */
+    count: number
+}
+
+/** A count of bulk entry results, for callers which don't need each result */
+export interface ResultSummary {
+    /** How many results there are. */
+    total: number
+
+    /** How many entries SES accepted. */
+    succeeded: number
+
+    /** How many entries failed. */
+    failed: number
+
+    /** How many results have each status. */
+    statuses: {[status in BulkEmailStatus]?: number}
 }
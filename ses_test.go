@@ -0,0 +1,220 @@
+// A fake SES endpoint for tests, so sends can be checked without calling AWS
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sesv2 "github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+	"github.com/talentmaker/lambda-ses/sesmail"
+)
+
+// A request received by the fake SES endpoint
+type fakeRequest struct {
+	Method string
+	Path   string
+	Body   string
+}
+
+// Answers every SES request with the response of respond, recording the requests
+type fakeSES struct {
+	respond func(request fakeRequest) (int, string)
+
+	// Extra headers of every response
+	header http.Header
+
+	mutex    sync.Mutex
+	requests []fakeRequest
+}
+
+func (fake *fakeSES) Do(request *http.Request) (*http.Response, error) {
+	var body []byte
+
+	if request.Body != nil {
+		read, err := io.ReadAll(request.Body)
+
+		if err != nil {
+			return nil, err
+		}
+
+		body = read
+	}
+
+	received := fakeRequest{Method: request.Method, Path: request.URL.Path, Body: string(body)}
+
+	fake.mutex.Lock()
+	fake.requests = append(fake.requests, received)
+	fake.mutex.Unlock()
+
+	status, response := fake.respond(received)
+	header := http.Header{"Content-Type": []string{"application/json"}}
+
+	for name, values := range fake.header {
+		header[name] = values
+	}
+
+	return &http.Response{
+		StatusCode: status,
+		Header:     header,
+		Body:       io.NopCloser(bytes.NewReader([]byte(response))),
+		Request:    request,
+	}, nil
+}
+
+func (fake *fakeSES) Requests() []fakeRequest {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	return append([]fakeRequest(nil), fake.requests...)
+}
+
+// Points the package's SES client at a fake endpoint for the rest of the test
+func useFakeSES(respond func(request fakeRequest) (int, string)) *fakeSES {
+	fake := &fakeSES{respond: respond}
+	ses = sesv2.New(sesv2.Options{
+		Region:     "us-east-1",
+		HTTPClient: fake,
+		Retryer:    aws.NopRetryer{},
+		Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "test", SecretAccessKey: "test"}, nil
+		}),
+	})
+
+	return fake
+}
+
+// Accepts every email, answering bulk sends with a successful result for each entry
+func acceptAll(request fakeRequest) (int, string) {
+	if strings.HasSuffix(request.Path, "/outbound-bulk-emails") {
+		results := strings.Repeat(`{"Status":"SUCCESS","MessageId":"bulk-id"},`, strings.Count(request.Body, `"Destination"`))
+
+		return 200, `{"BulkEmailEntryResults":[` + strings.TrimSuffix(results, ",") + `]}`
+	}
+
+	return 200, `{"MessageId":"message-id"}`
+}
+
+// A simple email from from@example.com to a single recipient
+func simpleEmail(to string) *sesmail.SendEmailInput {
+	return &sesmail.SendEmailInput{
+		Content: &sesmail.EmailContent{
+			Simple: &sesmail.Message{
+				Subject: &sesmail.Content{Data: aws.String("Subject")},
+				Body:    &sesmail.Body{Text: &sesmail.Content{Data: aws.String("Body")}},
+			},
+		},
+		Destination:      &sesmail.Destination{ToAddresses: []string{to}},
+		FromEmailAddress: aws.String("from@example.com"),
+	}
+}
+
+// A bulk email with a default template and an entry for each recipient
+func bulkEmail(recipients ...string) *sesmail.SendBulkEmailInput {
+	input := &sesmail.SendBulkEmailInput{
+		FromEmailAddress: aws.String("from@example.com"),
+		DefaultContent:   &sesmail.BulkEmailContent{Template: &sesmail.Template{TemplateName: aws.String("template")}},
+	}
+
+	for _, recipient := range recipients {
+		input.BulkEmailEntries = append(input.BulkEmailEntries, sesmail.BulkEmailEntry{
+			Destination: &sesmail.Destination{ToAddresses: []string{recipient}},
+		})
+	}
+
+	return input
+}
+
+// Calls the handler with the event encoded as JSON, like Lambda does
+func invoke(t *testing.T, event HandlerInput) (HandlerOutput, error) {
+	payload, err := json.Marshal(event)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return LambdaHandler(context.Background(), payload)
+}
+
+// A sesmail.Client which accepts every email without calling SES, recording what it was sent.
+// Operations it doesn't override panic through the nil Client.
+type mockClient struct {
+	sesmail.Client
+
+	region string
+
+	// Returned by every send instead of accepting it, if set
+	err error
+
+	mutex          sync.Mutex
+	sentEmails     []*sesv2.SendEmailInput
+	sentBulkEmails []*sesv2.SendBulkEmailInput
+}
+
+func (client *mockClient) SendEmail(
+	ctx context.Context,
+	params *sesv2.SendEmailInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.SendEmailOutput, error) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.sentEmails = append(client.sentEmails, params)
+
+	if client.err != nil {
+		return nil, client.err
+	}
+
+	return &sesv2.SendEmailOutput{MessageId: aws.String(client.region + "-message")}, nil
+}
+
+func (client *mockClient) SendBulkEmail(
+	ctx context.Context,
+	params *sesv2.SendBulkEmailInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.SendBulkEmailOutput, error) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.sentBulkEmails = append(client.sentBulkEmails, params)
+
+	if client.err != nil {
+		return nil, client.err
+	}
+
+	output := &sesv2.SendBulkEmailOutput{}
+
+	for range params.BulkEmailEntries {
+		output.BulkEmailEntryResults = append(output.BulkEmailEntryResults, types.BulkEmailEntryResult{
+			MessageId: aws.String(client.region + "-message"),
+			Status:    types.BulkEmailStatusSuccess,
+		})
+	}
+
+	return output, nil
+}
+
+// Makes the handler create mock clients when it loads its config, returning the clients by region
+func useMockClients(t *testing.T) map[string]*mockClient {
+	previous := newClient
+	t.Cleanup(func() { newClient = previous })
+
+	clients := map[string]*mockClient{}
+	newClient = func(options sesv2.Options) sesmail.Client {
+		client := &mockClient{region: options.Region}
+		clients[options.Region] = client
+
+		return client
+	}
+
+	return clients
+}
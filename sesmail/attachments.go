@@ -0,0 +1,109 @@
+// Checks on the attachments of emails
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"fmt"
+	"mime"
+	"strings"
+)
+
+// Attachment content types allowed when ALLOWED_ATTACHMENT_TYPES is not set. An entry ending in
+// "*" matches every content type starting with the rest of the entry.
+var defaultAllowedAttachmentTypes = []string{
+	"text/*",
+	"image/*",
+	"audio/*",
+	"video/*",
+	"application/pdf",
+	"application/json",
+	"application/zip",
+	"application/msword",
+	"application/vnd.ms-excel",
+	"application/vnd.ms-powerpoint",
+	"application/vnd.openxmlformats-officedocument.*",
+	"application/vnd.oasis.opendocument.*",
+	"message/rfc822",
+}
+
+// Checks that an attachment's content type is in the configured allowlist, or the default one when
+// none is configured
+func validateAttachmentType(contentType string) error {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+
+	if err != nil {
+		return fmt.Errorf("Attachment content type %q is invalid: %w", contentType, err)
+	}
+
+	allowlist := Settings.AllowedAttachmentTypes
+
+	if allowlist == nil {
+		allowlist = defaultAllowedAttachmentTypes
+	}
+
+	for _, allowed := range allowlist {
+		allowed = strings.ToLower(allowed)
+
+		if allowed == mediaType ||
+			(strings.HasSuffix(allowed, "*") && strings.HasPrefix(mediaType, strings.TrimSuffix(allowed, "*"))) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("Attachment content type %q is not allowed", mediaType)
+}
+
+// Checks the content type of every attachment in a raw MIME message. Messages which can't be parsed
+// are left for SES to reject.
+func validateRawMessageAttachments(data []byte) error {
+	tree, err := parseMimeTree(data)
+
+	if err != nil {
+		return nil
+	}
+
+	return validateMimeTreeAttachments(tree)
+}
+
+func validateMimeTreeAttachments(part *MimePart) error {
+	if part.Disposition == "attachment" {
+		if err := validateAttachmentType(part.ContentType); err != nil {
+			return err
+		}
+	}
+
+	for _, child := range part.Parts {
+		if err := validateMimeTreeAttachments(child); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Returns the combined encoded size of the attachments in a raw MIME message. Messages which can't
+// be parsed count as having none, and are left for SES to reject.
+func rawMessageAttachmentBytes(data []byte) int {
+	tree, err := parseMimeTree(data)
+
+	if err != nil {
+		return 0
+	}
+
+	return int(mimeTreeAttachmentBytes(tree))
+}
+
+func mimeTreeAttachmentBytes(part *MimePart) int64 {
+	if part.Disposition == "attachment" {
+		return part.Size
+	}
+
+	var size int64
+
+	for _, child := range part.Parts {
+		size += mimeTreeAttachmentBytes(child)
+	}
+
+	return size
+}
@@ -0,0 +1,118 @@
+// Tests for checks on the attachments of emails
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// A multipart/mixed message with a text body and an attachment of the content type
+func rawMessageWithAttachment(contentType string) []byte {
+	return []byte(strings.Join([]string{
+		"From: from@example.com",
+		"To: to@example.com",
+		"Subject: Attachment",
+		"MIME-Version: 1.0",
+		`Content-Type: multipart/mixed; boundary="boundary"`,
+		"",
+		"--boundary",
+		"Content-Type: text/plain",
+		"",
+		"See the attachment.",
+		"--boundary",
+		"Content-Type: " + contentType,
+		`Content-Disposition: attachment; filename="file"`,
+		"Content-Transfer-Encoding: base64",
+		"",
+		"aGVsbG8=",
+		"--boundary--",
+		"",
+	}, "\r\n"))
+}
+
+func TestValidateAttachmentType(t *testing.T) {
+	useSettings(t, Config{AllowedAttachmentTypes: defaultAllowedAttachmentTypes})
+
+	for _, test := range []struct {
+		contentType string
+		allowed     bool
+	}{
+		{"application/pdf", true},
+		{"image/png", true},
+		{"text/csv; charset=utf-8", true},
+		{"application/vnd.openxmlformats-officedocument.wordprocessingml.document", true},
+		{"application/x-msdownload", false},
+		{"application/javascript", false},
+		{"application/x-sh", false},
+		{"not a content type;;", false},
+	} {
+		t.Run(test.contentType, func(t *testing.T) {
+			err := validateAttachmentType(test.contentType)
+
+			if test.allowed && err != nil {
+				t.Errorf("expected %s to be allowed, got %v", test.contentType, err)
+			} else if !test.allowed && err == nil {
+				t.Errorf("expected %s to be rejected", test.contentType)
+			}
+		})
+	}
+}
+
+func TestValidateAttachmentTypeConfiguredList(t *testing.T) {
+	useSettings(t, Config{AllowedAttachmentTypes: []string{"application/pdf"}})
+
+	if err := validateAttachmentType("image/png"); err == nil {
+		t.Error("expected types outside the configured list to be rejected")
+	}
+
+	useSettings(t, Config{AllowedAttachmentTypes: []string{"*"}})
+
+	if err := validateAttachmentType("application/x-msdownload"); err != nil {
+		t.Errorf("expected * to allow everything, got %v", err)
+	}
+}
+
+func TestValidateAttachmentTypeDefaultList(t *testing.T) {
+	useSettings(t, Config{})
+
+	if err := validateAttachmentType("text/plain"); err != nil {
+		t.Errorf("expected the default list to allow text/plain, got %v", err)
+	} else if err := validateAttachmentType("application/x-msdownload"); err == nil {
+		t.Error("expected the default list to reject application/x-msdownload")
+	}
+
+	useSettings(t, Config{AllowedAttachmentTypes: []string{}})
+
+	if err := validateAttachmentType("text/plain"); err == nil {
+		t.Error("expected an empty list to reject every type")
+	}
+}
+
+func TestSendEmailChecksRawAttachments(t *testing.T) {
+	useSettings(t, Config{AllowedAttachmentTypes: defaultAllowedAttachmentTypes})
+
+	for _, test := range []struct {
+		contentType string
+		allowed     bool
+	}{
+		{"application/pdf", true},
+		{"application/x-msdownload", false},
+	} {
+		t.Run(test.contentType, func(t *testing.T) {
+			client := &fakeClient{}
+			input := simpleEmail("to@example.com")
+			input.Content = &EmailContent{Raw: &RawMessage{Data: rawMessageWithAttachment(test.contentType)}}
+
+			_, err := SendEmail(context.Background(), client, input)
+
+			if test.allowed && (err != nil || len(client.SentEmails()) != 1) {
+				t.Errorf("expected the email to be sent, got %v", err)
+			} else if !test.allowed && (err == nil || len(client.SentEmails()) != 0) {
+				t.Error("expected the email to be rejected before sending")
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+// Audit trail of every email handed to SES
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A record of a single email handed to SES, whether or not it was accepted
+type AuditReceipt struct {
+
+	// The SES operation used to send the email, such as SendEmail or SendBulkEmail.
+	Operation string `json:"operation"`
+
+	// The message ID returned by SES, if the email was accepted.
+	MessageId *string `json:"messageId"`
+
+	// The reason SES did not accept the email, if it was not accepted.
+	Error *string `json:"error"`
+
+	// The "From" address of the email.
+	FromEmailAddress *string `json:"from"`
+
+	// The recipients of the email.
+	Destination *Destination `json:"dest"`
+
+	// The name of the configuration set used when sending the email.
+	ConfigurationSetName *string `json:"configSetName"`
+
+	// When the email was handed to SES.
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Records every send to an external system for compliance. Sinks receive the full recipients and
+// errors, and an error returned by Record is logged without affecting the send.
+type AuditSink interface {
+	Record(ctx context.Context, receipt *AuditReceipt) error
+}
+
+// An audit sink which discards every receipt
+type NoopAuditSink struct{}
+
+func (NoopAuditSink) Record(context.Context, *AuditReceipt) error {
+	return nil
+}
+
+// An audit sink which writes each receipt as a line of JSON, such as to stdout so it ends up in
+// CloudWatch Logs. Since that's where send logs go, recipients are masked like theirs when
+// LOG_REDACT_PII is set.
+type JSONAuditSink struct {
+	Writer io.Writer
+
+	mutex sync.Mutex
+}
+
+func (sink *JSONAuditSink) Record(_ context.Context, receipt *AuditReceipt) error {
+	if Settings.LogRedactPII {
+		receipt = redactReceipt(receipt)
+	}
+
+	encoded, err := json.Marshal(receipt)
+
+	if err != nil {
+		return err
+	}
+
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+
+	_, err = sink.Writer.Write(append(encoded, '\n'))
+
+	return err
+}
+
+// Where PayloadStoreAuditSink stores receipts, kept apart from offloaded emails so S3 event
+// notifications for those don't pick them up
+const auditPrefix = "audit/"
+
+// An audit sink which stores each receipt as a JSON object in a payload store, such as the
+// OFFLOAD_BUCKET, under audit/ and the day the email was handed to SES. Receipts are stored whole,
+// since the store isn't a log.
+type PayloadStoreAuditSink struct {
+	Store PayloadStore
+
+	// Receipts stored so far, which keeps the keys of receipts with the same timestamp apart
+	count int64
+}
+
+func (sink *PayloadStoreAuditSink) Record(ctx context.Context, receipt *AuditReceipt) error {
+	encoded, err := json.Marshal(receipt)
+
+	if err != nil {
+		return err
+	}
+
+	key := fmt.Sprintf(
+		"%s%s/%d-%d.json",
+		auditPrefix,
+		receipt.Timestamp.UTC().Format("2006-01-02"),
+		receipt.Timestamp.UnixNano(),
+		atomic.AddInt64(&sink.count, 1),
+	)
+	_, err = sink.Store.Store(ctx, key, encoded)
+
+	return err
+}
+
+// Returns a copy of a receipt with its recipients masked, including those in its error
+func redactReceipt(receipt *AuditReceipt) *AuditReceipt {
+	redacted := *receipt
+
+	if receipt.Destination != nil {
+		redacted.Destination = &Destination{
+			ToAddresses:  maskAddresses(receipt.Destination.ToAddresses),
+			CcAddresses:  maskAddresses(receipt.Destination.CcAddresses),
+			BccAddresses: maskAddresses(receipt.Destination.BccAddresses),
+		}
+	}
+
+	if receipt.Error != nil {
+		message := redactAddresses(*receipt.Error)
+		redacted.Error = &message
+	}
+
+	return &redacted
+}
+
+// The sink every send is recorded to
+var Audit AuditSink = NoopAuditSink{}
+
+func recordAudit(ctx context.Context, receipt *AuditReceipt) {
+	if err := Audit.Record(ctx, receipt); err != nil {
+		log.Printf("failed to record audit receipt, %v", err)
+	}
+}
+
+func errorString(err error) *string {
+	if err == nil {
+		return nil
+	}
+
+	message := err.Error()
+
+	return &message
+}
@@ -0,0 +1,187 @@
+// Tests for the audit trail of emails handed to SES
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sesv2 "github.com/aws/aws-sdk-go-v2/service/sesv2"
+)
+
+// Keeps every receipt recorded through it
+type recordingAuditSink struct {
+	mutex    sync.Mutex
+	receipts []*AuditReceipt
+}
+
+func (sink *recordingAuditSink) Record(_ context.Context, receipt *AuditReceipt) error {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+
+	sink.receipts = append(sink.receipts, receipt)
+
+	return nil
+}
+
+func useRecordingAuditSink(t *testing.T) *recordingAuditSink {
+	sink := &recordingAuditSink{}
+	Audit = sink
+	t.Cleanup(func() { Audit = NoopAuditSink{} })
+
+	return sink
+}
+
+func TestAuditRecordsEachSend(t *testing.T) {
+	sink := useRecordingAuditSink(t)
+
+	_, errs := SendEmails(
+		context.Background(),
+		&fakeClient{},
+		[]*SendEmailInput{simpleEmail("a@example.com"), simpleEmail("b@example.com")},
+	)
+
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	} else if len(sink.receipts) != 2 {
+		t.Fatalf("expected a receipt per send, got %d", len(sink.receipts))
+	}
+
+	for index, to := range []string{"a@example.com", "b@example.com"} {
+		receipt := sink.receipts[index]
+
+		if receipt.Operation != "SendEmail" || aws.ToString(receipt.MessageId) != fmt.Sprintf("message-%d", index+1) ||
+			receipt.Error != nil || receipt.Destination.ToAddresses[0] != to {
+			t.Errorf("unexpected receipt %+v", receipt)
+		}
+	}
+}
+
+func TestAuditRecordsFailedSends(t *testing.T) {
+	client := &fakeClient{sendEmail: func(context.Context, *sesv2.SendEmailInput) (*sesv2.SendEmailOutput, error) {
+		return nil, errors.New("Email address is not verified.")
+	}}
+	sink := useRecordingAuditSink(t)
+
+	if _, err := SendEmail(context.Background(), client, simpleEmail("a@example.com")); err == nil {
+		t.Fatal("expected the send to fail")
+	} else if len(sink.receipts) != 1 || sink.receipts[0].Error == nil || sink.receipts[0].MessageId != nil {
+		t.Errorf("expected a receipt with the error, got %+v", sink.receipts)
+	}
+}
+
+func TestAuditRecordsEachBulkEntry(t *testing.T) {
+	sink := useRecordingAuditSink(t)
+
+	_, err := SendBulkEmail(context.Background(), &fakeClient{}, bulkEmail("a@example.com", "b@example.com"))
+
+	if err != nil {
+		t.Fatal(err)
+	} else if len(sink.receipts) != 2 {
+		t.Fatalf("expected a receipt per entry, got %d", len(sink.receipts))
+	}
+
+	for index, to := range []string{"a@example.com", "b@example.com"} {
+		if receipt := sink.receipts[index]; receipt.Operation != "SendBulkEmail" ||
+			aws.ToString(receipt.MessageId) != "bulk-"+to {
+			t.Errorf("unexpected receipt %+v", receipt)
+		}
+	}
+}
+
+func TestJSONAuditSinkWritesLines(t *testing.T) {
+	var output bytes.Buffer
+	sink := &JSONAuditSink{Writer: &output}
+
+	for _, id := range []string{"first", "second"} {
+		if err := sink.Record(context.Background(), &AuditReceipt{MessageId: aws.String(id)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+
+	if len(lines) != 2 {
+		t.Fatalf("expected a line per receipt, got %q", output.String())
+	}
+
+	var receipt AuditReceipt
+
+	if err := json.Unmarshal([]byte(lines[1]), &receipt); err != nil || aws.ToString(receipt.MessageId) != "second" {
+		t.Errorf("expected the second receipt, got %q", lines[1])
+	}
+}
+
+func TestPayloadStoreAuditSinkStoresReceipts(t *testing.T) {
+	useSettings(t, Config{LogRedactPII: true})
+
+	store := &resultStore{payloads: map[string][]byte{}}
+	sink := &PayloadStoreAuditSink{Store: store}
+	timestamp := time.Date(2022, 3, 4, 5, 6, 7, 0, time.UTC)
+
+	for _, id := range []string{"first", "second"} {
+		receipt := &AuditReceipt{
+			MessageId:   aws.String(id),
+			Destination: &Destination{ToAddresses: []string{"jane@example.com"}},
+			Timestamp:   timestamp,
+		}
+
+		if err := sink.Record(context.Background(), receipt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(store.keys) != 2 || store.keys[0] == store.keys[1] {
+		t.Fatalf("expected a key per receipt, got %q", store.keys)
+	} else if !strings.HasPrefix(store.keys[0], "audit/2022-03-04/") {
+		t.Errorf("expected the receipt under the day it was sent, got %q", store.keys[0])
+	}
+
+	var receipt AuditReceipt
+
+	if err := json.Unmarshal(store.payloads[store.keys[1]], &receipt); err != nil {
+		t.Fatal(err)
+	} else if aws.ToString(receipt.MessageId) != "second" {
+		t.Errorf("expected the second receipt, got %+v", receipt)
+	} else if expected := []string{"jane@example.com"}; !reflect.DeepEqual(receipt.Destination.ToAddresses, expected) {
+		t.Errorf("expected the recipients to be stored whole, got %q", receipt.Destination.ToAddresses)
+	}
+}
+
+func TestJSONAuditSinkRedactsRecipients(t *testing.T) {
+	useSettings(t, Config{LogRedactPII: true})
+
+	var output bytes.Buffer
+	receipt := &AuditReceipt{
+		Error:       aws.String("Email address is not verified: jane@example.com"),
+		Destination: &Destination{ToAddresses: []string{"jane@example.com"}, BccAddresses: []string{"bob@example.org"}},
+	}
+
+	if err := (&JSONAuditSink{Writer: &output}).Record(context.Background(), receipt); err != nil {
+		t.Fatal(err)
+	}
+
+	var written AuditReceipt
+
+	if err := json.Unmarshal(output.Bytes(), &written); err != nil {
+		t.Fatal(err)
+	} else if expected := []string{"j***@example.com"}; !reflect.DeepEqual(written.Destination.ToAddresses, expected) {
+		t.Errorf("expected %q, got %q", expected, written.Destination.ToAddresses)
+	} else if expected := []string{"b***@example.org"}; !reflect.DeepEqual(written.Destination.BccAddresses, expected) {
+		t.Errorf("expected %q, got %q", expected, written.Destination.BccAddresses)
+	} else if expected := "Email address is not verified: j***@example.com"; aws.ToString(written.Error) != expected {
+		t.Errorf("expected %q, got %q", expected, aws.ToString(written.Error))
+	} else if receipt.Destination.ToAddresses[0] != "jane@example.com" {
+		t.Errorf("expected the original receipt to be left unmasked, got %+v", receipt.Destination)
+	}
+}
@@ -0,0 +1,267 @@
+// Conversion of templated emails into bulk emails
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sesv2 "github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+)
+
+// The maximum number of entries SES accepts in a single SendBulkEmail request
+const maxBulkEmailEntries = 50
+
+// Converts emails into a single bulk email if they all use the same template and share every
+// parameter a bulk email can't vary per entry. Returns nil if the emails can't be converted.
+func templatedEmailsAsBulk(inputs []*SendEmailInput) *SendBulkEmailInput {
+	if len(inputs) == 0 {
+		return nil
+	}
+
+	first := inputs[0]
+
+	for _, input := range inputs {
+		if input == nil || !isTemplateOnly(input.Content) || input.ListManagementOptions != nil {
+			return nil
+		}
+
+		if !equalStrings(input.Content.Template.TemplateName, first.Content.Template.TemplateName) ||
+			!equalStrings(input.Content.Template.TemplateArn, first.Content.Template.TemplateArn) ||
+			!equalStrings(input.ConfigurationSetName, first.ConfigurationSetName) ||
+			!equalStrings(input.FeedbackForwardingEmailAddress, first.FeedbackForwardingEmailAddress) ||
+			!equalStrings(input.FeedbackForwardingEmailAddressIdentityArn, first.FeedbackForwardingEmailAddressIdentityArn) ||
+			!equalStrings(input.FromEmailAddress, first.FromEmailAddress) ||
+			!equalStrings(input.FromEmailAddressIdentityArn, first.FromEmailAddressIdentityArn) ||
+			!equalStrings(input.Region, first.Region) ||
+			!equalStringSlices(input.ReplyToAddresses, first.ReplyToAddresses) {
+			return nil
+		}
+	}
+
+	bulkInput := &SendBulkEmailInput{
+		DefaultContent: &BulkEmailContent{
+			Template: &Template{
+				TemplateArn:  first.Content.Template.TemplateArn,
+				TemplateData: aws.String("{}"),
+				TemplateName: first.Content.Template.TemplateName,
+			},
+		},
+
+		ConfigurationSetName:                      first.ConfigurationSetName,
+		FeedbackForwardingEmailAddress:            first.FeedbackForwardingEmailAddress,
+		FeedbackForwardingEmailAddressIdentityArn: first.FeedbackForwardingEmailAddressIdentityArn,
+		FromEmailAddress:                          first.FromEmailAddress,
+		FromEmailAddressIdentityArn:               first.FromEmailAddressIdentityArn,
+		ReplyToAddresses:                          first.ReplyToAddresses,
+		Region:                                    first.Region,
+	}
+
+	for _, input := range inputs {
+		entry := BulkEmailEntry{
+			Destination:     input.Destination,
+			ReplacementTags: input.EmailTags,
+		}
+
+		if input.Content.Template.TemplateData != nil {
+			entry.ReplacementEmailContent = &ReplacementEmailContent{
+				ReplacementTemplate: &ReplacementTemplate{
+					ReplacementTemplateData: input.Content.Template.TemplateData,
+				},
+			}
+		}
+
+		bulkInput.BulkEmailEntries = append(bulkInput.BulkEmailEntries, entry)
+	}
+
+	return bulkInput
+}
+
+// Sends a bulk email converted from individual emails in chunks SES accepts, mapping each entry
+// result back into the output of the email it was converted from by the result's index. Invalid
+// entries are left out of their chunk, so they fail on their own like individually sent emails
+// instead of failing the whole chunk. Entries skipped as duplicates or because every recipient
+// opted out have no result, so they're reported as errors instead.
+func sendEmailsAsBulk(
+	ctx context.Context,
+	client Client,
+	bulkInput *SendBulkEmailInput,
+) ([]*SendEmailOutput, []error) {
+	var outputs []*SendEmailOutput
+	var errs []error
+
+	for start := 0; start < len(bulkInput.BulkEmailEntries); start += maxBulkEmailEntries {
+		end := start + maxBulkEmailEntries
+
+		if end > len(bulkInput.BulkEmailEntries) {
+			end = len(bulkInput.BulkEmailEntries)
+		}
+
+		chunkInput := *bulkInput
+		chunkInput.BulkEmailEntries = nil
+		invalid := map[int]error{}
+		positions := map[int]int{}
+
+		for offset, entry := range bulkInput.BulkEmailEntries[start:end] {
+			if _, err := validateBulkEntry(bulkInput.DefaultEmailTags, entry); err != nil {
+				invalid[offset] = invalidInput(err)
+
+				continue
+			}
+
+			positions[offset] = len(chunkInput.BulkEmailEntries)
+			chunkInput.BulkEmailEntries = append(chunkInput.BulkEmailEntries, entry)
+		}
+
+		var output *SendBulkEmailOutput
+		var err error
+
+		if len(chunkInput.BulkEmailEntries) > 0 {
+			output, err = SendBulkEmail(ctx, client, &chunkInput)
+		}
+
+		results := map[int]BulkEmailEntryResult{}
+		skipped := map[int]error{}
+
+		if output != nil {
+			for _, result := range output.BulkEmailEntryResults {
+				results[result.Index] = result
+			}
+
+			for _, duplicate := range output.DuplicateRecipients {
+				if duplicate.Skipped {
+					skipped[duplicate.Index] = ErrDuplicateEntry
+				}
+			}
+
+			for _, optedOut := range output.OptedOutEntries {
+				if optedOut.Skipped {
+					skipped[optedOut.Index] = ErrAllRecipientsOptedOut
+				}
+			}
+		}
+
+		for offset, entry := range bulkInput.BulkEmailEntries[start:end] {
+			if invalidErr, ok := invalid[offset]; ok {
+				errs = append(errs, &EmailError{Index: start + offset, Destination: entry.Destination, Err: invalidErr})
+
+				continue
+			}
+
+			index := positions[offset]
+			result, ok := results[index]
+
+			if !ok {
+				entryErr := err
+
+				if skipErr, ok := skipped[index]; ok {
+					entryErr = skipErr
+				} else if entryErr == nil {
+					entryErr = errors.New("SES returned no result for the email")
+				}
+
+				errs = append(errs, &EmailError{Index: start + offset, Destination: entry.Destination, Err: entryErr})
+
+				continue
+			} else if result.Status != BulkEmailStatus(types.BulkEmailStatusSuccess) {
+				errs = append(errs, &EmailError{
+					Index:       start + offset,
+					Destination: entry.Destination,
+					Err:         &BulkEntryError{Status: result.Status, Message: aws.ToString(result.Error)},
+				})
+
+				continue
+			}
+
+			status := SendStatusAccepted
+
+			if result.MessageId == nil {
+				status = SendStatusAcceptedPendingId
+			}
+
+			destination := entry.Destination
+
+			if result.Recipients != nil {
+				destination = result.Recipients
+			}
+
+			outputs = append(outputs, &SendEmailOutput{
+				MessageId:                  result.MessageId,
+				Status:                     status,
+				ApiOperation:               "SendBulkEmail",
+				Region:                     output.Region,
+				ResolvedDestination:        destination,
+				CoveredRecipients:          destinationAddresses(destination),
+				ResolvedReplyTo:            output.ResolvedReplyTo,
+				FeedbackForwardingResolved: output.FeedbackForwardingResolved,
+				SuppressedRecipients:       result.SuppressedRecipients,
+				TemplateUsed:               output.TemplateUsed,
+				SizeBytes:                  result.SizeBytes,
+				ProcessingMillis:           output.ProcessingMillis,
+				ServiceMillis:              output.ServiceMillis,
+				RequestId:                  output.RequestId,
+				ResultMetadata:             output.ResultMetadata,
+			})
+		}
+	}
+
+	return outputs, errs
+}
+
+// Estimates the size of a bulk entry's message from the default template data and the entry's
+// replacement template data
+func bulkEntrySize(input *sesv2.SendBulkEmailInput, entry BulkEmailEntry) int {
+	size := replacementDataSize(entry)
+
+	if input.DefaultContent != nil && input.DefaultContent.Template != nil {
+		size += len(aws.ToString(input.DefaultContent.Template.TemplateData))
+	}
+
+	return size
+}
+
+func replacementDataSize(entry BulkEmailEntry) int {
+	if entry.ReplacementEmailContent == nil || entry.ReplacementEmailContent.ReplacementTemplate == nil {
+		return 0
+	}
+
+	return len(aws.ToString(entry.ReplacementEmailContent.ReplacementTemplate.ReplacementTemplateData))
+}
+
+// Whether content only has a template, so nothing is lost sending it as a bulk entry, which can't
+// have attachments or headers
+func isTemplateOnly(content *EmailContent) bool {
+	return content != nil &&
+		content.Template != nil &&
+		content.Body == nil &&
+		content.Subject == nil &&
+		content.Raw == nil &&
+		content.Simple == nil &&
+		len(content.Attachments) == 0 &&
+		len(content.Headers) == 0
+}
+
+func equalStrings(a *string, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return *a == *b
+}
+
+func equalStringSlices(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for index := range a {
+		if a[index] != b[index] {
+			return false
+		}
+	}
+
+	return true
+}
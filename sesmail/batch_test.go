@@ -0,0 +1,240 @@
+// Tests for conversion of templated emails into bulk emails
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestSendEmailsBatchesSameTemplate(t *testing.T) {
+	useSettings(t, Config{BatchTemplatedEmails: true})
+	client := &fakeClient{}
+
+	var inputs []*SendEmailInput
+
+	for index := 0; index < 120; index++ {
+		input := templatedEmail(fmt.Sprintf("user%d@example.com", index), "welcome")
+		input.Content.Template.TemplateData = aws.String(fmt.Sprintf(`{"index":%d}`, index))
+		inputs = append(inputs, input)
+	}
+
+	outputs, errs := SendEmails(context.Background(), client, inputs)
+
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	} else if len(client.SentEmails()) != 0 {
+		t.Error("expected no individual sends")
+	}
+
+	sent := client.SentBulkEmails()
+
+	if len(sent) != 3 || len(sent[0].BulkEmailEntries) != 50 || len(sent[2].BulkEmailEntries) != 20 {
+		t.Fatalf("expected chunks of 50, 50, and 20 entries, got %d requests", len(sent))
+	} else if aws.ToString(sent[0].DefaultContent.Template.TemplateName) != "welcome" {
+		t.Errorf("expected the shared template, got %+v", sent[0].DefaultContent.Template)
+	} else if data := sent[1].BulkEmailEntries[0].ReplacementEmailContent.ReplacementTemplate.ReplacementTemplateData; aws.ToString(data) != `{"index":50}` {
+		t.Errorf("expected each email's template data as replacement data, got %s", aws.ToString(data))
+	}
+
+	if len(outputs) != len(inputs) {
+		t.Fatalf("expected an output per email, got %d", len(outputs))
+	}
+
+	for index, output := range outputs {
+		to := inputs[index].Destination.ToAddresses[0]
+
+		if aws.ToString(output.MessageId) != "bulk-"+to || output.ResolvedDestination.ToAddresses[0] != to {
+			t.Errorf("expected output %d to belong to %s, got %+v", index, to, output)
+		}
+	}
+}
+
+func TestSendEmailsFallsBackToIndividualSends(t *testing.T) {
+	useSettings(t, Config{BatchTemplatedEmails: true})
+
+	for _, test := range []struct {
+		name   string
+		inputs []*SendEmailInput
+	}{
+		{"different templates", []*SendEmailInput{
+			templatedEmail("a@example.com", "welcome"),
+			templatedEmail("b@example.com", "goodbye"),
+		}},
+		{"simple content", []*SendEmailInput{
+			templatedEmail("a@example.com", "welcome"),
+			simpleEmail("b@example.com"),
+		}},
+		{"different senders", []*SendEmailInput{
+			templatedEmail("a@example.com", "welcome"),
+			func() *SendEmailInput {
+				input := templatedEmail("b@example.com", "welcome")
+				input.FromEmailAddress = aws.String("other@example.com")
+
+				return input
+			}(),
+		}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			client := &fakeClient{}
+			outputs, errs := SendEmails(context.Background(), client, test.inputs)
+
+			if len(errs) != 0 || len(outputs) != 2 {
+				t.Fatalf("expected 2 outputs, got %d and errors %v", len(outputs), errs)
+			} else if len(client.SentBulkEmails()) != 0 || len(client.SentEmails()) != 2 {
+				t.Errorf("expected individual sends, got %d bulk requests", len(client.SentBulkEmails()))
+			}
+		})
+	}
+}
+
+func TestSendEmailsDoesNotBatchAttachmentsOrHeaders(t *testing.T) {
+	useSettings(t, Config{BatchTemplatedEmails: true})
+
+	for _, test := range []struct {
+		name   string
+		modify func(*EmailContent)
+	}{
+		{"attachments", func(content *EmailContent) {
+			content.Attachments = []Attachment{{Filename: "notes.txt", ContentType: "text/plain", Data: []byte("notes")}}
+		}},
+		{"headers", func(content *EmailContent) {
+			content.Headers = map[string]string{"X-Campaign": "spring"}
+		}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			client := &fakeClient{}
+			inputs := []*SendEmailInput{
+				templatedEmail("a@example.com", "welcome"),
+				templatedEmail("b@example.com", "welcome"),
+			}
+
+			test.modify(inputs[1].Content)
+			SendEmails(context.Background(), client, inputs)
+
+			if len(client.SentBulkEmails()) != 0 {
+				t.Errorf("expected no bulk requests, since bulk entries can't carry %s", test.name)
+			}
+		})
+	}
+}
+
+func TestSendEmailsFailsOnlyInvalidBatchedEmails(t *testing.T) {
+	useSettings(t, Config{BatchTemplatedEmails: true})
+	client := &fakeClient{}
+	inputs := []*SendEmailInput{
+		templatedEmail("a@example.com", "welcome"),
+		templatedEmail("bad\n@example.com", "welcome"),
+		templatedEmail("c@example.com", "welcome"),
+	}
+
+	outputs, errs := SendEmails(context.Background(), client, inputs)
+	sent := client.SentBulkEmails()
+
+	if len(sent) != 1 || len(sent[0].BulkEmailEntries) != 2 {
+		t.Fatalf("expected the valid emails to be sent together, got %d requests", len(sent))
+	} else if len(outputs) != 2 || len(errs) != 1 {
+		t.Fatalf("expected 2 outputs and 1 error, got %d and %v", len(outputs), errs)
+	}
+
+	var emailErr *EmailError
+
+	if !errors.As(errs[0], &emailErr) || emailErr.Index != 1 {
+		t.Errorf("expected the error to belong to email 1, got %v", errs[0])
+	} else if ErrorResultCode(errs[0]) != ResultValidationError {
+		t.Errorf("expected a validation error, got %s", ErrorResultCode(errs[0]))
+	} else if aws.ToString(outputs[1].MessageId) != "bulk-c@example.com" {
+		t.Errorf("expected the third email's output to follow, got %+v", outputs[1])
+	}
+}
+
+func TestSendEmailsDoesNotBatchWhenDisabled(t *testing.T) {
+	useSettings(t, Config{})
+	client := &fakeClient{}
+
+	SendEmails(context.Background(), client, []*SendEmailInput{
+		templatedEmail("a@example.com", "welcome"),
+		templatedEmail("b@example.com", "welcome"),
+	})
+
+	if len(client.SentBulkEmails()) != 0 || len(client.SentEmails()) != 2 {
+		t.Error("expected individual sends while BATCH_TEMPLATED_EMAILS is off")
+	}
+}
+
+func TestSendEmailsReportsApiOperation(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		settings Config
+		inputs   []*SendEmailInput
+		expected string
+	}{
+		{"direct", Config{}, []*SendEmailInput{simpleEmail("a@example.com"), simpleEmail("b@example.com")}, "SendEmail"},
+		{
+			"batched",
+			Config{BatchTemplatedEmails: true},
+			[]*SendEmailInput{templatedEmail("a@example.com", "welcome"), templatedEmail("b@example.com", "welcome")},
+			"SendBulkEmail",
+		},
+		{
+			"not batched",
+			Config{BatchTemplatedEmails: true},
+			[]*SendEmailInput{templatedEmail("a@example.com", "welcome"), templatedEmail("b@example.com", "reminder")},
+			"SendEmail",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			useSettings(t, test.settings)
+
+			outputs, errs := SendEmails(context.Background(), &fakeClient{}, test.inputs)
+
+			if len(errs) != 0 {
+				t.Fatal(errs)
+			}
+
+			for index, output := range outputs {
+				if output.ApiOperation != test.expected {
+					t.Errorf("expected output %d to be sent with %s, got %q", index, test.expected, output.ApiOperation)
+				}
+			}
+		})
+	}
+}
+
+func TestSendBulkEmailReportsEntrySizes(t *testing.T) {
+	useSettings(t, Config{})
+
+	defaultData := `{"name":"friend"}`
+	input := bulkEmail("a@example.com", "b@example.com", "c@example.com")
+	input.DefaultContent.Template.TemplateData = aws.String(defaultData)
+
+	replacements := []string{"", `{"name":"Bo"}`, `{"name":"` + strings.Repeat("x", 1000) + `"}`}
+
+	for index, data := range replacements {
+		if data != "" {
+			input.BulkEmailEntries[index].ReplacementEmailContent = &ReplacementEmailContent{
+				ReplacementTemplate: &ReplacementTemplate{ReplacementTemplateData: aws.String(data)},
+			}
+		}
+	}
+
+	output, err := SendBulkEmail(context.Background(), &fakeClient{}, input)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for index, data := range replacements {
+		expected := len(defaultData) + len(data)
+
+		if size := output.BulkEmailEntryResults[index].SizeBytes; size != expected {
+			t.Errorf("expected entry %d to be %d bytes, got %d", index, expected, size)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// Retrying of bulk email entries which failed with a retryable status
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"time"
+
+	sesv2 "github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+)
+
+// Statuses retried when BULK_RETRY_STATUSES isn't set
+var defaultBulkRetryStatuses = []string{
+	string(types.BulkEmailStatusTransientFailure),
+	string(types.BulkEmailStatusAccountThrottled),
+}
+
+// How long to wait before the first retry, doubling with each attempt
+var bulkRetryDelay = 500 * time.Millisecond
+
+// Resends the entries of a bulk email whose results have a retryable status, up to
+// BulkRetryAttempts times, and merges the new results into the output. Stops early once the
+// context is done. Retries which fail outright leave the previous results in place.
+func retryBulkEmailEntries(
+	ctx context.Context,
+	client Client,
+	functionInput *sesv2.SendBulkEmailInput,
+	output *sesv2.SendBulkEmailOutput,
+) *sesv2.SendBulkEmailOutput {
+	if output == nil || Settings.BulkRetryAttempts <= 0 {
+		return output
+	}
+
+	delay := bulkRetryDelay
+
+	for attempt := 0; attempt < Settings.BulkRetryAttempts; attempt++ {
+		var indexes []int
+		var entries []types.BulkEmailEntry
+
+		for index, result := range output.BulkEmailEntryResults {
+			if index < len(functionInput.BulkEmailEntries) && isRetryableBulkStatus(result.Status) {
+				indexes = append(indexes, index)
+				entries = append(entries, functionInput.BulkEmailEntries[index])
+			}
+		}
+
+		if len(entries) == 0 {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return output
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+		retryInput := *functionInput
+		retryInput.BulkEmailEntries = entries
+
+		retryOutput, err := sendBulkEmailChunk(ctx, client, &retryInput)
+
+		if err != nil || retryOutput == nil {
+			continue
+		}
+
+		for retryIndex, result := range retryOutput.BulkEmailEntryResults {
+			if retryIndex < len(indexes) {
+				output.BulkEmailEntryResults[indexes[retryIndex]] = result
+			}
+		}
+	}
+
+	return output
+}
+
+func isRetryableBulkStatus(status types.BulkEmailStatus) bool {
+	for _, retryable := range Settings.BulkRetryStatuses {
+		if string(status) == retryable {
+			return true
+		}
+	}
+
+	return false
+}
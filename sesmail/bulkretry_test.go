@@ -0,0 +1,131 @@
+// Tests for retrying bulk email entries
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	sesv2 "github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+)
+
+// Retries without waiting, and with the default retryable statuses
+func useBulkRetries(t *testing.T, attempts int) {
+	previous := bulkRetryDelay
+	bulkRetryDelay = time.Millisecond
+	useSettings(t, Config{BulkRetryAttempts: attempts, BulkRetryStatuses: defaultBulkRetryStatuses})
+	t.Cleanup(func() { bulkRetryDelay = previous })
+}
+
+// A client which answers each entry with the statuses queued for its recipient, one per
+// attempt, and then with SUCCESS
+func statusClient(statuses map[string][]types.BulkEmailStatus) *fakeClient {
+	return &fakeClient{sendBulkEmail: func(_ context.Context, params *sesv2.SendBulkEmailInput) (*sesv2.SendBulkEmailOutput, error) {
+		output := acceptBulkEmail(params)
+
+		for index, entry := range params.BulkEmailEntries {
+			recipient := entry.Destination.ToAddresses[0]
+
+			if queued := statuses[recipient]; len(queued) > 0 {
+				output.BulkEmailEntryResults[index].Status = queued[0]
+				output.BulkEmailEntryResults[index].MessageId = nil
+				statuses[recipient] = queued[1:]
+			}
+		}
+
+		return output, nil
+	}}
+}
+
+func bulkStatuses(output *SendBulkEmailOutput) []BulkEmailStatus {
+	var statuses []BulkEmailStatus
+
+	for _, result := range output.BulkEmailEntryResults {
+		statuses = append(statuses, result.Status)
+	}
+
+	return statuses
+}
+
+func TestSendBulkEmailRetriesRetryableStatuses(t *testing.T) {
+	useBulkRetries(t, 2)
+
+	client := statusClient(map[string][]types.BulkEmailStatus{
+		"b@example.com": {types.BulkEmailStatusTransientFailure},
+		"c@example.com": {types.BulkEmailStatusAccountThrottled, types.BulkEmailStatusTransientFailure},
+		"d@example.com": {types.BulkEmailStatusMessageRejected},
+	})
+	output, err := SendBulkEmail(context.Background(), client, bulkEmail("a@example.com", "b@example.com", "c@example.com", "d@example.com"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []BulkEmailStatus{"SUCCESS", "SUCCESS", "SUCCESS", "MESSAGE_REJECTED"}
+
+	if statuses := bulkStatuses(output); !reflect.DeepEqual(statuses, expected) {
+		t.Errorf("expected %v, got %v", expected, statuses)
+	} else if message := *output.BulkEmailEntryResults[2].MessageId; message != "bulk-c@example.com" {
+		t.Errorf("expected the retried entry's message ID, got %s", message)
+	}
+
+	// The first request has every entry, then only the retryable ones
+	requests := client.SentBulkEmails()
+
+	if len(requests) != 3 || len(requests[1].BulkEmailEntries) != 2 || len(requests[2].BulkEmailEntries) != 1 {
+		t.Errorf("expected requests with 4, 2, and 1 entries, got %d requests", len(requests))
+	}
+}
+
+func TestSendBulkEmailStopsRetryingAfterAttempts(t *testing.T) {
+	useBulkRetries(t, 1)
+
+	client := statusClient(map[string][]types.BulkEmailStatus{
+		"a@example.com": {types.BulkEmailStatusTransientFailure, types.BulkEmailStatusTransientFailure},
+	})
+	output, err := SendBulkEmail(context.Background(), client, bulkEmail("a@example.com"))
+
+	if err != nil {
+		t.Fatal(err)
+	} else if statuses := bulkStatuses(output); !reflect.DeepEqual(statuses, []BulkEmailStatus{"TRANSIENT_FAILURE"}) {
+		t.Errorf("expected the last status to be kept, got %v", statuses)
+	} else if len(client.SentBulkEmails()) != 2 {
+		t.Errorf("expected 2 requests, got %d", len(client.SentBulkEmails()))
+	}
+}
+
+func TestSendBulkEmailDoesNotRetryByDefault(t *testing.T) {
+	useSettings(t, Config{BulkRetryStatuses: defaultBulkRetryStatuses})
+
+	client := statusClient(map[string][]types.BulkEmailStatus{
+		"a@example.com": {types.BulkEmailStatusTransientFailure},
+	})
+
+	if _, err := SendBulkEmail(context.Background(), client, bulkEmail("a@example.com")); err != nil {
+		t.Fatal(err)
+	} else if len(client.SentBulkEmails()) != 1 {
+		t.Errorf("expected 1 request, got %d", len(client.SentBulkEmails()))
+	}
+}
+
+func TestSendBulkEmailStopsRetryingWhenContextIsDone(t *testing.T) {
+	useBulkRetries(t, 3)
+	bulkRetryDelay = time.Hour
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	client := statusClient(map[string][]types.BulkEmailStatus{
+		"a@example.com": {types.BulkEmailStatusTransientFailure},
+	})
+
+	if _, err := SendBulkEmail(ctx, client, bulkEmail("a@example.com")); err != nil {
+		t.Fatal(err)
+	} else if len(client.SentBulkEmails()) != 1 {
+		t.Errorf("expected no retries, got %d requests", len(client.SentBulkEmails()))
+	}
+}
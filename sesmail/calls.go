@@ -0,0 +1,251 @@
+// Counting of the SES API calls made while handling a request
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"sync/atomic"
+
+	sesv2 "github.com/aws/aws-sdk-go-v2/service/sesv2"
+)
+
+// Counts the SES API calls made with a context, including bulk chunks, retries, and calls to a
+// fallback region. Retries made internally by the AWS SDK aren't counted.
+type APICallCounter struct {
+	count int64
+}
+
+// The number of SES API calls made so far
+func (counter *APICallCounter) Count() int64 {
+	return atomic.LoadInt64(&counter.count)
+}
+
+type apiCallCounterKey struct{}
+
+// Returns a context whose SES API calls through a CountingClient are counted by the counter
+func WithAPICallCounter(ctx context.Context, counter *APICallCounter) context.Context {
+	return context.WithValue(ctx, apiCallCounterKey{}, counter)
+}
+
+func countAPICall(ctx context.Context) {
+	if counter, ok := ctx.Value(apiCallCounterKey{}).(*APICallCounter); ok && counter != nil {
+		atomic.AddInt64(&counter.count, 1)
+	}
+}
+
+// A client which counts every call made through it with the counter of the call's context. Wrap
+// each regional client, rather than a FailoverClient, so calls to both regions are counted.
+type CountingClient struct {
+	Client
+}
+
+func (client *CountingClient) SendEmail(
+	ctx context.Context,
+	params *sesv2.SendEmailInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.SendEmailOutput, error) {
+	countAPICall(ctx)
+
+	return client.Client.SendEmail(ctx, params, optFns...)
+}
+
+func (client *CountingClient) SendBulkEmail(
+	ctx context.Context,
+	params *sesv2.SendBulkEmailInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.SendBulkEmailOutput, error) {
+	countAPICall(ctx)
+
+	return client.Client.SendBulkEmail(ctx, params, optFns...)
+}
+
+func (client *CountingClient) GetAccount(
+	ctx context.Context,
+	params *sesv2.GetAccountInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.GetAccountOutput, error) {
+	countAPICall(ctx)
+
+	return client.Client.GetAccount(ctx, params, optFns...)
+}
+
+func (client *CountingClient) GetSuppressedDestination(
+	ctx context.Context,
+	params *sesv2.GetSuppressedDestinationInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.GetSuppressedDestinationOutput, error) {
+	countAPICall(ctx)
+
+	return client.Client.GetSuppressedDestination(ctx, params, optFns...)
+}
+
+func (client *CountingClient) CreateConfigurationSetEventDestination(
+	ctx context.Context,
+	params *sesv2.CreateConfigurationSetEventDestinationInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.CreateConfigurationSetEventDestinationOutput, error) {
+	countAPICall(ctx)
+
+	return client.Client.CreateConfigurationSetEventDestination(ctx, params, optFns...)
+}
+
+func (client *CountingClient) GetEmailTemplate(
+	ctx context.Context,
+	params *sesv2.GetEmailTemplateInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.GetEmailTemplateOutput, error) {
+	countAPICall(ctx)
+
+	return client.Client.GetEmailTemplate(ctx, params, optFns...)
+}
+
+func (client *CountingClient) CreateEmailTemplate(
+	ctx context.Context,
+	params *sesv2.CreateEmailTemplateInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.CreateEmailTemplateOutput, error) {
+	countAPICall(ctx)
+
+	return client.Client.CreateEmailTemplate(ctx, params, optFns...)
+}
+
+func (client *CountingClient) UpdateEmailTemplate(
+	ctx context.Context,
+	params *sesv2.UpdateEmailTemplateInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.UpdateEmailTemplateOutput, error) {
+	countAPICall(ctx)
+
+	return client.Client.UpdateEmailTemplate(ctx, params, optFns...)
+}
+
+func (client *CountingClient) DeleteEmailTemplate(
+	ctx context.Context,
+	params *sesv2.DeleteEmailTemplateInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.DeleteEmailTemplateOutput, error) {
+	countAPICall(ctx)
+
+	return client.Client.DeleteEmailTemplate(ctx, params, optFns...)
+}
+
+func (client *CountingClient) PutSuppressedDestination(
+	ctx context.Context,
+	params *sesv2.PutSuppressedDestinationInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.PutSuppressedDestinationOutput, error) {
+	countAPICall(ctx)
+
+	return client.Client.PutSuppressedDestination(ctx, params, optFns...)
+}
+
+func (client *CountingClient) DeleteSuppressedDestination(
+	ctx context.Context,
+	params *sesv2.DeleteSuppressedDestinationInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.DeleteSuppressedDestinationOutput, error) {
+	countAPICall(ctx)
+
+	return client.Client.DeleteSuppressedDestination(ctx, params, optFns...)
+}
+
+func (client *CountingClient) ListSuppressedDestinations(
+	ctx context.Context,
+	params *sesv2.ListSuppressedDestinationsInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.ListSuppressedDestinationsOutput, error) {
+	countAPICall(ctx)
+
+	return client.Client.ListSuppressedDestinations(ctx, params, optFns...)
+}
+
+func (client *CountingClient) CreateContactList(
+	ctx context.Context,
+	params *sesv2.CreateContactListInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.CreateContactListOutput, error) {
+	countAPICall(ctx)
+
+	return client.Client.CreateContactList(ctx, params, optFns...)
+}
+
+func (client *CountingClient) CreateContact(
+	ctx context.Context,
+	params *sesv2.CreateContactInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.CreateContactOutput, error) {
+	countAPICall(ctx)
+
+	return client.Client.CreateContact(ctx, params, optFns...)
+}
+
+func (client *CountingClient) UpdateContact(
+	ctx context.Context,
+	params *sesv2.UpdateContactInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.UpdateContactOutput, error) {
+	countAPICall(ctx)
+
+	return client.Client.UpdateContact(ctx, params, optFns...)
+}
+
+func (client *CountingClient) DeleteContact(
+	ctx context.Context,
+	params *sesv2.DeleteContactInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.DeleteContactOutput, error) {
+	countAPICall(ctx)
+
+	return client.Client.DeleteContact(ctx, params, optFns...)
+}
+
+func (client *CountingClient) ListContacts(
+	ctx context.Context,
+	params *sesv2.ListContactsInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.ListContactsOutput, error) {
+	countAPICall(ctx)
+
+	return client.Client.ListContacts(ctx, params, optFns...)
+}
+
+func (client *CountingClient) DeleteContactList(
+	ctx context.Context,
+	params *sesv2.DeleteContactListInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.DeleteContactListOutput, error) {
+	countAPICall(ctx)
+
+	return client.Client.DeleteContactList(ctx, params, optFns...)
+}
+
+func (client *CountingClient) CreateConfigurationSet(
+	ctx context.Context,
+	params *sesv2.CreateConfigurationSetInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.CreateConfigurationSetOutput, error) {
+	countAPICall(ctx)
+
+	return client.Client.CreateConfigurationSet(ctx, params, optFns...)
+}
+
+func (client *CountingClient) DeleteConfigurationSet(
+	ctx context.Context,
+	params *sesv2.DeleteConfigurationSetInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.DeleteConfigurationSetOutput, error) {
+	countAPICall(ctx)
+
+	return client.Client.DeleteConfigurationSet(ctx, params, optFns...)
+}
+
+func (client *CountingClient) PutConfigurationSetSuppressionOptions(
+	ctx context.Context,
+	params *sesv2.PutConfigurationSetSuppressionOptionsInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.PutConfigurationSetSuppressionOptionsOutput, error) {
+	countAPICall(ctx)
+
+	return client.Client.PutConfigurationSetSuppressionOptions(ctx, params, optFns...)
+}
@@ -0,0 +1,97 @@
+// Tests for counting SES API calls
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+)
+
+func TestCountingClient(t *testing.T) {
+	unreachable := dialError()
+
+	for _, test := range []struct {
+		name     string
+		settings Config
+		client   func() Client
+		send     func(ctx context.Context, client Client)
+		expected int64
+	}{
+		{
+			"single email",
+			Config{},
+			func() Client { return &CountingClient{Client: &fakeClient{}} },
+			func(ctx context.Context, client Client) { SendEmail(ctx, client, simpleEmail("a@example.com")) },
+			1,
+		},
+		{
+			"chunked bulk email",
+			Config{BatchTemplatedEmails: true},
+			func() Client { return &CountingClient{Client: &fakeClient{}} },
+			func(ctx context.Context, client Client) {
+				var inputs []*SendEmailInput
+
+				for index := 0; index < 120; index++ {
+					inputs = append(inputs, templatedEmail(fmt.Sprintf("user%d@example.com", index), "welcome"))
+				}
+
+				SendEmails(ctx, client, inputs)
+			},
+			3,
+		},
+		{
+			"retried bulk entries",
+			Config{BulkRetryAttempts: 2, BulkRetryStatuses: defaultBulkRetryStatuses},
+			func() Client {
+				return &CountingClient{Client: statusClient(map[string][]types.BulkEmailStatus{
+					"a@example.com": {types.BulkEmailStatusTransientFailure, types.BulkEmailStatusTransientFailure},
+				})}
+			},
+			func(ctx context.Context, client Client) { SendBulkEmail(ctx, client, bulkEmail("a@example.com")) },
+			3,
+		},
+		{
+			"failed over",
+			Config{},
+			func() Client {
+				return &FailoverClient{
+					Primary:  &CountingClient{Client: failingClient(unreachable)},
+					Fallback: &CountingClient{Client: &fakeClient{}},
+				}
+			},
+			func(ctx context.Context, client Client) { SendEmail(ctx, client, simpleEmail("a@example.com")) },
+			2,
+		},
+		{
+			"failed validation",
+			Config{},
+			func() Client { return &CountingClient{Client: &fakeClient{}} },
+			func(ctx context.Context, client Client) { SendEmail(ctx, client, &SendEmailInput{}) },
+			0,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			// Shortens the delay before retries, which the settings then configure
+			useBulkRetries(t, 0)
+			useSettings(t, test.settings)
+
+			counter := &APICallCounter{}
+			test.send(WithAPICallCounter(context.Background(), counter), test.client())
+
+			if count := counter.Count(); count != test.expected {
+				t.Errorf("expected %d calls, got %d", test.expected, count)
+			}
+		})
+	}
+}
+
+func TestCountingClientWithoutCounter(t *testing.T) {
+	// Calls without a counter in the context aren't counted, and mustn't panic
+	if _, err := SendEmail(context.Background(), &CountingClient{Client: &fakeClient{}}, simpleEmail("a@example.com")); err != nil {
+		t.Fatal(err)
+	}
+}
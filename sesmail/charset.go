@@ -0,0 +1,53 @@
+// Resolution of the character sets of simple messages
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+)
+
+// The character set SES uses for content without one
+const sesDefaultCharset = "US-ASCII"
+
+// The character set used for each part of a simple message
+type Charsets struct {
+	Subject string `json:"subject,omitempty"`
+	Html    string `json:"html,omitempty"`
+	Text    string `json:"text,omitempty"`
+}
+
+// Applies DEFAULT_CHARSET to content without a character set
+func resolveCharset(charset *string) *string {
+	if charset == nil && Settings.DefaultCharset != "" {
+		return aws.String(Settings.DefaultCharset)
+	}
+
+	return charset
+}
+
+// Returns the character set SES will use for each part of a message, which is 7-bit ASCII for
+// parts sent without one
+func messageCharsets(message *types.Message) *Charsets {
+	charsets := &Charsets{
+		Subject: contentCharset(message.Subject),
+	}
+
+	if message.Body != nil {
+		charsets.Html = contentCharset(message.Body.Html)
+		charsets.Text = contentCharset(message.Body.Text)
+	}
+
+	return charsets
+}
+
+func contentCharset(content *types.Content) string {
+	if content == nil {
+		return ""
+	} else if content.Charset == nil {
+		return sesDefaultCharset
+	}
+
+	return *content.Charset
+}
@@ -0,0 +1,80 @@
+// Tests for resolving the character sets of simple messages
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestSendEmailReportsCharsets(t *testing.T) {
+	for _, test := range []struct {
+		name           string
+		defaultCharset string
+		subject        *string
+		html           *string
+		expected       Charsets
+	}{
+		{"SES default", "", nil, nil, Charsets{Subject: "US-ASCII", Html: "US-ASCII"}},
+		{"configured default", "UTF-8", nil, nil, Charsets{Subject: "UTF-8", Html: "UTF-8"}},
+		{
+			"explicit",
+			"UTF-8",
+			aws.String("ISO-8859-1"),
+			aws.String("Shift_JIS"),
+			Charsets{Subject: "ISO-8859-1", Html: "Shift_JIS"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			useSettings(t, Config{DefaultCharset: test.defaultCharset})
+
+			client := &fakeClient{}
+			input := simpleEmail("a@example.com")
+			input.Content.Simple.Subject.Charset = test.subject
+			input.Content.Simple.Body = &Body{Html: &Content{Data: aws.String("<p>Body</p>"), Charset: test.html}}
+
+			output, err := SendEmail(context.Background(), client, input)
+
+			if err != nil {
+				t.Fatal(err)
+			} else if *output.Charsets != test.expected {
+				t.Errorf("expected %+v, got %+v", test.expected, *output.Charsets)
+			}
+
+			// The reported charsets must be the ones sent
+			sent := client.SentEmails()[0].Content.Simple
+
+			if charset := aws.ToString(sent.Subject.Charset); charset != "" && charset != test.expected.Subject {
+				t.Errorf("expected the subject to be sent as %s, got %s", test.expected.Subject, charset)
+			} else if charset := aws.ToString(sent.Body.Html.Charset); charset != "" && charset != test.expected.Html {
+				t.Errorf("expected the HTML to be sent as %s, got %s", test.expected.Html, charset)
+			}
+		})
+	}
+}
+
+func TestSendEmailReportsCharsetsOnlyForSimpleEmails(t *testing.T) {
+	useSettings(t, Config{})
+
+	if output, err := SendEmail(context.Background(), &fakeClient{}, templatedEmail("a@example.com", "template")); err != nil {
+		t.Fatal(err)
+	} else if output.Charsets != nil {
+		t.Errorf("expected no charsets, got %+v", *output.Charsets)
+	}
+}
+
+func TestSendEmailReportsTextCharset(t *testing.T) {
+	useSettings(t, Config{})
+
+	output, err := SendEmail(context.Background(), &fakeClient{}, simpleEmail("a@example.com"))
+	expected := Charsets{Subject: "US-ASCII", Text: "US-ASCII"}
+
+	if err != nil {
+		t.Fatal(err)
+	} else if *output.Charsets != expected {
+		t.Errorf("expected %+v, got %+v", expected, *output.Charsets)
+	}
+}
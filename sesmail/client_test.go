@@ -0,0 +1,206 @@
+// A fake SES client for tests, so sends can be checked without calling AWS
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sesv2 "github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+)
+
+// Answers sends with the configured functions, accepting every email by default, and records
+// every request it receives. Operations it doesn't override panic through the nil Client.
+type fakeClient struct {
+	Client
+
+	sendEmail     func(ctx context.Context, params *sesv2.SendEmailInput) (*sesv2.SendEmailOutput, error)
+	sendBulkEmail func(ctx context.Context, params *sesv2.SendBulkEmailInput) (*sesv2.SendBulkEmailOutput, error)
+	getAccount    func(ctx context.Context, params *sesv2.GetAccountInput) (*sesv2.GetAccountOutput, error)
+
+	createEventDestination func(
+		ctx context.Context,
+		params *sesv2.CreateConfigurationSetEventDestinationInput,
+	) (*sesv2.CreateConfigurationSetEventDestinationOutput, error)
+
+	// Addresses on the suppression list with their reasons, checked by GetSuppressedDestination
+	suppressed map[string]types.SuppressionListReason
+
+	// The content of each template, returned by GetEmailTemplate
+	templates       map[string]*types.EmailTemplateContent
+	templateLookups int
+
+	mutex          sync.Mutex
+	sentEmails     []*sesv2.SendEmailInput
+	sentBulkEmails []*sesv2.SendBulkEmailInput
+}
+
+func (client *fakeClient) SendEmail(
+	ctx context.Context,
+	params *sesv2.SendEmailInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.SendEmailOutput, error) {
+	client.mutex.Lock()
+	client.sentEmails = append(client.sentEmails, params)
+	count := len(client.sentEmails)
+	client.mutex.Unlock()
+
+	if client.sendEmail != nil {
+		return client.sendEmail(ctx, params)
+	}
+
+	return &sesv2.SendEmailOutput{MessageId: aws.String(fmt.Sprintf("message-%d", count))}, nil
+}
+
+func (client *fakeClient) SendBulkEmail(
+	ctx context.Context,
+	params *sesv2.SendBulkEmailInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.SendBulkEmailOutput, error) {
+	client.mutex.Lock()
+	client.sentBulkEmails = append(client.sentBulkEmails, params)
+	client.mutex.Unlock()
+
+	if client.sendBulkEmail != nil {
+		return client.sendBulkEmail(ctx, params)
+	}
+
+	return acceptBulkEmail(params), nil
+}
+
+func (client *fakeClient) GetAccount(
+	ctx context.Context,
+	params *sesv2.GetAccountInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.GetAccountOutput, error) {
+	if client.getAccount == nil {
+		return client.Client.GetAccount(ctx, params, optFns...)
+	}
+
+	return client.getAccount(ctx, params)
+}
+
+func (client *fakeClient) GetSuppressedDestination(
+	ctx context.Context,
+	params *sesv2.GetSuppressedDestinationInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.GetSuppressedDestinationOutput, error) {
+	reason, ok := client.suppressed[aws.ToString(params.EmailAddress)]
+
+	if !ok {
+		return nil, &types.NotFoundException{Message: aws.String("Email address is not on the suppression list")}
+	}
+
+	return &sesv2.GetSuppressedDestinationOutput{
+		SuppressedDestination: &types.SuppressedDestination{EmailAddress: params.EmailAddress, Reason: reason},
+	}, nil
+}
+
+func (client *fakeClient) CreateConfigurationSetEventDestination(
+	ctx context.Context,
+	params *sesv2.CreateConfigurationSetEventDestinationInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.CreateConfigurationSetEventDestinationOutput, error) {
+	if client.createEventDestination == nil {
+		return client.Client.CreateConfigurationSetEventDestination(ctx, params, optFns...)
+	}
+
+	return client.createEventDestination(ctx, params)
+}
+
+func (client *fakeClient) GetEmailTemplate(
+	ctx context.Context,
+	params *sesv2.GetEmailTemplateInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.GetEmailTemplateOutput, error) {
+	client.mutex.Lock()
+	client.templateLookups++
+	client.mutex.Unlock()
+
+	content, ok := client.templates[aws.ToString(params.TemplateName)]
+
+	if !ok {
+		return nil, &types.NotFoundException{Message: aws.String("Template does not exist")}
+	}
+
+	return &sesv2.GetEmailTemplateOutput{TemplateName: params.TemplateName, TemplateContent: content}, nil
+}
+
+func (client *fakeClient) SentEmails() []*sesv2.SendEmailInput {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	return append([]*sesv2.SendEmailInput(nil), client.sentEmails...)
+}
+
+func (client *fakeClient) SentBulkEmails() []*sesv2.SendBulkEmailInput {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	return append([]*sesv2.SendBulkEmailInput(nil), client.sentBulkEmails...)
+}
+
+// A successful result for every entry of a bulk email, with message IDs naming the entry's first
+// recipient
+func acceptBulkEmail(params *sesv2.SendBulkEmailInput) *sesv2.SendBulkEmailOutput {
+	output := &sesv2.SendBulkEmailOutput{}
+
+	for _, entry := range params.BulkEmailEntries {
+		output.BulkEmailEntryResults = append(output.BulkEmailEntryResults, types.BulkEmailEntryResult{
+			MessageId: aws.String("bulk-" + entry.Destination.ToAddresses[0]),
+			Status:    types.BulkEmailStatusSuccess,
+		})
+	}
+
+	return output
+}
+
+// Restores the settings once the test finishes
+func useSettings(t interface{ Cleanup(func()) }, settings Config) {
+	previous := Settings
+	Settings = settings
+	t.Cleanup(func() { Settings = previous })
+}
+
+// A simple email from from@example.com to a single recipient
+func simpleEmail(to string) *SendEmailInput {
+	return &SendEmailInput{
+		Content: &EmailContent{
+			Simple: &Message{
+				Subject: &Content{Data: aws.String("Subject")},
+				Body:    &Body{Text: &Content{Data: aws.String("Body")}},
+			},
+		},
+		Destination:      &Destination{ToAddresses: []string{to}},
+		FromEmailAddress: aws.String("from@example.com"),
+	}
+}
+
+// A templated email from from@example.com to a single recipient
+func templatedEmail(to string, template string) *SendEmailInput {
+	return &SendEmailInput{
+		Content:          &EmailContent{Template: &Template{TemplateName: aws.String(template)}},
+		Destination:      &Destination{ToAddresses: []string{to}},
+		FromEmailAddress: aws.String("from@example.com"),
+	}
+}
+
+// A bulk email with a default template and an entry for each recipient
+func bulkEmail(recipients ...string) *SendBulkEmailInput {
+	input := &SendBulkEmailInput{
+		FromEmailAddress: aws.String("from@example.com"),
+		DefaultContent:   &BulkEmailContent{Template: &Template{TemplateName: aws.String("template")}},
+	}
+
+	for _, recipient := range recipients {
+		input.BulkEmailEntries = append(input.BulkEmailEntries, BulkEmailEntry{
+			Destination: &Destination{ToAddresses: []string{recipient}},
+		})
+	}
+
+	return input
+}
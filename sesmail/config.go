@@ -0,0 +1,437 @@
+// Runtime configuration read from the environment
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Settings which change how emails are validated and sent
+type Config struct {
+
+	// Reject every send without calling SES, for stopping all email during an incident.
+	// Read from SENDING_DISABLED.
+	SendingDisabled bool
+
+	// Remove control characters from subjects instead of rejecting the email.
+	// Read from STRIP_CONTROL_CHARACTERS.
+	StripControlCharacters bool
+
+	// Write an audit receipt for every email handed to SES to stdout.
+	// Read from AUDIT_LOG.
+	AuditLog bool
+
+	// Store audit receipts in OFFLOAD_BUCKET under audit/ instead of writing them to stdout.
+	// Read from AUDIT_LOG_S3.
+	AuditLogS3 bool
+
+	// Name of the template used for bulk emails which don't specify default content.
+	// Read from DEFAULT_BULK_TEMPLATE.
+	DefaultBulkTemplate string
+
+	// How long a single SendBulkEmail request may take before it is cancelled and its entries
+	// are reported as failed. Zero disables the timeout.
+	// Read from BULK_CHUNK_TIMEOUT, e.g. "10s".
+	BulkChunkTimeout time.Duration
+
+	// Send emails which all use the same template as bulk emails.
+	// Read from BATCH_TEMPLATED_EMAILS.
+	BatchTemplatedEmails bool
+
+	// Content types attachments may have. An entry ending in "*" matches every content type
+	// starting with the rest of the entry, and "*" allows everything. Documents, images, audio,
+	// video, and text are allowed when nil.
+	// Read from ALLOWED_ATTACHMENT_TYPES as a comma separated list.
+	AllowedAttachmentTypes []string
+
+	// The maximum number of emails per second sent to each recipient domain. Domains which aren't
+	// listed are unthrottled. Every entry of a bulk email counts as an email.
+	// Read from DOMAIN_RATE_LIMITS, e.g. "example.com=5,example.org=0.5".
+	DomainRateLimits map[string]float64
+
+	// Warn when more than this percentage of the daily sending quota has been used after sending
+	// multiple emails. Zero disables the check.
+	// Read from QUOTA_WARNING_PERCENT.
+	QuotaWarningPercent float64
+
+	// The maximum number of emails sent at the same time by SendEmails and SendEmailsStream.
+	// Read from SES_MAX_CONCURRENCY, defaulting to 4.
+	MaxConcurrency int
+
+	// Look up every recipient on the account suppression list before sending, and report the
+	// suppressed ones in the output.
+	// Read from CHECK_SUPPRESSION_LIST.
+	CheckSuppressionList bool
+
+	// Don't check that raw messages are validly base64 encoded and have no lines longer than RFC 5321
+	// allows.
+	// Read from SKIP_RAW_MESSAGE_VALIDATION.
+	SkipRawMessageValidation bool
+
+	// A region to retry sends in when the default region can't be reached or is unavailable. Sends
+	// which fail with other server errors or lose their connection aren't retried, since SES may
+	// have accepted them, and retrying could send the email twice. Used by the Lambda when creating
+	// its client.
+	// Read from FALLBACK_REGION.
+	FallbackRegion string
+
+	// The character set used for subjects and bodies which don't specify one. When unset, SES
+	// uses 7-bit ASCII.
+	// Read from DEFAULT_CHARSET.
+	DefaultCharset string
+
+	// Whether to warn about or skip bulk entries whose first To address already appeared in an
+	// earlier entry. Either "warn" or "skip"; duplicates are sent unreported when unset.
+	// Read from DUPLICATE_RECIPIENTS.
+	DuplicateRecipients DuplicateRecipientMode
+
+	// How many times to resend bulk entries which failed with a retryable status. Retries are
+	// disabled when zero.
+	// Read from BULK_RETRY_ATTEMPTS.
+	BulkRetryAttempts int
+
+	// The bulk entry statuses which are retried, such as TRANSIENT_FAILURE.
+	// Read from BULK_RETRY_STATUSES.
+	BulkRetryStatuses []string
+
+	// The most unique Reply-To addresses an email may have, lower than SES's own limit. SES's
+	// limit applies when zero.
+	// Read from MAX_REPLY_TO_ADDRESSES.
+	MaxReplyToAddresses int
+
+	// The most To, CC, and BCC recipients an email or bulk entry may have combined, lower than
+	// SES's own limit. SES's limit applies when zero.
+	// Read from MAX_RECIPIENTS.
+	MaxRecipients int
+
+	// Also describe errors in the Lambda's output as RFC 7807 problem details.
+	// Read from PROBLEM_DETAILS.
+	ProblemDetails bool
+
+	// Emit a single CloudWatch embedded metric format document with the sent and failed counts
+	// and SES latencies at the end of each invocation.
+	// Read from EMF_METRICS.
+	EmfMetrics bool
+
+	// The CloudWatch namespace of the embedded metrics.
+	// Read from EMF_NAMESPACE.
+	EmfNamespace string
+
+	// How long a warm Lambda keeps its settings and clients before reloading them. They're only
+	// loaded on cold start, or by the refreshConfig operation, when zero.
+	// Read from CONFIG_TTL.
+	ConfigTTL time.Duration
+
+	// Indent the Lambda's JSON output, such as for reading it from the CLI. Only the formatting
+	// changes. Read on cold start.
+	// Read from PRETTY_OUTPUT.
+	PrettyOutput bool
+
+	// The Reply-To addresses of emails which don't specify any.
+	// Read from DEFAULT_REPLY_TO.
+	DefaultReplyTo []string
+
+	// The feedback forwarding address of emails which specify neither an address nor an identity.
+	// Read from DEFAULT_FEEDBACK_ADDRESS.
+	DefaultFeedbackAddress string
+
+	// The ARN of the identity authorizing the default feedback forwarding address.
+	// Read from DEFAULT_FEEDBACK_ARN.
+	DefaultFeedbackArn string
+
+	// Mask the addresses of dropped recipients in the output, e.g. j***@example.com.
+	// Read from MASK_DROPPED_RECIPIENTS.
+	MaskDroppedRecipients bool
+
+	// Warn when a template has no text part. Each template is only looked up once per Lambda.
+	// Read from CHECK_TEMPLATE_TEXT.
+	CheckTemplateText bool
+
+	// The S3 bucket emails arrays larger than OffloadThreshold are written to, to be sent once S3
+	// notifies the Lambda that they're stored, along with bulk results larger than
+	// ResultOffloadThreshold. Used by the Lambda when creating its payload store.
+	// Read from OFFLOAD_BUCKET.
+	OffloadBucket string
+
+	// The SQS queue async emails are queued on, to be sent once SQS delivers them to the Lambda.
+	// Async emails are rejected when empty. Used by the Lambda when creating its queue client.
+	// Read from ASYNC_QUEUE_URL.
+	AsyncQueueURL string
+
+	// The most emails an emails array may have before it's offloaded. Offloading is disabled
+	// when zero.
+	// Read from OFFLOAD_THRESHOLD.
+	OffloadThreshold int
+
+	// The most SES sends in progress at once across every invocation sharing the process, such as
+	// with provisioned concurrency. Unlimited when zero.
+	// Read from MAX_CONCURRENT_SENDS.
+	MaxConcurrentSends int
+
+	// Reject payloads using deprecated or misspelled keys, rather than accepting them with a
+	// warning.
+	// Read from STRICT_MODE.
+	StrictMode bool
+
+	// Whether to warn about or block sends when the account's enforcement status, checked on cold
+	// start, isn't HEALTHY. Either "warn" or "block"; the status isn't checked when unset.
+	// Read from ENFORCEMENT_CHECK.
+	EnforcementCheck EnforcementMode
+
+	// Whether to warn about or reject bulk entries without replacement template data when the
+	// template uses variables. Either "warn" or "error"; entries aren't checked when unset.
+	// Read from REPLACEMENT_DATA_CHECK.
+	ReplacementDataCheck ReplacementDataMode
+
+	// The longest random delay before each send, which spreads out the start of a batch
+	// independently of rate limits. Zero disables the delay.
+	// Read from SEND_JITTER, e.g. "200ms".
+	SendJitter time.Duration
+
+	// Whether to check every email of an emails array before sending any, so an invalid email
+	// means nothing is sent. Bulk emails are always checked in full before sending.
+	// Read from VALIDATE_BATCH_FIRST.
+	ValidateBatchFirst bool
+
+	// Whether to warn about or reject attachments whose content looks like a different type than
+	// they were declared as. Either "warn" or "error"; attachments aren't checked when unset.
+	// Read from ATTACHMENT_SNIFF.
+	AttachmentSniff AttachmentSniffMode
+
+	// The most To, CC, and BCC recipients an emails array may have across every email, to guard
+	// against accidental mass mailing. Zero disables the limit.
+	// Read from MAX_BATCH_RECIPIENTS.
+	MaxBatchRecipients int
+
+	// The most bulk entry results returned inline. Larger results are written to the payload store
+	// in chunks instead, if one is configured. Disabled when zero.
+	// Read from RESULT_OFFLOAD_THRESHOLD.
+	ResultOffloadThreshold int
+
+	// How many bulk entry results are written to each offloaded chunk.
+	// Read from RESULT_CHUNK_SIZE.
+	ResultChunkSize int
+
+	// Whether to warn about or reject raw messages whose To, CC, and BCC headers don't match their
+	// Destination. Either "warn" or "error"; recipients aren't compared when unset.
+	// Read from RAW_RECIPIENT_CHECK.
+	RawRecipientCheck RawRecipientCheckMode
+
+	// Whether raw messages whose recipients don't match are sent to their Destination, the default,
+	// or to their "headers". Only used when RawRecipientCheck is "warn".
+	// Read from RAW_RECIPIENT_PRECEDENCE.
+	RawRecipientPrecedence RawRecipientPrecedence
+
+	// The most attachment bytes the emails of an invocation may have combined, to bound the memory
+	// and cost of building their messages. Attachments in raw messages count by their encoded size.
+	// Zero disables the limit.
+	// Read from MAX_ATTACHMENT_BYTES.
+	MaxAttachmentBytes int
+
+	// How long before the Lambda's deadline an invocation stops waiting on SES, so it can still
+	// report the timeout instead of being killed.
+	// Read from DEADLINE_MARGIN.
+	DeadlineMargin time.Duration
+
+	// The most characters of an email's body included in its preview. Zero includes the whole body.
+	// Read from PREVIEW_LENGTH.
+	PreviewLength int
+
+	// Which sends are logged as JSON lines, either "info" for every send or "error" for failed
+	// sends only. Sends aren't logged when unset.
+	// Read from LOG_LEVEL.
+	LogLevel LogLevel
+
+	// Whether to mask the recipient addresses in send logs and JSONAuditSink receipts, including
+	// those in error messages.
+	// Read from LOG_REDACT_PII.
+	LogRedactPII bool
+
+	// Whether to lowercase the domains of the From, Reply-To, and feedback forwarding addresses,
+	// leaving their local parts untouched.
+	// Read from NORMALIZE_SENDER_DOMAINS.
+	NormalizeSenderDomains bool
+
+	// Whether destructive operations, such as deleting a contact list and its contacts or a
+	// configuration set, are allowed.
+	// Read from ALLOW_ADMIN_OPERATIONS.
+	AllowAdminOperations bool
+
+	// Whether sends are faked instead of calling SES, failing at FaultInjectionRate. Only for
+	// testing; never set it in production.
+	// Read from FAULT_INJECTION.
+	FaultInjection bool
+
+	// The share of faked sends and bulk entries which fail, from 0 to 1.
+	// Read from FAULT_INJECTION_RATE.
+	FaultInjectionRate float64
+
+	// The bulk entry statuses injected failures are picked from, such as MESSAGE_REJECTED.
+	// Read from FAULT_INJECTION_STATUSES.
+	FaultInjectionStatuses []string
+}
+
+// The settings used by every send. The Lambda loads them from the environment on cold start, while
+// library users can assign them directly, starting from DefaultConfig.
+var Settings = DefaultConfig()
+
+// Returns the settings used when nothing else is configured, which are also the fallbacks of
+// ConfigFromEnv
+func DefaultConfig() Config {
+	return Config{
+		AllowedAttachmentTypes: defaultAllowedAttachmentTypes,
+		MaxConcurrency:         4,
+		BulkRetryStatuses:      defaultBulkRetryStatuses,
+		EmfNamespace:           "lambda-ses",
+		ResultChunkSize:        1000,
+		DeadlineMargin:         time.Second,
+		PreviewLength:          200,
+	}
+}
+
+// Reads settings from the environment, falling back to DefaultConfig for those which aren't set
+func ConfigFromEnv() Config {
+	defaults := DefaultConfig()
+
+	return Config{
+		SendingDisabled:          envBool("SENDING_DISABLED"),
+		StripControlCharacters:   envBool("STRIP_CONTROL_CHARACTERS"),
+		AuditLog:                 envBool("AUDIT_LOG"),
+		AuditLogS3:               envBool("AUDIT_LOG_S3"),
+		DefaultBulkTemplate:      os.Getenv("DEFAULT_BULK_TEMPLATE"),
+		BulkChunkTimeout:         envDuration("BULK_CHUNK_TIMEOUT", 0),
+		BatchTemplatedEmails:     envBool("BATCH_TEMPLATED_EMAILS"),
+		AllowedAttachmentTypes:   envList("ALLOWED_ATTACHMENT_TYPES", defaults.AllowedAttachmentTypes),
+		DomainRateLimits:         envRates("DOMAIN_RATE_LIMITS"),
+		QuotaWarningPercent:      envFloat("QUOTA_WARNING_PERCENT"),
+		MaxConcurrency:           envInt("SES_MAX_CONCURRENCY", defaults.MaxConcurrency),
+		CheckSuppressionList:     envBool("CHECK_SUPPRESSION_LIST"),
+		SkipRawMessageValidation: envBool("SKIP_RAW_MESSAGE_VALIDATION"),
+		FallbackRegion:           os.Getenv("FALLBACK_REGION"),
+		DefaultCharset:           os.Getenv("DEFAULT_CHARSET"),
+		DuplicateRecipients:      DuplicateRecipientMode(strings.ToLower(os.Getenv("DUPLICATE_RECIPIENTS"))),
+		BulkRetryAttempts:        envInt("BULK_RETRY_ATTEMPTS", 0),
+		BulkRetryStatuses:        envList("BULK_RETRY_STATUSES", defaults.BulkRetryStatuses),
+		MaxReplyToAddresses:      envInt("MAX_REPLY_TO_ADDRESSES", 0),
+		MaxRecipients:            envInt("MAX_RECIPIENTS", 0),
+		ProblemDetails:           envBool("PROBLEM_DETAILS"),
+		EmfMetrics:               envBool("EMF_METRICS"),
+		EmfNamespace:             envString("EMF_NAMESPACE", defaults.EmfNamespace),
+		ConfigTTL:                envDuration("CONFIG_TTL", 0),
+		PrettyOutput:             envBool("PRETTY_OUTPUT"),
+		DefaultReplyTo:           envList("DEFAULT_REPLY_TO", nil),
+		DefaultFeedbackAddress:   os.Getenv("DEFAULT_FEEDBACK_ADDRESS"),
+		DefaultFeedbackArn:       os.Getenv("DEFAULT_FEEDBACK_ARN"),
+		MaskDroppedRecipients:    envBool("MASK_DROPPED_RECIPIENTS"),
+		CheckTemplateText:        envBool("CHECK_TEMPLATE_TEXT"),
+		OffloadBucket:            os.Getenv("OFFLOAD_BUCKET"),
+		OffloadThreshold:         envInt("OFFLOAD_THRESHOLD", 0),
+		AsyncQueueURL:            os.Getenv("ASYNC_QUEUE_URL"),
+		MaxConcurrentSends:       envInt("MAX_CONCURRENT_SENDS", 0),
+		StrictMode:               envBool("STRICT_MODE"),
+		EnforcementCheck:         EnforcementMode(strings.ToLower(os.Getenv("ENFORCEMENT_CHECK"))),
+		ReplacementDataCheck:     ReplacementDataMode(strings.ToLower(os.Getenv("REPLACEMENT_DATA_CHECK"))),
+		SendJitter:               envDuration("SEND_JITTER", 0),
+		ValidateBatchFirst:       envBool("VALIDATE_BATCH_FIRST"),
+		AttachmentSniff:          AttachmentSniffMode(strings.ToLower(os.Getenv("ATTACHMENT_SNIFF"))),
+		MaxBatchRecipients:       envInt("MAX_BATCH_RECIPIENTS", 0),
+		ResultOffloadThreshold:   envInt("RESULT_OFFLOAD_THRESHOLD", 0),
+		ResultChunkSize:          envInt("RESULT_CHUNK_SIZE", defaults.ResultChunkSize),
+		RawRecipientCheck:        RawRecipientCheckMode(strings.ToLower(os.Getenv("RAW_RECIPIENT_CHECK"))),
+		RawRecipientPrecedence:   RawRecipientPrecedence(strings.ToLower(os.Getenv("RAW_RECIPIENT_PRECEDENCE"))),
+		MaxAttachmentBytes:       envInt("MAX_ATTACHMENT_BYTES", 0),
+		DeadlineMargin:           envDuration("DEADLINE_MARGIN", defaults.DeadlineMargin),
+		PreviewLength:            envInt("PREVIEW_LENGTH", defaults.PreviewLength),
+		LogLevel:                 LogLevel(strings.ToLower(os.Getenv("LOG_LEVEL"))),
+		LogRedactPII:             envBool("LOG_REDACT_PII"),
+		NormalizeSenderDomains:   envBool("NORMALIZE_SENDER_DOMAINS"),
+		AllowAdminOperations:     envBool("ALLOW_ADMIN_OPERATIONS"),
+		FaultInjection:           envBool("FAULT_INJECTION"),
+		FaultInjectionRate:       envFloat("FAULT_INJECTION_RATE"),
+		FaultInjectionStatuses:   envList("FAULT_INJECTION_STATUSES", nil),
+	}
+}
+
+func envBool(key string) bool {
+	value, err := strconv.ParseBool(os.Getenv(key))
+
+	return err == nil && value
+}
+
+func envString(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+
+	return fallback
+}
+
+func envInt(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+
+	if err != nil {
+		return fallback
+	}
+
+	return value
+}
+
+func envFloat(key string) float64 {
+	value, err := strconv.ParseFloat(os.Getenv(key), 64)
+
+	if err != nil {
+		return 0
+	}
+
+	return value
+}
+
+func envList(key string, fallback []string) []string {
+	value := os.Getenv(key)
+
+	if value == "" {
+		return fallback
+	}
+
+	var list []string
+
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+
+	return list
+}
+
+func envRates(key string) map[string]float64 {
+	rates := make(map[string]float64)
+
+	for _, item := range envList(key, nil) {
+		pair := strings.SplitN(item, "=", 2)
+
+		if len(pair) != 2 {
+			continue
+		}
+
+		if value, err := strconv.ParseFloat(strings.TrimSpace(pair[1]), 64); err == nil {
+			rates[strings.ToLower(strings.TrimSpace(pair[0]))] = value
+		}
+	}
+
+	return rates
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+
+	if err != nil {
+		return fallback
+	}
+
+	return value
+}
@@ -0,0 +1,53 @@
+// Tests for runtime configuration
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestConfigFromEnvFallsBackToDefaults(t *testing.T) {
+	for _, key := range []string{
+		"ALLOWED_ATTACHMENT_TYPES",
+		"SES_MAX_CONCURRENCY",
+		"BULK_RETRY_STATUSES",
+		"EMF_NAMESPACE",
+		"RESULT_CHUNK_SIZE",
+		"DEADLINE_MARGIN",
+		"PREVIEW_LENGTH",
+	} {
+		t.Setenv(key, "")
+	}
+
+	settings, defaults := ConfigFromEnv(), DefaultConfig()
+
+	if !reflect.DeepEqual(settings.AllowedAttachmentTypes, defaults.AllowedAttachmentTypes) ||
+		!reflect.DeepEqual(settings.BulkRetryStatuses, defaults.BulkRetryStatuses) ||
+		settings.MaxConcurrency != defaults.MaxConcurrency ||
+		settings.EmfNamespace != defaults.EmfNamespace ||
+		settings.ResultChunkSize != defaults.ResultChunkSize ||
+		settings.DeadlineMargin != defaults.DeadlineMargin ||
+		settings.PreviewLength != defaults.PreviewLength {
+		t.Errorf("expected the defaults %+v, got %+v", defaults, settings)
+	}
+
+	t.Setenv("PREVIEW_LENGTH", "0")
+
+	if settings := ConfigFromEnv(); settings.PreviewLength != 0 {
+		t.Errorf("expected an explicit zero to be kept, got %d", settings.PreviewLength)
+	}
+}
+
+func TestSettingsStartFromDefaults(t *testing.T) {
+	defaults := DefaultConfig()
+
+	if defaults.MaxConcurrency != 4 || defaults.PreviewLength != 200 ||
+		defaults.DeadlineMargin != time.Second || defaults.ResultChunkSize != 1000 {
+		t.Errorf("unexpected defaults %+v", defaults)
+	} else if !reflect.DeepEqual(Settings, defaults) {
+		t.Errorf("expected the settings to start as %+v, got %+v", defaults, Settings)
+	}
+}
@@ -0,0 +1,168 @@
+// Creation and deletion of configuration sets, and their suppression options
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sesv2 "github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+)
+
+// A configuration set to create, which emails are sent with to track their events
+type CreateConfigurationSetInput struct {
+
+	// The name of the configuration set.
+	//
+	// This member is required.
+	ConfigurationSetName *string `json:"configSetName"`
+
+	// The domain open and click tracking links point to, instead of an SES domain.
+	CustomRedirectDomain *string `json:"customRedirectDomain"`
+
+	// Whether SES publishes the bounce and complaint rates of emails sent with the configuration set
+	// to CloudWatch.
+	ReputationMetricsEnabled bool `json:"reputationMetricsEnabled"`
+
+	// Whether emails can be sent with the configuration set. Defaults to true.
+	SendingEnabled *bool `json:"sendingEnabled"`
+
+	// Why addresses are added to the account suppression list for emails sent with the
+	// configuration set, BOUNCE and COMPLAINT. Null uses the account's settings, while an empty list
+	// adds no addresses.
+	SuppressedReasons []string `json:"suppressedReasons"`
+}
+
+// A configuration set to delete
+type DeleteConfigurationSetInput struct {
+
+	// The name of the configuration set.
+	//
+	// This member is required.
+	ConfigurationSetName *string `json:"configSetName"`
+
+	// Confirms deleting the configuration set and its event destinations, to prevent accidental
+	// deletion.
+	Confirm bool `json:"confirm"`
+}
+
+// The suppression options to set on a configuration set
+type ConfigurationSetSuppressionOptionsInput struct {
+
+	// The name of the configuration set.
+	//
+	// This member is required.
+	ConfigurationSetName *string `json:"configSetName"`
+
+	// Why addresses are added to the account suppression list for emails sent with the
+	// configuration set, BOUNCE and COMPLAINT. Null uses the account's settings, while an empty list
+	// adds no addresses.
+	SuppressedReasons []string `json:"suppressedReasons"`
+}
+
+func validateSuppressedReasons(reasons []string) error {
+	seen := map[string]bool{}
+
+	for _, reason := range reasons {
+		if !isKnownSuppressionReason(types.SuppressionListReason(reason)) {
+			return fmt.Errorf("Unknown suppression reason %q, expected BOUNCE or COMPLAINT", reason)
+		} else if seen[reason] {
+			return fmt.Errorf("Suppression reason %s is repeated", reason)
+		}
+
+		seen[reason] = true
+	}
+
+	return nil
+}
+
+func suppressedReasons(reasons []string) []types.SuppressionListReason {
+	converted := []types.SuppressionListReason{}
+
+	for _, reason := range reasons {
+		converted = append(converted, types.SuppressionListReason(reason))
+	}
+
+	return converted
+}
+
+// Creates a configuration set with tracking, reputation, sending, and suppression options
+func CreateConfigurationSet(ctx context.Context, client Client, input *CreateConfigurationSetInput) error {
+	if aws.ToString(input.ConfigurationSetName) == "" {
+		return invalidInput(errors.New("Configuration set name is required"))
+	} else if err := validateSuppressedReasons(input.SuppressedReasons); err != nil {
+		return invalidInput(err)
+	}
+
+	createInput := &sesv2.CreateConfigurationSetInput{
+		ConfigurationSetName: input.ConfigurationSetName,
+		ReputationOptions: &types.ReputationOptions{
+			ReputationMetricsEnabled: input.ReputationMetricsEnabled,
+		},
+		SendingOptions: &types.SendingOptions{
+			SendingEnabled: input.SendingEnabled == nil || *input.SendingEnabled,
+		},
+	}
+
+	if aws.ToString(input.CustomRedirectDomain) != "" {
+		createInput.TrackingOptions = &types.TrackingOptions{CustomRedirectDomain: input.CustomRedirectDomain}
+	}
+
+	if input.SuppressedReasons != nil {
+		createInput.SuppressionOptions = &types.SuppressionOptions{
+			SuppressedReasons: suppressedReasons(input.SuppressedReasons),
+		}
+	}
+
+	_, err := client.CreateConfigurationSet(ctx, createInput)
+
+	return err
+}
+
+// Deletes a configuration set and its event destinations. Needs ALLOW_ADMIN_OPERATIONS and confirm
+// to be set.
+func DeleteConfigurationSet(ctx context.Context, client Client, input *DeleteConfigurationSetInput) error {
+	if aws.ToString(input.ConfigurationSetName) == "" {
+		return invalidInput(errors.New("Configuration set name is required"))
+	} else if !Settings.AllowAdminOperations {
+		return ErrAdminOperationsDisabled
+	} else if !input.Confirm {
+		return invalidInput(errors.New("Deleting a configuration set needs confirm to be set"))
+	}
+
+	_, err := client.DeleteConfigurationSet(ctx, &sesv2.DeleteConfigurationSetInput{
+		ConfigurationSetName: input.ConfigurationSetName,
+	})
+
+	return err
+}
+
+// Sets why addresses are added to the account suppression list for emails sent with a
+// configuration set
+func PutConfigurationSetSuppressionOptions(
+	ctx context.Context,
+	client Client,
+	input *ConfigurationSetSuppressionOptionsInput,
+) error {
+	if aws.ToString(input.ConfigurationSetName) == "" {
+		return invalidInput(errors.New("Configuration set name is required"))
+	} else if err := validateSuppressedReasons(input.SuppressedReasons); err != nil {
+		return invalidInput(err)
+	}
+
+	putInput := &sesv2.PutConfigurationSetSuppressionOptionsInput{
+		ConfigurationSetName: input.ConfigurationSetName,
+	}
+
+	if input.SuppressedReasons != nil {
+		putInput.SuppressedReasons = suppressedReasons(input.SuppressedReasons)
+	}
+
+	_, err := client.PutConfigurationSetSuppressionOptions(ctx, putInput)
+
+	return err
+}
@@ -0,0 +1,211 @@
+// Tests for creation and deletion of configuration sets, and their suppression options
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sesv2 "github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+)
+
+// Records the configuration set operations it receives
+type configurationSetClient struct {
+	fakeClient
+
+	requests []interface{}
+}
+
+func (client *configurationSetClient) CreateConfigurationSet(
+	ctx context.Context,
+	params *sesv2.CreateConfigurationSetInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.CreateConfigurationSetOutput, error) {
+	client.requests = append(client.requests, params)
+
+	return &sesv2.CreateConfigurationSetOutput{}, nil
+}
+
+func (client *configurationSetClient) DeleteConfigurationSet(
+	ctx context.Context,
+	params *sesv2.DeleteConfigurationSetInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.DeleteConfigurationSetOutput, error) {
+	client.requests = append(client.requests, params)
+
+	return &sesv2.DeleteConfigurationSetOutput{}, nil
+}
+
+func (client *configurationSetClient) PutConfigurationSetSuppressionOptions(
+	ctx context.Context,
+	params *sesv2.PutConfigurationSetSuppressionOptionsInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.PutConfigurationSetSuppressionOptionsOutput, error) {
+	client.requests = append(client.requests, params)
+
+	return &sesv2.PutConfigurationSetSuppressionOptionsOutput{}, nil
+}
+
+func TestCreateConfigurationSet(t *testing.T) {
+	name := aws.String("tracking")
+
+	for _, test := range []struct {
+		name     string
+		input    *CreateConfigurationSetInput
+		expected *sesv2.CreateConfigurationSetInput
+	}{
+		{
+			"defaults",
+			&CreateConfigurationSetInput{ConfigurationSetName: name},
+			&sesv2.CreateConfigurationSetInput{
+				ConfigurationSetName: name,
+				ReputationOptions:    &types.ReputationOptions{},
+				SendingOptions:       &types.SendingOptions{SendingEnabled: true},
+			},
+		},
+		{
+			"every option",
+			&CreateConfigurationSetInput{
+				ConfigurationSetName:     name,
+				CustomRedirectDomain:     aws.String("links.example.com"),
+				ReputationMetricsEnabled: true,
+				SendingEnabled:           aws.Bool(false),
+				SuppressedReasons:        []string{"BOUNCE", "COMPLAINT"},
+			},
+			&sesv2.CreateConfigurationSetInput{
+				ConfigurationSetName: name,
+				ReputationOptions:    &types.ReputationOptions{ReputationMetricsEnabled: true},
+				SendingOptions:       &types.SendingOptions{SendingEnabled: false},
+				TrackingOptions:      &types.TrackingOptions{CustomRedirectDomain: aws.String("links.example.com")},
+				SuppressionOptions: &types.SuppressionOptions{SuppressedReasons: []types.SuppressionListReason{
+					types.SuppressionListReasonBounce,
+					types.SuppressionListReasonComplaint,
+				}},
+			},
+		},
+		{
+			"no suppression",
+			&CreateConfigurationSetInput{ConfigurationSetName: name, SuppressedReasons: []string{}},
+			&sesv2.CreateConfigurationSetInput{
+				ConfigurationSetName: name,
+				ReputationOptions:    &types.ReputationOptions{},
+				SendingOptions:       &types.SendingOptions{SendingEnabled: true},
+				SuppressionOptions:   &types.SuppressionOptions{SuppressedReasons: []types.SuppressionListReason{}},
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			client := &configurationSetClient{}
+
+			if err := CreateConfigurationSet(context.Background(), client, test.input); err != nil {
+				t.Fatal(err)
+			} else if !reflect.DeepEqual(client.requests, []interface{}{test.expected}) {
+				t.Errorf("expected %+v, got %+v", test.expected, client.requests)
+			}
+		})
+	}
+}
+
+func TestCreateConfigurationSetValidatesInput(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		input    *CreateConfigurationSetInput
+		expected string
+	}{
+		{"missing name", &CreateConfigurationSetInput{}, "Configuration set name is required"},
+		{
+			"unknown reason",
+			&CreateConfigurationSetInput{ConfigurationSetName: aws.String("tracking"), SuppressedReasons: []string{"bounce"}},
+			`Unknown suppression reason "bounce", expected BOUNCE or COMPLAINT`,
+		},
+		{
+			"repeated reason",
+			&CreateConfigurationSetInput{ConfigurationSetName: aws.String("tracking"), SuppressedReasons: []string{"BOUNCE", "BOUNCE"}},
+			"Suppression reason BOUNCE is repeated",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			client := &configurationSetClient{}
+
+			if err := CreateConfigurationSet(context.Background(), client, test.input); err == nil || err.Error() != test.expected {
+				t.Errorf("expected %q, got %v", test.expected, err)
+			} else if len(client.requests) != 0 {
+				t.Error("expected an invalid input not to reach SES")
+			}
+		})
+	}
+}
+
+func TestDeleteConfigurationSet(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		admin    bool
+		input    *DeleteConfigurationSetInput
+		expected string
+	}{
+		{"missing name", true, &DeleteConfigurationSetInput{Confirm: true}, "Configuration set name is required"},
+		{
+			"admin operations disabled",
+			false,
+			&DeleteConfigurationSetInput{ConfigurationSetName: aws.String("tracking"), Confirm: true},
+			ErrAdminOperationsDisabled.Error(),
+		},
+		{
+			"not confirmed",
+			true,
+			&DeleteConfigurationSetInput{ConfigurationSetName: aws.String("tracking")},
+			"Deleting a configuration set needs confirm to be set",
+		},
+		{"confirmed", true, &DeleteConfigurationSetInput{ConfigurationSetName: aws.String("tracking"), Confirm: true}, ""},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			useSettings(t, Config{AllowAdminOperations: test.admin})
+
+			client := &configurationSetClient{}
+			err := DeleteConfigurationSet(context.Background(), client, test.input)
+
+			if test.expected != "" {
+				if err == nil || err.Error() != test.expected {
+					t.Errorf("expected %q, got %v", test.expected, err)
+				} else if len(client.requests) != 0 {
+					t.Error("expected the configuration set not to be deleted")
+				}
+
+				return
+			}
+
+			expected := []interface{}{&sesv2.DeleteConfigurationSetInput{ConfigurationSetName: aws.String("tracking")}}
+
+			if err != nil {
+				t.Fatal(err)
+			} else if !reflect.DeepEqual(client.requests, expected) {
+				t.Errorf("expected %+v, got %+v", expected, client.requests)
+			}
+		})
+	}
+}
+
+func TestPutConfigurationSetSuppressionOptions(t *testing.T) {
+	client := &configurationSetClient{}
+	input := &ConfigurationSetSuppressionOptionsInput{
+		ConfigurationSetName: aws.String("tracking"),
+		SuppressedReasons:    []string{"COMPLAINT"},
+	}
+
+	if err := PutConfigurationSetSuppressionOptions(context.Background(), client, input); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []interface{}{&sesv2.PutConfigurationSetSuppressionOptionsInput{
+		ConfigurationSetName: aws.String("tracking"),
+		SuppressedReasons:    []types.SuppressionListReason{types.SuppressionListReasonComplaint},
+	}}
+
+	if !reflect.DeepEqual(client.requests, expected) {
+		t.Errorf("expected %+v, got %+v", expected, client.requests)
+	}
+}
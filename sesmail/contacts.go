@@ -0,0 +1,333 @@
+// Management of SES contact lists and their contacts
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sesv2 "github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+)
+
+// What to do with a contact list
+type ContactAction string
+
+const (
+	// Create a contact list with its topics.
+	ContactCreateList ContactAction = "createList"
+
+	// Add a contact to a list.
+	ContactCreate ContactAction = "create"
+
+	// Replace the topic preferences of a contact on a list.
+	ContactUpdate ContactAction = "update"
+
+	// Remove a contact from a list.
+	ContactDelete ContactAction = "delete"
+
+	// List the contacts on a list, a page at a time.
+	ContactList ContactAction = "list"
+
+	// Delete a list and every contact on it. Needs ALLOW_ADMIN_OPERATIONS and confirm to be set.
+	ContactDeleteList ContactAction = "deleteList"
+)
+
+// Returned by admin operations, such as deleting a contact list, unless ALLOW_ADMIN_OPERATIONS is
+// set
+var ErrAdminOperationsDisabled = errors.New("Admin operations are disabled")
+
+// A topic of a contact list, which contacts subscribe to or unsubscribe from
+type ContactTopic struct {
+
+	// The name of the topic, as used by ListManagementOptions.
+	//
+	// This member is required.
+	TopicName *string `json:"topicName"`
+
+	// The name of the topic shown to contacts on the subscription preferences page.
+	//
+	// This member is required.
+	DisplayName *string `json:"displayName"`
+
+	// A description of the topic shown to contacts on the subscription preferences page.
+	Description *string `json:"description"`
+
+	// Whether contacts are subscribed to the topic unless they say otherwise, either OPT_IN or
+	// OPT_OUT.
+	//
+	// This member is required.
+	DefaultSubscriptionStatus string `json:"defaultSubscriptionStatus"`
+}
+
+// Whether a contact is subscribed to a topic
+type TopicPreference struct {
+
+	// The name of the topic.
+	//
+	// This member is required.
+	TopicName *string `json:"topicName"`
+
+	// Whether the contact is subscribed to the topic, either OPT_IN or OPT_OUT.
+	//
+	// This member is required.
+	SubscriptionStatus string `json:"subscriptionStatus"`
+}
+
+// A contact list to create or delete, a contact to add to, update on, or remove from a list, or a
+// filter to list a list's contacts with
+type ContactInput struct {
+
+	// The name of the contact list.
+	//
+	// This member is required.
+	ContactListName *string `json:"contactListName"`
+
+	// A description of the contact list. Only used when creating a list.
+	Description *string `json:"description"`
+
+	// The topics of the contact list. Only used when creating a list.
+	Topics []ContactTopic `json:"topics"`
+
+	// The address of the contact. Required unless creating or listing a list.
+	EmailAddress *string `json:"address"`
+
+	// Whether the contact is subscribed to each topic, overriding the topic's default.
+	TopicPreferences []TopicPreference `json:"topicPreferences"`
+
+	// Unsubscribe the contact from every topic of the list.
+	UnsubscribeAll bool `json:"unsubscribeAll"`
+
+	// Only list contacts with this subscription status, either OPT_IN or OPT_OUT.
+	FilteredStatus string `json:"filteredStatus"`
+
+	// Only list contacts by their subscription to this topic, rather than to any topic.
+	FilteredTopicName *string `json:"filteredTopicName"`
+
+	// The token of the page to list, from the previous page's output.
+	NextToken *string `json:"nextToken"`
+
+	// The most contacts to list in a page.
+	PageSize *int32 `json:"pageSize"`
+
+	// Confirms deleting the list and every contact on it, to prevent accidental deletion.
+	Confirm bool `json:"confirm"`
+}
+
+// A contact on a contact list
+type Contact struct {
+
+	// The address of the contact.
+	EmailAddress string `json:"address"`
+
+	// Whether the contact is subscribed to each topic they set a preference for.
+	TopicPreferences []TopicPreference `json:"topicPreferences"`
+
+	// Whether the contact is unsubscribed from every topic of the list.
+	UnsubscribeAll bool `json:"unsubscribeAll"`
+
+	// When the contact was last updated.
+	LastUpdatedTimestamp *time.Time `json:"lastUpdatedTimestamp,omitempty"`
+}
+
+// The contacts which were listed
+type ContactOutput struct {
+
+	// The contacts found on the list.
+	Contacts []Contact `json:"contacts"`
+
+	// The token of the next page, if there are more contacts to list.
+	NextToken *string `json:"nextToken,omitempty"`
+}
+
+func isKnownSubscriptionStatus(status types.SubscriptionStatus) bool {
+	for _, known := range status.Values() {
+		if status == known {
+			return true
+		}
+	}
+
+	return false
+}
+
+func validateContactInput(action ContactAction, input *ContactInput) error {
+	if aws.ToString(input.ContactListName) == "" {
+		return errors.New("Contact list name is required")
+	}
+
+	switch action {
+	case ContactCreateList:
+		for _, topic := range input.Topics {
+			if aws.ToString(topic.TopicName) == "" || aws.ToString(topic.DisplayName) == "" {
+				return errors.New("Contact list topics need a name and display name")
+			} else if !isKnownSubscriptionStatus(types.SubscriptionStatus(topic.DefaultSubscriptionStatus)) {
+				return fmt.Errorf(
+					"Unknown subscription status %q, expected OPT_IN or OPT_OUT",
+					topic.DefaultSubscriptionStatus,
+				)
+			}
+		}
+	case ContactCreate, ContactUpdate, ContactDelete:
+		if aws.ToString(input.EmailAddress) == "" {
+			return errors.New("Contact address is required")
+		}
+	case ContactList:
+		if input.FilteredStatus != "" &&
+			!isKnownSubscriptionStatus(types.SubscriptionStatus(input.FilteredStatus)) {
+			return fmt.Errorf("Unknown subscription status %q, expected OPT_IN or OPT_OUT", input.FilteredStatus)
+		}
+	case ContactDeleteList:
+		if !Settings.AllowAdminOperations {
+			return ErrAdminOperationsDisabled
+		} else if !input.Confirm {
+			return errors.New("Deleting a contact list and its contacts needs confirm to be set")
+		}
+	default:
+		return fmt.Errorf(
+			"Unknown contact action %q, expected createList, create, update, delete, list, or deleteList",
+			action,
+		)
+	}
+
+	for _, preference := range input.TopicPreferences {
+		if aws.ToString(preference.TopicName) == "" {
+			return errors.New("Topic preferences need a topic name")
+		} else if !isKnownSubscriptionStatus(types.SubscriptionStatus(preference.SubscriptionStatus)) {
+			return fmt.Errorf(
+				"Unknown subscription status %q, expected OPT_IN or OPT_OUT",
+				preference.SubscriptionStatus,
+			)
+		}
+	}
+
+	return nil
+}
+
+func topicPreferences(preferences []TopicPreference) []types.TopicPreference {
+	var converted []types.TopicPreference
+
+	for _, preference := range preferences {
+		converted = append(converted, types.TopicPreference{
+			TopicName:          preference.TopicName,
+			SubscriptionStatus: types.SubscriptionStatus(preference.SubscriptionStatus),
+		})
+	}
+
+	return converted
+}
+
+// Creates or deletes a contact list, or adds a contact to, updates a contact on, removes a contact
+// from, or lists the contacts of a list. Only listing contacts has an output.
+func ManageContacts(
+	ctx context.Context,
+	client Client,
+	action ContactAction,
+	input *ContactInput,
+) (*ContactOutput, error) {
+	if err := validateContactInput(action, input); err != nil {
+		return nil, invalidInput(err)
+	}
+
+	switch action {
+	case ContactCreateList:
+		createInput := &sesv2.CreateContactListInput{
+			ContactListName: input.ContactListName,
+			Description:     input.Description,
+		}
+
+		for _, topic := range input.Topics {
+			createInput.Topics = append(createInput.Topics, types.Topic{
+				TopicName:                 topic.TopicName,
+				DisplayName:               topic.DisplayName,
+				Description:               topic.Description,
+				DefaultSubscriptionStatus: types.SubscriptionStatus(topic.DefaultSubscriptionStatus),
+			})
+		}
+
+		_, err := client.CreateContactList(ctx, createInput)
+
+		return nil, err
+	case ContactCreate:
+		_, err := client.CreateContact(ctx, &sesv2.CreateContactInput{
+			ContactListName:  input.ContactListName,
+			EmailAddress:     input.EmailAddress,
+			TopicPreferences: topicPreferences(input.TopicPreferences),
+			UnsubscribeAll:   input.UnsubscribeAll,
+		})
+
+		return nil, err
+	case ContactUpdate:
+		_, err := client.UpdateContact(ctx, &sesv2.UpdateContactInput{
+			ContactListName:  input.ContactListName,
+			EmailAddress:     input.EmailAddress,
+			TopicPreferences: topicPreferences(input.TopicPreferences),
+			UnsubscribeAll:   input.UnsubscribeAll,
+		})
+
+		return nil, err
+	case ContactDelete:
+		_, err := client.DeleteContact(ctx, &sesv2.DeleteContactInput{
+			ContactListName: input.ContactListName,
+			EmailAddress:    input.EmailAddress,
+		})
+
+		return nil, err
+	case ContactDeleteList:
+		_, err := client.DeleteContactList(ctx, &sesv2.DeleteContactListInput{
+			ContactListName: input.ContactListName,
+		})
+
+		return nil, err
+	}
+
+	listInput := &sesv2.ListContactsInput{
+		ContactListName: input.ContactListName,
+		NextToken:       input.NextToken,
+		PageSize:        input.PageSize,
+	}
+
+	if input.FilteredStatus != "" || input.FilteredTopicName != nil {
+		listInput.Filter = &types.ListContactsFilter{
+			FilteredStatus: types.SubscriptionStatus(input.FilteredStatus),
+		}
+
+		if input.FilteredTopicName != nil {
+			listInput.Filter.TopicFilter = &types.TopicFilter{TopicName: input.FilteredTopicName}
+		}
+	}
+
+	output, err := client.ListContacts(ctx, listInput)
+
+	if err != nil {
+		return nil, err
+	}
+
+	contactOutput := &ContactOutput{
+		Contacts:  []Contact{},
+		NextToken: output.NextToken,
+	}
+
+	for _, contact := range output.Contacts {
+		preferences := []TopicPreference{}
+
+		for _, preference := range contact.TopicPreferences {
+			preferences = append(preferences, TopicPreference{
+				TopicName:          preference.TopicName,
+				SubscriptionStatus: string(preference.SubscriptionStatus),
+			})
+		}
+
+		contactOutput.Contacts = append(contactOutput.Contacts, Contact{
+			EmailAddress:         aws.ToString(contact.EmailAddress),
+			TopicPreferences:     preferences,
+			UnsubscribeAll:       contact.UnsubscribeAll,
+			LastUpdatedTimestamp: contact.LastUpdatedTimestamp,
+		})
+	}
+
+	return contactOutput, nil
+}
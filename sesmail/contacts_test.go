@@ -0,0 +1,290 @@
+// Tests for management of SES contact lists and their contacts
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sesv2 "github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+)
+
+// Records the contact operations it receives, answering lists with listed
+type contactsClient struct {
+	fakeClient
+
+	requests []interface{}
+	listed   *sesv2.ListContactsOutput
+}
+
+func (client *contactsClient) CreateContactList(
+	ctx context.Context,
+	params *sesv2.CreateContactListInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.CreateContactListOutput, error) {
+	client.requests = append(client.requests, params)
+
+	return &sesv2.CreateContactListOutput{}, nil
+}
+
+func (client *contactsClient) CreateContact(
+	ctx context.Context,
+	params *sesv2.CreateContactInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.CreateContactOutput, error) {
+	client.requests = append(client.requests, params)
+
+	return &sesv2.CreateContactOutput{}, nil
+}
+
+func (client *contactsClient) UpdateContact(
+	ctx context.Context,
+	params *sesv2.UpdateContactInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.UpdateContactOutput, error) {
+	client.requests = append(client.requests, params)
+
+	return &sesv2.UpdateContactOutput{}, nil
+}
+
+func (client *contactsClient) DeleteContact(
+	ctx context.Context,
+	params *sesv2.DeleteContactInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.DeleteContactOutput, error) {
+	client.requests = append(client.requests, params)
+
+	return &sesv2.DeleteContactOutput{}, nil
+}
+
+func (client *contactsClient) ListContacts(
+	ctx context.Context,
+	params *sesv2.ListContactsInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.ListContactsOutput, error) {
+	client.requests = append(client.requests, params)
+
+	return client.listed, nil
+}
+
+func (client *contactsClient) DeleteContactList(
+	ctx context.Context,
+	params *sesv2.DeleteContactListInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.DeleteContactListOutput, error) {
+	client.requests = append(client.requests, params)
+
+	return &sesv2.DeleteContactListOutput{}, nil
+}
+
+func TestManageContacts(t *testing.T) {
+	list := aws.String("newsletter")
+	address := aws.String("a@example.com")
+	preferences := []TopicPreference{{TopicName: aws.String("weekly"), SubscriptionStatus: "OPT_OUT"}}
+	sesPreferences := []types.TopicPreference{{TopicName: aws.String("weekly"), SubscriptionStatus: types.SubscriptionStatusOptOut}}
+
+	for _, test := range []struct {
+		name     string
+		action   ContactAction
+		input    *ContactInput
+		expected interface{}
+	}{
+		{
+			"create list",
+			ContactCreateList,
+			&ContactInput{
+				ContactListName: list,
+				Description:     aws.String("News"),
+				Topics: []ContactTopic{{
+					TopicName:                 aws.String("weekly"),
+					DisplayName:               aws.String("Weekly digest"),
+					DefaultSubscriptionStatus: "OPT_IN",
+				}},
+			},
+			&sesv2.CreateContactListInput{
+				ContactListName: list,
+				Description:     aws.String("News"),
+				Topics: []types.Topic{{
+					TopicName:                 aws.String("weekly"),
+					DisplayName:               aws.String("Weekly digest"),
+					DefaultSubscriptionStatus: types.SubscriptionStatusOptIn,
+				}},
+			},
+		},
+		{
+			"create contact",
+			ContactCreate,
+			&ContactInput{ContactListName: list, EmailAddress: address, TopicPreferences: preferences},
+			&sesv2.CreateContactInput{ContactListName: list, EmailAddress: address, TopicPreferences: sesPreferences},
+		},
+		{
+			"update contact",
+			ContactUpdate,
+			&ContactInput{ContactListName: list, EmailAddress: address, UnsubscribeAll: true},
+			&sesv2.UpdateContactInput{ContactListName: list, EmailAddress: address, UnsubscribeAll: true},
+		},
+		{
+			"delete contact",
+			ContactDelete,
+			&ContactInput{ContactListName: list, EmailAddress: address},
+			&sesv2.DeleteContactInput{ContactListName: list, EmailAddress: address},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			client := &contactsClient{}
+			output, err := ManageContacts(context.Background(), client, test.action, test.input)
+
+			if err != nil || output != nil {
+				t.Fatalf("expected no output, got %+v and %v", output, err)
+			} else if len(client.requests) != 1 || !reflect.DeepEqual(client.requests[0], test.expected) {
+				t.Errorf("expected %+v, got %+v", test.expected, client.requests)
+			}
+		})
+	}
+}
+
+func TestManageContactsList(t *testing.T) {
+	client := &contactsClient{listed: &sesv2.ListContactsOutput{
+		Contacts: []types.Contact{
+			{
+				EmailAddress:     aws.String("a@example.com"),
+				TopicPreferences: []types.TopicPreference{{TopicName: aws.String("weekly"), SubscriptionStatus: types.SubscriptionStatusOptIn}},
+			},
+			{EmailAddress: aws.String("b@example.com"), UnsubscribeAll: true},
+		},
+		NextToken: aws.String("page-2"),
+	}}
+	input := &ContactInput{
+		ContactListName:   aws.String("newsletter"),
+		FilteredStatus:    "OPT_IN",
+		FilteredTopicName: aws.String("weekly"),
+		PageSize:          aws.Int32(2),
+	}
+
+	output, err := ManageContacts(context.Background(), client, ContactList, input)
+	expected := &ContactOutput{
+		Contacts: []Contact{
+			{EmailAddress: "a@example.com", TopicPreferences: []TopicPreference{{TopicName: aws.String("weekly"), SubscriptionStatus: "OPT_IN"}}},
+			{EmailAddress: "b@example.com", TopicPreferences: []TopicPreference{}, UnsubscribeAll: true},
+		},
+		NextToken: aws.String("page-2"),
+	}
+	expectedInput := &sesv2.ListContactsInput{
+		ContactListName: aws.String("newsletter"),
+		Filter: &types.ListContactsFilter{
+			FilteredStatus: types.SubscriptionStatusOptIn,
+			TopicFilter:    &types.TopicFilter{TopicName: aws.String("weekly")},
+		},
+		PageSize: aws.Int32(2),
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(output, expected) {
+		t.Errorf("expected %+v, got %+v", expected, output)
+	} else if len(client.requests) != 1 || !reflect.DeepEqual(client.requests[0], expectedInput) {
+		t.Errorf("expected %+v, got %+v", expectedInput, client.requests)
+	}
+}
+
+func TestManageContactsValidatesInput(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		action   ContactAction
+		input    *ContactInput
+		expected string
+	}{
+		{"no list", ContactList, &ContactInput{}, "Contact list name is required"},
+		{"no address", ContactUpdate, &ContactInput{ContactListName: aws.String("newsletter")}, "Contact address is required"},
+		{
+			"topic without a display name",
+			ContactCreateList,
+			&ContactInput{ContactListName: aws.String("newsletter"), Topics: []ContactTopic{{TopicName: aws.String("weekly")}}},
+			"Contact list topics need a name and display name",
+		},
+		{
+			"unknown default status",
+			ContactCreateList,
+			&ContactInput{
+				ContactListName: aws.String("newsletter"),
+				Topics:          []ContactTopic{{TopicName: aws.String("weekly"), DisplayName: aws.String("Weekly"), DefaultSubscriptionStatus: "MAYBE"}},
+			},
+			`Unknown subscription status "MAYBE", expected OPT_IN or OPT_OUT`,
+		},
+		{
+			"unknown preference status",
+			ContactCreate,
+			&ContactInput{
+				ContactListName:  aws.String("newsletter"),
+				EmailAddress:     aws.String("a@example.com"),
+				TopicPreferences: []TopicPreference{{TopicName: aws.String("weekly"), SubscriptionStatus: "opt_in"}},
+			},
+			`Unknown subscription status "opt_in", expected OPT_IN or OPT_OUT`,
+		},
+		{
+			"unknown filter",
+			ContactList,
+			&ContactInput{ContactListName: aws.String("newsletter"), FilteredStatus: "SUBSCRIBED"},
+			`Unknown subscription status "SUBSCRIBED", expected OPT_IN or OPT_OUT`,
+		},
+		{
+			"unknown action",
+			"deleteAll",
+			&ContactInput{ContactListName: aws.String("newsletter")},
+			`Unknown contact action "deleteAll", expected createList, create, update, delete, list, or deleteList`,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			client := &contactsClient{}
+
+			if _, err := ManageContacts(context.Background(), client, test.action, test.input); err == nil || err.Error() != test.expected {
+				t.Errorf("expected %q, got %v", test.expected, err)
+			} else if len(client.requests) != 0 {
+				t.Error("expected an invalid input not to reach SES")
+			}
+		})
+	}
+}
+
+func TestManageContactsDeletesList(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		admin    bool
+		confirm  bool
+		expected string
+	}{
+		{"admin operations disabled", false, true, ErrAdminOperationsDisabled.Error()},
+		{"not confirmed", true, false, "Deleting a contact list and its contacts needs confirm to be set"},
+		{"confirmed", true, true, ""},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			useSettings(t, Config{AllowAdminOperations: test.admin})
+
+			client := &contactsClient{}
+			input := &ContactInput{ContactListName: aws.String("newsletter"), Confirm: test.confirm}
+			_, err := ManageContacts(context.Background(), client, ContactDeleteList, input)
+
+			if test.expected != "" {
+				if err == nil || err.Error() != test.expected {
+					t.Errorf("expected %q, got %v", test.expected, err)
+				} else if len(client.requests) != 0 {
+					t.Error("expected the list not to be deleted")
+				}
+
+				return
+			}
+
+			expected := []interface{}{&sesv2.DeleteContactListInput{ContactListName: aws.String("newsletter")}}
+
+			if err != nil {
+				t.Fatal(err)
+			} else if !reflect.DeepEqual(client.requests, expected) {
+				t.Errorf("expected %+v, got %+v", expected, client.requests)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+// Reporting of the effective settings for debugging deployments
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"reflect"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Describes the effective settings, keyed by the camel cased name of each Config field, with
+// durations formatted like "10s". Settings hold no credentials, which the AWS SDK loads on its own,
+// so nothing secret is reported.
+func DebugConfig() map[string]interface{} {
+	settings := reflect.ValueOf(Settings)
+	described := make(map[string]interface{}, settings.NumField())
+
+	for index := 0; index < settings.NumField(); index++ {
+		field := settings.Type().Field(index)
+		value := settings.Field(index).Interface()
+
+		if duration, ok := value.(time.Duration); ok {
+			value = duration.String()
+		}
+
+		described[camelCase(field.Name)] = value
+	}
+
+	return described
+}
+
+// Lowercases the first letter of a name
+func camelCase(name string) string {
+	first, size := utf8.DecodeRuneInString(name)
+
+	return string(unicode.ToLower(first)) + name[size:]
+}
@@ -0,0 +1,43 @@
+// Tests for reporting the effective settings
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDebugConfig(t *testing.T) {
+	useSettings(t, Config{
+		DomainRateLimits:       map[string]float64{"example.com": 5},
+		DefaultBulkTemplate:    "fallback",
+		DefaultReplyTo:         []string{"reply@example.com"},
+		AllowedAttachmentTypes: []string{"application/pdf"},
+		ConfigTTL:              10 * time.Second,
+		FallbackRegion:         "us-west-2",
+	})
+
+	described := DebugConfig()
+
+	for name, expected := range map[string]interface{}{
+		"domainRateLimits":       map[string]float64{"example.com": 5},
+		"defaultBulkTemplate":    "fallback",
+		"defaultReplyTo":         []string{"reply@example.com"},
+		"allowedAttachmentTypes": []string{"application/pdf"},
+		"configTTL":              "10s",
+		"fallbackRegion":         "us-west-2",
+		"sendingDisabled":        false,
+	} {
+		if value, ok := described[name]; !ok {
+			t.Errorf("expected %s to be reported", name)
+		} else if !reflect.DeepEqual(value, expected) {
+			t.Errorf("expected %s to be %v, got %v", name, expected, value)
+		}
+	}
+
+	if fields := reflect.TypeOf(Config{}).NumField(); len(described) != fields {
+		t.Errorf("expected all %d settings, got %d", fields, len(described))
+	}
+}
@@ -0,0 +1,90 @@
+// Migration of deprecated and misspelled keys in payloads
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Deprecated or misspelled keys, and the keys which replace them
+var deprecatedKeys = map[string]string{
+	"temaplte": "template",
+}
+
+// Returned by MigrateDeprecatedKeys in strict mode when a payload uses deprecated keys
+type ErrDeprecatedKeys struct {
+
+	// A message for each deprecated key explaining how to migrate.
+	Migrations []string
+}
+
+func (err *ErrDeprecatedKeys) Error() string {
+	return fmt.Sprintf("Payload uses deprecated keys: %v", err.Migrations)
+}
+
+// Renames deprecated keys anywhere in a JSON payload to the keys which replace them, returning the
+// migrated payload along with a warning for each renamed key. With STRICT_MODE enabled, payloads
+// using deprecated keys are rejected instead. Keys whose replacement is also present are left
+// as is, since the replacement takes precedence.
+func MigrateDeprecatedKeys(payload []byte) ([]byte, []string, error) {
+	var decoded interface{}
+
+	if err := json.Unmarshal(payload, &decoded); err != nil {
+		return nil, nil, err
+	}
+
+	var migrations []string
+
+	migrateKeys(decoded, &migrations)
+
+	if len(migrations) == 0 {
+		return payload, nil, nil
+	} else if Settings.StrictMode {
+		return nil, nil, &ErrDeprecatedKeys{Migrations: migrations}
+	}
+
+	migrated, err := json.Marshal(decoded)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return migrated, migrations, nil
+}
+
+func migrateKeys(value interface{}, migrations *[]string) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+
+		for key := range value {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			replacement, ok := deprecatedKeys[key]
+
+			if ok {
+				*migrations = append(*migrations, fmt.Sprintf("%q is deprecated, use %q instead", key, replacement))
+
+				if _, exists := value[replacement]; !exists {
+					value[replacement] = value[key]
+				}
+
+				delete(value, key)
+				key = replacement
+			}
+
+			migrateKeys(value[key], migrations)
+		}
+	case []interface{}:
+		for _, item := range value {
+			migrateKeys(item, migrations)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+// Tests for migrating deprecated and misspelled keys in payloads
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestMigrateDeprecatedKeys(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		payload    string
+		expected   string
+		migrations int
+	}{
+		{"current keys", `{"email":{"content":{"template":{"templateName":"a"}}}}`, "", 0},
+		{
+			"misspelled key",
+			`{"email":{"content":{"temaplte":{"templateName":"a"}}}}`,
+			`{"email":{"content":{"template":{"templateName":"a"}}}}`,
+			1,
+		},
+		{
+			"nested in arrays",
+			`{"emails":[{"content":{"temaplte":{"templateName":"a"}}},{"content":{"temaplte":{"templateName":"b"}}}]}`,
+			`{"emails":[{"content":{"template":{"templateName":"a"}}},{"content":{"template":{"templateName":"b"}}}]}`,
+			2,
+		},
+		{
+			"replacement takes precedence",
+			`{"content":{"temaplte":{"templateName":"old"},"template":{"templateName":"new"}}}`,
+			`{"content":{"template":{"templateName":"new"}}}`,
+			1,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			useSettings(t, Config{})
+
+			migrated, migrations, err := MigrateDeprecatedKeys([]byte(test.payload))
+
+			if err != nil {
+				t.Fatal(err)
+			} else if len(migrations) != test.migrations {
+				t.Errorf("expected %d warnings, got %v", test.migrations, migrations)
+			}
+
+			expected := test.expected
+
+			if expected == "" {
+				expected = test.payload
+			}
+
+			var got, want interface{}
+
+			if err := json.Unmarshal(migrated, &got); err != nil {
+				t.Fatal(err)
+			} else if err := json.Unmarshal([]byte(expected), &want); err != nil {
+				t.Fatal(err)
+			} else if !reflect.DeepEqual(got, want) {
+				t.Errorf("expected %s, got %s", expected, migrated)
+			}
+		})
+	}
+}
+
+func TestMigrateDeprecatedKeysStrictMode(t *testing.T) {
+	useSettings(t, Config{StrictMode: true})
+
+	_, _, err := MigrateDeprecatedKeys([]byte(`{"email":{"content":{"temaplte":{"templateName":"a"}}}}`))
+
+	var deprecated *ErrDeprecatedKeys
+
+	if !errors.As(err, &deprecated) {
+		t.Fatalf("expected ErrDeprecatedKeys, got %v", err)
+	}
+
+	expected := []string{`"temaplte" is deprecated, use "template" instead`}
+
+	if !reflect.DeepEqual(deprecated.Migrations, expected) {
+		t.Errorf("expected %q, got %q", expected, deprecated.Migrations)
+	}
+
+	// Payloads without deprecated keys are still accepted
+	if _, migrations, err := MigrateDeprecatedKeys([]byte(`{"email":{}}`)); err != nil || migrations != nil {
+		t.Errorf("expected the payload to be accepted, got %v and %v", migrations, err)
+	}
+}
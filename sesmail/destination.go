@@ -0,0 +1,128 @@
+// Resolution of the recipients an email is actually sent to
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Returns the destination an email is actually sent to. Domains are converted to Punycode, and
+// addresses repeated across To, CC, and BCC are only kept the first time.
+func resolveDestination(destination *Destination) (*Destination, error) {
+	seen := map[string]bool{}
+
+	resolve := func(addresses []string) ([]string, error) {
+		var resolved []string
+
+		for _, address := range addresses {
+			address, err := punycodeAddress(address)
+
+			if err != nil {
+				return nil, err
+			}
+
+			key := strings.ToLower(strings.TrimSpace(address))
+
+			if !seen[key] {
+				seen[key] = true
+				resolved = append(resolved, address)
+			}
+		}
+
+		return resolved, nil
+	}
+
+	resolved := &Destination{}
+	var err error
+
+	if resolved.ToAddresses, err = resolve(destination.ToAddresses); err != nil {
+		return nil, err
+	} else if resolved.CcAddresses, err = resolve(destination.CcAddresses); err != nil {
+		return nil, err
+	} else if resolved.BccAddresses, err = resolve(destination.BccAddresses); err != nil {
+		return nil, err
+	}
+
+	return resolved, nil
+}
+
+// Converts the domain of an address to Punycode, as SES requires, keeping a closing angle bracket
+// after it if the address has a display name
+func punycodeAddress(address string) (string, error) {
+	at := strings.LastIndex(address, "@")
+
+	if at == -1 || strings.IndexFunc(address[at+1:], isNonASCII) == -1 {
+		return address, nil
+	}
+
+	domain := strings.TrimRight(address[at+1:], ">")
+	encoded, err := punycodeDomain(domain)
+
+	if err != nil {
+		return "", fmt.Errorf("Recipient %q has an invalid domain: %w", address, err)
+	}
+
+	return address[:at+1] + encoded + address[at+1+len(domain):], nil
+}
+
+// Returns the Reply-To addresses an email is actually sent with, which are the configured defaults
+// when none are given, without repeats
+func resolveReplyTo(replyTo []string) []string {
+	if len(replyTo) == 0 {
+		replyTo = Settings.DefaultReplyTo
+	}
+
+	if Settings.NormalizeSenderDomains {
+		normalized := make([]string, 0, len(replyTo))
+
+		for _, address := range replyTo {
+			normalized = append(normalized, normalizeSenderDomain(address))
+		}
+
+		replyTo = normalized
+	}
+
+	return dedupeAddresses(replyTo)
+}
+
+// Lowercases the domain of a sender address when NORMALIZE_SENDER_DOMAINS is set, leaving the local
+// part untouched, since it may be case sensitive. The address may include a display name.
+func normalizeSenderDomain(address string) string {
+	at := strings.LastIndex(address, "@")
+
+	if !Settings.NormalizeSenderDomains || at == -1 {
+		return address
+	}
+
+	return address[:at] + strings.ToLower(address[at:])
+}
+
+// Like normalizeSenderDomain, for an optional address
+func normalizeSenderAddress(address *string) *string {
+	if address == nil {
+		return nil
+	}
+
+	normalized := normalizeSenderDomain(*address)
+
+	return &normalized
+}
+
+// Returns the addresses without repeats, compared case insensitively, keeping the first of each
+func dedupeAddresses(addresses []string) []string {
+	var unique []string
+	seen := map[string]bool{}
+
+	for _, address := range addresses {
+		key := strings.ToLower(strings.TrimSpace(address))
+
+		if !seen[key] {
+			seen[key] = true
+			unique = append(unique, address)
+		}
+	}
+
+	return unique
+}
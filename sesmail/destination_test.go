@@ -0,0 +1,272 @@
+// Tests for resolution of the recipients an email is actually sent to
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sesv2 "github.com/aws/aws-sdk-go-v2/service/sesv2"
+)
+
+func TestResolveDestination(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		input    *Destination
+		expected *Destination
+	}{
+		{
+			"unchanged",
+			&Destination{
+				ToAddresses:  []string{"to@example.com"},
+				CcAddresses:  []string{"cc@example.com"},
+				BccAddresses: []string{"bcc@example.com"},
+			},
+			&Destination{
+				ToAddresses:  []string{"to@example.com"},
+				CcAddresses:  []string{"cc@example.com"},
+				BccAddresses: []string{"bcc@example.com"},
+			},
+		},
+		{
+			"punycode",
+			&Destination{ToAddresses: []string{"a@bücher.example", "Name <b@München.example>"}},
+			&Destination{ToAddresses: []string{"a@xn--bcher-kva.example", "Name <b@xn--mnchen-3ya.example>"}},
+		},
+		{
+			"deduplicated",
+			&Destination{
+				ToAddresses:  []string{"a@example.com", "A@Example.com"},
+				CcAddresses:  []string{"a@example.com", "b@example.com"},
+				BccAddresses: []string{"b@example.com", "c@example.com"},
+			},
+			&Destination{
+				ToAddresses:  []string{"a@example.com"},
+				CcAddresses:  []string{"b@example.com"},
+				BccAddresses: []string{"c@example.com"},
+			},
+		},
+		{
+			"deduplicated after punycode",
+			&Destination{ToAddresses: []string{"a@bücher.example"}, CcAddresses: []string{"a@xn--bcher-kva.example"}},
+			&Destination{ToAddresses: []string{"a@xn--bcher-kva.example"}},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			resolved, err := resolveDestination(test.input)
+
+			if err != nil {
+				t.Fatal(err)
+			} else if !reflect.DeepEqual(resolved, test.expected) {
+				t.Errorf("expected %+v, got %+v", test.expected, resolved)
+			}
+		})
+	}
+}
+
+func TestResolveDestinationDoesNotShareAddresses(t *testing.T) {
+	input := &Destination{ToAddresses: []string{"to@example.com"}}
+	resolved, err := resolveDestination(input)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input.ToAddresses[0] = "changed@example.com"
+
+	if resolved.ToAddresses[0] != "to@example.com" {
+		t.Error("expected the resolved destination not to share addresses with the input")
+	}
+}
+
+func TestResolveDestinationWithInvalidDomain(t *testing.T) {
+	if _, err := resolveDestination(&Destination{ToAddresses: []string{"a@bü..example"}}); err == nil {
+		t.Error("expected an invalid domain to be rejected")
+	}
+}
+
+func TestPunycodeDomain(t *testing.T) {
+	for _, test := range []struct {
+		domain   string
+		expected string
+	}{
+		{"example.com", "example.com"},
+		{"bücher.example", "xn--bcher-kva.example"},
+		{"mail.München.example", "mail.xn--mnchen-3ya.example"},
+		{"例え.テスト", "xn--r8jz45g.xn--zckzah"},
+		{"ü", "xn--tda"},
+	} {
+		t.Run(test.domain, func(t *testing.T) {
+			if encoded, err := punycodeDomain(test.domain); err != nil {
+				t.Fatal(err)
+			} else if encoded != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, encoded)
+			}
+		})
+	}
+}
+
+func TestSendEmailSendsToResolvedDestination(t *testing.T) {
+	input := simpleEmail("a@bücher.example")
+	input.Destination.CcAddresses = []string{"A@bücher.example", "b@example.com"}
+	client := &fakeClient{}
+	output, err := SendEmail(context.Background(), client, input)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &Destination{
+		ToAddresses: []string{"a@xn--bcher-kva.example"},
+		CcAddresses: []string{"b@example.com"},
+	}
+
+	if !reflect.DeepEqual(output.ResolvedDestination, expected) {
+		t.Errorf("expected %+v to be reported, got %+v", expected, output.ResolvedDestination)
+	} else if sent := client.SentEmails()[0].Destination; !reflect.DeepEqual(sent.ToAddresses, expected.ToAddresses) ||
+		!reflect.DeepEqual(sent.CcAddresses, expected.CcAddresses) {
+		t.Errorf("expected the email to be sent to %+v, got %+v", expected, sent)
+	}
+}
+
+func TestSendBulkEmailSendsToResolvedDestinations(t *testing.T) {
+	client := &fakeClient{}
+	input := bulkEmail("a@bücher.example")
+	input.BulkEmailEntries[0].Destination.BccAddresses = []string{"a@bücher.example"}
+
+	if _, err := SendBulkEmail(context.Background(), client, input); err != nil {
+		t.Fatal(err)
+	}
+
+	sent := client.SentBulkEmails()[0].BulkEmailEntries[0].Destination
+
+	if !reflect.DeepEqual(sent.ToAddresses, []string{"a@xn--bcher-kva.example"}) || len(sent.BccAddresses) != 0 {
+		t.Errorf("expected the entry to be sent to a@xn--bcher-kva.example once, got %+v", sent)
+	}
+}
+
+func TestConvertSendEmailOutputIncludesDestination(t *testing.T) {
+	destination := &Destination{ToAddresses: []string{"to@example.com"}}
+	output := convertSendEmailOutput(&sesv2.SendEmailOutput{MessageId: aws.String("id")}, destination)
+
+	if output.ResolvedDestination != destination || aws.ToString(output.MessageId) != "id" {
+		t.Errorf("expected the message ID and resolved destination, got %+v", output)
+	}
+
+	if output := convertSendEmailOutput(nil, destination); output.ResolvedDestination != destination {
+		t.Error("expected the resolved destination without an SES output")
+	}
+}
+
+func TestSendEmailReportsResolvedReplyTo(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		defaults []string
+		replyTo  []string
+		expected []string
+	}{
+		{"explicit", []string{"default@example.com"}, []string{"reply@example.com"}, []string{"reply@example.com"}},
+		{"default applied", []string{"default@example.com"}, nil, []string{"default@example.com"}},
+		{
+			"deduplicated",
+			nil,
+			[]string{"reply@example.com", "Reply@example.com", "other@example.com"},
+			[]string{"reply@example.com", "other@example.com"},
+		},
+		{"none", nil, nil, nil},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			useSettings(t, Config{DefaultReplyTo: test.defaults})
+
+			input := simpleEmail("a@example.com")
+			input.ReplyToAddresses = test.replyTo
+			client := &fakeClient{}
+			output, err := SendEmail(context.Background(), client, input)
+
+			if err != nil {
+				t.Fatal(err)
+			} else if !reflect.DeepEqual(output.ResolvedReplyTo, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, output.ResolvedReplyTo)
+			} else if sent := client.SentEmails()[0].ReplyToAddresses; !reflect.DeepEqual(sent, test.expected) {
+				t.Errorf("expected the email to be sent with %v, got %v", test.expected, sent)
+			}
+
+			bulkInput := bulkEmail("a@example.com")
+			bulkInput.ReplyToAddresses = test.replyTo
+			bulkOutput, err := SendBulkEmail(context.Background(), client, bulkInput)
+
+			if err != nil {
+				t.Fatal(err)
+			} else if !reflect.DeepEqual(bulkOutput.ResolvedReplyTo, test.expected) {
+				t.Errorf("expected the bulk email to report %v, got %v", test.expected, bulkOutput.ResolvedReplyTo)
+			}
+		})
+	}
+}
+
+func TestSendEmailReportsCoveredRecipients(t *testing.T) {
+	useSettings(t, Config{})
+
+	input := simpleEmail("to@example.com")
+	input.Destination.CcAddresses = []string{"cc@example.com"}
+	input.Destination.BccAddresses = []string{"bcc@example.com"}
+	output, err := SendEmail(context.Background(), &fakeClient{}, input)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := destinationAddresses(output.ResolvedDestination)
+
+	if !reflect.DeepEqual(output.CoveredRecipients, expected) {
+		t.Errorf("expected %v, got %v", expected, output.CoveredRecipients)
+	} else if len(expected) != 3 {
+		t.Errorf("expected every To, CC, and BCC recipient to be covered, got %v", expected)
+	}
+}
+
+func TestSendEmailsAsBulkReportsCoveredRecipients(t *testing.T) {
+	useSettings(t, Config{})
+
+	client := &fakeClient{}
+	outputs, errs := sendEmailsAsBulk(context.Background(), client, bulkEmail("a@example.com", "b@example.com"))
+
+	if len(errs) > 0 {
+		t.Fatal(errs[0])
+	}
+
+	for index, to := range []string{"a@example.com", "b@example.com"} {
+		if !reflect.DeepEqual(outputs[index].CoveredRecipients, []string{to}) {
+			t.Errorf("expected [%s], got %v", to, outputs[index].CoveredRecipients)
+		}
+	}
+}
+
+func TestSendBulkEmailReportsEntryRecipients(t *testing.T) {
+	useSettings(t, Config{})
+	useOptOutChecker(t, fakeOptOutChecker{"b@example.com": true, "d@example.com": true})
+
+	input := bulkEmail("a@example.com", "b@example.com", "c@example.com")
+	input.BulkEmailEntries[2].Destination.CcAddresses = []string{"d@example.com"}
+	input.BulkEmailEntries[2].Destination.BccAddresses = []string{"e@example.com"}
+	output, err := SendBulkEmail(context.Background(), &fakeClient{}, input)
+
+	if err != nil {
+		t.Fatal(err)
+	} else if len(output.BulkEmailEntryResults) != 2 {
+		t.Fatalf("expected the opted out entry to have no result, got %+v", output.BulkEmailEntryResults)
+	}
+
+	for index, expected := range [][]string{{"a@example.com"}, {"c@example.com", "e@example.com"}} {
+		result := output.BulkEmailEntryResults[index]
+
+		if result.Recipients == nil {
+			t.Errorf("expected result %d to have recipients", index)
+		} else if recipients := destinationAddresses(result.Recipients); !reflect.DeepEqual(recipients, expected) {
+			t.Errorf("expected %v, got %v", expected, recipients)
+		}
+	}
+}
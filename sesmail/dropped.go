@@ -0,0 +1,83 @@
+// Reporting of recipients who were left out of a send
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import "strings"
+
+// Why a recipient was left out of a send
+type DropReason string
+
+const (
+	// The recipient opted out according to the configured OptOutChecker.
+	DropReasonOptedOut DropReason = "OPTED_OUT"
+
+	// The recipient's bulk entry was skipped as a duplicate of an earlier entry.
+	DropReasonDuplicateEntry DropReason = "DUPLICATE_ENTRY"
+)
+
+// A recipient who was left out of a send
+type DroppedRecipient struct {
+
+	// The address of the recipient, masked if MASK_DROPPED_RECIPIENTS is enabled.
+	EmailAddress string `json:"address"`
+
+	// Why the recipient was left out.
+	Reason DropReason `json:"reason"`
+
+	// The index of the recipient's bulk entry. Only set for bulk emails.
+	Index *int `json:"index,omitempty"`
+}
+
+func newDroppedRecipients(addresses []string, reason DropReason, index *int) []DroppedRecipient {
+	var dropped []DroppedRecipient
+
+	for _, address := range addresses {
+		if Settings.MaskDroppedRecipients {
+			address = maskAddress(address)
+		}
+
+		dropped = append(dropped, DroppedRecipient{EmailAddress: address, Reason: reason, Index: index})
+	}
+
+	return dropped
+}
+
+// Hides all but the first character of the local part of an address, e.g. j***@example.com
+func maskAddress(address string) string {
+	at := strings.LastIndex(address, "@")
+
+	if at <= 0 {
+		return "***"
+	}
+
+	return address[:1] + "***" + address[at:]
+}
+
+// Masks each of a list of addresses, returning a new list
+func maskAddresses(addresses []string) []string {
+	if addresses == nil {
+		return nil
+	}
+
+	masked := make([]string, 0, len(addresses))
+
+	for _, address := range addresses {
+		masked = append(masked, maskAddress(address))
+	}
+
+	return masked
+}
+
+func destinationAddresses(destination *Destination) []string {
+	if destination == nil {
+		return nil
+	}
+
+	var addresses []string
+
+	addresses = append(addresses, destination.ToAddresses...)
+	addresses = append(addresses, destination.CcAddresses...)
+
+	return append(addresses, destination.BccAddresses...)
+}
@@ -0,0 +1,86 @@
+// Tests for reporting recipients who were left out of a send
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func intPointer(value int) *int {
+	return &value
+}
+
+func TestSendEmailReportsDroppedRecipients(t *testing.T) {
+	useOptOutChecker(t, fakeOptOutChecker{"b@example.com": true})
+
+	input := simpleEmail("a@example.com")
+	input.Destination.CcAddresses = []string{"b@example.com"}
+
+	output, err := SendEmail(context.Background(), &fakeClient{}, input)
+	expected := []DroppedRecipient{{EmailAddress: "b@example.com", Reason: DropReasonOptedOut}}
+
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(output.DroppedRecipients, expected) {
+		t.Errorf("expected %+v, got %+v", expected, output.DroppedRecipients)
+	}
+}
+
+func TestSendBulkEmailReportsDroppedRecipients(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		mask     bool
+		expected []DroppedRecipient
+	}{
+		{
+			"unmasked",
+			false,
+			[]DroppedRecipient{
+				{EmailAddress: "b@example.com", Reason: DropReasonOptedOut, Index: intPointer(1)},
+				{EmailAddress: "a@example.com", Reason: DropReasonDuplicateEntry, Index: intPointer(2)},
+				{EmailAddress: "c@example.com", Reason: DropReasonDuplicateEntry, Index: intPointer(2)},
+			},
+		},
+		{
+			"masked",
+			true,
+			[]DroppedRecipient{
+				{EmailAddress: "b***@example.com", Reason: DropReasonOptedOut, Index: intPointer(1)},
+				{EmailAddress: "a***@example.com", Reason: DropReasonDuplicateEntry, Index: intPointer(2)},
+				{EmailAddress: "c***@example.com", Reason: DropReasonDuplicateEntry, Index: intPointer(2)},
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			useSettings(t, Config{DuplicateRecipients: DuplicateRecipientsSkip, MaskDroppedRecipients: test.mask})
+			useOptOutChecker(t, fakeOptOutChecker{"b@example.com": true})
+
+			input := bulkEmail("a@example.com", "b@example.com", "a@example.com")
+			input.BulkEmailEntries[2].Destination.CcAddresses = []string{"c@example.com"}
+
+			output, err := SendBulkEmail(context.Background(), &fakeClient{}, input)
+
+			if err != nil {
+				t.Fatal(err)
+			} else if !reflect.DeepEqual(output.DroppedRecipients, test.expected) {
+				t.Errorf("expected %+v, got %+v", test.expected, output.DroppedRecipients)
+			}
+		})
+	}
+}
+
+func TestMaskAddress(t *testing.T) {
+	for address, expected := range map[string]string{
+		"jane@example.com": "j***@example.com",
+		"j@example.com":    "j***@example.com",
+		"@example.com":     "***",
+		"not an address":   "***",
+	} {
+		if masked := maskAddress(address); masked != expected {
+			t.Errorf("expected %s to be masked as %s, got %s", address, expected, masked)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+// Detection of bulk entries sent to the same primary recipient
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"errors"
+	"strings"
+)
+
+// Returned for emails sent as bulk entries which were skipped as duplicates of an earlier email
+var ErrDuplicateEntry = errors.New("Skipped as a duplicate of an earlier email")
+
+// How bulk entries whose first To address already appeared in an earlier entry are handled
+type DuplicateRecipientMode string
+
+const (
+	// Send duplicate entries as usual.
+	DuplicateRecipientsAllow DuplicateRecipientMode = ""
+
+	// Send duplicate entries, but report them in the output.
+	DuplicateRecipientsWarn DuplicateRecipientMode = "warn"
+
+	// Leave duplicate entries out of the request, and report them in the output.
+	DuplicateRecipientsSkip DuplicateRecipientMode = "skip"
+)
+
+// A bulk entry whose first To address already appeared in an earlier entry
+type DuplicateRecipient struct {
+
+	// The index of the duplicate entry.
+	Index int `json:"index"`
+
+	// The index of the first entry sent to the same address.
+	FirstIndex int `json:"firstIndex"`
+
+	// The duplicated address.
+	EmailAddress string `json:"address"`
+
+	// Whether the entry was left out of the request.
+	Skipped bool `json:"skipped"`
+}
+
+// Finds entries whose first To address, compared case insensitively, already appeared in an
+// earlier entry. Returns nothing when duplicate detection is disabled.
+func findDuplicateRecipients(entries []BulkEmailEntry) []DuplicateRecipient {
+	if Settings.DuplicateRecipients == DuplicateRecipientsAllow {
+		return nil
+	}
+
+	var duplicates []DuplicateRecipient
+	firstIndexes := map[string]int{}
+
+	for index, entry := range entries {
+		if entry.Destination == nil || len(entry.Destination.ToAddresses) == 0 {
+			continue
+		}
+
+		address := strings.ToLower(strings.TrimSpace(entry.Destination.ToAddresses[0]))
+
+		if firstIndex, ok := firstIndexes[address]; ok {
+			duplicates = append(duplicates, DuplicateRecipient{
+				Index:        index,
+				FirstIndex:   firstIndex,
+				EmailAddress: entry.Destination.ToAddresses[0],
+				Skipped:      Settings.DuplicateRecipients == DuplicateRecipientsSkip,
+			})
+		} else {
+			firstIndexes[address] = index
+		}
+	}
+
+	return duplicates
+}
@@ -0,0 +1,83 @@
+// Tests for detecting bulk entries sent to the same primary recipient
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestSendBulkEmailDuplicateRecipients(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		mode     DuplicateRecipientMode
+		sent     []string
+		expected []DuplicateRecipient
+	}{
+		{
+			"allow",
+			DuplicateRecipientsAllow,
+			[]string{"a@example.com", "b@example.com", "A@example.com ", "a@example.com"},
+			nil,
+		},
+		{
+			"warn",
+			DuplicateRecipientsWarn,
+			[]string{"a@example.com", "b@example.com", "A@example.com ", "a@example.com"},
+			[]DuplicateRecipient{
+				{Index: 2, FirstIndex: 0, EmailAddress: "A@example.com "},
+				{Index: 3, FirstIndex: 0, EmailAddress: "a@example.com"},
+			},
+		},
+		{
+			"skip",
+			DuplicateRecipientsSkip,
+			[]string{"a@example.com", "b@example.com"},
+			[]DuplicateRecipient{
+				{Index: 2, FirstIndex: 0, EmailAddress: "A@example.com ", Skipped: true},
+				{Index: 3, FirstIndex: 0, EmailAddress: "a@example.com", Skipped: true},
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			useSettings(t, Config{DuplicateRecipients: test.mode})
+
+			client := &fakeClient{}
+			input := bulkEmail("a@example.com", "b@example.com", "A@example.com ", "a@example.com")
+			output, err := SendBulkEmail(context.Background(), client, input)
+
+			if err != nil {
+				t.Fatal(err)
+			} else if !reflect.DeepEqual(output.DuplicateRecipients, test.expected) {
+				t.Errorf("expected duplicates %+v, got %+v", test.expected, output.DuplicateRecipients)
+			}
+
+			var sent []string
+
+			for _, entry := range client.SentBulkEmails()[0].BulkEmailEntries {
+				sent = append(sent, entry.Destination.ToAddresses[0])
+			}
+
+			if !reflect.DeepEqual(sent, test.sent) {
+				t.Errorf("expected entries for %v to be sent, got %v", test.sent, sent)
+			}
+		})
+	}
+}
+
+func TestSendBulkEmailUniqueRecipients(t *testing.T) {
+	useSettings(t, Config{DuplicateRecipients: DuplicateRecipientsSkip})
+
+	client := &fakeClient{}
+	output, err := SendBulkEmail(context.Background(), client, bulkEmail("a@example.com", "b@example.com"))
+
+	if err != nil {
+		t.Fatal(err)
+	} else if output.DuplicateRecipients != nil {
+		t.Errorf("expected no duplicates, got %+v", output.DuplicateRecipients)
+	} else if entries := client.SentBulkEmails()[0].BulkEmailEntries; len(entries) != 2 {
+		t.Errorf("expected both entries to be sent, got %d", len(entries))
+	}
+}
@@ -0,0 +1,77 @@
+// Gating of sends on the account's enforcement status
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sesv2 "github.com/aws/aws-sdk-go-v2/service/sesv2"
+)
+
+// How sends are handled while the account isn't in good standing
+type EnforcementMode string
+
+const (
+	// Don't check the enforcement status.
+	EnforcementIgnore EnforcementMode = ""
+
+	// Warn about the enforcement status on every send.
+	EnforcementWarn EnforcementMode = "warn"
+
+	// Reject every send.
+	EnforcementBlock EnforcementMode = "block"
+)
+
+// The enforcement status of an account in good standing
+const healthyEnforcementStatus = "HEALTHY"
+
+// The account's enforcement status, such as HEALTHY or SHUTDOWN, as of the last call to
+// LoadEnforcementStatus. Empty if it hasn't been loaded.
+var EnforcementStatus string
+
+// Returned by every send while ENFORCEMENT_CHECK is set to block and the account isn't in good
+// standing
+var ErrEnforcementBlocked = errors.New("Sending is blocked by the account's enforcement status")
+
+// Looks up the account's enforcement status when ENFORCEMENT_CHECK is set. The Lambda calls this
+// on cold start.
+func LoadEnforcementStatus(ctx context.Context, client Client) error {
+	if Settings.EnforcementCheck == EnforcementIgnore {
+		EnforcementStatus = ""
+
+		return nil
+	}
+
+	output, err := client.GetAccount(ctx, &sesv2.GetAccountInput{})
+
+	if err != nil {
+		return err
+	}
+
+	EnforcementStatus = aws.ToString(output.EnforcementStatus)
+
+	return nil
+}
+
+// Returns a warning if the account isn't in good standing, or an empty string if it is or its
+// status hasn't been loaded
+func EnforcementWarning() string {
+	if EnforcementStatus == "" || EnforcementStatus == healthyEnforcementStatus {
+		return ""
+	}
+
+	return fmt.Sprintf("The account's enforcement status is %s, so sends may fail", EnforcementStatus)
+}
+
+// Rejects sends while the account isn't in good standing, if blocking is enabled
+func checkEnforcement() error {
+	if Settings.EnforcementCheck != EnforcementBlock || EnforcementWarning() == "" {
+		return nil
+	}
+
+	return fmt.Errorf("%w, %s", ErrEnforcementBlocked, EnforcementStatus)
+}
@@ -0,0 +1,75 @@
+// Tests for gating sends on the account's enforcement status
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sesv2 "github.com/aws/aws-sdk-go-v2/service/sesv2"
+)
+
+// A client whose account has the given enforcement status
+func enforcementClient(status string) *fakeClient {
+	return &fakeClient{getAccount: func(context.Context, *sesv2.GetAccountInput) (*sesv2.GetAccountOutput, error) {
+		return &sesv2.GetAccountOutput{EnforcementStatus: aws.String(status)}, nil
+	}}
+}
+
+// Loads the given enforcement status in the given mode, restoring the previous status after the test
+func useEnforcementStatus(t *testing.T, mode EnforcementMode, status string) *fakeClient {
+	previous := EnforcementStatus
+	t.Cleanup(func() { EnforcementStatus = previous })
+	useSettings(t, Config{EnforcementCheck: mode})
+
+	client := enforcementClient(status)
+
+	if err := LoadEnforcementStatus(context.Background(), client); err != nil {
+		t.Fatal(err)
+	}
+
+	return client
+}
+
+func TestEnforcementStatus(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		mode    EnforcementMode
+		status  string
+		warns   bool
+		blocks  bool
+		checked bool
+	}{
+		{"healthy warn", EnforcementWarn, "HEALTHY", false, false, true},
+		{"healthy block", EnforcementBlock, "HEALTHY", false, false, true},
+		{"under review warn", EnforcementWarn, "UNDER_REVIEW", true, false, true},
+		{"shutdown warn", EnforcementWarn, "SHUTDOWN", true, false, true},
+		{"shutdown block", EnforcementBlock, "SHUTDOWN", true, true, true},
+		{"unchecked", EnforcementIgnore, "SHUTDOWN", false, false, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			client := useEnforcementStatus(t, test.mode, test.status)
+
+			if warning := EnforcementWarning(); (warning != "") != test.warns {
+				t.Errorf("expected a warning %t, got %q", test.warns, warning)
+			} else if checked := EnforcementStatus != ""; checked != test.checked {
+				t.Errorf("expected the status to be checked %t, got %q", test.checked, EnforcementStatus)
+			}
+
+			_, emailErr := SendEmail(context.Background(), client, simpleEmail("to@example.com"))
+			_, bulkErr := SendBulkEmail(context.Background(), client, bulkEmail("to@example.com"))
+
+			for _, err := range []error{emailErr, bulkErr} {
+				if (err != nil) != test.blocks {
+					t.Errorf("expected sends to be blocked %t, got %v", test.blocks, err)
+				}
+			}
+
+			if test.blocks && len(client.SentEmails())+len(client.SentBulkEmails()) != 0 {
+				t.Error("expected nothing to be sent while blocked")
+			}
+		})
+	}
+}
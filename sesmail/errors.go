@@ -0,0 +1,246 @@
+// Classification of errors returned while sending emails
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sesv2 "github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+	"github.com/aws/smithy-go"
+)
+
+// Returned by every send while SENDING_DISABLED is set
+var ErrSendingDisabled = errors.New("Sending is disabled")
+
+// Returned when an invocation reaches its deadline, less DEADLINE_MARGIN, before it finishes. Emails
+// sent before then may have been accepted.
+var ErrInvocationTimeout = errors.New("The invocation timed out")
+
+// Returned when a bulk email chunk doesn't finish within BULK_CHUNK_TIMEOUT. SES may still be
+// healthy, so the chunk is worth retrying.
+var ErrChunkTimeout = errors.New("Bulk email chunk timed out")
+
+// Returned for the valid emails of a batch which weren't sent because ValidateBatchFirst is set and
+// another email failed validation
+var ErrBatchValidationFailed = errors.New("Not sent because another email in the batch failed validation")
+
+// An error in the input, found before it was sent to SES
+type ValidationError struct {
+
+	// Why the input is invalid.
+	Err error
+}
+
+func (err *ValidationError) Error() string {
+	return err.Err.Error()
+}
+
+func (err *ValidationError) Unwrap() error {
+	return err.Err
+}
+
+// Wraps an error found checking the input in a ValidationError, so it's reported as
+// VALIDATION_ERROR. Returns nil for a nil error.
+func invalidInput(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &ValidationError{Err: err}
+}
+
+// Returned when an email references a template which doesn't exist
+type ErrTemplateNotFound struct {
+
+	// The name or ARN of the missing template.
+	Name string
+
+	// The error returned by SES, if any.
+	Err error
+}
+
+func (err *ErrTemplateNotFound) Error() string {
+	return fmt.Sprintf("Template %q does not exist", err.Name)
+}
+
+func (err *ErrTemplateNotFound) Unwrap() error {
+	return err.Err
+}
+
+// Converts SES's NotFoundException into ErrTemplateNotFound when the request used a template, so
+// a missing template is reported the same way by every operation
+func templateNotFound(err error, template *types.Template) error {
+	var notFound *types.NotFoundException
+
+	if template == nil || !errors.As(err, &notFound) {
+		return err
+	}
+
+	return newTemplateNotFound(template, err)
+}
+
+// Like templateNotFound, but for sends, whose NotFoundException may instead be about their
+// configuration set, contact list, or identity. A template given by name is looked up to confirm
+// it's missing, while the exception has to mention a template given only by its ARN.
+func sendTemplateNotFound(ctx context.Context, client Client, err error, template *types.Template) error {
+	var notFound *types.NotFoundException
+
+	if template == nil || !errors.As(err, &notFound) {
+		return err
+	} else if aws.ToString(template.TemplateName) == "" {
+		if !strings.Contains(strings.ToLower(notFound.ErrorMessage()), "template") {
+			return err
+		}
+
+		return newTemplateNotFound(template, err)
+	}
+
+	_, lookupErr := client.GetEmailTemplate(ctx, &sesv2.GetEmailTemplateInput{TemplateName: template.TemplateName})
+
+	if !errors.As(lookupErr, &notFound) {
+		return err
+	}
+
+	return newTemplateNotFound(template, err)
+}
+
+func newTemplateNotFound(template *types.Template, err error) *ErrTemplateNotFound {
+	return &ErrTemplateNotFound{Name: templateIdentifier(template), Err: err}
+}
+
+// Returns the name of a template, or its ARN if it has no name
+func templateIdentifier(template *types.Template) string {
+	if template == nil {
+		return ""
+	} else if name := aws.ToString(template.TemplateName); name != "" {
+		return name
+	}
+
+	return aws.ToString(template.TemplateArn)
+}
+
+// An error sending one of several emails, which records the email it belongs to
+type EmailError struct {
+
+	// The index of the email in the inputs it was sent with.
+	Index int
+
+	// The recipients of the email, if it had any.
+	Destination *Destination
+
+	// Why the email wasn't sent.
+	Err error
+}
+
+func (err *EmailError) Error() string {
+	return err.Err.Error()
+}
+
+func (err *EmailError) Unwrap() error {
+	return err.Err
+}
+
+// A failed entry of a bulk email sent in place of an individual email
+type BulkEntryError struct {
+
+	// The status SES returned for the entry.
+	Status BulkEmailStatus
+
+	// The error SES described the entry's failure with.
+	Message string
+}
+
+func (err *BulkEntryError) Error() string {
+	return fmt.Sprintf("Bulk email entry %s: %s", err.Status, err.Message)
+}
+
+// Returns a short reason for an error, which is the SES error code for API errors such as
+// TooManyRequestsException, or the message for everything else
+func ErrorReason(err error) string {
+	var apiErr smithy.APIError
+
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorCode()
+	}
+
+	return err.Error()
+}
+
+// An error in a form which survives being serialized to JSON, unlike the error interface
+type APIError struct {
+
+	// The error message.
+	Message string `json:"message"`
+
+	// The SES error code, such as MessageRejected, if SES returned the error.
+	Code string `json:"code,omitempty"`
+
+	// The index of the email the error belongs to, when sending several.
+	Index *int `json:"index,omitempty"`
+
+	// The recipients of the email the error belongs to, when sending several.
+	Destination *Destination `json:"destination,omitempty"`
+}
+
+func (err *APIError) Error() string {
+	return err.Message
+}
+
+// Converts an error into an APIError, or nil if there was no error
+func NewAPIError(err error) *APIError {
+	if err == nil {
+		return nil
+	}
+
+	converted := &APIError{Message: err.Error()}
+	var apiErr smithy.APIError
+	var emailErr *EmailError
+
+	if errors.As(err, &apiErr) {
+		converted.Code = apiErr.ErrorCode()
+	}
+
+	if errors.As(err, &emailErr) {
+		index := emailErr.Index
+		converted.Index = &index
+		converted.Destination = emailErr.Destination
+	}
+
+	return converted
+}
+
+// Converts each error into an APIError
+func NewAPIErrors(errs []error) []*APIError {
+	if errs == nil {
+		return nil
+	}
+
+	converted := make([]*APIError, 0, len(errs))
+
+	for _, err := range errs {
+		converted = append(converted, NewAPIError(err))
+	}
+
+	return converted
+}
+
+// Groups errors by their reason, counting how many times each reason occurred
+func SummarizeErrors(errs []error) map[string]int {
+	if len(errs) == 0 {
+		return nil
+	}
+
+	summary := make(map[string]int)
+
+	for _, err := range errs {
+		summary[ErrorReason(err)]++
+	}
+
+	return summary
+}
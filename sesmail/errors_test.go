@@ -0,0 +1,387 @@
+// Tests for classification of errors returned while sending emails
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sesv2 "github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+	"github.com/aws/smithy-go"
+)
+
+func TestSummarizeErrors(t *testing.T) {
+	throttled := &smithy.GenericAPIError{Code: "TooManyRequestsException", Message: "Rate exceeded"}
+	rejected := &smithy.GenericAPIError{Code: "MessageRejected", Message: "Email address is not verified"}
+
+	summary := SummarizeErrors([]error{
+		throttled,
+		fmt.Errorf("operation error SES: SendEmail, %w", throttled),
+		rejected,
+		throttled,
+		errors.New("Content is required"),
+		errors.New("Content is required"),
+	})
+
+	expected := map[string]int{
+		"TooManyRequestsException": 3,
+		"MessageRejected":          1,
+		"Content is required":      2,
+	}
+
+	if !reflect.DeepEqual(summary, expected) {
+		t.Errorf("expected %v, got %v", expected, summary)
+	}
+}
+
+func TestSummarizeErrorsWithoutErrors(t *testing.T) {
+	if summary := SummarizeErrors(nil); summary != nil {
+		t.Errorf("expected no summary, got %v", summary)
+	}
+}
+
+func TestSummarizeErrorsDistinctReasons(t *testing.T) {
+	summary := SummarizeErrors([]error{errors.New("first"), errors.New("second")})
+
+	if len(summary) != 2 || summary["first"] != 1 || summary["second"] != 1 {
+		t.Errorf("expected each reason once, got %v", summary)
+	}
+}
+
+func TestNewAPIError(t *testing.T) {
+	rejected := &smithy.GenericAPIError{Code: "MessageRejected", Message: "Email address is not verified"}
+
+	for _, test := range []struct {
+		name     string
+		err      error
+		expected *APIError
+	}{
+		{"no error", nil, nil},
+		{"plain", errors.New("Content is required"), &APIError{Message: "Content is required"}},
+		{"ses", rejected, &APIError{Message: rejected.Error(), Code: "MessageRejected"}},
+		{
+			"wrapped ses",
+			fmt.Errorf("operation error SES: SendEmail, %w", rejected),
+			&APIError{Message: "operation error SES: SendEmail, " + rejected.Error(), Code: "MessageRejected"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if converted := NewAPIError(test.err); !reflect.DeepEqual(converted, test.expected) {
+				t.Errorf("expected %+v, got %+v", test.expected, converted)
+			}
+		})
+	}
+}
+
+func TestAPIErrorMarshalsMessage(t *testing.T) {
+	encoded, err := json.Marshal(NewAPIErrors([]error{errors.New("Content is required")}))
+
+	if err != nil {
+		t.Fatal(err)
+	} else if expected := `[{"message":"Content is required"}]`; string(encoded) != expected {
+		t.Errorf("expected %s, got %s", expected, encoded)
+	}
+}
+
+// A client which reports every template as missing
+func missingTemplateClient() *fakeClient {
+	notFound := &types.NotFoundException{Message: aws.String("Template missing does not exist.")}
+
+	return &fakeClient{
+		sendEmail: func(context.Context, *sesv2.SendEmailInput) (*sesv2.SendEmailOutput, error) {
+			return nil, notFound
+		},
+		sendBulkEmail: func(context.Context, *sesv2.SendBulkEmailInput) (*sesv2.SendBulkEmailOutput, error) {
+			return nil, notFound
+		},
+	}
+}
+
+func firstError(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return errs[0]
+}
+
+func TestTemplateNotFoundAcrossOperations(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		settings Config
+		send     func(client Client) error
+	}{
+		{"email", Config{}, func(client Client) error {
+			_, err := SendEmail(context.Background(), client, templatedEmail("a@example.com", "missing"))
+
+			return err
+		}},
+		{"emails", Config{}, func(client Client) error {
+			_, errs := SendEmails(context.Background(), client, []*SendEmailInput{templatedEmail("a@example.com", "missing")})
+
+			return firstError(errs)
+		}},
+		{"batched emails", Config{BatchTemplatedEmails: true}, func(client Client) error {
+			_, errs := SendEmails(context.Background(), client, []*SendEmailInput{
+				templatedEmail("a@example.com", "missing"),
+				templatedEmail("b@example.com", "missing"),
+			})
+
+			return firstError(errs)
+		}},
+		{"bulk email", Config{}, func(client Client) error {
+			input := bulkEmail("a@example.com")
+			input.DefaultContent.Template.TemplateName = aws.String("missing")
+			_, err := SendBulkEmail(context.Background(), client, input)
+
+			return err
+		}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			useSettings(t, test.settings)
+
+			var notFound *ErrTemplateNotFound
+			err := test.send(missingTemplateClient())
+
+			if !errors.As(err, &notFound) {
+				t.Fatalf("expected ErrTemplateNotFound, got %v", err)
+			} else if notFound.Name != "missing" {
+				t.Errorf("expected the template name missing, got %q", notFound.Name)
+			} else if notFound.Error() != `Template "missing" does not exist` {
+				t.Errorf("unexpected message %q", notFound.Error())
+			}
+		})
+	}
+}
+
+func TestTemplateNotFoundOnlyForTemplates(t *testing.T) {
+	notFound := &types.NotFoundException{Message: aws.String("Configuration set does not exist.")}
+	client := &fakeClient{sendEmail: func(context.Context, *sesv2.SendEmailInput) (*sesv2.SendEmailOutput, error) {
+		return nil, notFound
+	}}
+
+	var templateErr *ErrTemplateNotFound
+
+	if _, err := SendEmail(context.Background(), client, simpleEmail("a@example.com")); errors.As(err, &templateErr) {
+		t.Errorf("expected a simple email not to report a missing template, got %v", err)
+	}
+}
+
+func TestTemplateNotFoundOnlyWhenTheTemplateIsMissing(t *testing.T) {
+	notFound := &types.NotFoundException{Message: aws.String("Configuration set marketing does not exist.")}
+	client := &fakeClient{
+		sendEmail: func(context.Context, *sesv2.SendEmailInput) (*sesv2.SendEmailOutput, error) {
+			return nil, notFound
+		},
+		sendBulkEmail: func(context.Context, *sesv2.SendBulkEmailInput) (*sesv2.SendBulkEmailOutput, error) {
+			return nil, notFound
+		},
+		templates: map[string]*types.EmailTemplateContent{"welcome": {}},
+	}
+
+	byArn := templatedEmail("a@example.com", "")
+	byArn.Content.Template.TemplateArn = aws.String("arn:aws:ses:us-east-1:123456789012:template/welcome")
+	bulk := bulkEmail("a@example.com")
+	bulk.DefaultContent.Template.TemplateName = aws.String("welcome")
+
+	var templateErr *ErrTemplateNotFound
+
+	if _, err := SendEmail(context.Background(), client, templatedEmail("a@example.com", "welcome")); errors.As(err, &templateErr) || !errors.Is(err, notFound) {
+		t.Errorf("expected the configuration set error for an existing template, got %v", err)
+	} else if _, err := SendEmail(context.Background(), client, byArn); errors.As(err, &templateErr) || !errors.Is(err, notFound) {
+		t.Errorf("expected the configuration set error for a template ARN, got %v", err)
+	} else if _, err := SendBulkEmail(context.Background(), client, bulk); errors.As(err, &templateErr) || !errors.Is(err, notFound) {
+		t.Errorf("expected the configuration set error for a bulk email, got %v", err)
+	}
+}
+
+func TestTemplateNotFoundBulkEntryStatus(t *testing.T) {
+	client := &fakeClient{sendBulkEmail: func(_ context.Context, params *sesv2.SendBulkEmailInput) (*sesv2.SendBulkEmailOutput, error) {
+		output := acceptBulkEmail(params)
+		output.BulkEmailEntryResults[0].Status = types.BulkEmailStatusTemplateNotFound
+
+		return output, nil
+	}}
+
+	output, err := SendBulkEmail(context.Background(), client, bulkEmail("a@example.com"))
+
+	if err != nil {
+		t.Fatal(err)
+	} else if message := aws.ToString(output.BulkEmailEntryResults[0].Error); message != `Template "template" does not exist` {
+		t.Errorf("expected the missing template error, got %q", message)
+	}
+}
+
+func TestSendEmailsReportsFailedEmails(t *testing.T) {
+	for _, batchFirst := range []bool{false, true} {
+		t.Run(fmt.Sprintf("validate batch first %t", batchFirst), func(t *testing.T) {
+			useSettings(t, Config{ValidateBatchFirst: batchFirst})
+
+			rejected := &smithy.GenericAPIError{Code: "MessageRejected", Message: "Email address is not verified."}
+			client := &fakeClient{sendEmail: func(ctx context.Context, params *sesv2.SendEmailInput) (*sesv2.SendEmailOutput, error) {
+				if params.Destination.ToAddresses[0] == "rejected@example.com" {
+					return nil, rejected
+				}
+
+				return &sesv2.SendEmailOutput{MessageId: aws.String("id")}, nil
+			}}
+			inputs := []*SendEmailInput{
+				simpleEmail("a@example.com"),
+				simpleEmail("rejected@example.com"),
+				simpleEmail("b@example.com"),
+				{Destination: &Destination{ToAddresses: []string{"invalid@example.com"}}},
+				simpleEmail("rejected@example.com"),
+			}
+
+			expected := []int{1, 3, 4}
+
+			if batchFirst {
+				// Nothing is sent when an email is invalid, so every email has an error
+				expected = []int{0, 1, 2, 3, 4}
+			}
+
+			_, errs := SendEmails(context.Background(), client, inputs)
+
+			if len(errs) != len(expected) {
+				t.Fatalf("expected %d errors, got %v", len(expected), errs)
+			}
+
+			for position, err := range errs {
+				var emailErr *EmailError
+
+				if !errors.As(err, &emailErr) {
+					t.Fatalf("expected an email error, got %v", err)
+				} else if emailErr.Index != expected[position] || emailErr.Destination != inputs[expected[position]].Destination {
+					t.Errorf("expected email %d, got email %d to %v", expected[position], emailErr.Index, emailErr.Destination)
+				}
+
+				converted := NewAPIError(err)
+
+				if converted.Index == nil || *converted.Index != expected[position] || converted.Destination != emailErr.Destination {
+					t.Errorf("expected the API error to carry email %d, got %+v", expected[position], converted)
+				}
+			}
+		})
+	}
+}
+
+func TestSendEmailsReportsNilEmails(t *testing.T) {
+	useSettings(t, Config{MaxConcurrency: 2})
+
+	client := &fakeClient{}
+	outputs, errs := SendEmails(context.Background(), client, []*SendEmailInput{nil, simpleEmail("to@example.com")})
+	var emailErr *EmailError
+
+	if len(outputs) != 1 || len(errs) != 1 {
+		t.Fatalf("expected 1 output and 1 error, got %v and %v", outputs, errs)
+	} else if !errors.As(errs[0], &emailErr) || emailErr.Index != 0 || emailErr.Err.Error() != "Email is required" {
+		t.Errorf("expected email 0 to be required, got %v", errs[0])
+	}
+}
+
+func TestSendEmailsAsBulkReportsFailedEntries(t *testing.T) {
+	useSettings(t, Config{})
+
+	client := &fakeClient{sendBulkEmail: func(ctx context.Context, params *sesv2.SendBulkEmailInput) (*sesv2.SendBulkEmailOutput, error) {
+		output := &sesv2.SendBulkEmailOutput{}
+
+		for _, entry := range params.BulkEmailEntries {
+			result := types.BulkEmailEntryResult{Status: types.BulkEmailStatusSuccess, MessageId: aws.String("id")}
+
+			if entry.Destination.ToAddresses[0] == "rejected@example.com" {
+				result = types.BulkEmailEntryResult{Status: types.BulkEmailStatusMessageRejected, Error: aws.String("rejected")}
+			}
+
+			output.BulkEmailEntryResults = append(output.BulkEmailEntryResults, result)
+		}
+
+		return output, nil
+	}}
+	input := bulkEmail("a@example.com", "rejected@example.com", "b@example.com")
+
+	_, errs := sendEmailsAsBulk(context.Background(), client, input)
+
+	var emailErr *EmailError
+
+	if len(errs) != 1 || !errors.As(errs[0], &emailErr) {
+		t.Fatalf("expected one email error, got %v", errs)
+	} else if emailErr.Index != 1 || emailErr.Destination != input.BulkEmailEntries[1].Destination {
+		t.Errorf("expected entry 1, got entry %d to %v", emailErr.Index, emailErr.Destination)
+	}
+}
+
+func TestSendEmailsAsBulkReportsSkippedEntries(t *testing.T) {
+	useSettings(t, Config{BatchTemplatedEmails: true, DuplicateRecipients: DuplicateRecipientsSkip})
+	useOptOutChecker(t, fakeOptOutChecker{"opted-out@example.com": true})
+
+	client := &fakeClient{}
+	outputs, errs := SendEmails(context.Background(), client, []*SendEmailInput{
+		templatedEmail("x@example.com", "welcome"),
+		templatedEmail("x@example.com", "welcome"),
+		templatedEmail("opted-out@example.com", "welcome"),
+		templatedEmail("z@example.com", "welcome"),
+	})
+
+	if len(client.SentBulkEmails()) != 1 {
+		t.Fatalf("expected the emails to be sent as a bulk email, got %d", len(client.SentBulkEmails()))
+	} else if len(outputs) != 2 {
+		t.Fatalf("expected 2 emails to be sent, got %d", len(outputs))
+	}
+
+	for index, to := range []string{"x@example.com", "z@example.com"} {
+		if id := aws.ToString(outputs[index].MessageId); id != "bulk-"+to {
+			t.Errorf("expected output %d to be for %s, got %s", index, to, id)
+		}
+	}
+
+	expected := []struct {
+		index int
+		err   error
+	}{
+		{1, ErrDuplicateEntry},
+		{2, ErrAllRecipientsOptedOut},
+	}
+
+	if len(errs) != len(expected) {
+		t.Fatalf("expected %d errors, got %v", len(expected), errs)
+	}
+
+	for i, test := range expected {
+		var emailErr *EmailError
+
+		if !errors.As(errs[i], &emailErr) || emailErr.Index != test.index || !errors.Is(emailErr, test.err) {
+			t.Errorf("expected email %d to fail with %v, got %v", test.index, test.err, errs[i])
+		}
+	}
+
+	// Every error has a cause, so summarizing them mustn't panic
+	if summary := SummarizeErrors(errs); len(summary) != 2 {
+		t.Errorf("expected 2 reasons, got %v", summary)
+	} else if apiErrs := NewAPIErrors(errs); len(apiErrs) != 2 {
+		t.Errorf("expected 2 API errors, got %v", apiErrs)
+	}
+}
+
+func TestSendEmailsAsBulkWithoutResults(t *testing.T) {
+	useSettings(t, Config{})
+
+	client := &fakeClient{sendBulkEmail: func(ctx context.Context, params *sesv2.SendBulkEmailInput) (*sesv2.SendBulkEmailOutput, error) {
+		return &sesv2.SendBulkEmailOutput{}, nil
+	}}
+	_, errs := sendEmailsAsBulk(context.Background(), client, bulkEmail("a@example.com"))
+
+	var emailErr *EmailError
+
+	if len(errs) != 1 || !errors.As(errs[0], &emailErr) {
+		t.Fatalf("expected one email error, got %v", errs)
+	} else if emailErr.Err == nil {
+		t.Error("expected an entry without a result to have a cause")
+	}
+}
@@ -0,0 +1,157 @@
+// Creation of configuration set event destinations
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sesv2 "github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+)
+
+// A CloudWatch dimension which sending metrics are published with
+type CloudWatchDimension struct {
+
+	// The name of the dimension.
+	Name string `json:"name"`
+
+	// The value published when an email doesn't specify one.
+	DefaultValue string `json:"defaultValue"`
+
+	// Where SES finds the value of the dimension, either MESSAGE_TAG, EMAIL_HEADER, or LINK_TAG.
+	Source string `json:"source"`
+}
+
+// Attaches an SNS topic or CloudWatch destination to a configuration set, which receives the
+// events of emails sent with the configuration set
+type CreateEventDestinationInput struct {
+
+	// The name of the configuration set.
+	//
+	// This member is required.
+	ConfigurationSetName *string `json:"configSetName"`
+
+	// A name that identifies the event destination within the configuration set.
+	//
+	// This member is required.
+	EventDestinationName *string `json:"name"`
+
+	// The events sent to the destination, such as SEND, DELIVERY, and BOUNCE.
+	//
+	// This member is required.
+	MatchingEventTypes []string `json:"eventTypes"`
+
+	// Whether the destination receives events. Defaults to true.
+	Enabled *bool `json:"enabled"`
+
+	// The ARN of the SNS topic events are published to.
+	SnsTopicArn *string `json:"snsTopicArn"`
+
+	// The dimensions events are published to CloudWatch with.
+	CloudWatchDimensions []CloudWatchDimension `json:"cloudWatchDimensions"`
+}
+
+func validateCreateEventDestinationInput(input *CreateEventDestinationInput) error {
+	if aws.ToString(input.ConfigurationSetName) == "" {
+		return errors.New("Configuration set name is required")
+	} else if aws.ToString(input.EventDestinationName) == "" {
+		return errors.New("Event destination name is required")
+	} else if (input.SnsTopicArn == nil) == (len(input.CloudWatchDimensions) == 0) {
+		return errors.New("Exactly one of an SNS topic or CloudWatch dimensions is required")
+	} else if len(input.MatchingEventTypes) == 0 {
+		return errors.New("At least one event type is required")
+	}
+
+	seen := map[string]bool{}
+
+	for _, eventType := range input.MatchingEventTypes {
+		if !isKnownEventType(types.EventType(eventType)) {
+			return fmt.Errorf("Unknown event type %q", eventType)
+		} else if seen[eventType] {
+			return fmt.Errorf("Event type %s is repeated", eventType)
+		}
+
+		seen[eventType] = true
+	}
+
+	for _, dimension := range input.CloudWatchDimensions {
+		if problems := validateTag(dimension.Name, dimension.DefaultValue); len(problems) > 0 {
+			return fmt.Errorf("Invalid CloudWatch dimension: %s", problems[0])
+		} else if !isKnownDimensionSource(types.DimensionValueSource(dimension.Source)) {
+			return fmt.Errorf("Unknown CloudWatch dimension source %q", dimension.Source)
+		}
+	}
+
+	return nil
+}
+
+func isKnownEventType(eventType types.EventType) bool {
+	for _, known := range eventType.Values() {
+		if eventType == known {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isKnownDimensionSource(source types.DimensionValueSource) bool {
+	for _, known := range source.Values() {
+		if source == known {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Converts the input into an SES request
+func createEventDestinationInput(
+	input *CreateEventDestinationInput,
+) *sesv2.CreateConfigurationSetEventDestinationInput {
+	definition := &types.EventDestinationDefinition{
+		Enabled: input.Enabled == nil || *input.Enabled,
+	}
+
+	for _, eventType := range input.MatchingEventTypes {
+		definition.MatchingEventTypes = append(definition.MatchingEventTypes, types.EventType(eventType))
+	}
+
+	if input.SnsTopicArn != nil {
+		definition.SnsDestination = &types.SnsDestination{TopicArn: input.SnsTopicArn}
+	} else {
+		definition.CloudWatchDestination = &types.CloudWatchDestination{}
+
+		for _, dimension := range input.CloudWatchDimensions {
+			definition.CloudWatchDestination.DimensionConfigurations = append(
+				definition.CloudWatchDestination.DimensionConfigurations,
+				types.CloudWatchDimensionConfiguration{
+					DefaultDimensionValue: aws.String(dimension.DefaultValue),
+					DimensionName:         aws.String(dimension.Name),
+					DimensionValueSource:  types.DimensionValueSource(dimension.Source),
+				},
+			)
+		}
+	}
+
+	return &sesv2.CreateConfigurationSetEventDestinationInput{
+		ConfigurationSetName: input.ConfigurationSetName,
+		EventDestination:     definition,
+		EventDestinationName: input.EventDestinationName,
+	}
+}
+
+// Attaches an event destination to a configuration set
+func CreateEventDestination(ctx context.Context, client Client, input *CreateEventDestinationInput) error {
+	if err := validateCreateEventDestinationInput(input); err != nil {
+		return invalidInput(err)
+	}
+
+	_, err := client.CreateConfigurationSetEventDestination(ctx, createEventDestinationInput(input))
+
+	return err
+}
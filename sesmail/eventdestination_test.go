@@ -0,0 +1,114 @@
+// Tests for creating configuration set event destinations
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sesv2 "github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+)
+
+// An input attaching an SNS topic which receives the given events
+func snsEventDestination(eventTypes ...string) *CreateEventDestinationInput {
+	return &CreateEventDestinationInput{
+		ConfigurationSetName: aws.String("default"),
+		EventDestinationName: aws.String("events"),
+		MatchingEventTypes:   eventTypes,
+		SnsTopicArn:          aws.String("arn:aws:sns:us-east-1:123456789012:events"),
+	}
+}
+
+func TestValidateCreateEventDestinationInput(t *testing.T) {
+	cloudWatch := snsEventDestination("SEND")
+	cloudWatch.SnsTopicArn = nil
+	cloudWatch.CloudWatchDimensions = []CloudWatchDimension{{Name: "campaign", DefaultValue: "none", Source: "MESSAGE_TAG"}}
+
+	badSource := snsEventDestination("SEND")
+	badSource.SnsTopicArn = nil
+	badSource.CloudWatchDimensions = []CloudWatchDimension{{Name: "campaign", DefaultValue: "none", Source: "BODY"}}
+
+	both := snsEventDestination("SEND")
+	both.CloudWatchDimensions = cloudWatch.CloudWatchDimensions
+
+	for _, test := range []struct {
+		name     string
+		input    *CreateEventDestinationInput
+		expected string
+	}{
+		{"SNS", snsEventDestination("SEND", "DELIVERY", "BOUNCE"), ""},
+		{"CloudWatch", cloudWatch, ""},
+		{"no configuration set", &CreateEventDestinationInput{}, "Configuration set name is required"},
+		{"no event types", snsEventDestination(), "At least one event type is required"},
+		{"unknown event type", snsEventDestination("SEND", "OPENED"), `Unknown event type "OPENED"`},
+		{"repeated event type", snsEventDestination("SEND", "SEND"), "Event type SEND is repeated"},
+		{"both destinations", both, "Exactly one of an SNS topic or CloudWatch dimensions is required"},
+		{"unknown dimension source", badSource, `Unknown CloudWatch dimension source "BODY"`},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateCreateEventDestinationInput(test.input)
+
+			if test.expected == "" && err != nil {
+				t.Errorf("expected no error, got %v", err)
+			} else if test.expected != "" && (err == nil || err.Error() != test.expected) {
+				t.Errorf("expected %q, got %v", test.expected, err)
+			}
+		})
+	}
+}
+
+func TestCreateEventDestinationBuildsRequest(t *testing.T) {
+	var sent *sesv2.CreateConfigurationSetEventDestinationInput
+	client := &fakeClient{createEventDestination: func(
+		_ context.Context,
+		params *sesv2.CreateConfigurationSetEventDestinationInput,
+	) (*sesv2.CreateConfigurationSetEventDestinationOutput, error) {
+		sent = params
+
+		return &sesv2.CreateConfigurationSetEventDestinationOutput{}, nil
+	}}
+
+	if err := CreateEventDestination(context.Background(), client, snsEventDestination("SEND", "BOUNCE")); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &sesv2.CreateConfigurationSetEventDestinationInput{
+		ConfigurationSetName: aws.String("default"),
+		EventDestinationName: aws.String("events"),
+		EventDestination: &types.EventDestinationDefinition{
+			Enabled:            true,
+			MatchingEventTypes: []types.EventType{types.EventTypeSend, types.EventTypeBounce},
+			SnsDestination:     &types.SnsDestination{TopicArn: aws.String("arn:aws:sns:us-east-1:123456789012:events")},
+		},
+	}
+
+	if !reflect.DeepEqual(sent, expected) {
+		t.Errorf("expected %+v, got %+v", expected, sent)
+	}
+}
+
+func TestCreateEventDestinationInputCloudWatch(t *testing.T) {
+	input := snsEventDestination("DELIVERY")
+	input.SnsTopicArn = nil
+	input.Enabled = aws.Bool(false)
+	input.CloudWatchDimensions = []CloudWatchDimension{{Name: "campaign", DefaultValue: "none", Source: "MESSAGE_TAG"}}
+
+	definition := createEventDestinationInput(input).EventDestination
+	expected := &types.CloudWatchDestination{
+		DimensionConfigurations: []types.CloudWatchDimensionConfiguration{{
+			DefaultDimensionValue: aws.String("none"),
+			DimensionName:         aws.String("campaign"),
+			DimensionValueSource:  types.DimensionValueSourceMessageTag,
+		}},
+	}
+
+	if definition.Enabled {
+		t.Error("expected the destination to be disabled")
+	} else if definition.SnsDestination != nil || !reflect.DeepEqual(definition.CloudWatchDestination, expected) {
+		t.Errorf("expected %+v, got %+v", expected, definition.CloudWatchDestination)
+	}
+}
@@ -0,0 +1,295 @@
+// Failover to a secondary region when the primary region is unavailable
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+
+	sesv2 "github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// A client which retries requests against a client in a fallback region when the primary region
+// can't be reached or fails with a server error. Requests which SES rejected, such as invalid
+// emails or throttling, are not retried. Sends are only retried when SES can't have accepted them,
+// since retrying one which it may have accepted could send the email twice.
+type FailoverClient struct {
+	Primary       Client
+	PrimaryRegion string
+
+	Fallback       Client
+	FallbackRegion string
+}
+
+type regionKey struct{}
+
+// Returns the region a FailoverClient sent a request to, or an empty string if the request wasn't
+// sent through a FailoverClient
+func regionFromMetadata(metadata middleware.Metadata) string {
+	region, _ := metadata.Get(regionKey{}).(string)
+
+	return region
+}
+
+// Whether an error means the region is unavailable, rather than the request being rejected
+func isRegionalError(err error) bool {
+	var sendErr *smithyhttp.RequestSendError
+	var responseErr *smithyhttp.ResponseError
+	var apiErr smithy.APIError
+
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	} else if errors.As(err, &sendErr) {
+		return true
+	} else if errors.As(err, &apiErr) && apiErr.ErrorFault() == smithy.FaultServer {
+		return true
+	}
+
+	return errors.As(err, &responseErr) && responseErr.HTTPStatusCode() >= 500
+}
+
+// Whether an error means a send never reached SES, because no connection could be made or SES was
+// unavailable, so retrying it elsewhere can't send the email twice. Other server errors and
+// dropped connections may come after SES accepted the email.
+func isUnsentError(err error) bool {
+	var dnsErr *net.DNSError
+	var opErr *net.OpError
+	var responseErr *smithyhttp.ResponseError
+
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	} else if errors.As(err, &dnsErr) || (errors.As(err, &opErr) && opErr.Op == "dial") {
+		return true
+	}
+
+	return errors.As(err, &responseErr) && responseErr.HTTPStatusCode() == http.StatusServiceUnavailable
+}
+
+// Whether to retry a request in the fallback region, which canRetry decides from its error
+func (client *FailoverClient) shouldFailover(err error, canRetry func(error) bool) bool {
+	if client.Fallback == nil || !canRetry(err) {
+		return false
+	}
+
+	log.Printf("request to %s failed, retrying in %s, %v", client.PrimaryRegion, client.FallbackRegion, err)
+
+	return true
+}
+
+func (client *FailoverClient) SendEmail(
+	ctx context.Context,
+	params *sesv2.SendEmailInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.SendEmailOutput, error) {
+	output, err := client.Primary.SendEmail(ctx, params, optFns...)
+	region := client.PrimaryRegion
+
+	if client.shouldFailover(err, isUnsentError) {
+		output, err = client.Fallback.SendEmail(ctx, params, optFns...)
+		region = client.FallbackRegion
+	}
+
+	if output != nil {
+		output.ResultMetadata.Set(regionKey{}, region)
+	}
+
+	return output, err
+}
+
+func (client *FailoverClient) SendBulkEmail(
+	ctx context.Context,
+	params *sesv2.SendBulkEmailInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.SendBulkEmailOutput, error) {
+	output, err := client.Primary.SendBulkEmail(ctx, params, optFns...)
+	region := client.PrimaryRegion
+
+	if client.shouldFailover(err, isUnsentError) {
+		output, err = client.Fallback.SendBulkEmail(ctx, params, optFns...)
+		region = client.FallbackRegion
+	}
+
+	if output != nil {
+		output.ResultMetadata.Set(regionKey{}, region)
+	}
+
+	return output, err
+}
+
+func (client *FailoverClient) GetAccount(
+	ctx context.Context,
+	params *sesv2.GetAccountInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.GetAccountOutput, error) {
+	return client.Primary.GetAccount(ctx, params, optFns...)
+}
+
+func (client *FailoverClient) GetSuppressedDestination(
+	ctx context.Context,
+	params *sesv2.GetSuppressedDestinationInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.GetSuppressedDestinationOutput, error) {
+	output, err := client.Primary.GetSuppressedDestination(ctx, params, optFns...)
+
+	if client.shouldFailover(err, isRegionalError) {
+		return client.Fallback.GetSuppressedDestination(ctx, params, optFns...)
+	}
+
+	return output, err
+}
+
+// Configuration sets belong to a region, so event destinations are only created in the primary
+// region
+func (client *FailoverClient) CreateConfigurationSetEventDestination(
+	ctx context.Context,
+	params *sesv2.CreateConfigurationSetEventDestinationInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.CreateConfigurationSetEventDestinationOutput, error) {
+	return client.Primary.CreateConfigurationSetEventDestination(ctx, params, optFns...)
+}
+
+func (client *FailoverClient) GetEmailTemplate(
+	ctx context.Context,
+	params *sesv2.GetEmailTemplateInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.GetEmailTemplateOutput, error) {
+	output, err := client.Primary.GetEmailTemplate(ctx, params, optFns...)
+
+	if client.shouldFailover(err, isRegionalError) {
+		return client.Fallback.GetEmailTemplate(ctx, params, optFns...)
+	}
+
+	return output, err
+}
+
+// Templates belong to a region, so they're only managed in the primary region. Send with the
+// fallback region's templates by creating them there separately.
+func (client *FailoverClient) CreateEmailTemplate(
+	ctx context.Context,
+	params *sesv2.CreateEmailTemplateInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.CreateEmailTemplateOutput, error) {
+	return client.Primary.CreateEmailTemplate(ctx, params, optFns...)
+}
+
+func (client *FailoverClient) UpdateEmailTemplate(
+	ctx context.Context,
+	params *sesv2.UpdateEmailTemplateInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.UpdateEmailTemplateOutput, error) {
+	return client.Primary.UpdateEmailTemplate(ctx, params, optFns...)
+}
+
+func (client *FailoverClient) DeleteEmailTemplate(
+	ctx context.Context,
+	params *sesv2.DeleteEmailTemplateInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.DeleteEmailTemplateOutput, error) {
+	return client.Primary.DeleteEmailTemplate(ctx, params, optFns...)
+}
+
+// Each region has its own suppression list, so it's only managed in the primary region
+func (client *FailoverClient) PutSuppressedDestination(
+	ctx context.Context,
+	params *sesv2.PutSuppressedDestinationInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.PutSuppressedDestinationOutput, error) {
+	return client.Primary.PutSuppressedDestination(ctx, params, optFns...)
+}
+
+func (client *FailoverClient) DeleteSuppressedDestination(
+	ctx context.Context,
+	params *sesv2.DeleteSuppressedDestinationInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.DeleteSuppressedDestinationOutput, error) {
+	return client.Primary.DeleteSuppressedDestination(ctx, params, optFns...)
+}
+
+func (client *FailoverClient) ListSuppressedDestinations(
+	ctx context.Context,
+	params *sesv2.ListSuppressedDestinationsInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.ListSuppressedDestinationsOutput, error) {
+	return client.Primary.ListSuppressedDestinations(ctx, params, optFns...)
+}
+
+// Contact lists belong to a region, so they're only managed in the primary region
+func (client *FailoverClient) CreateContactList(
+	ctx context.Context,
+	params *sesv2.CreateContactListInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.CreateContactListOutput, error) {
+	return client.Primary.CreateContactList(ctx, params, optFns...)
+}
+
+func (client *FailoverClient) CreateContact(
+	ctx context.Context,
+	params *sesv2.CreateContactInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.CreateContactOutput, error) {
+	return client.Primary.CreateContact(ctx, params, optFns...)
+}
+
+func (client *FailoverClient) UpdateContact(
+	ctx context.Context,
+	params *sesv2.UpdateContactInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.UpdateContactOutput, error) {
+	return client.Primary.UpdateContact(ctx, params, optFns...)
+}
+
+func (client *FailoverClient) DeleteContact(
+	ctx context.Context,
+	params *sesv2.DeleteContactInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.DeleteContactOutput, error) {
+	return client.Primary.DeleteContact(ctx, params, optFns...)
+}
+
+func (client *FailoverClient) ListContacts(
+	ctx context.Context,
+	params *sesv2.ListContactsInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.ListContactsOutput, error) {
+	return client.Primary.ListContacts(ctx, params, optFns...)
+}
+
+func (client *FailoverClient) DeleteContactList(
+	ctx context.Context,
+	params *sesv2.DeleteContactListInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.DeleteContactListOutput, error) {
+	return client.Primary.DeleteContactList(ctx, params, optFns...)
+}
+
+// Configuration sets belong to a region, so they're only managed in the primary region
+func (client *FailoverClient) CreateConfigurationSet(
+	ctx context.Context,
+	params *sesv2.CreateConfigurationSetInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.CreateConfigurationSetOutput, error) {
+	return client.Primary.CreateConfigurationSet(ctx, params, optFns...)
+}
+
+func (client *FailoverClient) DeleteConfigurationSet(
+	ctx context.Context,
+	params *sesv2.DeleteConfigurationSetInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.DeleteConfigurationSetOutput, error) {
+	return client.Primary.DeleteConfigurationSet(ctx, params, optFns...)
+}
+
+func (client *FailoverClient) PutConfigurationSetSuppressionOptions(
+	ctx context.Context,
+	params *sesv2.PutConfigurationSetSuppressionOptionsInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.PutConfigurationSetSuppressionOptionsOutput, error) {
+	return client.Primary.PutConfigurationSetSuppressionOptions(ctx, params, optFns...)
+}
@@ -0,0 +1,115 @@
+// Tests for failing over to a secondary region
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+
+	sesv2 "github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// An error from connecting to SES, before any request is sent
+func dialError() error {
+	return &smithyhttp.RequestSendError{Err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}}
+}
+
+// A client whose sends all fail with err
+func failingClient(err error) *fakeClient {
+	return &fakeClient{
+		sendEmail: func(context.Context, *sesv2.SendEmailInput) (*sesv2.SendEmailOutput, error) {
+			return nil, err
+		},
+		sendBulkEmail: func(context.Context, *sesv2.SendBulkEmailInput) (*sesv2.SendBulkEmailOutput, error) {
+			return nil, err
+		},
+	}
+}
+
+func TestFailoverClientSendEmail(t *testing.T) {
+	for _, test := range []struct {
+		name           string
+		err            error
+		expectedRegion string
+	}{
+		{"unreachable", dialError(), "us-west-2"},
+		{"unresolvable", &smithyhttp.RequestSendError{Err: &net.DNSError{Err: "no such host", Name: "email.us-east-1.amazonaws.com"}}, "us-west-2"},
+		{"unavailable", &smithyhttp.ResponseError{
+			Response: &smithyhttp.Response{Response: &http.Response{StatusCode: http.StatusServiceUnavailable}},
+			Err:      errors.New("service unavailable"),
+		}, "us-west-2"},
+		{"server error", &smithy.GenericAPIError{Code: "InternalFailure", Fault: smithy.FaultServer}, ""},
+		{"connection reset", &smithyhttp.RequestSendError{Err: &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}}, ""},
+		{"rejected", &smithy.GenericAPIError{Code: "MessageRejected", Fault: smithy.FaultClient}, ""},
+		{"cancelled", context.Canceled, ""},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			fallback := &fakeClient{}
+			client := &FailoverClient{
+				Primary:        failingClient(test.err),
+				PrimaryRegion:  "us-east-1",
+				Fallback:       fallback,
+				FallbackRegion: "us-west-2",
+			}
+
+			output, err := SendEmail(context.Background(), client, simpleEmail("a@example.com"))
+
+			if test.expectedRegion == "" {
+				if !errors.Is(err, test.err) {
+					t.Errorf("expected %v, got %v", test.err, err)
+				} else if len(fallback.SentEmails()) != 0 {
+					t.Errorf("expected the fallback region not to be used")
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			} else if output.Region != test.expectedRegion {
+				t.Errorf("expected region %s, got %s", test.expectedRegion, output.Region)
+			}
+		})
+	}
+}
+
+func TestFailoverClientReportsPrimaryRegion(t *testing.T) {
+	client := &FailoverClient{
+		Primary:        &fakeClient{},
+		PrimaryRegion:  "us-east-1",
+		Fallback:       &fakeClient{},
+		FallbackRegion: "us-west-2",
+	}
+
+	if output, err := SendEmail(context.Background(), client, simpleEmail("a@example.com")); err != nil {
+		t.Fatal(err)
+	} else if output.Region != "us-east-1" {
+		t.Errorf("expected region us-east-1, got %s", output.Region)
+	}
+}
+
+func TestFailoverClientSendBulkEmail(t *testing.T) {
+	client := &FailoverClient{
+		Primary:        failingClient(dialError()),
+		PrimaryRegion:  "us-east-1",
+		Fallback:       &fakeClient{},
+		FallbackRegion: "us-west-2",
+	}
+
+	if output, err := SendBulkEmail(context.Background(), client, bulkEmail("a@example.com")); err != nil {
+		t.Fatal(err)
+	} else if output.Region != "us-west-2" {
+		t.Errorf("expected region us-west-2, got %s", output.Region)
+	}
+}
+
+func TestFailoverClientWithoutFallback(t *testing.T) {
+	expected := dialError()
+	client := &FailoverClient{Primary: failingClient(expected), PrimaryRegion: "us-east-1"}
+
+	if _, err := SendEmail(context.Background(), client, simpleEmail("a@example.com")); !errors.Is(err, expected) {
+		t.Errorf("expected %v, got %v", expected, err)
+	}
+}
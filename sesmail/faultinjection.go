@@ -0,0 +1,137 @@
+// Injected send failures for testing how callers handle them, without calling SES
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sesv2 "github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+	"github.com/aws/smithy-go"
+)
+
+// The SES error code SendEmail fails with for each bulk entry status
+var faultErrorCodes = map[types.BulkEmailStatus]string{
+	types.BulkEmailStatusMessageRejected:               "MessageRejected",
+	types.BulkEmailStatusMailFromDomainNotVerified:     "MailFromDomainNotVerifiedException",
+	types.BulkEmailStatusConfigurationSetNotFound:      "NotFoundException",
+	types.BulkEmailStatusTemplateNotFound:              "NotFoundException",
+	types.BulkEmailStatusAccountSuspended:              "AccountSuspendedException",
+	types.BulkEmailStatusAccountThrottled:              "TooManyRequestsException",
+	types.BulkEmailStatusAccountDailyQuotaExceeded:     "LimitExceededException",
+	types.BulkEmailStatusInvalidSendingPoolName:        "BadRequestException",
+	types.BulkEmailStatusAccountSendingPaused:          "SendingPausedException",
+	types.BulkEmailStatusConfigurationSetSendingPaused: "SendingPausedException",
+	types.BulkEmailStatusInvalidParameter:              "BadRequestException",
+	types.BulkEmailStatusTransientFailure:              "InternalFailure",
+	types.BulkEmailStatusFailed:                        "InternalFailure",
+}
+
+// A client which never sends. It fails a share of sends with the configured statuses and accepts
+// the rest with made-up message IDs. Every other call goes to the wrapped client. Only for testing;
+// FAULT_INJECTION must never be set in production.
+type FaultInjectionClient struct {
+	Client
+
+	// The share of sends and bulk entries which fail, from 0 to 1.
+	Rate float64
+
+	// The bulk entry statuses failures are picked from, such as MESSAGE_REJECTED or
+	// ACCOUNT_THROTTLED. SendEmail fails with the matching SES error. Defaults to
+	// TRANSIENT_FAILURE.
+	Statuses []string
+
+	lock   sync.Mutex
+	random *rand.Rand
+}
+
+// Returns a warning that sends are faked, or an empty string if FAULT_INJECTION isn't set
+func FaultInjectionWarning() string {
+	if !Settings.FaultInjection {
+		return ""
+	}
+
+	return "FAULT_INJECTION is set, so emails aren't sent and failures are injected"
+}
+
+// Returns the status to fail a send with, or an empty status to accept it
+func (client *FaultInjectionClient) fault() types.BulkEmailStatus {
+	client.lock.Lock()
+	defer client.lock.Unlock()
+
+	if client.random == nil {
+		client.random = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+
+	if client.random.Float64() >= client.Rate {
+		return ""
+	} else if len(client.Statuses) == 0 {
+		return types.BulkEmailStatusTransientFailure
+	}
+
+	return types.BulkEmailStatus(client.Statuses[client.random.Intn(len(client.Statuses))])
+}
+
+func fakeMessageID() *string {
+	return aws.String(fmt.Sprintf("fault-injection-%d", time.Now().UnixNano()))
+}
+
+func (client *FaultInjectionClient) SendEmail(
+	ctx context.Context,
+	params *sesv2.SendEmailInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.SendEmailOutput, error) {
+	status := client.fault()
+
+	if status == "" {
+		return &sesv2.SendEmailOutput{MessageId: fakeMessageID()}, nil
+	}
+
+	code, ok := faultErrorCodes[status]
+
+	if !ok {
+		code = string(status)
+	}
+
+	fault := smithy.FaultClient
+
+	if status == types.BulkEmailStatusTransientFailure || status == types.BulkEmailStatusFailed {
+		fault = smithy.FaultServer
+	}
+
+	return nil, &smithy.GenericAPIError{
+		Code:    code,
+		Message: fmt.Sprintf("Injected failure with status %s", status),
+		Fault:   fault,
+	}
+}
+
+func (client *FaultInjectionClient) SendBulkEmail(
+	ctx context.Context,
+	params *sesv2.SendBulkEmailInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.SendBulkEmailOutput, error) {
+	output := &sesv2.SendBulkEmailOutput{}
+
+	for range params.BulkEmailEntries {
+		if status := client.fault(); status != "" {
+			output.BulkEmailEntryResults = append(output.BulkEmailEntryResults, types.BulkEmailEntryResult{
+				Status: status,
+				Error:  aws.String(fmt.Sprintf("Injected failure with status %s", status)),
+			})
+		} else {
+			output.BulkEmailEntryResults = append(output.BulkEmailEntryResults, types.BulkEmailEntryResult{
+				Status:    types.BulkEmailStatusSuccess,
+				MessageId: fakeMessageID(),
+			})
+		}
+	}
+
+	return output, nil
+}
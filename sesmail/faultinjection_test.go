@@ -0,0 +1,127 @@
+// Tests for injecting send failures in test mode
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+
+	sesv2 "github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+	"github.com/aws/smithy-go"
+)
+
+// A fault injection client with a seeded source, so the failures are the same on every run
+func seededFaultInjectionClient(rate float64, statuses ...string) *FaultInjectionClient {
+	return &FaultInjectionClient{
+		Client:   &fakeClient{},
+		Rate:     rate,
+		Statuses: statuses,
+		random:   rand.New(rand.NewSource(1)),
+	}
+}
+
+func TestFaultInjectionClientFailsAtRate(t *testing.T) {
+	const entries = 10000
+
+	for _, rate := range []float64{0, 0.25, 0.5, 1} {
+		t.Run(fmt.Sprint(rate), func(t *testing.T) {
+			client := seededFaultInjectionClient(rate)
+			params := &sesv2.SendBulkEmailInput{BulkEmailEntries: make([]types.BulkEmailEntry, entries)}
+			output, err := client.SendBulkEmail(context.Background(), params)
+
+			if err != nil {
+				t.Fatal(err)
+			} else if len(output.BulkEmailEntryResults) != entries {
+				t.Fatalf("expected %d results, got %d", entries, len(output.BulkEmailEntryResults))
+			}
+
+			failed := 0
+
+			for _, result := range output.BulkEmailEntryResults {
+				if result.Status != types.BulkEmailStatusSuccess {
+					failed++
+				} else if result.MessageId == nil {
+					t.Error("expected an accepted entry to have a message ID")
+				}
+			}
+
+			if actual := float64(failed) / entries; math.Abs(actual-rate) > 0.02 {
+				t.Errorf("expected about %.2f of entries to fail, got %.4f", rate, actual)
+			}
+		})
+	}
+}
+
+func TestFaultInjectionClientUsesStatuses(t *testing.T) {
+	client := seededFaultInjectionClient(1, "MESSAGE_REJECTED", "ACCOUNT_THROTTLED")
+	params := &sesv2.SendBulkEmailInput{BulkEmailEntries: make([]types.BulkEmailEntry, 100)}
+	output, err := client.SendBulkEmail(context.Background(), params)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := map[types.BulkEmailStatus]int{}
+
+	for _, result := range output.BulkEmailEntryResults {
+		seen[result.Status]++
+	}
+
+	if len(seen) != 2 || seen[types.BulkEmailStatusMessageRejected] == 0 || seen[types.BulkEmailStatusAccountThrottled] == 0 {
+		t.Errorf("expected failures with both configured statuses, got %v", seen)
+	}
+
+	if status := seededFaultInjectionClient(1).fault(); status != types.BulkEmailStatusTransientFailure {
+		t.Errorf("expected failures to default to %s, got %s", types.BulkEmailStatusTransientFailure, status)
+	}
+}
+
+func TestFaultInjectionClientSendEmailErrors(t *testing.T) {
+	for _, test := range []struct {
+		status string
+		code   string
+		fault  smithy.ErrorFault
+	}{
+		{"MESSAGE_REJECTED", "MessageRejected", smithy.FaultClient},
+		{"ACCOUNT_THROTTLED", "TooManyRequestsException", smithy.FaultClient},
+		{"TRANSIENT_FAILURE", "InternalFailure", smithy.FaultServer},
+	} {
+		t.Run(test.status, func(t *testing.T) {
+			_, err := seededFaultInjectionClient(1, test.status).SendEmail(context.Background(), &sesv2.SendEmailInput{})
+
+			var apiErr smithy.APIError
+
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("expected an API error, got %v", err)
+			} else if apiErr.ErrorCode() != test.code || apiErr.ErrorFault() != test.fault {
+				t.Errorf("expected %s with fault %v, got %s with fault %v", test.code, test.fault, apiErr.ErrorCode(), apiErr.ErrorFault())
+			}
+		})
+	}
+
+	if output, err := seededFaultInjectionClient(0).SendEmail(context.Background(), &sesv2.SendEmailInput{}); err != nil {
+		t.Fatal(err)
+	} else if output.MessageId == nil {
+		t.Error("expected an accepted send to have a message ID")
+	}
+}
+
+func TestFaultInjectionWarning(t *testing.T) {
+	useSettings(t, Config{})
+
+	if warning := FaultInjectionWarning(); warning != "" {
+		t.Errorf("expected no warning, got %q", warning)
+	}
+
+	useSettings(t, Config{FaultInjection: true})
+
+	if warning := FaultInjectionWarning(); warning == "" {
+		t.Error("expected a warning while FAULT_INJECTION is set")
+	}
+}
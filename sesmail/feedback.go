@@ -0,0 +1,60 @@
+// Resolution of the feedback forwarding address emails are sent with
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import "github.com/aws/aws-sdk-go-v2/aws"
+
+// The feedback forwarding address and identity an email was actually sent with
+type FeedbackForwarding struct {
+
+	// The address bounces and complaints are forwarded to.
+	EmailAddress *string `json:"emailAddress,omitempty"`
+
+	// The ARN of the identity authorizing the feedback forwarding address.
+	IdentityArn *string `json:"identityArn,omitempty"`
+
+	// Whether the configured defaults were applied because the email specified neither.
+	Default bool `json:"default"`
+}
+
+// Returns the feedback forwarding address and identity ARN an email is actually sent with, which
+// are the configured defaults when neither is given. Returns nil when neither is given nor
+// configured, leaving SES to forward feedback to the From address.
+func resolveFeedbackForwarding(address *string, identityArn *string) *FeedbackForwarding {
+	if aws.ToString(address) != "" || aws.ToString(identityArn) != "" {
+		return &FeedbackForwarding{EmailAddress: normalizeSenderAddress(address), IdentityArn: identityArn}
+	} else if Settings.DefaultFeedbackAddress == "" && Settings.DefaultFeedbackArn == "" {
+		return nil
+	}
+
+	resolved := &FeedbackForwarding{Default: true}
+
+	if Settings.DefaultFeedbackAddress != "" {
+		resolved.EmailAddress = aws.String(normalizeSenderDomain(Settings.DefaultFeedbackAddress))
+	}
+
+	if Settings.DefaultFeedbackArn != "" {
+		resolved.IdentityArn = aws.String(Settings.DefaultFeedbackArn)
+	}
+
+	return resolved
+}
+
+// Returns the resolved feedback forwarding address, or nil if there is none
+func (feedback *FeedbackForwarding) emailAddress() *string {
+	if feedback == nil {
+		return nil
+	}
+
+	return feedback.EmailAddress
+}
+
+// Returns the resolved feedback forwarding identity ARN, or nil if there is none
+func (feedback *FeedbackForwarding) identityArn() *string {
+	if feedback == nil {
+		return nil
+	}
+
+	return feedback.IdentityArn
+}
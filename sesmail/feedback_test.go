@@ -0,0 +1,95 @@
+// Tests for resolving the feedback forwarding address emails are sent with
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestSendReportsFeedbackForwarding(t *testing.T) {
+	const defaultArn = "arn:aws:ses:us-east-1:123456789012:identity/example.com"
+	const overrideArn = "arn:aws:ses:us-east-1:123456789012:identity/other.example.com"
+
+	for _, test := range []struct {
+		name        string
+		defaults    Config
+		address     *string
+		identityArn *string
+		expected    *FeedbackForwarding
+	}{
+		{"nothing configured", Config{}, nil, nil, nil},
+		{
+			"default applied",
+			Config{DefaultFeedbackAddress: "bounces@example.com", DefaultFeedbackArn: defaultArn},
+			nil,
+			nil,
+			&FeedbackForwarding{EmailAddress: aws.String("bounces@example.com"), IdentityArn: aws.String(defaultArn), Default: true},
+		},
+		{
+			"default address only",
+			Config{DefaultFeedbackAddress: "bounces@example.com"},
+			nil,
+			nil,
+			&FeedbackForwarding{EmailAddress: aws.String("bounces@example.com"), Default: true},
+		},
+		{
+			"address overrides the default",
+			Config{DefaultFeedbackAddress: "bounces@example.com", DefaultFeedbackArn: defaultArn},
+			aws.String("feedback@other.example.com"),
+			nil,
+			&FeedbackForwarding{EmailAddress: aws.String("feedback@other.example.com")},
+		},
+		{
+			"identity overrides the default",
+			Config{DefaultFeedbackAddress: "bounces@example.com"},
+			nil,
+			aws.String(overrideArn),
+			&FeedbackForwarding{IdentityArn: aws.String(overrideArn)},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			useSettings(t, test.defaults)
+
+			client := &fakeClient{}
+
+			email := simpleEmail("to@example.com")
+			email.FeedbackForwardingEmailAddress = test.address
+			email.FeedbackForwardingEmailAddressIdentityArn = test.identityArn
+
+			bulk := bulkEmail("to@example.com")
+			bulk.FeedbackForwardingEmailAddress = test.address
+			bulk.FeedbackForwardingEmailAddressIdentityArn = test.identityArn
+
+			emailOutput, err := SendEmail(context.Background(), client, email)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			bulkOutput, err := SendBulkEmail(context.Background(), client, bulk)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, resolved := range []*FeedbackForwarding{emailOutput.FeedbackForwardingResolved, bulkOutput.FeedbackForwardingResolved} {
+				if !reflect.DeepEqual(resolved, test.expected) {
+					t.Errorf("expected %+v, got %+v", test.expected, resolved)
+				}
+			}
+
+			// The reported address is the one sent
+			sentEmail, sentBulk := client.SentEmails()[0], client.SentBulkEmails()[0]
+
+			if aws.ToString(sentEmail.FeedbackForwardingEmailAddress) != aws.ToString(test.expected.emailAddress()) ||
+				aws.ToString(sentBulk.FeedbackForwardingEmailAddressIdentityArn) != aws.ToString(test.expected.identityArn()) {
+				t.Errorf("expected %+v to be sent, got %+v and %+v", test.expected, sentEmail, sentBulk)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+// Canonical fingerprints of requests, for detecting duplicate sends across invocations
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sesv2 "github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+)
+
+// The parts of a request which decide what is sent to whom. Addresses are normalized and sorted,
+// and template data is re-encoded, so neither ordering nor formatting changes the fingerprint.
+type fingerprintRecipients struct {
+	To  []string `json:"to,omitempty"`
+	Cc  []string `json:"cc,omitempty"`
+	Bcc []string `json:"bcc,omitempty"`
+
+	// Only set for bulk entries.
+	TemplateData interface{} `json:"templateData,omitempty"`
+}
+
+type fingerprintRequest struct {
+	Operation        string                  `json:"operation"`
+	From             string                  `json:"from,omitempty"`
+	ReplyTo          []string                `json:"replyTo,omitempty"`
+	ConfigurationSet string                  `json:"configurationSet,omitempty"`
+	Tags             map[string]string       `json:"tags,omitempty"`
+	Subject          *types.Content          `json:"subject,omitempty"`
+	Html             *types.Content          `json:"html,omitempty"`
+	Text             *types.Content          `json:"text,omitempty"`
+	Raw              []byte                  `json:"raw,omitempty"`
+	Template         string                  `json:"template,omitempty"`
+	TemplateData     interface{}             `json:"templateData,omitempty"`
+	Recipients       []fingerprintRecipients `json:"recipients"`
+}
+
+func normalizeAddresses(addresses []string) []string {
+	var normalized []string
+
+	for _, address := range addresses {
+		normalized = append(normalized, strings.ToLower(strings.TrimSpace(address)))
+	}
+
+	sort.Strings(normalized)
+
+	return normalized
+}
+
+func normalizeTags(tags []types.MessageTag) map[string]string {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	normalized := make(map[string]string)
+
+	for _, tag := range tags {
+		normalized[aws.ToString(tag.Name)] = aws.ToString(tag.Value)
+	}
+
+	return normalized
+}
+
+// Decodes JSON template data so it's re-encoded with sorted keys and no whitespace, falling back
+// to the data as is if it isn't valid JSON
+func normalizeTemplateData(data *string) interface{} {
+	if data == nil {
+		return nil
+	}
+
+	var decoded interface{}
+
+	if err := json.Unmarshal([]byte(*data), &decoded); err != nil {
+		return *data
+	}
+
+	return decoded
+}
+
+func normalizeTemplate(request *fingerprintRequest, template *types.Template) {
+	if template == nil {
+		return
+	}
+
+	request.Template = aws.ToString(template.TemplateName)
+
+	if request.Template == "" {
+		request.Template = aws.ToString(template.TemplateArn)
+	}
+
+	request.TemplateData = normalizeTemplateData(template.TemplateData)
+}
+
+func normalizeRecipients(destination *types.Destination) fingerprintRecipients {
+	if destination == nil {
+		return fingerprintRecipients{}
+	}
+
+	return fingerprintRecipients{
+		To:  normalizeAddresses(destination.ToAddresses),
+		Cc:  normalizeAddresses(destination.CcAddresses),
+		Bcc: normalizeAddresses(destination.BccAddresses),
+	}
+}
+
+func fingerprint(request *fingerprintRequest) string {
+	encoded, err := json.Marshal(request)
+
+	if err != nil {
+		return ""
+	}
+
+	sum := sha256.Sum256(encoded)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// Returns a hex encoded SHA-256 hash of what an SES request sends to whom
+func sendEmailFingerprint(input *sesv2.SendEmailInput) string {
+	request := &fingerprintRequest{
+		Operation:        "SendEmail",
+		From:             strings.ToLower(aws.ToString(input.FromEmailAddress)),
+		ReplyTo:          normalizeAddresses(input.ReplyToAddresses),
+		ConfigurationSet: aws.ToString(input.ConfigurationSetName),
+		Tags:             normalizeTags(input.EmailTags),
+		Recipients:       []fingerprintRecipients{normalizeRecipients(input.Destination)},
+	}
+
+	if simple := input.Content.Simple; simple != nil {
+		request.Subject = simple.Subject
+
+		if simple.Body != nil {
+			request.Html = simple.Body.Html
+			request.Text = simple.Body.Text
+		}
+	}
+
+	if input.Content.Raw != nil {
+		request.Raw = input.Content.Raw.Data
+	}
+
+	normalizeTemplate(request, input.Content.Template)
+
+	return fingerprint(request)
+}
+
+// Returns a hex encoded SHA-256 hash of what an SES bulk request sends to whom. Entries keep their
+// order, since results are matched to entries by position.
+func sendBulkEmailFingerprint(input *sesv2.SendBulkEmailInput) string {
+	request := &fingerprintRequest{
+		Operation:        "SendBulkEmail",
+		From:             strings.ToLower(aws.ToString(input.FromEmailAddress)),
+		ReplyTo:          normalizeAddresses(input.ReplyToAddresses),
+		ConfigurationSet: aws.ToString(input.ConfigurationSetName),
+		Tags:             normalizeTags(input.DefaultEmailTags),
+		Recipients:       []fingerprintRecipients{},
+	}
+
+	if input.DefaultContent != nil {
+		normalizeTemplate(request, input.DefaultContent.Template)
+	}
+
+	for _, entry := range input.BulkEmailEntries {
+		recipients := normalizeRecipients(entry.Destination)
+
+		if entry.ReplacementEmailContent != nil && entry.ReplacementEmailContent.ReplacementTemplate != nil {
+			recipients.TemplateData = normalizeTemplateData(
+				entry.ReplacementEmailContent.ReplacementTemplate.ReplacementTemplateData,
+			)
+		}
+
+		request.Recipients = append(request.Recipients, recipients)
+	}
+
+	return fingerprint(request)
+}
@@ -0,0 +1,110 @@
+// Tests for canonical fingerprints of requests
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// A templated email to two recipients, which modify changes before it's sent
+func fingerprintEmail(t *testing.T, modify func(input *SendEmailInput)) string {
+	input := templatedEmail("a@example.com", "welcome")
+	input.Destination.ToAddresses = append(input.Destination.ToAddresses, "b@example.com")
+	input.Content.Template.TemplateData = aws.String(`{"name":"Jane","count":1}`)
+	input.EmailTags = MessageTag{"campaign": "launch", "team": "growth"}
+
+	if modify != nil {
+		modify(input)
+	}
+
+	output, err := SendEmail(context.Background(), &fakeClient{}, input)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return output.Fingerprint
+}
+
+func TestSendEmailFingerprintIsStable(t *testing.T) {
+	expected := fingerprintEmail(t, nil)
+
+	if len(expected) != 64 {
+		t.Fatalf("expected a SHA-256 hex digest, got %q", expected)
+	}
+
+	for name, modify := range map[string]func(input *SendEmailInput){
+		"recipient order": func(input *SendEmailInput) {
+			input.Destination.ToAddresses = []string{"b@example.com", "a@example.com"}
+		},
+		"address case and spacing": func(input *SendEmailInput) {
+			input.Destination.ToAddresses = []string{" A@Example.com", "b@example.com"}
+		},
+		"template data formatting": func(input *SendEmailInput) {
+			input.Content.Template.TemplateData = aws.String("{\n  \"count\": 1,\n  \"name\": \"Jane\"\n}")
+		},
+		"tag order": func(input *SendEmailInput) {
+			input.EmailTags = MessageTag{"team": "growth", "campaign": "launch"}
+		},
+	} {
+		if fingerprint := fingerprintEmail(t, modify); fingerprint != expected {
+			t.Errorf("expected %s not to change the fingerprint", name)
+		}
+	}
+}
+
+func TestSendEmailFingerprintChanges(t *testing.T) {
+	expected := fingerprintEmail(t, nil)
+
+	for name, modify := range map[string]func(input *SendEmailInput){
+		"recipient": func(input *SendEmailInput) {
+			input.Destination.ToAddresses = []string{"a@example.com", "c@example.com"}
+		},
+		"recipient moved to CC": func(input *SendEmailInput) {
+			input.Destination.ToAddresses = []string{"a@example.com"}
+			input.Destination.CcAddresses = []string{"b@example.com"}
+		},
+		"sender": func(input *SendEmailInput) {
+			input.FromEmailAddress = aws.String("other@example.com")
+		},
+		"template": func(input *SendEmailInput) {
+			input.Content.Template.TemplateName = aws.String("reminder")
+		},
+		"template data": func(input *SendEmailInput) {
+			input.Content.Template.TemplateData = aws.String(`{"name":"John","count":1}`)
+		},
+		"tag": func(input *SendEmailInput) {
+			input.EmailTags = MessageTag{"campaign": "relaunch", "team": "growth"}
+		},
+	} {
+		if fingerprint := fingerprintEmail(t, modify); fingerprint == expected {
+			t.Errorf("expected a different %s to change the fingerprint", name)
+		}
+	}
+}
+
+func TestSendBulkEmailFingerprint(t *testing.T) {
+	send := func(input *SendBulkEmailInput) string {
+		output, err := SendBulkEmail(context.Background(), &fakeClient{}, input)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return output.Fingerprint
+	}
+
+	expected := send(bulkEmail("a@example.com", "b@example.com"))
+
+	if fingerprint := send(bulkEmail("A@example.com", "b@example.com")); fingerprint != expected {
+		t.Error("expected address case not to change the fingerprint")
+	} else if fingerprint := send(bulkEmail("b@example.com", "a@example.com")); fingerprint == expected {
+		t.Error("expected the entry order to change the fingerprint")
+	} else if fingerprint := send(bulkEmail("a@example.com")); fingerprint == expected {
+		t.Error("expected a missing entry to change the fingerprint")
+	}
+}
@@ -0,0 +1,37 @@
+// Resolution of From addresses from identity ARNs
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// Returns the From address, or the address of an email identity when only its ARN is given, e.g.
+// arn:aws:ses:us-east-1:123456789012:identity/sender@example.com. Domain identities don't name an
+// address, so the From address has to be given explicitly for them. The domain is lowercased when
+// NORMALIZE_SENDER_DOMAINS is set.
+func resolveFromAddress(from *string, identityArn *string) (*string, error) {
+	if from != nil || identityArn == nil {
+		return normalizeSenderAddress(from), nil
+	}
+
+	index := strings.LastIndex(*identityArn, ":identity/")
+
+	if index == -1 {
+		return nil, fmt.Errorf("From identity ARN %s isn't an SES identity", *identityArn)
+	}
+
+	identity := (*identityArn)[index+len(":identity/"):]
+
+	if !strings.Contains(identity, "@") {
+		return nil, fmt.Errorf(
+			"From identity %s is a domain, so a From address must be given to send from it", identity,
+		)
+	}
+
+	return aws.String(normalizeSenderDomain(identity)), nil
+}
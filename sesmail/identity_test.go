@@ -0,0 +1,131 @@
+// Tests for resolving From addresses from identity ARNs
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestResolveFromAddress(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		from        *string
+		identityArn *string
+		expected    string
+		err         string
+	}{
+		{"from address", aws.String("from@example.com"), nil, "from@example.com", ""},
+		{
+			"from address with an ARN",
+			aws.String("from@example.com"),
+			aws.String("arn:aws:ses:us-east-1:123456789012:identity/example.com"),
+			"from@example.com",
+			"",
+		},
+		{
+			"email identity ARN",
+			nil,
+			aws.String("arn:aws:ses:us-east-1:123456789012:identity/sender@example.com"),
+			"sender@example.com",
+			"",
+		},
+		{
+			"domain identity ARN",
+			nil,
+			aws.String("arn:aws:ses:us-east-1:123456789012:identity/example.com"),
+			"",
+			"From identity example.com is a domain, so a From address must be given to send from it",
+		},
+		{
+			"not an identity ARN",
+			nil,
+			aws.String("arn:aws:ses:us-east-1:123456789012:configuration-set/default"),
+			"",
+			"From identity ARN arn:aws:ses:us-east-1:123456789012:configuration-set/default isn't an SES identity",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			from, err := resolveFromAddress(test.from, test.identityArn)
+
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Errorf("expected %q, got %v", test.err, err)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			} else if aws.ToString(from) != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, aws.ToString(from))
+			}
+		})
+	}
+}
+
+func TestSendEmailResolvesFromAddress(t *testing.T) {
+	client := &fakeClient{}
+	input := simpleEmail("a@example.com")
+	input.FromEmailAddress = nil
+	input.FromEmailAddressIdentityArn = aws.String("arn:aws:ses:us-east-1:123456789012:identity/sender@example.com")
+
+	if _, err := SendEmail(context.Background(), client, input); err != nil {
+		t.Fatal(err)
+	} else if from := aws.ToString(client.SentEmails()[0].FromEmailAddress); from != "sender@example.com" {
+		t.Errorf("expected the email to be sent from sender@example.com, got %s", from)
+	}
+}
+
+func TestSendEmailNormalizesSenderDomains(t *testing.T) {
+	for _, test := range []struct {
+		name             string
+		normalize        bool
+		expectedFrom     string
+		expectedReplyTo  []string
+		expectedFeedback string
+	}{
+		{"disabled", false, "Sender@Example.COM", []string{"Reply@Example.com"}, "Bounces@EXAMPLE.com"},
+		{"enabled", true, "Sender@example.com", []string{"Reply@example.com"}, "Bounces@example.com"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			useSettings(t, Config{NormalizeSenderDomains: test.normalize})
+
+			client := &fakeClient{}
+			input := simpleEmail("a@example.com")
+			input.FromEmailAddress = aws.String("Sender@Example.COM")
+			input.ReplyToAddresses = []string{"Reply@Example.com", "reply@example.com"}
+			input.FeedbackForwardingEmailAddress = aws.String("Bounces@EXAMPLE.com")
+
+			if _, err := SendEmail(context.Background(), client, input); err != nil {
+				t.Fatal(err)
+			}
+
+			sent := client.SentEmails()[0]
+
+			if from := aws.ToString(sent.FromEmailAddress); from != test.expectedFrom {
+				t.Errorf("expected %q, got %q", test.expectedFrom, from)
+			} else if !reflect.DeepEqual(sent.ReplyToAddresses, test.expectedReplyTo) {
+				t.Errorf("expected %v, got %v", test.expectedReplyTo, sent.ReplyToAddresses)
+			} else if feedback := aws.ToString(sent.FeedbackForwardingEmailAddress); feedback != test.expectedFeedback {
+				t.Errorf("expected %q, got %q", test.expectedFeedback, feedback)
+			}
+		})
+	}
+}
+
+func TestNormalizeSenderDomainKeepsLocalPart(t *testing.T) {
+	useSettings(t, Config{NormalizeSenderDomains: true})
+
+	for address, expected := range map[string]string{
+		"Sender@Example.COM":               "Sender@example.com",
+		"Sender <Sender@Mail.Example.com>": "Sender <Sender@mail.example.com>",
+		"\"A@B\"@Example.com":              "\"A@B\"@example.com",
+		"not an address":                   "not an address",
+	} {
+		if normalized := normalizeSenderDomain(address); normalized != expected {
+			t.Errorf("expected %q, got %q", expected, normalized)
+		}
+	}
+}
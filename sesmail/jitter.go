@@ -0,0 +1,44 @@
+// Random delays before sends to smooth out bursts
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Source of jitter, guarded by a mutex since sends run concurrently
+var jitterRand = struct {
+	sync.Mutex
+	*rand.Rand
+}{Rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+
+// Waits a random duration up to SEND_JITTER before a send, so a batch doesn't hit SES all at once.
+// The wait is skipped if it would outlast the context's deadline, and cut short with the context's
+// error if the context is done first.
+func waitForJitter(ctx context.Context) error {
+	if Settings.SendJitter <= 0 {
+		return nil
+	}
+
+	jitterRand.Lock()
+	delay := time.Duration(jitterRand.Int63n(int64(Settings.SendJitter) + 1))
+	jitterRand.Unlock()
+
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= delay {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,115 @@
+// Tests for random delays before sends
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sesv2 "github.com/aws/aws-sdk-go-v2/service/sesv2"
+)
+
+func TestWaitForJitterStaysWithinBounds(t *testing.T) {
+	useSettings(t, Config{SendJitter: 20 * time.Millisecond})
+
+	var longest time.Duration
+
+	for attempt := 0; attempt < 20; attempt++ {
+		start := time.Now()
+
+		if err := waitForJitter(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		if elapsed := time.Since(start); elapsed > longest {
+			longest = elapsed
+		}
+	}
+
+	// Allow for the timer firing late
+	if longest > 40*time.Millisecond {
+		t.Errorf("expected delays of at most 20ms, got %v", longest)
+	}
+}
+
+func TestWaitForJitterDisabled(t *testing.T) {
+	useSettings(t, Config{})
+	start := time.Now()
+
+	if err := waitForJitter(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if elapsed := time.Since(start); elapsed > 5*time.Millisecond {
+		t.Errorf("expected no delay, got %v", elapsed)
+	}
+}
+
+func TestWaitForJitterRespectsContext(t *testing.T) {
+	useSettings(t, Config{SendJitter: time.Second})
+
+	// A delay which would outlast the deadline is skipped, leaving the time for the send
+	deadline, cancelDeadline := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancelDeadline()
+	start := time.Now()
+
+	if err := waitForJitter(deadline); err != nil {
+		t.Errorf("expected the delay to be skipped, got %v", err)
+	} else if elapsed := time.Since(start); elapsed > 10*time.Millisecond {
+		t.Errorf("expected the delay to be skipped, waited %v", elapsed)
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := waitForJitter(cancelled); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %q, got %v", context.Canceled, err)
+	}
+}
+
+func TestSendEmailsSpreadsOutSends(t *testing.T) {
+	useSettings(t, Config{SendJitter: 40 * time.Millisecond, MaxConcurrency: 8})
+
+	var mutex sync.Mutex
+	var times []time.Time
+
+	client := &fakeClient{sendEmail: func(context.Context, *sesv2.SendEmailInput) (*sesv2.SendEmailOutput, error) {
+		mutex.Lock()
+		times = append(times, time.Now())
+		mutex.Unlock()
+
+		return &sesv2.SendEmailOutput{MessageId: aws.String("message-id")}, nil
+	}}
+
+	var inputs []*SendEmailInput
+
+	for index := 0; index < 8; index++ {
+		inputs = append(inputs, simpleEmail(fmt.Sprintf("user%d@example.com", index)))
+	}
+
+	start := time.Now()
+
+	if _, errs := SendEmails(context.Background(), client, inputs); len(errs) != 0 {
+		t.Fatal(errs[0])
+	}
+
+	first, last := times[0], times[0]
+
+	for _, sent := range times {
+		if sent.Before(first) {
+			first = sent
+		} else if sent.After(last) {
+			last = sent
+		}
+	}
+
+	if spread := last.Sub(first); spread < 5*time.Millisecond {
+		t.Errorf("expected the sends to be spread out, got %v between the first and last", spread)
+	} else if total := last.Sub(start); total > 80*time.Millisecond {
+		t.Errorf("expected every send within the jitter, got %v", total)
+	}
+}
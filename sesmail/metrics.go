@@ -0,0 +1,209 @@
+// Aggregation of send metrics into CloudWatch embedded metric format documents
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// The configuration set dimension of sends which didn't use one
+const noConfigurationSet = "none"
+
+// Send counts and SES latencies aggregated across an invocation by configuration set, so they can
+// be emitted as one embedded metric format (EMF) document per configuration set instead of one per
+// send
+type Metrics struct {
+	mutex sync.Mutex
+	sets  map[string]*setMetrics
+}
+
+// The counts and latencies of the sends through one configuration set
+type setMetrics struct {
+	emailsSent        int
+	emailsFailed      int
+	bulkEntriesSent   int
+	bulkEntriesFailed int
+	latencies         map[int64]int
+}
+
+type metricsKey struct{}
+
+// Returns a context whose sends are recorded to the metrics
+func WithMetrics(ctx context.Context, metrics *Metrics) context.Context {
+	return context.WithValue(ctx, metricsKey{}, metrics)
+}
+
+// Records sent and failed emails, or bulk entries if bulk is set, along with how long SES took to
+// respond, under the configuration set they were sent through, if the context has metrics
+func recordMetrics(
+	ctx context.Context,
+	configurationSet *string,
+	bulk bool,
+	sent int,
+	failed int,
+	latency time.Duration,
+) {
+	metrics, ok := ctx.Value(metricsKey{}).(*Metrics)
+
+	if !ok || metrics == nil {
+		return
+	}
+
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+
+	set := metrics.set(aws.ToString(configurationSet))
+
+	if bulk {
+		set.bulkEntriesSent += sent
+		set.bulkEntriesFailed += failed
+	} else {
+		set.emailsSent += sent
+		set.emailsFailed += failed
+	}
+
+	set.latencies[latency.Milliseconds()]++
+}
+
+// Returns the metrics of a configuration set, creating them the first time. Must be called with the
+// mutex held.
+func (metrics *Metrics) set(name string) *setMetrics {
+	if name == "" {
+		name = noConfigurationSet
+	}
+
+	if metrics.sets == nil {
+		metrics.sets = make(map[string]*setMetrics)
+	}
+
+	set, ok := metrics.sets[name]
+
+	if !ok {
+		set = &setMetrics{latencies: make(map[int64]int)}
+		metrics.sets[name] = set
+	}
+
+	return set
+}
+
+type emfMetric struct {
+	Name string `json:"Name"`
+	Unit string `json:"Unit"`
+}
+
+type emfDirective struct {
+	Namespace  string      `json:"Namespace"`
+	Dimensions [][]string  `json:"Dimensions"`
+	Metrics    []emfMetric `json:"Metrics"`
+}
+
+type emfMetadata struct {
+	Timestamp         int64          `json:"Timestamp"`
+	CloudWatchMetrics []emfDirective `json:"CloudWatchMetrics"`
+}
+
+// A latency distribution, with how many times each value occurred
+type emfDistribution struct {
+	Values []int64 `json:"Values"`
+	Counts []int   `json:"Counts"`
+}
+
+// Writes the aggregated metrics as single line EMF documents under the namespace, one for each
+// configuration set sent through, with each dimension and the configuration set as properties of
+// the documents. Sent and Failed count emails and bulk entries together. A document without a
+// configuration set is written if nothing was sent, so the counts still read zero.
+func (metrics *Metrics) Flush(writer io.Writer, namespace string, dimensions map[string]string) error {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+
+	dimensionNames := []string{}
+
+	for name := range dimensions {
+		dimensionNames = append(dimensionNames, name)
+	}
+
+	sort.Strings(dimensionNames)
+
+	setDimensionNames := append(append([]string(nil), dimensionNames...), "ConfigurationSet")
+
+	if len(metrics.sets) == 0 {
+		metrics.set(noConfigurationSet)
+	}
+
+	var setNames []string
+
+	for name := range metrics.sets {
+		setNames = append(setNames, name)
+	}
+
+	sort.Strings(setNames)
+
+	for _, setName := range setNames {
+		set := metrics.sets[setName]
+		emfMetrics := []emfMetric{
+			{Name: "Sent", Unit: "Count"},
+			{Name: "Failed", Unit: "Count"},
+			{Name: "EmailsSent", Unit: "Count"},
+			{Name: "EmailsFailed", Unit: "Count"},
+			{Name: "BulkEntriesSent", Unit: "Count"},
+			{Name: "BulkEntriesFailed", Unit: "Count"},
+		}
+		document := map[string]interface{}{
+			"Sent":              set.emailsSent + set.bulkEntriesSent,
+			"Failed":            set.emailsFailed + set.bulkEntriesFailed,
+			"EmailsSent":        set.emailsSent,
+			"EmailsFailed":      set.emailsFailed,
+			"BulkEntriesSent":   set.bulkEntriesSent,
+			"BulkEntriesFailed": set.bulkEntriesFailed,
+			"ConfigurationSet":  setName,
+		}
+
+		if len(set.latencies) > 0 {
+			latency := emfDistribution{}
+
+			for value := range set.latencies {
+				latency.Values = append(latency.Values, value)
+			}
+
+			sort.Slice(latency.Values, func(i, j int) bool { return latency.Values[i] < latency.Values[j] })
+
+			for _, value := range latency.Values {
+				latency.Counts = append(latency.Counts, set.latencies[value])
+			}
+
+			emfMetrics = append(emfMetrics, emfMetric{Name: "Latency", Unit: "Milliseconds"})
+			document["Latency"] = latency
+		}
+
+		for name, value := range dimensions {
+			document[name] = value
+		}
+
+		document["_aws"] = emfMetadata{
+			Timestamp: time.Now().UnixNano() / int64(time.Millisecond),
+			CloudWatchMetrics: []emfDirective{{
+				Namespace:  namespace,
+				Dimensions: [][]string{dimensionNames, setDimensionNames},
+				Metrics:    emfMetrics,
+			}},
+		}
+
+		encoded, err := json.Marshal(document)
+
+		if err != nil {
+			return err
+		} else if _, err := writer.Write(append(encoded, '\n')); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
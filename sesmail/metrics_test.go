@@ -0,0 +1,205 @@
+// Tests for aggregating send metrics into EMF documents
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sesv2 "github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+)
+
+// The fields of an EMF document checked by tests
+type emfDocument struct {
+	Sent              int
+	Failed            int
+	EmailsSent        int
+	EmailsFailed      int
+	BulkEntriesSent   int
+	BulkEntriesFailed int
+	Latency           emfDistribution
+	Operation         string
+	ConfigurationSet  string
+	Aws               emfMetadata `json:"_aws"`
+}
+
+// Flushes the metrics, decoding each document written
+func flushDocuments(t *testing.T, metrics *Metrics, dimensions map[string]string) []emfDocument {
+	var buffer bytes.Buffer
+	var documents []emfDocument
+
+	if err := metrics.Flush(&buffer, "lambda-ses", dimensions); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range strings.Split(strings.TrimSpace(buffer.String()), "\n") {
+		var document emfDocument
+
+		if err := json.Unmarshal([]byte(line), &document); err != nil {
+			t.Fatalf("expected an EMF document, got %q", line)
+		}
+
+		documents = append(documents, document)
+	}
+
+	return documents
+}
+
+func TestMetricsFlushesOneAggregatedDocument(t *testing.T) {
+	metrics := &Metrics{}
+	ctx := WithMetrics(context.Background(), metrics)
+
+	rejectB := &fakeClient{
+		sendEmail: func(_ context.Context, params *sesv2.SendEmailInput) (*sesv2.SendEmailOutput, error) {
+			if params.Destination.ToAddresses[0] == "b@example.com" {
+				return nil, errors.New("rejected")
+			}
+
+			return &sesv2.SendEmailOutput{}, nil
+		},
+		sendBulkEmail: func(_ context.Context, params *sesv2.SendBulkEmailInput) (*sesv2.SendBulkEmailOutput, error) {
+			output := acceptBulkEmail(params)
+			output.BulkEmailEntryResults[1].Status = types.BulkEmailStatusFailed
+
+			return output, nil
+		},
+	}
+
+	SendEmails(ctx, rejectB, []*SendEmailInput{simpleEmail("a@example.com"), simpleEmail("b@example.com"), simpleEmail("c@example.com")})
+	SendBulkEmail(ctx, rejectB, bulkEmail("d@example.com", "e@example.com", "f@example.com"))
+
+	documents := flushDocuments(t, metrics, map[string]string{"Operation": "emails"})
+
+	if len(documents) != 1 {
+		t.Fatalf("expected a single document, got %+v", documents)
+	}
+
+	document := documents[0]
+
+	// Three single sends and one bulk send
+	latencies := 0
+
+	for _, count := range document.Latency.Counts {
+		latencies += count
+	}
+
+	if document.Sent != 4 || document.Failed != 2 {
+		t.Errorf("expected 4 sent and 2 failed, got %d and %d", document.Sent, document.Failed)
+	} else if document.EmailsSent != 2 || document.EmailsFailed != 1 {
+		t.Errorf("expected 2 emails sent and 1 failed, got %d and %d", document.EmailsSent, document.EmailsFailed)
+	} else if document.BulkEntriesSent != 2 || document.BulkEntriesFailed != 1 {
+		t.Errorf("expected 2 bulk entries sent and 1 failed, got %d and %d", document.BulkEntriesSent, document.BulkEntriesFailed)
+	} else if document.ConfigurationSet != noConfigurationSet {
+		t.Errorf("expected the ConfigurationSet dimension %q, got %q", noConfigurationSet, document.ConfigurationSet)
+	} else if latencies != 4 {
+		t.Errorf("expected 4 latencies, got %d", latencies)
+	} else if document.Operation != "emails" {
+		t.Errorf("expected the Operation dimension, got %q", document.Operation)
+	}
+
+	expected := []emfDirective{{
+		Namespace:  "lambda-ses",
+		Dimensions: [][]string{{"Operation"}, {"Operation", "ConfigurationSet"}},
+		Metrics: []emfMetric{
+			{Name: "Sent", Unit: "Count"},
+			{Name: "Failed", Unit: "Count"},
+			{Name: "EmailsSent", Unit: "Count"},
+			{Name: "EmailsFailed", Unit: "Count"},
+			{Name: "BulkEntriesSent", Unit: "Count"},
+			{Name: "BulkEntriesFailed", Unit: "Count"},
+			{Name: "Latency", Unit: "Milliseconds"},
+		},
+	}}
+
+	if !reflect.DeepEqual(document.Aws.CloudWatchMetrics, expected) {
+		t.Errorf("expected %+v, got %+v", expected, document.Aws.CloudWatchMetrics)
+	} else if document.Aws.Timestamp == 0 {
+		t.Errorf("expected a timestamp")
+	}
+}
+
+func TestMetricsFlushWithoutSends(t *testing.T) {
+	var buffer bytes.Buffer
+	var document map[string]interface{}
+
+	if err := (&Metrics{}).Flush(&buffer, "lambda-ses", nil); err != nil {
+		t.Fatal(err)
+	} else if err := json.Unmarshal(buffer.Bytes(), &document); err != nil {
+		t.Fatal(err)
+	} else if document["Sent"] != 0.0 || document["Failed"] != 0.0 {
+		t.Errorf("expected zero counts, got %v", document)
+	} else if _, ok := document["Latency"]; ok {
+		t.Errorf("expected no latency without sends, got %v", document["Latency"])
+	}
+}
+
+func TestMetricsDistribution(t *testing.T) {
+	metrics := &Metrics{}
+	ctx := WithMetrics(context.Background(), metrics)
+
+	for _, latency := range []int64{30, 10, 30, 20} {
+		recordMetrics(ctx, nil, false, 1, 0, time.Duration(latency)*time.Millisecond)
+	}
+
+	documents := flushDocuments(t, metrics, nil)
+	expected := emfDistribution{Values: []int64{10, 20, 30}, Counts: []int{1, 1, 2}}
+
+	if len(documents) != 1 {
+		t.Fatalf("expected a single document, got %+v", documents)
+	} else if !reflect.DeepEqual(documents[0].Latency, expected) {
+		t.Errorf("expected %+v, got %+v", expected, documents[0].Latency)
+	}
+}
+
+func TestRecordMetricsWithoutMetrics(t *testing.T) {
+	// Sends without metrics in the context record nothing, and mustn't panic
+	recordMetrics(context.Background(), nil, false, 1, 0, 0)
+}
+
+func TestMetricsFlushesADocumentPerConfigurationSet(t *testing.T) {
+	metrics := &Metrics{}
+	ctx := WithMetrics(context.Background(), metrics)
+	tracked := simpleEmail("a@example.com")
+	tracked.ConfigurationSetName = aws.String("tracking")
+	bulk := bulkEmail("b@example.com", "c@example.com")
+	bulk.ConfigurationSetName = aws.String("newsletter")
+
+	SendEmail(ctx, &fakeClient{}, tracked)
+	SendEmail(ctx, &fakeClient{}, simpleEmail("d@example.com"))
+	SendBulkEmail(ctx, &fakeClient{}, bulk)
+
+	documents := flushDocuments(t, metrics, map[string]string{"Operation": "emails"})
+
+	if len(documents) != 3 {
+		t.Fatalf("expected 3 documents, got %+v", documents)
+	}
+
+	for i, expected := range []struct {
+		set             string
+		emailsSent      int
+		bulkEntriesSent int
+	}{
+		{"newsletter", 0, 2},
+		{noConfigurationSet, 1, 0},
+		{"tracking", 1, 0},
+	} {
+		document := documents[i]
+
+		if document.ConfigurationSet != expected.set || document.Operation != "emails" {
+			t.Errorf("expected the dimensions of %s, got %+v", expected.set, document)
+		} else if document.EmailsSent != expected.emailsSent || document.BulkEntriesSent != expected.bulkEntriesSent {
+			t.Errorf("expected %+v, got %+v", expected, document)
+		} else if len(document.Latency.Counts) != 1 {
+			t.Errorf("expected %s to have its own latency, got %+v", expected.set, document.Latency)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+// Inspection of MIME messages
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+)
+
+// A description of a part of a MIME message, without its content
+type MimePart struct {
+
+	// The media type of the part, such as text/html or multipart/alternative.
+	ContentType string `json:"contentType"`
+
+	// The Content-Transfer-Encoding of the part, such as base64 or quoted-printable.
+	Encoding string `json:"encoding,omitempty"`
+
+	// The Content-Disposition of the part, such as inline or attachment.
+	Disposition string `json:"disposition,omitempty"`
+
+	// The filename of the part, if it is an attachment.
+	Filename string `json:"filename,omitempty"`
+
+	// The encoded size of the part's body in bytes. For multipart parts, this is the total size of
+	// their children.
+	Size int64 `json:"size"`
+
+	// The children of a multipart part.
+	Parts []*MimePart `json:"parts,omitempty"`
+}
+
+// Parses a raw MIME message into a tree of its parts
+func parseMimeTree(data []byte) (*MimePart, error) {
+	message, err := mail.ReadMessage(bytes.NewReader(data))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return parseMimePart(message.Header, message.Body)
+}
+
+// Describes the MIME structure of the raw message sent to SES, which is either given by the caller
+// or built for simple messages with attachments or headers. It's unknown for other simple and
+// templated emails, since SES builds their MIME message.
+func describeMime(raw *types.RawMessage) *MimePart {
+	if raw == nil {
+		return nil
+	}
+
+	tree, err := parseMimeTree(raw.Data)
+
+	if err != nil {
+		return nil
+	}
+
+	return tree
+}
+
+type mimeHeader interface {
+	Get(key string) string
+}
+
+func parseMimePart(header mimeHeader, body io.Reader) (*MimePart, error) {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+
+	if err != nil {
+		mediaType = "text/plain"
+	}
+
+	part := &MimePart{
+		ContentType: mediaType,
+		Encoding:    strings.ToLower(header.Get("Content-Transfer-Encoding")),
+	}
+
+	if disposition, dispositionParams, err := mime.ParseMediaType(header.Get("Content-Disposition")); err == nil {
+		part.Disposition = disposition
+		part.Filename = dispositionParams["filename"]
+	}
+
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		part.Size, err = io.Copy(io.Discard, body)
+
+		return part, err
+	}
+
+	reader := multipart.NewReader(body, params["boundary"])
+
+	for {
+		child, err := reader.NextRawPart()
+
+		if err == io.EOF {
+			return part, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		childPart, err := parseMimePart(child.Header, child)
+
+		if err != nil {
+			return nil, err
+		}
+
+		part.Size += childPart.Size
+		part.Parts = append(part.Parts, childPart)
+	}
+}
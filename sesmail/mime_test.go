@@ -0,0 +1,154 @@
+// Tests for inspection of MIME messages
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func rawMessage(lines ...string) []byte {
+	return []byte(strings.Join(lines, "\r\n"))
+}
+
+func TestParseMimeTree(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		data     []byte
+		expected *MimePart
+	}{
+		{
+			"plain text",
+			rawMessage("Subject: Plain", "Content-Type: text/plain; charset=utf-8", "", "Hello"),
+			&MimePart{ContentType: "text/plain", Size: 5},
+		},
+		{
+			"no content type",
+			rawMessage("Subject: Plain", "", "Hello"),
+			&MimePart{ContentType: "text/plain", Size: 5},
+		},
+		{
+			"attachment",
+			rawMessageWithAttachment("application/pdf"),
+			&MimePart{
+				ContentType: "multipart/mixed",
+				Size:        27,
+				Parts: []*MimePart{
+					{ContentType: "text/plain", Size: 19},
+					{
+						ContentType: "application/pdf",
+						Encoding:    "base64",
+						Disposition: "attachment",
+						Filename:    "file",
+						Size:        8,
+					},
+				},
+			},
+		},
+		{
+			"alternative inside mixed",
+			rawMessage(
+				`Content-Type: multipart/mixed; boundary="outer"`,
+				"",
+				"--outer",
+				`Content-Type: multipart/alternative; boundary="inner"`,
+				"",
+				"--inner",
+				"Content-Type: text/plain",
+				"",
+				"Text",
+				"--inner",
+				"Content-Type: text/html",
+				"Content-Transfer-Encoding: Quoted-Printable",
+				"",
+				"<p>HTML</p>",
+				"--inner--",
+				"--outer",
+				"Content-Type: image/png",
+				`Content-Disposition: inline; filename="logo.png"`,
+				"",
+				"PNG",
+				"--outer--",
+			),
+			&MimePart{
+				ContentType: "multipart/mixed",
+				Size:        18,
+				Parts: []*MimePart{
+					{
+						ContentType: "multipart/alternative",
+						Size:        15,
+						Parts: []*MimePart{
+							{ContentType: "text/plain", Size: 4},
+							{ContentType: "text/html", Encoding: "quoted-printable", Size: 11},
+						},
+					},
+					{ContentType: "image/png", Disposition: "inline", Filename: "logo.png", Size: 3},
+				},
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			tree, err := parseMimeTree(test.data)
+
+			if err != nil {
+				t.Fatal(err)
+			} else if !reflect.DeepEqual(tree, test.expected) {
+				t.Errorf("expected %s, got %s", describeTree(test.expected), describeTree(tree))
+			}
+		})
+	}
+}
+
+// Encodes a tree as JSON for readable test failures
+func describeTree(part *MimePart) string {
+	encoded, _ := json.Marshal(part)
+
+	return string(encoded)
+}
+
+func TestSendEmailDebugMime(t *testing.T) {
+	useSettings(t, Config{AllowedAttachmentTypes: []string{"*"}})
+
+	raw := simpleEmail("to@example.com")
+	raw.Content = &EmailContent{Raw: &RawMessage{Data: rawMessageWithAttachment("application/pdf")}}
+	raw.DebugMime = true
+
+	output, err := SendEmail(context.Background(), &fakeClient{}, raw)
+
+	if err != nil {
+		t.Fatal(err)
+	} else if output.MimeTree == nil || len(output.MimeTree.Parts) != 2 {
+		t.Errorf("expected the MIME tree of the raw email, got %s", describeTree(output.MimeTree))
+	}
+
+	simple := simpleEmail("to@example.com")
+	simple.DebugMime = true
+
+	if output, err := SendEmail(context.Background(), &fakeClient{}, simple); err != nil {
+		t.Fatal(err)
+	} else if output.MimeTree != nil {
+		t.Error("expected no MIME tree for a simple email, since SES builds its MIME message")
+	}
+
+	simple.Content.Attachments = []Attachment{{Filename: "notes.txt", ContentType: "text/plain", Data: []byte("notes")}}
+
+	if output, err := SendEmail(context.Background(), &fakeClient{}, simple); err != nil {
+		t.Fatal(err)
+	} else if output.MimeTree == nil || output.MimeTree.ContentType != "multipart/mixed" {
+		t.Errorf("expected the MIME tree built for the attachment, got %s", describeTree(output.MimeTree))
+	} else if attachment := output.MimeTree.Parts[len(output.MimeTree.Parts)-1]; attachment.Filename != "notes.txt" {
+		t.Errorf("expected the attachment to be described, got %s", describeTree(output.MimeTree))
+	}
+
+	raw.DebugMime = false
+
+	if output, err := SendEmail(context.Background(), &fakeClient{}, raw); err != nil {
+		t.Fatal(err)
+	} else if output.MimeTree != nil {
+		t.Error("expected no MIME tree unless debugMime is set")
+	}
+}
@@ -0,0 +1,297 @@
+// Building of MIME messages for simple emails with attachments, and custom headers
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sesv2 "github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+)
+
+// A file attached to a simple email
+type Attachment struct {
+
+	// The name of the file shown to recipients.
+	Filename string `json:"filename"`
+
+	// The media type of the file, such as application/pdf.
+	ContentType string `json:"contentType"`
+
+	// The content of the file, base64 encoded in JSON.
+	Data []byte `json:"data"`
+}
+
+// The longest line of base64 encoded attachments, as recommended by RFC 2045
+const base64LineLength = 76
+
+// The charset of MIME parts whose content doesn't specify one
+const defaultMimeCharset = "UTF-8"
+
+// Headers written by the MIME builder, which custom headers may not set
+var reservedHeaders = map[string]bool{
+	"Bcc":                       true,
+	"Cc":                        true,
+	"Content-Transfer-Encoding": true,
+	"Content-Type":              true,
+	"From":                      true,
+	"Mime-Version":              true,
+	"Reply-To":                  true,
+	"Subject":                   true,
+	"To":                        true,
+}
+
+// Checks that custom headers have valid names which aren't reserved, and strips or rejects control
+// characters in their values like subjects
+func sanitizeHeaders(headers map[string]string) (map[string]string, error) {
+	sanitized := make(map[string]string, len(headers))
+
+	for name, value := range headers {
+		if name == "" || strings.IndexFunc(name, isInvalidHeaderNameCharacter) != -1 {
+			return nil, fmt.Errorf("Header name %q is invalid", name)
+		} else if reservedHeaders[textproto.CanonicalMIMEHeaderKey(name)] {
+			return nil, fmt.Errorf("Header %s is reserved, so set it through its own field instead", name)
+		}
+
+		value, err := sanitizeHeaderValue("Header "+name, value)
+
+		if err != nil {
+			return nil, err
+		}
+
+		sanitized[name] = value
+	}
+
+	return sanitized, nil
+}
+
+// Converts sanitized custom headers to SES's native message headers, in order of their names and
+// encoded like the MIME builder writes them
+func messageHeaders(headers map[string]string) []types.MessageHeader {
+	messageHeaders := make([]types.MessageHeader, 0, len(headers))
+
+	for _, name := range sortedKeys(headers) {
+		messageHeaders = append(messageHeaders, types.MessageHeader{
+			Name:  aws.String(name),
+			Value: aws.String(mime.QEncoding.Encode(defaultMimeCharset, headers[name])),
+		})
+	}
+
+	return messageHeaders
+}
+
+// Whether a character can't appear in a header name, which RFC 5322 limits to printable ASCII
+// other than colons
+func isInvalidHeaderNameCharacter(char rune) bool {
+	return char <= ' ' || char > '~' || char == ':'
+}
+
+// Checks that attachments have a name and an allowed content type
+func validateAttachments(attachments []Attachment) error {
+	for index, attachment := range attachments {
+		if attachment.Filename == "" {
+			return fmt.Errorf("Attachment %d: Filename is required", index)
+		} else if err := validateAttachmentType(attachment.ContentType); err != nil {
+			return fmt.Errorf("Attachment %d: %w", index, err)
+		}
+	}
+
+	return nil
+}
+
+// Builds a multipart/mixed MIME message from the simple message of an SES request, the attachments,
+// and the custom headers, so it can be sent as a raw message instead
+func buildMimeMessage(
+	functionInput *sesv2.SendEmailInput,
+	attachments []Attachment,
+	headers map[string]string,
+) ([]byte, error) {
+	simple := functionInput.Content.Simple
+
+	if simple == nil || simple.Body == nil {
+		return nil, errors.New("Attachments and headers require a simple message with a subject and body")
+	}
+
+	var message bytes.Buffer
+
+	writeAddressHeader(&message, "From", aws.ToString(functionInput.FromEmailAddress))
+	writeAddressHeader(&message, "To", functionInput.Destination.ToAddresses...)
+	writeAddressHeader(&message, "Cc", functionInput.Destination.CcAddresses...)
+	writeAddressHeader(&message, "Reply-To", functionInput.ReplyToAddresses...)
+	writeHeader(&message, "Subject", encodeHeaderValue(simple.Subject))
+	writeHeader(&message, "MIME-Version", "1.0")
+
+	for _, name := range sortedKeys(headers) {
+		writeHeader(&message, name, mime.QEncoding.Encode(defaultMimeCharset, headers[name]))
+	}
+
+	mixed := multipart.NewWriter(&message)
+
+	writeHeader(&message, "Content-Type", mime.FormatMediaType(
+		"multipart/mixed", map[string]string{"boundary": mixed.Boundary()},
+	))
+	message.WriteString("\r\n")
+
+	if err := writeBody(mixed, simple.Body); err != nil {
+		return nil, err
+	}
+
+	for _, attachment := range attachments {
+		if err := writeAttachment(mixed, attachment); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := mixed.Close(); err != nil {
+		return nil, err
+	}
+
+	return message.Bytes(), nil
+}
+
+func writeHeader(message *bytes.Buffer, name string, value string) {
+	fmt.Fprintf(message, "%s: %s\r\n", name, value)
+}
+
+// Writes a header listing addresses, or nothing if there are none
+func writeAddressHeader(message *bytes.Buffer, name string, addresses ...string) {
+	if len(addresses) > 0 && addresses[0] != "" {
+		writeHeader(message, name, strings.Join(addresses, ", "))
+	}
+}
+
+// Encodes a header value as an RFC 2047 encoded word if it isn't plain ASCII
+func encodeHeaderValue(content *types.Content) string {
+	if content == nil {
+		return ""
+	}
+
+	return mime.QEncoding.Encode(contentCharsetOrDefault(content), aws.ToString(content.Data))
+}
+
+func contentCharsetOrDefault(content *types.Content) string {
+	if charset := aws.ToString(content.Charset); charset != "" {
+		return charset
+	}
+
+	return defaultMimeCharset
+}
+
+// Writes the HTML and text bodies as a single part, or as a multipart/alternative part if both
+// are given
+func writeBody(mixed *multipart.Writer, body *types.Body) error {
+	if body.Html == nil || body.Text == nil {
+		content, mediaType := body.Text, "text/plain"
+
+		if body.Html != nil {
+			content, mediaType = body.Html, "text/html"
+		}
+
+		if content == nil {
+			return errors.New("Attachments and headers require an HTML or text body")
+		}
+
+		return writeTextPart(mixed, mediaType, content)
+	}
+
+	var alternativeBody bytes.Buffer
+	alternative := multipart.NewWriter(&alternativeBody)
+
+	if err := writeTextPart(alternative, "text/plain", body.Text); err != nil {
+		return err
+	} else if err := writeTextPart(alternative, "text/html", body.Html); err != nil {
+		return err
+	} else if err := alternative.Close(); err != nil {
+		return err
+	}
+
+	part, err := mixed.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {mime.FormatMediaType(
+			"multipart/alternative", map[string]string{"boundary": alternative.Boundary()},
+		)},
+	})
+
+	if err != nil {
+		return err
+	}
+
+	_, err = part.Write(alternativeBody.Bytes())
+
+	return err
+}
+
+// Writes text content as a quoted-printable part
+func writeTextPart(writer *multipart.Writer, mediaType string, content *types.Content) error {
+	part, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {mime.FormatMediaType(
+			mediaType, map[string]string{"charset": contentCharsetOrDefault(content)},
+		)},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+
+	if err != nil {
+		return err
+	}
+
+	encoder := quotedprintable.NewWriter(part)
+
+	if _, err := encoder.Write([]byte(aws.ToString(content.Data))); err != nil {
+		return err
+	}
+
+	return encoder.Close()
+}
+
+// Writes an attachment as a base64 encoded part
+func writeAttachment(writer *multipart.Writer, attachment Attachment) error {
+	part, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {attachment.ContentType},
+		"Content-Transfer-Encoding": {"base64"},
+		"Content-Disposition": {mime.FormatMediaType(
+			"attachment", map[string]string{"filename": attachment.Filename},
+		)},
+	})
+
+	if err != nil {
+		return err
+	}
+
+	encoded := base64.StdEncoding.EncodeToString(attachment.Data)
+
+	for start := 0; start < len(encoded); start += base64LineLength {
+		end := start + base64LineLength
+
+		if end > len(encoded) {
+			end = len(encoded)
+		}
+
+		if _, err := fmt.Fprintf(part, "%s\r\n", encoded[start:end]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+
+	for key := range values {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
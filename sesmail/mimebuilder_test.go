@@ -0,0 +1,302 @@
+// Tests for building MIME messages for simple emails with attachments
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+)
+
+// A part of a parsed MIME message, with its body decoded
+type builtPart struct {
+	mediaType   string
+	disposition string
+	filename    string
+	body        string
+	children    []builtPart
+}
+
+// Parses the parts of a multipart body, decoding quoted-printable bodies and leaving base64 as is
+func readBuiltParts(t *testing.T, body io.Reader, boundary string) []builtPart {
+	var parts []builtPart
+	reader := multipart.NewReader(body, boundary)
+
+	for {
+		part, err := reader.NextPart()
+
+		if err == io.EOF {
+			return parts
+		} else if err != nil {
+			t.Fatal(err)
+		}
+
+		mediaType, params, err := mime.ParseMediaType(part.Header.Get("Content-Type"))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		built := builtPart{mediaType: mediaType, filename: part.FileName()}
+		built.disposition, _, _ = mime.ParseMediaType(part.Header.Get("Content-Disposition"))
+
+		if strings.HasPrefix(mediaType, "multipart/") {
+			built.children = readBuiltParts(t, part, params["boundary"])
+		} else {
+			data, err := io.ReadAll(part)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			built.body = strings.ReplaceAll(string(data), "\r\n", "")
+		}
+
+		parts = append(parts, built)
+	}
+}
+
+// Sends an email with attachments, returning the headers and parts of the raw message sent
+func sendWithAttachments(t *testing.T, body *Body, attachments ...Attachment) (mail.Header, []builtPart) {
+	useSettings(t, Config{AllowedAttachmentTypes: defaultAllowedAttachmentTypes})
+
+	client := &fakeClient{}
+	input := simpleEmail("to@example.com")
+	input.ReplyToAddresses = []string{"reply@example.com"}
+	input.Content.Simple.Body = body
+	input.Content.Attachments = attachments
+
+	if _, err := SendEmail(context.Background(), client, input); err != nil {
+		t.Fatal(err)
+	}
+
+	content := client.SentEmails()[0].Content
+
+	if content.Simple != nil || content.Raw == nil {
+		t.Fatalf("expected a raw message, got %+v", content)
+	}
+
+	message, err := mail.ReadMessage(bytes.NewReader(content.Raw.Data))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+
+	if err != nil {
+		t.Fatal(err)
+	} else if mediaType != "multipart/mixed" || params["boundary"] == "" {
+		t.Fatalf("expected multipart/mixed with a boundary, got %s", message.Header.Get("Content-Type"))
+	} else if !bytes.Contains(content.Raw.Data, []byte("\r\n--"+params["boundary"]+"--")) {
+		t.Errorf("expected the closing boundary, got %s", content.Raw.Data)
+	}
+
+	return message.Header, readBuiltParts(t, message.Body, params["boundary"])
+}
+
+func TestBuildMimeMessageHeaders(t *testing.T) {
+	header, _ := sendWithAttachments(
+		t,
+		&Body{Text: &Content{Data: aws.String("Hello")}},
+		Attachment{Filename: "a.txt", ContentType: "text/plain", Data: []byte("a")},
+	)
+
+	for name, expected := range map[string]string{
+		"From":         "from@example.com",
+		"To":           "to@example.com",
+		"Reply-To":     "reply@example.com",
+		"Subject":      "Subject",
+		"Mime-Version": "1.0",
+	} {
+		if value := header.Get(name); value != expected {
+			t.Errorf("expected %s to be %q, got %q", name, expected, value)
+		}
+	}
+}
+
+func TestBuildMimeMessageAttachments(t *testing.T) {
+	_, parts := sendWithAttachments(
+		t,
+		&Body{Html: &Content{Data: aws.String("<p>Hello</p>")}},
+		Attachment{Filename: "report.pdf", ContentType: "application/pdf", Data: []byte("%PDF-1.4")},
+		Attachment{Filename: "photo.png", ContentType: "image/png", Data: bytes.Repeat([]byte{0x89}, 100)},
+	)
+
+	if len(parts) != 3 {
+		t.Fatalf("expected a body and 2 attachments, got %+v", parts)
+	} else if parts[0].mediaType != "text/html" || parts[0].body != "<p>Hello</p>" || parts[0].disposition != "" {
+		t.Errorf("expected the HTML body first, got %+v", parts[0])
+	}
+
+	for index, expected := range []builtPart{
+		{mediaType: "application/pdf", disposition: "attachment", filename: "report.pdf", body: "JVBERi0xLjQ="},
+		{mediaType: "image/png", disposition: "attachment", filename: "photo.png"},
+	} {
+		part := parts[index+1]
+
+		if part.mediaType != expected.mediaType || part.disposition != expected.disposition || part.filename != expected.filename {
+			t.Errorf("expected %+v, got %+v", expected, part)
+		} else if expected.body != "" && part.body != expected.body {
+			t.Errorf("expected %s to be encoded as %q, got %q", expected.filename, expected.body, part.body)
+		}
+	}
+}
+
+func TestBuildMimeMessageHtmlAndText(t *testing.T) {
+	_, parts := sendWithAttachments(
+		t,
+		&Body{Html: &Content{Data: aws.String("<p>Hello</p>")}, Text: &Content{Data: aws.String("Hello")}},
+		Attachment{Filename: "a.txt", ContentType: "text/plain", Data: []byte("a")},
+	)
+
+	if len(parts) != 2 || parts[0].mediaType != "multipart/alternative" {
+		t.Fatalf("expected an alternative body and an attachment, got %+v", parts)
+	}
+
+	alternatives := parts[0].children
+
+	if len(alternatives) != 2 ||
+		alternatives[0].mediaType != "text/plain" || alternatives[0].body != "Hello" ||
+		alternatives[1].mediaType != "text/html" || alternatives[1].body != "<p>Hello</p>" {
+		t.Errorf("expected the text then the HTML body, got %+v", alternatives)
+	} else if parts[1].disposition != "attachment" || parts[1].filename != "a.txt" {
+		t.Errorf("expected the attachment, got %+v", parts[1])
+	}
+}
+
+func TestSendEmailRejectsInvalidAttachments(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		attachment Attachment
+		expected   string
+	}{
+		{"no filename", Attachment{ContentType: "text/plain"}, "Attachment 0: Filename is required"},
+		{
+			"disallowed type",
+			Attachment{Filename: "run.exe", ContentType: "application/x-msdownload"},
+			`Attachment 0: Attachment content type "application/x-msdownload" is not allowed`,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			useSettings(t, Config{AllowedAttachmentTypes: defaultAllowedAttachmentTypes})
+
+			input := simpleEmail("to@example.com")
+			input.Content.Attachments = []Attachment{test.attachment}
+
+			if _, err := SendEmail(context.Background(), &fakeClient{}, input); err == nil || err.Error() != test.expected {
+				t.Errorf("expected %q, got %v", test.expected, err)
+			}
+		})
+	}
+}
+
+func TestSendEmailSetsMessageHeaders(t *testing.T) {
+	useSettings(t, Config{})
+
+	client := &fakeClient{}
+	input := simpleEmail("to@example.com")
+	input.Content.Headers = map[string]string{
+		"X-Priority":       "1",
+		"List-Unsubscribe": "<mailto:unsubscribe@example.com>",
+		"X-Campaign":       "Über launch",
+	}
+
+	if _, err := SendEmail(context.Background(), client, input); err != nil {
+		t.Fatal(err)
+	}
+
+	content := client.SentEmails()[0].Content
+
+	if content.Raw != nil || content.Simple == nil {
+		t.Fatalf("expected a simple message, got %+v", content)
+	}
+
+	expected := []types.MessageHeader{
+		{Name: aws.String("List-Unsubscribe"), Value: aws.String("<mailto:unsubscribe@example.com>")},
+		{Name: aws.String("X-Campaign"), Value: aws.String("=?UTF-8?q?=C3=9Cber_launch?=")},
+		{Name: aws.String("X-Priority"), Value: aws.String("1")},
+	}
+
+	if !reflect.DeepEqual(content.Simple.Headers, expected) {
+		t.Errorf("expected %+v, got %+v", expected, content.Simple.Headers)
+	}
+
+	if subject := aws.ToString(content.Simple.Subject.Data); subject != "Subject" {
+		t.Errorf("expected the subject to be kept, got %q", subject)
+	}
+}
+
+func TestSendEmailWritesCustomHeadersWithAttachments(t *testing.T) {
+	useSettings(t, Config{AllowedAttachmentTypes: defaultAllowedAttachmentTypes})
+
+	client := &fakeClient{}
+	input := simpleEmail("to@example.com")
+	input.Content.Attachments = []Attachment{{Filename: "notes.txt", ContentType: "text/plain", Data: []byte("notes")}}
+	input.Content.Headers = map[string]string{
+		"X-Priority": "1",
+		"X-Campaign": "Über launch",
+	}
+
+	if _, err := SendEmail(context.Background(), client, input); err != nil {
+		t.Fatal(err)
+	}
+
+	content := client.SentEmails()[0].Content
+
+	if content.Simple != nil || content.Raw == nil {
+		t.Fatalf("expected a raw message, got %+v", content)
+	}
+
+	message, err := mail.ReadMessage(bytes.NewReader(content.Raw.Data))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoder := &mime.WordDecoder{}
+
+	for name, expected := range input.Content.Headers {
+		if value, err := decoder.DecodeHeader(message.Header.Get(name)); err != nil || value != expected {
+			t.Errorf("expected %s to be %q, got %q", name, expected, value)
+		}
+	}
+}
+
+func TestSendEmailRejectsInvalidHeaders(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		headers  map[string]string
+		expected string
+	}{
+		{"from", map[string]string{"From": "other@example.com"}, "Header From is reserved, so set it through its own field instead"},
+		{"to", map[string]string{"to": "other@example.com"}, "Header to is reserved, so set it through its own field instead"},
+		{"subject", map[string]string{"SUBJECT": "Hi"}, "Header SUBJECT is reserved, so set it through its own field instead"},
+		{"invalid name", map[string]string{"X Priority": "1"}, `Header name "X Priority" is invalid`},
+		{"injected value", map[string]string{"X-Priority": "1\r\nBcc: victim@example.com"}, "Header X-Priority must not contain control characters"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			useSettings(t, Config{})
+
+			client := &fakeClient{}
+			input := simpleEmail("to@example.com")
+			input.Content.Headers = test.headers
+
+			if _, err := SendEmail(context.Background(), client, input); err == nil || err.Error() != test.expected {
+				t.Errorf("expected %q, got %v", test.expected, err)
+			} else if len(client.SentEmails()) != 0 {
+				t.Errorf("expected nothing to be sent, got %d", len(client.SentEmails()))
+			}
+		})
+	}
+}
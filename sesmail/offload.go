@@ -0,0 +1,93 @@
+// Offloading of oversized payloads to external storage
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Stores payloads too large to process within a single invocation
+type PayloadStore interface {
+
+	// Stores the payload under the key, returning where it was stored.
+	Store(ctx context.Context, key string, payload []byte) (string, error)
+
+	// Loads the payload stored under the key.
+	Load(ctx context.Context, key string) ([]byte, error)
+}
+
+// The store oversized payloads are offloaded to. Offloading is disabled when nil.
+var Offload PayloadStore
+
+// The largest payload loaded from the payload store, which is enough for any emails array this
+// function could send in one invocation
+const maxLoadedPayloadSize = 64 << 20
+
+// The operations of an S3 client which S3PayloadStore uses, implemented by *s3.Client
+type S3Client interface {
+	PutObject(
+		ctx context.Context,
+		params *s3.PutObjectInput,
+		optFns ...func(*s3.Options),
+	) (*s3.PutObjectOutput, error)
+
+	GetObject(
+		ctx context.Context,
+		params *s3.GetObjectInput,
+		optFns ...func(*s3.Options),
+	) (*s3.GetObjectOutput, error)
+}
+
+// A payload store which writes payloads to an S3 bucket
+type S3PayloadStore struct {
+	Bucket string
+	Client S3Client
+}
+
+// Puts the payload in the bucket, returning its s3:// URI
+func (store *S3PayloadStore) Store(ctx context.Context, key string, payload []byte) (string, error) {
+	_, err := store.Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(store.Bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(payload),
+		ContentType: aws.String("application/json"),
+	})
+
+	if err != nil {
+		return "", fmt.Errorf("Failed to store payload in S3: %w", err)
+	}
+
+	return fmt.Sprintf("s3://%s/%s", store.Bucket, key), nil
+}
+
+// Gets the payload stored under the key from the bucket, refusing payloads larger than
+// maxLoadedPayloadSize
+func (store *S3PayloadStore) Load(ctx context.Context, key string) ([]byte, error) {
+	output, err := store.Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(store.Bucket),
+		Key:    aws.String(key),
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load payload from S3: %w", err)
+	}
+
+	defer output.Body.Close()
+
+	payload, err := io.ReadAll(io.LimitReader(output.Body, maxLoadedPayloadSize+1))
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load payload from S3: %w", err)
+	} else if len(payload) > maxLoadedPayloadSize {
+		return nil, fmt.Errorf("Payload %s is larger than %d bytes", key, maxLoadedPayloadSize)
+	}
+
+	return payload, nil
+}
@@ -0,0 +1,148 @@
+// Tests for offloading payloads to external storage
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Answers every request with the status and response, recording the last request
+type fakeTransport struct {
+	status   int
+	response string
+	request  *http.Request
+	body     []byte
+}
+
+func (transport *fakeTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	transport.request, transport.body = request, nil
+
+	if request.Body != nil {
+		body, err := io.ReadAll(request.Body)
+
+		if err != nil {
+			return nil, err
+		}
+
+		transport.body = body
+	}
+
+	return &http.Response{
+		StatusCode: transport.status,
+		Status:     http.StatusText(transport.status),
+		Body:       io.NopCloser(strings.NewReader(transport.response)),
+		Request:    request,
+	}, nil
+}
+
+func s3Store(bucket string, transport *fakeTransport) *S3PayloadStore {
+	return &S3PayloadStore{
+		Bucket: bucket,
+		Client: s3.New(s3.Options{
+			Region: "us-east-1",
+			Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+				return aws.Credentials{AccessKeyID: "test", SecretAccessKey: "test"}, nil
+			}),
+			HTTPClient:                 &http.Client{Transport: transport},
+			RequestChecksumCalculation: aws.RequestChecksumCalculationWhenRequired,
+			RetryMaxAttempts:           1,
+		}),
+	}
+}
+
+func TestS3PayloadStore(t *testing.T) {
+	transport := &fakeTransport{status: http.StatusOK}
+	location, err := s3Store("payloads", transport).Store(context.Background(), "emails/1.json", []byte(`{"emails":[]}`))
+
+	if err != nil {
+		t.Fatal(err)
+	} else if location != "s3://payloads/emails/1.json" {
+		t.Errorf("expected s3://payloads/emails/1.json, got %s", location)
+	}
+
+	request := transport.request
+
+	if request.Method != http.MethodPut || request.URL.Host+request.URL.Path != "payloads.s3.us-east-1.amazonaws.com/emails/1.json" {
+		t.Errorf("expected a PUT to the object, got %s %s", request.Method, request.URL)
+	} else if !bytes.Equal(transport.body, []byte(`{"emails":[]}`)) {
+		t.Errorf("expected the payload to be uploaded, got %s", transport.body)
+	} else if !strings.HasPrefix(request.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=test/") {
+		t.Errorf("expected a signed request, got %q", request.Header.Get("Authorization"))
+	}
+}
+
+func TestS3PayloadStoreEscapesKeys(t *testing.T) {
+	transport := &fakeTransport{status: http.StatusOK}
+
+	if _, err := s3Store("payloads", transport).Store(context.Background(), "emails/a b+c.json", []byte("{}")); err != nil {
+		t.Fatal(err)
+	} else if path := transport.request.URL.EscapedPath(); path != "/emails/a%20b%2Bc.json" {
+		t.Errorf("expected the key to be escaped, got %s", path)
+	}
+}
+
+func TestS3PayloadStoreDottedBucket(t *testing.T) {
+	transport := &fakeTransport{status: http.StatusOK}
+
+	if _, err := s3Store("talentmaker.payloads", transport).Store(context.Background(), "emails/1.json", []byte("{}")); err != nil {
+		t.Fatal(err)
+	} else if url := transport.request.URL; url.Host+url.Path != "s3.us-east-1.amazonaws.com/talentmaker.payloads/emails/1.json" {
+		t.Errorf("expected a path-style URL matching S3's certificate, got %s", url)
+	}
+}
+
+func TestS3PayloadStoreError(t *testing.T) {
+	transport := &fakeTransport{status: http.StatusForbidden, response: "<Error><Code>AccessDenied</Code></Error>"}
+	_, err := s3Store("payloads", transport).Store(context.Background(), "emails/1.json", []byte("{}"))
+
+	if err == nil || !strings.HasPrefix(err.Error(), "Failed to store payload in S3: ") || !strings.Contains(err.Error(), "AccessDenied") {
+		t.Errorf("expected the S3 error, got %v", err)
+	}
+}
+
+func TestS3PayloadStoreLoad(t *testing.T) {
+	transport := &fakeTransport{status: http.StatusOK, response: `{"emails":[]}`}
+	payload, err := s3Store("payloads", transport).Load(context.Background(), "emails/1.json")
+
+	if err != nil {
+		t.Fatal(err)
+	} else if string(payload) != `{"emails":[]}` {
+		t.Errorf("expected the stored payload, got %s", payload)
+	}
+
+	request := transport.request
+
+	if request.Method != http.MethodGet || request.URL.Host+request.URL.Path != "payloads.s3.us-east-1.amazonaws.com/emails/1.json" {
+		t.Errorf("expected a GET of the object, got %s %s", request.Method, request.URL)
+	} else if !strings.HasPrefix(request.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=test/") {
+		t.Errorf("expected a signed request, got %q", request.Header.Get("Authorization"))
+	}
+}
+
+func TestS3PayloadStoreLoadTooLarge(t *testing.T) {
+	transport := &fakeTransport{status: http.StatusOK, response: strings.Repeat(" ", maxLoadedPayloadSize+1)}
+	_, err := s3Store("payloads", transport).Load(context.Background(), "emails/1.json")
+
+	if expected := fmt.Sprintf("Payload emails/1.json is larger than %d bytes", maxLoadedPayloadSize); err == nil || err.Error() != expected {
+		t.Errorf("expected %q, got %v", expected, err)
+	}
+}
+
+func TestS3PayloadStoreLoadError(t *testing.T) {
+	transport := &fakeTransport{status: http.StatusNotFound, response: "<Error><Code>NoSuchKey</Code></Error>"}
+	_, err := s3Store("payloads", transport).Load(context.Background(), "emails/1.json")
+
+	if err == nil || !strings.HasPrefix(err.Error(), "Failed to load payload from S3: ") || !strings.Contains(err.Error(), "NoSuchKey") {
+		t.Errorf("expected the S3 error, got %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+// Skipping of recipients who opted out through an external service
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Looks up whether recipients have opted out of emails, such as in an organization's own opt-out
+// database, beyond the SES suppression list
+type OptOutChecker interface {
+	IsOptedOut(ctx context.Context, address string) (bool, error)
+}
+
+// An opt-out checker which never opts anyone out
+type NoopOptOutChecker struct{}
+
+func (NoopOptOutChecker) IsOptedOut(context.Context, string) (bool, error) {
+	return false, nil
+}
+
+// The checker consulted for every recipient before sending
+var OptOut OptOutChecker = NoopOptOutChecker{}
+
+// Returned when every recipient of an email has opted out, so there's nobody left to send it to
+var ErrAllRecipientsOptedOut = errors.New("Every recipient has opted out")
+
+// A bulk entry with recipients who opted out
+type OptedOutEntry struct {
+
+	// The index of the entry.
+	Index int `json:"index"`
+
+	// The recipients who opted out and were removed from the entry.
+	Addresses []string `json:"addresses"`
+
+	// Whether every recipient opted out, so the entry was left out of the request.
+	Skipped bool `json:"skipped"`
+}
+
+// Returns a copy of the destination without the recipients who opted out, along with their
+// addresses. Since the opt-out status of a recipient can't be assumed, a failed lookup fails the
+// send.
+func removeOptedOutRecipients(ctx context.Context, destination *Destination) (*Destination, []string, error) {
+	var optedOut []string
+
+	filter := func(addresses []string) ([]string, error) {
+		var kept []string
+
+		for _, address := range addresses {
+			isOptedOut, err := OptOut.IsOptedOut(ctx, address)
+
+			if err != nil {
+				return nil, fmt.Errorf("Failed to check if %s opted out: %w", address, err)
+			} else if isOptedOut {
+				optedOut = append(optedOut, address)
+			} else {
+				kept = append(kept, address)
+			}
+		}
+
+		return kept, nil
+	}
+
+	filtered := &Destination{}
+	var err error
+
+	if filtered.ToAddresses, err = filter(destination.ToAddresses); err != nil {
+		return nil, nil, err
+	} else if filtered.CcAddresses, err = filter(destination.CcAddresses); err != nil {
+		return nil, nil, err
+	} else if filtered.BccAddresses, err = filter(destination.BccAddresses); err != nil {
+		return nil, nil, err
+	}
+
+	return filtered, optedOut, nil
+}
+
+func isEmptyDestination(destination *Destination) bool {
+	return len(destination.ToAddresses) == 0 && len(destination.CcAddresses) == 0 &&
+		len(destination.BccAddresses) == 0
+}
@@ -0,0 +1,124 @@
+// Tests for skipping recipients who opted out
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Opts out the listed addresses, failing lookups of addresses at broken.example.com
+type fakeOptOutChecker map[string]bool
+
+func (checker fakeOptOutChecker) IsOptedOut(_ context.Context, address string) (bool, error) {
+	if strings.HasSuffix(address, "@broken.example.com") {
+		return false, errors.New("lookup failed")
+	}
+
+	return checker[address], nil
+}
+
+// Uses the checker for the rest of the test
+func useOptOutChecker(t *testing.T, checker OptOutChecker) {
+	previous := OptOut
+	OptOut = checker
+	t.Cleanup(func() { OptOut = previous })
+}
+
+func TestSendEmailSkipsOptedOutRecipients(t *testing.T) {
+	useOptOutChecker(t, fakeOptOutChecker{"b@example.com": true, "d@example.com": true})
+
+	client := &fakeClient{}
+	input := simpleEmail("a@example.com")
+	input.Destination.ToAddresses = append(input.Destination.ToAddresses, "b@example.com")
+	input.Destination.CcAddresses = []string{"c@example.com"}
+	input.Destination.BccAddresses = []string{"d@example.com"}
+
+	output, err := SendEmail(context.Background(), client, input)
+
+	if err != nil {
+		t.Fatal(err)
+	} else if expected := []string{"b@example.com", "d@example.com"}; !reflect.DeepEqual(output.OptedOutRecipients, expected) {
+		t.Errorf("expected %v to be reported, got %v", expected, output.OptedOutRecipients)
+	}
+
+	sent := client.SentEmails()[0].Destination
+
+	if !reflect.DeepEqual(sent.ToAddresses, []string{"a@example.com"}) ||
+		!reflect.DeepEqual(sent.CcAddresses, []string{"c@example.com"}) ||
+		len(sent.BccAddresses) != 0 {
+		t.Errorf("expected opted out recipients not to be sent to, got %+v", sent)
+	}
+}
+
+func TestSendEmailWithEveryRecipientOptedOut(t *testing.T) {
+	useOptOutChecker(t, fakeOptOutChecker{"a@example.com": true})
+
+	client := &fakeClient{}
+
+	if _, err := SendEmail(context.Background(), client, simpleEmail("a@example.com")); err != ErrAllRecipientsOptedOut {
+		t.Errorf("expected %v, got %v", ErrAllRecipientsOptedOut, err)
+	} else if len(client.SentEmails()) != 0 {
+		t.Errorf("expected SES not to be called")
+	}
+}
+
+func TestSendEmailFailsWhenOptOutLookupFails(t *testing.T) {
+	useOptOutChecker(t, fakeOptOutChecker{})
+
+	if _, err := SendEmail(context.Background(), &fakeClient{}, simpleEmail("a@broken.example.com")); err == nil ||
+		err.Error() != "Failed to check if a@broken.example.com opted out: lookup failed" {
+		t.Errorf("expected the lookup error, got %v", err)
+	}
+}
+
+func TestSendBulkEmailSkipsOptedOutEntries(t *testing.T) {
+	useOptOutChecker(t, fakeOptOutChecker{"b@example.com": true, "d@example.com": true})
+
+	client := &fakeClient{}
+	input := bulkEmail("a@example.com", "b@example.com", "c@example.com")
+	input.BulkEmailEntries[2].Destination.CcAddresses = []string{"d@example.com"}
+
+	output, err := SendBulkEmail(context.Background(), client, input)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []OptedOutEntry{
+		{Index: 1, Addresses: []string{"b@example.com"}, Skipped: true},
+		{Index: 2, Addresses: []string{"d@example.com"}},
+	}
+
+	if !reflect.DeepEqual(output.OptedOutEntries, expected) {
+		t.Errorf("expected %+v, got %+v", expected, output.OptedOutEntries)
+	}
+
+	entries := client.SentBulkEmails()[0].BulkEmailEntries
+
+	if len(entries) != 2 || entries[1].Destination.ToAddresses[0] != "c@example.com" || len(entries[1].Destination.CcAddresses) != 0 {
+		t.Errorf("expected the opted out entry and recipient to be left out, got %+v", entries)
+	}
+}
+
+func TestSendBulkEmailWithEveryEntryOptedOut(t *testing.T) {
+	useOptOutChecker(t, fakeOptOutChecker{"a@example.com": true, "b@example.com": true})
+
+	client := &fakeClient{}
+
+	if _, err := SendBulkEmail(context.Background(), client, bulkEmail("a@example.com", "b@example.com")); err != ErrAllRecipientsOptedOut {
+		t.Errorf("expected %v, got %v", ErrAllRecipientsOptedOut, err)
+	} else if len(client.SentBulkEmails()) != 0 {
+		t.Errorf("expected SES not to be called, got %+v", client.SentBulkEmails())
+	}
+}
+
+func TestNoopOptOutChecker(t *testing.T) {
+	if optedOut, err := (NoopOptOutChecker{}).IsOptedOut(context.Background(), "a@example.com"); optedOut || err != nil {
+		t.Errorf("expected nobody to be opted out, got %t and %v", optedOut, err)
+	}
+}
@@ -0,0 +1,180 @@
+// Previews of the subject and body of simple and templated emails, without sending them
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+)
+
+// The subject and the start of the body of an email, as plain text, for display in a UI
+type EmailPreview struct {
+
+	// The subject of the email, with template variables replaced.
+	Subject string `json:"subject"`
+
+	// The start of the body as plain text, taken from the text part or converted from the HTML part
+	// if there's none, with template variables replaced.
+	Body string `json:"body"`
+
+	// Whether the body was cut short at PREVIEW_LENGTH characters.
+	Truncated bool `json:"truncated"`
+}
+
+// Matches an element whose content is never displayed
+var hiddenElementPattern = regexp.MustCompile(`(?is)<(script|style|head)\b.*?</(script|style|head)\s*>`)
+
+// Matches an element which starts a new line, such as <br> or </p>
+var lineBreakPattern = regexp.MustCompile(`(?i)<(br|/p|/div|/h[1-6]|/li|/tr)\b[^>]*>`)
+
+// Matches any HTML tag or comment
+var htmlTagPattern = regexp.MustCompile(`(?s)<!--.*?-->|<[^>]*>`)
+
+// Matches a Handlebars tag which substitutes a variable, such as {{name}} or {{{user.name}}}
+var templateSubstitutionPattern = regexp.MustCompile(`\{\{\{?\s*([\w.]+)\s*\}?\}\}`)
+
+// Matches any other Handlebars tag, such as {{#if name}} or {{! comment}}
+var templateTagPattern = regexp.MustCompile(`\{\{[^}]*\}\}\}?`)
+
+// Converts HTML into plain text, keeping line breaks between blocks
+func htmlToText(content string) string {
+	content = hiddenElementPattern.ReplaceAllString(content, "")
+	content = lineBreakPattern.ReplaceAllString(content, "\n")
+	content = htmlTagPattern.ReplaceAllString(content, "")
+
+	return html.UnescapeString(content)
+}
+
+// Collapses the whitespace of each line and drops empty lines
+func collapseWhitespace(content string) string {
+	var lines []string
+
+	for _, line := range strings.Split(content, "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Looks up a dotted path, such as user.name, in template data
+func templateValue(data map[string]interface{}, path string) string {
+	var value interface{} = data
+
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+
+		if !ok {
+			return ""
+		}
+
+		value = object[key]
+	}
+
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	default:
+		encoded, _ := json.Marshal(value)
+
+		return string(encoded)
+	}
+}
+
+// Replaces the variables of a template with their values, as SES would, and removes any other
+// tags. Missing variables are replaced with nothing.
+func renderTemplate(content string, data map[string]interface{}) string {
+	content = templateSubstitutionPattern.ReplaceAllStringFunc(content, func(tag string) string {
+		return templateValue(data, templateSubstitutionPattern.FindStringSubmatch(tag)[1])
+	})
+
+	return templateTagPattern.ReplaceAllString(content, "")
+}
+
+// Cuts text to at most length characters, reporting whether it was cut
+func truncatePreview(content string, length int) (string, bool) {
+	runes := []rune(content)
+
+	if length <= 0 || len(runes) <= length {
+		return content, false
+	}
+
+	return strings.TrimSpace(string(runes[:length])) + "…", true
+}
+
+// Returns the subject, text, and HTML of an email's simple or templated content
+func previewParts(ctx context.Context, client Client, content *EmailContent) (string, string, string, error) {
+	if content.Body != nil && content.Subject != nil {
+		return aws.ToString(content.Subject.Data), bodyData(content.Body.Text), bodyData(content.Body.Html), nil
+	} else if simple := content.Simple; simple != nil && simple.Body != nil && simple.Subject != nil {
+		return aws.ToString(simple.Subject.Data), bodyData(simple.Body.Text), bodyData(simple.Body.Html), nil
+	} else if content.Template == nil {
+		return "", "", "", invalidInput(errors.New("Previews need simple or templated content"))
+	} else if aws.ToString(content.Template.TemplateName) == "" {
+		return "", "", "", invalidInput(errors.New("Previews need a template name"))
+	}
+
+	templateContent, err := getTemplateContent(ctx, client, *content.Template.TemplateName)
+
+	if err != nil {
+		return "", "", "", templateNotFound(err, &types.Template{TemplateName: content.Template.TemplateName})
+	}
+
+	var data map[string]interface{}
+
+	if !isEmptyTemplateData(content.Template.TemplateData) {
+		if err := json.Unmarshal([]byte(*content.Template.TemplateData), &data); err != nil {
+			return "", "", "", invalidInput(fmt.Errorf("Template data isn't a JSON object: %w", err))
+		}
+	}
+
+	return renderTemplate(aws.ToString(templateContent.Subject), data),
+		renderTemplate(aws.ToString(templateContent.Text), data),
+		renderTemplate(aws.ToString(templateContent.Html), data),
+		nil
+}
+
+func bodyData(content *Content) string {
+	if content == nil {
+		return ""
+	}
+
+	return aws.ToString(content.Data)
+}
+
+// Returns the subject of an email and the start of its body as plain text, at most PREVIEW_LENGTH
+// characters long, without sending it. Templates are looked up in SES, and their variables are
+// replaced with the email's template data. Raw messages can't be previewed.
+func PreviewEmail(ctx context.Context, client Client, input *SendEmailInput) (*EmailPreview, error) {
+	if err := ValidateSendEmailInput(input); err != nil {
+		return nil, err
+	}
+
+	subject, text, htmlBody, err := previewParts(ctx, client, input.Content)
+
+	if err != nil {
+		return nil, err
+	} else if strings.TrimSpace(text) == "" {
+		text = htmlToText(htmlBody)
+	}
+
+	body, truncated := truncatePreview(collapseWhitespace(text), Settings.PreviewLength)
+
+	return &EmailPreview{
+		Subject:   collapseWhitespace(subject),
+		Body:      body,
+		Truncated: truncated,
+	}, nil
+}
@@ -0,0 +1,166 @@
+// Tests for previews of the subject and body of emails
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+)
+
+func TestHtmlToText(t *testing.T) {
+	for content, expected := range map[string]string{
+		"<p>Hello</p><p>World</p>":                          "Hello\nWorld\n",
+		"Line one<br>Line two<BR/>":                         "Line one\nLine two\n",
+		"<style>p { color: red; }</style><b>Bold</b> text":  "Bold text",
+		"<!-- hidden --><a href=\"/\">Fish &amp; chips</a>": "Fish & chips",
+		"<head><title>Ignored</title></head>Body":           "Body",
+	} {
+		if text := htmlToText(content); text != expected {
+			t.Errorf("expected %q for %q, got %q", expected, content, text)
+		}
+	}
+}
+
+func TestRenderTemplate(t *testing.T) {
+	data := map[string]interface{}{
+		"name":  "Ada",
+		"user":  map[string]interface{}{"plan": "pro"},
+		"count": 3,
+	}
+
+	for content, expected := range map[string]string{
+		"Hi {{name}}":                       "Hi Ada",
+		"Hi {{ name }}, on {{{user.plan}}}": "Hi Ada, on pro",
+		"{{count}} new messages":            "3 new messages",
+		"Hi {{missing}}!":                   "Hi !",
+		"{{#if name}}Welcome{{/if}}":        "Welcome",
+	} {
+		if rendered := renderTemplate(content, data); rendered != expected {
+			t.Errorf("expected %q for %q, got %q", expected, content, rendered)
+		}
+	}
+}
+
+func TestTruncatePreview(t *testing.T) {
+	for _, test := range []struct {
+		content   string
+		length    int
+		expected  string
+		truncated bool
+	}{
+		{"short", 10, "short", false},
+		{"exactly ten", 11, "exactly ten", false},
+		{"one word too many", 12, "one word too…", true},
+		{"trailing space cut", 9, "trailing…", true},
+		{"ünïcödé text", 6, "ünïcöd…", true},
+		{"no limit", 0, "no limit", false},
+	} {
+		if preview, truncated := truncatePreview(test.content, test.length); preview != test.expected || truncated != test.truncated {
+			t.Errorf("expected %q and %t for %q, got %q and %t", test.expected, test.truncated, test.content, preview, truncated)
+		}
+	}
+}
+
+func TestPreviewEmail(t *testing.T) {
+	useTemplateCache(t)
+
+	client := &fakeClient{templates: map[string]*types.EmailTemplateContent{
+		"welcome": {
+			Subject: aws.String("Welcome, {{name}}"),
+			Html:    aws.String("<h1>Hi {{name}}</h1><p>Your plan is   {{plan}}.</p>"),
+		},
+		"with-text": {
+			Subject: aws.String("Receipt"),
+			Html:    aws.String("<p>HTML</p>"),
+			Text:    aws.String("Thanks, {{name}}"),
+		},
+	}}
+	htmlEmail := simpleEmail("to@example.com")
+	htmlEmail.Content.Simple.Body = &Body{Html: &Content{Data: aws.String("<p>Hello   <b>there</b></p>")}}
+
+	for _, test := range []struct {
+		name     string
+		length   int
+		input    *SendEmailInput
+		expected *EmailPreview
+	}{
+		{"simple text", 200, simpleEmail("to@example.com"), &EmailPreview{Subject: "Subject", Body: "Body"}},
+		{"simple HTML", 200, htmlEmail, &EmailPreview{Subject: "Subject", Body: "Hello there"}},
+		{
+			"template",
+			200,
+			templatedEmailWithData("welcome", `{"name":"Ada","plan":"pro"}`),
+			&EmailPreview{Subject: "Welcome, Ada", Body: "Hi Ada\nYour plan is pro."},
+		},
+		{
+			"template text part",
+			200,
+			templatedEmailWithData("with-text", `{"name":"Ada"}`),
+			&EmailPreview{Subject: "Receipt", Body: "Thanks, Ada"},
+		},
+		{
+			"truncated",
+			10,
+			templatedEmailWithData("welcome", `{"name":"Ada","plan":"pro"}`),
+			&EmailPreview{Subject: "Welcome, Ada", Body: "Hi Ada\nYou…", Truncated: true},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			useSettings(t, Config{PreviewLength: test.length})
+
+			sent := len(client.SentEmails())
+			preview, err := PreviewEmail(context.Background(), client, test.input)
+
+			if err != nil {
+				t.Fatal(err)
+			} else if !reflect.DeepEqual(preview, test.expected) {
+				t.Errorf("expected %+v, got %+v", test.expected, preview)
+			} else if len(client.SentEmails()) != sent {
+				t.Error("expected the email not to be sent")
+			}
+		})
+	}
+}
+
+// A templated email to to@example.com with the template data
+func templatedEmailWithData(template string, data string) *SendEmailInput {
+	input := templatedEmail("to@example.com", template)
+	input.Content.Template.TemplateData = aws.String(data)
+
+	return input
+}
+
+func TestPreviewEmailErrors(t *testing.T) {
+	useSettings(t, Config{PreviewLength: 200})
+	useTemplateCache(t)
+
+	client := &fakeClient{templates: map[string]*types.EmailTemplateContent{}}
+	raw := &SendEmailInput{
+		Content:          &EmailContent{Raw: &RawMessage{Data: rawMessage("Subject: Hi", "", "Hello")}},
+		Destination:      &Destination{ToAddresses: []string{"to@example.com"}},
+		FromEmailAddress: aws.String("from@example.com"),
+	}
+
+	if _, err := PreviewEmail(context.Background(), client, raw); err == nil || err.Error() != "Previews need simple or templated content" {
+		t.Errorf("expected raw messages not to be previewed, got %v", err)
+	}
+
+	var notFound *ErrTemplateNotFound
+
+	if _, err := PreviewEmail(context.Background(), client, templatedEmail("to@example.com", "missing")); !errors.As(err, &notFound) {
+		t.Errorf("expected the template not to be found, got %v", err)
+	}
+
+	if _, err := PreviewEmail(context.Background(), client, &SendEmailInput{}); err == nil {
+		t.Error("expected an invalid email to be rejected")
+	} else if strings.HasPrefix(err.Error(), "Previews") {
+		t.Errorf("expected the email to be validated first, got %v", err)
+	}
+}
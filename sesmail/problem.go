@@ -0,0 +1,104 @@
+// Conversion of errors into RFC 7807 problem details
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"errors"
+	"net/http"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/smithy-go"
+)
+
+// The media type of serialized problem details
+const ProblemContentType = "application/problem+json"
+
+// An error described as an RFC 7807 problem details object
+type Problem struct {
+
+	// A URI identifying the kind of problem, such as urn:lambda-ses:problem:MessageRejected.
+	Type string `json:"type"`
+
+	// A short summary of the kind of problem, which is the SES error code for SES errors.
+	Title string `json:"title"`
+
+	// The HTTP status code suited to the problem.
+	Status int `json:"status"`
+
+	// The full error message.
+	Detail string `json:"detail"`
+
+	// A URI identifying this occurrence of the problem, which is the SES request ID when known.
+	Instance string `json:"instance,omitempty"`
+}
+
+// HTTP statuses of SES error codes which don't come with a response, or whose response status
+// doesn't suit the caller
+var problemStatuses = map[string]int{
+	"AccountSuspendedException":          http.StatusForbidden,
+	"BadRequestException":                http.StatusBadRequest,
+	"LimitExceededException":             http.StatusTooManyRequests,
+	"MailFromDomainNotVerifiedException": http.StatusBadRequest,
+	"MessageRejected":                    http.StatusBadRequest,
+	"NotFoundException":                  http.StatusNotFound,
+	"SendingPausedException":             http.StatusForbidden,
+	"TooManyRequestsException":           http.StatusTooManyRequests,
+}
+
+// Describes an error as problem details. SES errors are identified by their error code, while
+// errors raised before reaching SES, such as invalid input, are reported as bad requests.
+func NewProblem(err error) *Problem {
+	if err == nil {
+		return nil
+	}
+
+	problem := &Problem{
+		Type:   "urn:lambda-ses:problem:InvalidInput",
+		Title:  "Invalid input",
+		Status: http.StatusBadRequest,
+		Detail: err.Error(),
+	}
+
+	var apiErr smithy.APIError
+	var templateErr *ErrTemplateNotFound
+	var virusErr *ErrVirusDetected
+	var responseErr *awshttp.ResponseError
+
+	if errors.Is(err, ErrSendingDisabled) {
+		problem.Type = "urn:lambda-ses:problem:SendingDisabled"
+		problem.Title = "Sending disabled"
+		problem.Status = http.StatusServiceUnavailable
+	} else if errors.Is(err, ErrChunkTimeout) {
+		problem.Type = "urn:lambda-ses:problem:ChunkTimeout"
+		problem.Title = "Chunk timed out"
+		problem.Status = http.StatusGatewayTimeout
+	} else if errors.As(err, &templateErr) {
+		problem.Type = "urn:lambda-ses:problem:TemplateNotFound"
+		problem.Title = "Template not found"
+		problem.Status = http.StatusNotFound
+	} else if errors.As(err, &virusErr) {
+		problem.Type = "urn:lambda-ses:problem:VirusDetected"
+		problem.Title = "Virus detected"
+		problem.Status = http.StatusUnprocessableEntity
+	} else if errors.As(err, &apiErr) {
+		problem.Type = "urn:lambda-ses:problem:" + apiErr.ErrorCode()
+		problem.Title = apiErr.ErrorCode()
+
+		if status, ok := problemStatuses[apiErr.ErrorCode()]; ok {
+			problem.Status = status
+		} else if apiErr.ErrorFault() == smithy.FaultServer {
+			problem.Status = http.StatusBadGateway
+		}
+	} else if errors.As(err, &responseErr) {
+		problem.Type = "urn:lambda-ses:problem:ServiceError"
+		problem.Title = "Service error"
+		problem.Status = http.StatusBadGateway
+	}
+
+	if errors.As(err, &responseErr) && responseErr.ServiceRequestID() != "" {
+		problem.Instance = "urn:aws:request:" + responseErr.ServiceRequestID()
+	}
+
+	return problem
+}
@@ -0,0 +1,134 @@
+// Tests for describing errors as RFC 7807 problem details
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// Wraps an error in a response from SES with the given status and request ID
+func responseError(status int, requestID string, err error) error {
+	return &awshttp.ResponseError{
+		ResponseError: &smithyhttp.ResponseError{
+			Response: &smithyhttp.Response{Response: &http.Response{StatusCode: status}},
+			Err:      err,
+		},
+		RequestID: requestID,
+	}
+}
+
+func TestNewProblem(t *testing.T) {
+	rejected := &smithy.GenericAPIError{Code: "MessageRejected", Message: "Email address is not verified.", Fault: smithy.FaultClient}
+	internal := &smithy.GenericAPIError{Code: "InternalFailure", Message: "Internal error", Fault: smithy.FaultServer}
+
+	for _, test := range []struct {
+		name     string
+		err      error
+		expected Problem
+	}{
+		{
+			"validation error",
+			errors.New("Content is required"),
+			Problem{
+				Type:   "urn:lambda-ses:problem:InvalidInput",
+				Title:  "Invalid input",
+				Status: 400,
+				Detail: "Content is required",
+			},
+		},
+		{
+			"SES error",
+			fmt.Errorf("operation error SESv2: SendEmail, %w", responseError(400, "request-id", rejected)),
+			Problem{
+				Type:     "urn:lambda-ses:problem:MessageRejected",
+				Title:    "MessageRejected",
+				Status:   400,
+				Detail:   "operation error SESv2: SendEmail, https response error StatusCode: 400, RequestID: request-id, api error MessageRejected: Email address is not verified.",
+				Instance: "urn:aws:request:request-id",
+			},
+		},
+		{
+			"throttled",
+			&smithy.GenericAPIError{Code: "TooManyRequestsException", Message: "Rate exceeded"},
+			Problem{
+				Type:   "urn:lambda-ses:problem:TooManyRequestsException",
+				Title:  "TooManyRequestsException",
+				Status: 429,
+				Detail: "api error TooManyRequestsException: Rate exceeded",
+			},
+		},
+		{
+			"SES server error",
+			internal,
+			Problem{
+				Type:   "urn:lambda-ses:problem:InternalFailure",
+				Title:  "InternalFailure",
+				Status: 502,
+				Detail: "api error InternalFailure: Internal error",
+			},
+		},
+		{
+			"response without an API error",
+			responseError(503, "", errors.New("service unavailable")),
+			Problem{
+				Type:   "urn:lambda-ses:problem:ServiceError",
+				Title:  "Service error",
+				Status: 502,
+				Detail: "https response error StatusCode: 503, RequestID: , service unavailable",
+			},
+		},
+		{
+			"missing template",
+			&ErrTemplateNotFound{Name: "welcome"},
+			Problem{
+				Type:   "urn:lambda-ses:problem:TemplateNotFound",
+				Title:  "Template not found",
+				Status: 404,
+				Detail: `Template "welcome" does not exist`,
+			},
+		},
+		{
+			"sending disabled",
+			ErrSendingDisabled,
+			Problem{
+				Type:   "urn:lambda-ses:problem:SendingDisabled",
+				Title:  "Sending disabled",
+				Status: 503,
+				Detail: "Sending is disabled",
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if problem := NewProblem(test.err); !reflect.DeepEqual(*problem, test.expected) {
+				t.Errorf("expected %+v, got %+v", test.expected, *problem)
+			}
+		})
+	}
+}
+
+func TestNewProblemWithoutError(t *testing.T) {
+	if problem := NewProblem(nil); problem != nil {
+		t.Errorf("expected no problem, got %+v", *problem)
+	}
+}
+
+func TestProblemJSON(t *testing.T) {
+	encoded, err := json.Marshal(NewProblem(errors.New("Content is required")))
+	expected := `{"type":"urn:lambda-ses:problem:InvalidInput","title":"Invalid input","status":400,"detail":"Content is required"}`
+
+	if err != nil {
+		t.Fatal(err)
+	} else if string(encoded) != expected {
+		t.Errorf("expected %s, got %s", expected, encoded)
+	}
+}
@@ -0,0 +1,162 @@
+// Punycode encoding of internationalized domain names
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Parameters of Punycode's bootstring encoding, from RFC 3492
+const (
+	punycodeBase        = 36
+	punycodeTMin        = 1
+	punycodeTMax        = 26
+	punycodeSkew        = 38
+	punycodeDamp        = 700
+	punycodeInitialBias = 72
+	punycodeInitialN    = 128
+)
+
+// The most characters a domain label may have
+const maxLabelLength = 63
+
+// Converts each non-ASCII label of a domain to Punycode, lowercasing it first, e.g. Bücher.example
+// becomes xn--bcher-kva.example. ASCII labels are kept as is.
+func punycodeDomain(domain string) (string, error) {
+	labels := strings.Split(domain, ".")
+
+	for index, label := range labels {
+		if strings.IndexFunc(label, isNonASCII) == -1 {
+			continue
+		}
+
+		encoded := punycodeLabel(strings.ToLower(label))
+
+		if len(encoded) > maxLabelLength {
+			return "", fmt.Errorf("Label %q is longer than %d characters in Punycode", label, maxLabelLength)
+		}
+
+		labels[index] = encoded
+	}
+
+	for _, label := range labels {
+		if label == "" {
+			return "", errors.New("Domains can't have empty labels")
+		}
+	}
+
+	return strings.Join(labels, "."), nil
+}
+
+// Encodes a domain label with non-ASCII characters in Punycode, prefixed with xn--
+func punycodeLabel(label string) string {
+	var encoded strings.Builder
+
+	runes := []rune(label)
+
+	for _, char := range runes {
+		if char <= unicode.MaxASCII {
+			encoded.WriteRune(char)
+		}
+	}
+
+	basic := encoded.Len()
+	handled := basic
+
+	if basic > 0 {
+		encoded.WriteByte('-')
+	}
+
+	n, delta, bias := rune(punycodeInitialN), 0, punycodeInitialBias
+
+	for handled < len(runes) {
+		next := rune(unicode.MaxRune)
+
+		for _, char := range runes {
+			if char >= n && char < next {
+				next = char
+			}
+		}
+
+		delta += int(next-n) * (handled + 1)
+		n = next
+
+		for _, char := range runes {
+			if char < n {
+				delta++
+
+				continue
+			} else if char > n {
+				continue
+			}
+
+			q := delta
+
+			for k := punycodeBase; ; k += punycodeBase {
+				t := punycodeThreshold(k, bias)
+
+				if q < t {
+					break
+				}
+
+				encoded.WriteByte(punycodeDigit(t + (q-t)%(punycodeBase-t)))
+				q = (q - t) / (punycodeBase - t)
+			}
+
+			encoded.WriteByte(punycodeDigit(q))
+			bias = punycodeAdapt(delta, handled+1, handled == basic)
+			delta = 0
+			handled++
+		}
+
+		delta++
+		n++
+	}
+
+	return "xn--" + encoded.String()
+}
+
+func punycodeThreshold(k int, bias int) int {
+	if k <= bias+punycodeTMin {
+		return punycodeTMin
+	} else if k >= bias+punycodeTMax {
+		return punycodeTMax
+	}
+
+	return k - bias
+}
+
+func punycodeAdapt(delta int, points int, first bool) int {
+	if first {
+		delta /= punycodeDamp
+	} else {
+		delta /= 2
+	}
+
+	delta += delta / points
+	k := 0
+
+	for delta > ((punycodeBase-punycodeTMin)*punycodeTMax)/2 {
+		delta /= punycodeBase - punycodeTMin
+		k += punycodeBase
+	}
+
+	return k + (punycodeBase-punycodeTMin+1)*delta/(delta+punycodeSkew)
+}
+
+func punycodeDigit(digit int) byte {
+	if digit < 26 {
+		return byte('a' + digit)
+	}
+
+	return byte('0' + digit - 26)
+}
+
+// Whether a character is outside ASCII, so its domain needs converting to Punycode
+func isNonASCII(char rune) bool {
+	return char > unicode.MaxASCII
+}
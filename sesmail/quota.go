@@ -0,0 +1,79 @@
+// Checks on the account's daily sending quota
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	sesv2 "github.com/aws/aws-sdk-go-v2/service/sesv2"
+)
+
+// Returns a warning if the account has used more of its daily quota than the configured
+// QUOTA_WARNING_PERCENT. Returns an empty string if usage is below the threshold, the check is
+// disabled, or the account has no daily quota.
+func CheckQuota(ctx context.Context, client Client) (string, error) {
+	if Settings.QuotaWarningPercent <= 0 {
+		return "", nil
+	}
+
+	output, err := client.GetAccount(ctx, &sesv2.GetAccountInput{})
+
+	if err != nil {
+		return "", err
+	} else if output.SendQuota == nil || output.SendQuota.Max24HourSend <= 0 {
+		return "", nil
+	}
+
+	quota := output.SendQuota
+	percent := quota.SentLast24Hours / quota.Max24HourSend * 100
+
+	if percent < Settings.QuotaWarningPercent {
+		return "", nil
+	}
+
+	warning := fmt.Sprintf(
+		"%.0f of %.0f emails in the daily quota have been sent (%.1f%%)",
+		quota.SentLast24Hours, quota.Max24HourSend, percent,
+	)
+	log.Printf("warning: %s", warning)
+
+	return warning, nil
+}
+
+// The account's sending quota and whether it can send, for deciding whether a large batch fits
+type AccountQuota struct {
+
+	// The most emails the account may send in 24 hours. -1 means unlimited.
+	Max24HourSend float64 `json:"max24HourSend"`
+
+	// The most emails the account may send per second.
+	MaxSendRate float64 `json:"maxSendRate"`
+
+	// How many emails the account sent in the last 24 hours.
+	SentLast24Hours float64 `json:"sentLast24Hours"`
+
+	// Whether the account may send emails.
+	SendingEnabled bool `json:"sendingEnabled"`
+}
+
+// Looks up the account's sending quota
+func GetAccountQuota(ctx context.Context, client Client) (*AccountQuota, error) {
+	output, err := client.GetAccount(ctx, &sesv2.GetAccountInput{})
+
+	if err != nil {
+		return nil, err
+	}
+
+	quota := &AccountQuota{SendingEnabled: output.SendingEnabled}
+
+	if output.SendQuota != nil {
+		quota.Max24HourSend = output.SendQuota.Max24HourSend
+		quota.MaxSendRate = output.SendQuota.MaxSendRate
+		quota.SentLast24Hours = output.SendQuota.SentLast24Hours
+	}
+
+	return quota, nil
+}
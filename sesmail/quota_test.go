@@ -0,0 +1,108 @@
+// Tests for checks on the daily sending quota
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	sesv2 "github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+)
+
+// A client whose account has sent the given number of its daily quota
+func quotaClient(sent float64, max float64) *fakeClient {
+	return &fakeClient{getAccount: func(context.Context, *sesv2.GetAccountInput) (*sesv2.GetAccountOutput, error) {
+		return &sesv2.GetAccountOutput{
+			SendQuota: &types.SendQuota{SentLast24Hours: sent, Max24HourSend: max},
+		}, nil
+	}}
+}
+
+func TestCheckQuota(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		percent  float64
+		sent     float64
+		max      float64
+		expected string
+	}{
+		{"below the threshold", 80, 700, 1000, ""},
+		{"at the threshold", 80, 800, 1000, "800 of 1000 emails in the daily quota have been sent (80.0%)"},
+		{"above the threshold", 80, 950, 1000, "950 of 1000 emails in the daily quota have been sent (95.0%)"},
+		{"without a daily quota", 80, 950, 0, ""},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			useSettings(t, Config{QuotaWarningPercent: test.percent})
+
+			if warning, err := CheckQuota(context.Background(), quotaClient(test.sent, test.max)); err != nil {
+				t.Fatal(err)
+			} else if warning != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, warning)
+			}
+		})
+	}
+}
+
+func TestCheckQuotaDisabled(t *testing.T) {
+	useSettings(t, Config{})
+
+	// GetAccount would panic if it were called
+	if warning, err := CheckQuota(context.Background(), &fakeClient{}); err != nil || warning != "" {
+		t.Errorf("expected no warning, got %q and %v", warning, err)
+	}
+}
+
+func TestCheckQuotaError(t *testing.T) {
+	useSettings(t, Config{QuotaWarningPercent: 80})
+	expected := errors.New("access denied")
+	client := &fakeClient{getAccount: func(context.Context, *sesv2.GetAccountInput) (*sesv2.GetAccountOutput, error) {
+		return nil, expected
+	}}
+
+	if _, err := CheckQuota(context.Background(), client); err != expected {
+		t.Errorf("expected %v, got %v", expected, err)
+	}
+}
+
+func TestGetAccountQuota(t *testing.T) {
+	client := &fakeClient{getAccount: func(context.Context, *sesv2.GetAccountInput) (*sesv2.GetAccountOutput, error) {
+		return &sesv2.GetAccountOutput{
+			SendQuota:      &types.SendQuota{Max24HourSend: 50000, MaxSendRate: 14, SentLast24Hours: 1200},
+			SendingEnabled: true,
+		}, nil
+	}}
+	expected := &AccountQuota{Max24HourSend: 50000, MaxSendRate: 14, SentLast24Hours: 1200, SendingEnabled: true}
+
+	if quota, err := GetAccountQuota(context.Background(), client); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(quota, expected) {
+		t.Errorf("expected %+v, got %+v", expected, quota)
+	}
+}
+
+func TestGetAccountQuotaWithoutSendQuota(t *testing.T) {
+	client := &fakeClient{getAccount: func(context.Context, *sesv2.GetAccountInput) (*sesv2.GetAccountOutput, error) {
+		return &sesv2.GetAccountOutput{}, nil
+	}}
+
+	if quota, err := GetAccountQuota(context.Background(), client); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(quota, &AccountQuota{}) {
+		t.Errorf("expected an empty quota, got %+v", quota)
+	}
+}
+
+func TestGetAccountQuotaError(t *testing.T) {
+	expected := errors.New("access denied")
+	client := &fakeClient{getAccount: func(context.Context, *sesv2.GetAccountInput) (*sesv2.GetAccountOutput, error) {
+		return nil, expected
+	}}
+
+	if quota, err := GetAccountQuota(context.Background(), client); err != expected || quota != nil {
+		t.Errorf("expected %v, got %+v and %v", expected, quota, err)
+	}
+}
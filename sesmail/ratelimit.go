@@ -0,0 +1,94 @@
+// Pacing of sends to recipient domains which rate limit incoming mail
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Spaces out sends to each rate limited domain so they never exceed the domain's configured rate
+type domainLimiter struct {
+	mutex sync.Mutex
+
+	// The earliest time the next send to each domain may happen
+	next map[string]time.Time
+}
+
+var domainLimits = &domainLimiter{next: make(map[string]time.Time)}
+
+// Reserves a slot for the domain and returns how long to wait before using it
+func (limiter *domainLimiter) reserve(domain string, rate float64) time.Duration {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	now := time.Now()
+	next := limiter.next[domain]
+
+	if next.Before(now) {
+		next = now
+	}
+
+	limiter.next[domain] = next.Add(time.Duration(float64(time.Second) / rate))
+
+	return next.Sub(now)
+}
+
+// Waits until an email can be sent to every rate limited domain in each destination, or until the
+// context is done. Each destination reserves its own slot, so a bulk email with several entries to
+// a domain waits for the last of them, since SES sends the entries together.
+func waitForDomainLimits(ctx context.Context, destinations ...*Destination) error {
+	if len(Settings.DomainRateLimits) == 0 {
+		return nil
+	}
+
+	var wait time.Duration
+
+	for _, destination := range destinations {
+		for domain := range destinationDomains(destination) {
+			rate, ok := Settings.DomainRateLimits[domain]
+
+			if !ok || rate <= 0 {
+				continue
+			}
+
+			if delay := domainLimits.reserve(domain, rate); delay > wait {
+				wait = delay
+			}
+		}
+	}
+
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Returns the lowercased domains of every recipient in a destination
+func destinationDomains(destination *Destination) map[string]struct{} {
+	domains := make(map[string]struct{})
+
+	for _, addresses := range [][]string{
+		destination.ToAddresses, destination.CcAddresses, destination.BccAddresses,
+	} {
+		for _, address := range addresses {
+			if at := strings.LastIndex(address, "@"); at != -1 {
+				domains[strings.ToLower(strings.TrimRight(address[at+1:], ">"))] = struct{}{}
+			}
+		}
+	}
+
+	return domains
+}
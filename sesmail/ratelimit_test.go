@@ -0,0 +1,119 @@
+// Tests for pacing sends to rate limited domains
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Uses a fresh limiter so earlier tests' reservations don't delay sends
+func useDomainLimits(t *testing.T, rates map[string]float64) {
+	previous := domainLimits
+	domainLimits = &domainLimiter{next: make(map[string]time.Time)}
+	useSettings(t, Config{DomainRateLimits: rates})
+	t.Cleanup(func() { domainLimits = previous })
+}
+
+// Sends an email to each address in turn and returns how long they took
+func timeSends(t *testing.T, addresses ...string) time.Duration {
+	start := time.Now()
+
+	for _, address := range addresses {
+		if _, err := SendEmail(context.Background(), &fakeClient{}, simpleEmail(address)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return time.Since(start)
+}
+
+func TestDomainRateLimitPacesThrottledDomain(t *testing.T) {
+	useDomainLimits(t, map[string]float64{"slow.example.com": 20})
+
+	// The first send is immediate, and each one after waits 50ms
+	if elapsed := timeSends(t, "a@slow.example.com", "b@SLOW.example.com", "c@slow.example.com"); elapsed < 100*time.Millisecond {
+		t.Errorf("expected sends to slow.example.com to be paced, but they took %s", elapsed)
+	}
+}
+
+func TestDomainRateLimitLeavesOtherDomainsUnthrottled(t *testing.T) {
+	useDomainLimits(t, map[string]float64{"slow.example.com": 1})
+
+	timeSends(t, "a@slow.example.com")
+
+	addresses := make([]string, 20)
+
+	for index := range addresses {
+		addresses[index] = "a@fast.example.com"
+	}
+
+	if elapsed := timeSends(t, addresses...); elapsed > 500*time.Millisecond {
+		t.Errorf("expected sends to fast.example.com not to wait, but they took %s", elapsed)
+	}
+}
+
+func TestDomainRateLimitPacesBulkEntries(t *testing.T) {
+	useDomainLimits(t, map[string]float64{"slow.example.com": 20})
+
+	start := time.Now()
+	input := bulkEmail("a@slow.example.com", "b@fast.example.com", "c@slow.example.com", "d@slow.example.com")
+
+	// The bulk email waits for the third entry to slow.example.com, 100ms out
+	if _, err := SendBulkEmail(context.Background(), &fakeClient{}, input); err != nil {
+		t.Fatal(err)
+	} else if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("expected the entries to slow.example.com to be paced, but sending took %s", elapsed)
+	}
+}
+
+func TestDomainRateLimitPacesBatchedEmails(t *testing.T) {
+	rates := map[string]float64{"slow.example.com": 20}
+	useDomainLimits(t, rates)
+	useSettings(t, Config{DomainRateLimits: rates, BatchTemplatedEmails: true})
+
+	start := time.Now()
+	client := &fakeClient{}
+
+	if _, errs := SendEmails(context.Background(), client, []*SendEmailInput{
+		templatedEmail("a@slow.example.com", "welcome"),
+		templatedEmail("b@slow.example.com", "welcome"),
+		templatedEmail("c@slow.example.com", "welcome"),
+	}); len(errs) != 0 {
+		t.Fatal(errs)
+	} else if len(client.SentBulkEmails()) != 1 {
+		t.Fatal("expected the emails to be sent as a bulk email")
+	} else if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("expected the emails to slow.example.com to be paced, but sending took %s", elapsed)
+	}
+}
+
+func TestDomainRateLimitStopsWhenContextIsDone(t *testing.T) {
+	useDomainLimits(t, map[string]float64{"slow.example.com": 0.1})
+
+	timeSends(t, "a@slow.example.com")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	client := &fakeClient{}
+
+	if _, err := SendEmail(ctx, client, simpleEmail("b@slow.example.com")); err != context.DeadlineExceeded {
+		t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+	} else if len(client.SentEmails()) != 0 {
+		t.Errorf("expected SES not to be called")
+	}
+}
+
+func TestEnvRates(t *testing.T) {
+	t.Setenv("DOMAIN_RATE_LIMITS", " Example.com=5, example.org = 0.5,invalid,bad=rate")
+
+	expected := map[string]float64{"example.com": 5, "example.org": 0.5}
+
+	if rates := envRates("DOMAIN_RATE_LIMITS"); !reflect.DeepEqual(rates, expected) {
+		t.Errorf("expected %v, got %v", expected, rates)
+	}
+}
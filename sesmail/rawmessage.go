@@ -0,0 +1,60 @@
+// Encoding and decoding of raw messages given either base64 encoded or as plain MIME
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// The JSON form of a raw message, whose data may be base64 encoded or plain MIME
+type rawMessageJSON struct {
+	Data     string `json:"data"`
+	IsBase64 *bool  `json:"isBase64,omitempty"`
+}
+
+// Decodes a raw message into the MIME bytes it holds. Data is base64 decoded when isBase64 is true,
+// used as is when it's false, and decoded only if it's valid base64 when it isn't given, so plain
+// MIME messages can be sent without encoding them first. Either way, the AWS SDK base64 encodes
+// the message again when calling SES.
+func (raw *RawMessage) UnmarshalJSON(data []byte) error {
+	var decoded rawMessageJSON
+
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	raw.IsBase64 = decoded.IsBase64
+
+	if decoded.IsBase64 != nil && !*decoded.IsBase64 {
+		raw.Data = []byte(decoded.Data)
+
+		return nil
+	}
+
+	message, err := base64.StdEncoding.DecodeString(decoded.Data)
+
+	if err != nil && decoded.IsBase64 != nil {
+		return fmt.Errorf("Raw message data is not valid base64: %w", err)
+	} else if err != nil {
+		message = []byte(decoded.Data)
+	}
+
+	raw.Data = message
+
+	return nil
+}
+
+// Encodes a raw message with its data base64 encoded and isBase64 set, whatever form it was decoded
+// from, so it decodes to the same bytes when it's resubmitted, such as in a retry payload or an
+// offloaded emails array.
+func (raw RawMessage) MarshalJSON() ([]byte, error) {
+	isBase64 := true
+
+	return json.Marshal(rawMessageJSON{
+		Data:     base64.StdEncoding.EncodeToString(raw.Data),
+		IsBase64: &isBase64,
+	})
+}
@@ -0,0 +1,153 @@
+// Tests for encoding and decoding raw messages given either base64 encoded or as plain MIME
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestRawMessageUnmarshalJSON(t *testing.T) {
+	message := string(rawMessage("From: from@example.com", "To: to@example.com", "Subject: Hi", "", "Hello"))
+	encoded := base64.StdEncoding.EncodeToString([]byte(message))
+	quoted := func(value string) string {
+		data, _ := json.Marshal(value)
+
+		return string(data)
+	}
+
+	for _, test := range []struct {
+		name     string
+		json     string
+		expected string
+		invalid  bool
+	}{
+		{"detected base64", `{"data":` + quoted(encoded) + `}`, message, false},
+		{"detected plain", `{"data":` + quoted(message) + `}`, message, false},
+		{"declared base64", `{"data":` + quoted(encoded) + `,"isBase64":true}`, message, false},
+		{"declared plain", `{"data":` + quoted(message) + `,"isBase64":false}`, message, false},
+		{"plain which looks like base64", `{"data":"abcd","isBase64":false}`, "abcd", false},
+		{"declared base64 but invalid", `{"data":` + quoted(message) + `,"isBase64":true}`, "", true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var raw RawMessage
+			err := json.Unmarshal([]byte(test.json), &raw)
+
+			if test.invalid {
+				if err == nil {
+					t.Errorf("expected invalid base64 to be rejected, got %q", raw.Data)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			} else if string(raw.Data) != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, raw.Data)
+			}
+		})
+	}
+}
+
+func TestRawMessageRoundTrip(t *testing.T) {
+	message := string(rawMessage("From: from@example.com", "To: to@example.com", "Subject: Hi", "", "Hello"))
+	encoded := base64.StdEncoding.EncodeToString([]byte(message))
+	quoted := func(value string) string {
+		data, _ := json.Marshal(value)
+
+		return string(data)
+	}
+
+	for _, test := range []struct {
+		name string
+		json string
+	}{
+		{"base64", `{"data":` + quoted(encoded) + `,"isBase64":true}`},
+		{"plain", `{"data":` + quoted(message) + `,"isBase64":false}`},
+		{"plain which looks like base64", `{"data":"abcd","isBase64":false}`},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var raw RawMessage
+
+			if err := json.Unmarshal([]byte(test.json), &raw); err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := json.Marshal(&SendEmailInput{Content: &EmailContent{Raw: &raw}})
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var input SendEmailInput
+
+			if err := json.Unmarshal(data, &input); err != nil {
+				t.Fatal(err)
+			}
+
+			roundTripped := input.Content.Raw
+
+			if string(roundTripped.Data) != string(raw.Data) {
+				t.Errorf("expected %q after a round trip, got %q from %s", raw.Data, roundTripped.Data, data)
+			} else if roundTripped.IsBase64 == nil || !*roundTripped.IsBase64 {
+				t.Errorf("expected the data to be marshalled as base64, got %s", data)
+			}
+		})
+	}
+}
+
+func TestSendEmailSendsPlainRawMessage(t *testing.T) {
+	useSettings(t, Config{})
+
+	message := rawMessage("From: from@example.com", "To: to@example.com", "Subject: Hi", "", "Hello")
+	payload, _ := json.Marshal(map[string]interface{}{
+		"from":    "from@example.com",
+		"dest":    map[string]interface{}{"to": []string{"to@example.com"}},
+		"content": map[string]interface{}{"raw": map[string]interface{}{"data": string(message)}},
+	})
+
+	var input SendEmailInput
+
+	if err := json.Unmarshal(payload, &input); err != nil {
+		t.Fatal(err)
+	}
+
+	client := &fakeClient{}
+
+	if _, err := SendEmail(context.Background(), client, &input); err != nil {
+		t.Fatal(err)
+	} else if sent := client.SentEmails()[0].Content.Raw.Data; string(sent) != string(message) {
+		t.Errorf("expected the message to be sent as is, got %q", sent)
+	}
+}
+
+func TestSendEmailRejectsUndecodableRawMessage(t *testing.T) {
+	useSettings(t, Config{})
+
+	// Truncated base64 isn't decoded when isBase64 isn't given, so it's caught before sending
+	encoded := base64.StdEncoding.EncodeToString(rawMessage("From: from@example.com", "Subject: Hi", "", "Hello"))
+	payload, _ := json.Marshal(map[string]interface{}{
+		"from":    "from@example.com",
+		"dest":    map[string]interface{}{"to": []string{"to@example.com"}},
+		"content": map[string]interface{}{"raw": map[string]interface{}{"data": encoded[:len(encoded)-3]}},
+	})
+
+	var input SendEmailInput
+
+	if err := json.Unmarshal(payload, &input); err != nil {
+		t.Fatal(err)
+	}
+
+	client := &fakeClient{}
+
+	if _, err := SendEmail(context.Background(), client, &input); err == nil || !strings.HasPrefix(err.Error(), "Raw message data is not valid base64") {
+		t.Errorf("expected the invalid base64 to be rejected, got %v", err)
+	} else if len(client.SentEmails()) != 0 {
+		t.Error("expected the invalid message not to be sent")
+	}
+}
@@ -0,0 +1,161 @@
+// Reconciliation of a raw message's header recipients with its Destination
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"bytes"
+	"fmt"
+	"net/mail"
+	"strings"
+)
+
+// How raw messages whose header recipients don't match their Destination are handled
+type RawRecipientCheckMode string
+
+const (
+	// Don't compare the recipients.
+	RawRecipientCheckIgnore RawRecipientCheckMode = ""
+
+	// Send the email, but report the mismatched recipients in the output.
+	RawRecipientCheckWarn RawRecipientCheckMode = "warn"
+
+	// Reject emails with mismatched recipients.
+	RawRecipientCheckReject RawRecipientCheckMode = "error"
+)
+
+// Which recipients a raw message is sent to when its headers and Destination disagree
+type RawRecipientPrecedence string
+
+const (
+	// Send to the Destination, as SES does.
+	RawRecipientsFromDestination RawRecipientPrecedence = ""
+
+	// Send to the To, CC, and BCC headers of the message. The Destination's BCC addresses are
+	// kept when the message has no BCC header, since BCC headers are usually left out.
+	RawRecipientsFromHeaders RawRecipientPrecedence = "headers"
+)
+
+// A recipient found in only one of a raw message's headers and its Destination
+type RecipientMismatch struct {
+
+	// The address of the recipient.
+	EmailAddress string `json:"address"`
+
+	// Where the recipient is missing from, either "headers" or "destination".
+	MissingFrom string `json:"missingFrom"`
+}
+
+func (mismatch RecipientMismatch) String() string {
+	if mismatch.MissingFrom == "headers" {
+		return fmt.Sprintf("Recipient %s is in the Destination but not the raw message's headers", mismatch.EmailAddress)
+	}
+
+	return fmt.Sprintf("Recipient %s is in the raw message's headers but not the Destination", mismatch.EmailAddress)
+}
+
+// Reads the To, CC, and BCC headers of a raw message. Returns nil if the message can't be parsed,
+// leaving SES to report it.
+func rawHeaderRecipients(data []byte) *Destination {
+	message, err := mail.ReadMessage(bytes.NewReader(data))
+
+	if err != nil {
+		return nil
+	}
+
+	recipients := &Destination{}
+
+	for _, field := range []struct {
+		header    string
+		addresses *[]string
+	}{
+		{"To", &recipients.ToAddresses},
+		{"Cc", &recipients.CcAddresses},
+		{"Bcc", &recipients.BccAddresses},
+	} {
+		addresses, err := message.Header.AddressList(field.header)
+
+		if err != nil && err != mail.ErrHeaderNotPresent {
+			return nil
+		}
+
+		for _, address := range addresses {
+			*field.addresses = append(*field.addresses, address.Address)
+		}
+	}
+
+	return recipients
+}
+
+// Returns the bare, lowercase form of an address, which may include a display name
+func normalizeRecipient(address string) string {
+	if parsed, err := mail.ParseAddress(address); err == nil {
+		address = parsed.Address
+	}
+
+	return strings.ToLower(address)
+}
+
+func recipientSet(addresses ...[]string) map[string]bool {
+	set := map[string]bool{}
+
+	for _, list := range addresses {
+		for _, address := range list {
+			set[normalizeRecipient(address)] = true
+		}
+	}
+
+	return set
+}
+
+// Compares the header recipients of a raw message with its Destination when RAW_RECIPIENT_CHECK is
+// set, returning the destination to send to according to RAW_RECIPIENT_PRECEDENCE and the
+// recipients found in only one of them. The Destination's BCC addresses are never expected in the
+// headers. Returns an error for the first mismatch instead when mismatches are rejected.
+func reconcileRawRecipients(
+	destination *Destination,
+	raw *RawMessage,
+) (*Destination, []RecipientMismatch, error) {
+	if raw == nil || Settings.RawRecipientCheck == RawRecipientCheckIgnore {
+		return destination, nil, nil
+	}
+
+	headers := rawHeaderRecipients(raw.Data)
+
+	if headers == nil {
+		return destination, nil, nil
+	}
+
+	var mismatches []RecipientMismatch
+
+	headerSet := recipientSet(headers.ToAddresses, headers.CcAddresses, headers.BccAddresses)
+	destinationSet := recipientSet(destination.ToAddresses, destination.CcAddresses, destination.BccAddresses)
+
+	for _, list := range [][]string{destination.ToAddresses, destination.CcAddresses} {
+		for _, address := range list {
+			if !headerSet[normalizeRecipient(address)] {
+				mismatches = append(mismatches, RecipientMismatch{EmailAddress: address, MissingFrom: "headers"})
+			}
+		}
+	}
+
+	for _, list := range [][]string{headers.ToAddresses, headers.CcAddresses, headers.BccAddresses} {
+		for _, address := range list {
+			if !destinationSet[normalizeRecipient(address)] {
+				mismatches = append(mismatches, RecipientMismatch{EmailAddress: address, MissingFrom: "destination"})
+			}
+		}
+	}
+
+	if len(mismatches) > 0 && Settings.RawRecipientCheck == RawRecipientCheckReject {
+		return nil, nil, fmt.Errorf("%s", mismatches[0])
+	} else if len(mismatches) == 0 || Settings.RawRecipientPrecedence != RawRecipientsFromHeaders {
+		return destination, mismatches, nil
+	}
+
+	if len(headers.BccAddresses) == 0 {
+		headers.BccAddresses = append([]string(nil), destination.BccAddresses...)
+	}
+
+	return headers, mismatches, nil
+}
@@ -0,0 +1,153 @@
+// Tests for reconciliation of a raw message's header recipients with its Destination
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+)
+
+// A raw email whose message has the given To and CC headers, sent to the destination
+func rawEmail(to string, cc string, destination *Destination) *SendEmailInput {
+	headers := []string{"From: from@example.com", "To: " + to}
+
+	if cc != "" {
+		headers = append(headers, "Cc: "+cc)
+	}
+
+	return &SendEmailInput{
+		Content:          &EmailContent{Raw: &RawMessage{Data: rawMessage(append(headers, "Subject: Hi", "", "Hello")...)}},
+		Destination:      destination,
+		FromEmailAddress: aws.String("from@example.com"),
+	}
+}
+
+func TestSendEmailComparesRawRecipients(t *testing.T) {
+	destination := &Destination{
+		ToAddresses:  []string{"a@example.com"},
+		CcAddresses:  []string{"c@example.com"},
+		BccAddresses: []string{"hidden@example.com"},
+	}
+	mismatched := []RecipientMismatch{
+		{EmailAddress: "c@example.com", MissingFrom: "headers"},
+		{EmailAddress: "b@example.com", MissingFrom: "destination"},
+	}
+
+	for _, test := range []struct {
+		name       string
+		check      RawRecipientCheckMode
+		precedence RawRecipientPrecedence
+		to         string
+		cc         string
+		mismatches []RecipientMismatch
+		sentTo     *types.Destination
+		expected   string
+	}{
+		{
+			"matching",
+			RawRecipientCheckReject,
+			"",
+			`"A" <A@example.com>`,
+			"c@example.com",
+			nil,
+			&types.Destination{
+				ToAddresses:  []string{"a@example.com"},
+				CcAddresses:  []string{"c@example.com"},
+				BccAddresses: []string{"hidden@example.com"},
+			},
+			"",
+		},
+		{
+			"not checked",
+			RawRecipientCheckIgnore,
+			"",
+			"a@example.com, b@example.com",
+			"",
+			nil,
+			&types.Destination{
+				ToAddresses:  []string{"a@example.com"},
+				CcAddresses:  []string{"c@example.com"},
+				BccAddresses: []string{"hidden@example.com"},
+			},
+			"",
+		},
+		{
+			"warned, sent to the destination",
+			RawRecipientCheckWarn,
+			RawRecipientsFromDestination,
+			"a@example.com, b@example.com",
+			"",
+			mismatched,
+			&types.Destination{
+				ToAddresses:  []string{"a@example.com"},
+				CcAddresses:  []string{"c@example.com"},
+				BccAddresses: []string{"hidden@example.com"},
+			},
+			"",
+		},
+		{
+			"warned, sent to the headers",
+			RawRecipientCheckWarn,
+			RawRecipientsFromHeaders,
+			"a@example.com, b@example.com",
+			"",
+			mismatched,
+			&types.Destination{
+				ToAddresses:  []string{"a@example.com", "b@example.com"},
+				BccAddresses: []string{"hidden@example.com"},
+			},
+			"",
+		},
+		{
+			"rejected",
+			RawRecipientCheckReject,
+			RawRecipientsFromHeaders,
+			"a@example.com, b@example.com",
+			"",
+			nil,
+			nil,
+			"Recipient c@example.com is in the Destination but not the raw message's headers",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			useSettings(t, Config{RawRecipientCheck: test.check, RawRecipientPrecedence: test.precedence})
+
+			client := &fakeClient{}
+			output, err := SendEmail(context.Background(), client, rawEmail(test.to, test.cc, destination))
+
+			if test.expected != "" {
+				if err == nil || err.Error() != test.expected {
+					t.Errorf("expected %q, got %v", test.expected, err)
+				} else if len(client.SentEmails()) != 0 {
+					t.Error("expected SES not to be called")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			} else if !reflect.DeepEqual(output.RecipientMismatches, test.mismatches) {
+				t.Errorf("expected mismatches %+v, got %+v", test.mismatches, output.RecipientMismatches)
+			} else if sent := client.SentEmails()[0].Destination; !reflect.DeepEqual(sent, test.sentTo) {
+				t.Errorf("expected the email to be sent to %+v, got %+v", test.sentTo, sent)
+			}
+		})
+	}
+}
+
+func TestReconcileRawRecipientsUnparsableMessage(t *testing.T) {
+	useSettings(t, Config{RawRecipientCheck: RawRecipientCheckReject})
+
+	destination := &Destination{ToAddresses: []string{"a@example.com"}}
+	resolved, mismatches, err := reconcileRawRecipients(destination, &RawMessage{Data: []byte("To: <broken")})
+
+	if err != nil || mismatches != nil || resolved != destination {
+		t.Errorf("expected an unparsable message to be left to SES, got %+v, %+v, and %v", resolved, mismatches, err)
+	}
+}
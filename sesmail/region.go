@@ -0,0 +1,31 @@
+// Selection of the client for sends which override the region
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"errors"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// Returns the client sending through SES in a region
+type RegionalClientProvider func(region string) (Client, error)
+
+// Provides clients for sends which set a region. Sends which set a region are rejected when nil.
+// The Lambda provides clients sharing its credentials, creating each one once.
+var RegionalClients RegionalClientProvider
+
+// Returned for sends which set a region when RegionalClients is nil
+var ErrRegionOverrideUnsupported = errors.New("Sending through another region isn't supported")
+
+// Returns the client for a send, which is the given client unless the send sets a region
+func clientForRegion(client Client, region *string) (Client, error) {
+	if aws.ToString(region) == "" {
+		return client, nil
+	} else if RegionalClients == nil {
+		return nil, ErrRegionOverrideUnsupported
+	}
+
+	return RegionalClients(*region)
+}
@@ -0,0 +1,97 @@
+// Tests for selecting the client for sends which override the region
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// Provides a fake client for each of the given regions, restoring the previous provider after the
+// test
+func useRegionalClients(t *testing.T, regions ...string) map[string]*fakeClient {
+	previous := RegionalClients
+	t.Cleanup(func() { RegionalClients = previous })
+
+	clients := map[string]*fakeClient{}
+
+	for _, region := range regions {
+		clients[region] = &fakeClient{}
+	}
+
+	RegionalClients = func(region string) (Client, error) {
+		if client, ok := clients[region]; ok {
+			return client, nil
+		}
+
+		return nil, errors.New("unknown region " + region)
+	}
+
+	return clients
+}
+
+func TestSendSelectsRegionalClient(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		region   *string
+		expected string
+	}{
+		{"default region", nil, ""},
+		{"empty region", aws.String(""), ""},
+		{"eu-west-1", aws.String("eu-west-1"), "eu-west-1"},
+		{"ap-southeast-2", aws.String("ap-southeast-2"), "ap-southeast-2"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			useSettings(t, Config{})
+			clients := useRegionalClients(t, "eu-west-1", "ap-southeast-2")
+			defaultClient := &fakeClient{}
+
+			email := simpleEmail("to@example.com")
+			email.Region = test.region
+			bulk := bulkEmail("to@example.com")
+			bulk.Region = test.region
+
+			emailOutput, err := SendEmail(context.Background(), defaultClient, email)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			bulkOutput, err := SendBulkEmail(context.Background(), defaultClient, bulk)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expected := defaultClient
+
+			if test.expected != "" {
+				expected = clients[test.expected]
+			}
+
+			if len(expected.SentEmails()) != 1 || len(expected.SentBulkEmails()) != 1 {
+				t.Errorf("expected both sends to go through %q, got %d and %d", test.expected,
+					len(expected.SentEmails()), len(expected.SentBulkEmails()))
+			} else if emailOutput.Region != test.expected || bulkOutput.Region != test.expected {
+				t.Errorf("expected region %q, got %q and %q", test.expected, emailOutput.Region, bulkOutput.Region)
+			}
+		})
+	}
+}
+
+func TestSendRejectsRegionWithoutProvider(t *testing.T) {
+	useSettings(t, Config{})
+	useRegionalClients(t)
+	RegionalClients = nil
+
+	email := simpleEmail("to@example.com")
+	email.Region = aws.String("eu-west-1")
+
+	if _, err := SendEmail(context.Background(), &fakeClient{}, email); !errors.Is(err, ErrRegionOverrideUnsupported) {
+		t.Errorf("expected %q, got %v", ErrRegionOverrideUnsupported, err)
+	}
+}
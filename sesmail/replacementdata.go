@@ -0,0 +1,94 @@
+// Checks that bulk entries provide data for templates with variables
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+)
+
+// How bulk entries without replacement data are handled when the template uses variables
+type ReplacementDataMode string
+
+const (
+	// Don't check entries for replacement data.
+	ReplacementDataIgnore ReplacementDataMode = ""
+
+	// Send the emails, but report the entries without replacement data in the output.
+	ReplacementDataWarn ReplacementDataMode = "warn"
+
+	// Reject the bulk email if any entry has no replacement data.
+	ReplacementDataRequire ReplacementDataMode = "error"
+)
+
+// Matches a Handlebars tag which isn't a comment, such as {{name}} or {{#if name}}
+var templateVariablePattern = regexp.MustCompile(`\{\{\{?\s*[^!\s{}]`)
+
+// Whether any part of a template references a variable
+func templateHasVariables(content *types.EmailTemplateContent) bool {
+	for _, part := range []*string{content.Subject, content.Html, content.Text} {
+		if templateVariablePattern.MatchString(aws.ToString(part)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Whether template data is missing or an empty object
+func isEmptyTemplateData(data *string) bool {
+	switch strings.Join(strings.Fields(aws.ToString(data)), "") {
+	case "", "{}", "null":
+		return true
+	}
+
+	return false
+}
+
+// Returns the indices of entries without replacement data when the template uses variables.
+// Returns nothing when REPLACEMENT_DATA_CHECK is disabled or the template is only known by ARN.
+func findEntriesMissingData(
+	ctx context.Context,
+	client Client,
+	template *types.Template,
+	entries []BulkEmailEntry,
+) ([]int, error) {
+	if Settings.ReplacementDataCheck == ReplacementDataIgnore || aws.ToString(template.TemplateName) == "" {
+		return nil, nil
+	}
+
+	content, err := getTemplateContent(ctx, client, *template.TemplateName)
+
+	if err != nil || !templateHasVariables(content) {
+		return nil, err
+	}
+
+	var missing []int
+
+	for index, entry := range entries {
+		if entry.ReplacementEmailContent == nil ||
+			entry.ReplacementEmailContent.ReplacementTemplate == nil ||
+			isEmptyTemplateData(entry.ReplacementEmailContent.ReplacementTemplate.ReplacementTemplateData) {
+			missing = append(missing, index)
+		}
+	}
+
+	return missing, nil
+}
+
+// Formats indices as a comma separated list
+func joinInts(values []int) string {
+	formatted := make([]string, len(values))
+
+	for index, value := range values {
+		formatted[index] = strconv.Itoa(value)
+	}
+
+	return strings.Join(formatted, ", ")
+}
@@ -0,0 +1,121 @@
+// Tests for checking that bulk entries provide data for templates with variables
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+)
+
+func TestTemplateHasVariables(t *testing.T) {
+	for _, test := range []struct {
+		html     string
+		expected bool
+	}{
+		{"<p>Hello</p>", false},
+		{"<p>Hello {{name}}</p>", true},
+		{"<p>Hello {{ name }}</p>", true},
+		{"<p>{{{html}}}</p>", true},
+		{"{{#if vip}}VIP{{/if}}", true},
+		{"{{! a comment }}<p>Hello</p>", false},
+	} {
+		if hasVariables := templateHasVariables(&types.EmailTemplateContent{Html: aws.String(test.html)}); hasVariables != test.expected {
+			t.Errorf("expected %t for %q, got %t", test.expected, test.html, hasVariables)
+		}
+	}
+}
+
+// A bulk email whose entries have the given replacement data, where an empty string means none
+func bulkEmailWithData(template string, data ...string) *SendBulkEmailInput {
+	input := &SendBulkEmailInput{
+		FromEmailAddress: aws.String("from@example.com"),
+		DefaultContent:   &BulkEmailContent{Template: &Template{TemplateName: aws.String(template)}},
+	}
+
+	for _, entryData := range data {
+		entry := BulkEmailEntry{Destination: &Destination{ToAddresses: []string{"to@example.com"}}}
+
+		if entryData != "" {
+			entry.ReplacementEmailContent = &ReplacementEmailContent{
+				ReplacementTemplate: &ReplacementTemplate{ReplacementTemplateData: aws.String(entryData)},
+			}
+		}
+
+		input.BulkEmailEntries = append(input.BulkEmailEntries, entry)
+	}
+
+	return input
+}
+
+func replacementDataClient() *fakeClient {
+	return &fakeClient{templates: map[string]*types.EmailTemplateContent{
+		"personal": {Subject: aws.String("Hi {{name}}"), Html: aws.String("<p>Hi</p>")},
+		"static":   {Subject: aws.String("Hi"), Html: aws.String("<p>Hi</p>")},
+	}}
+}
+
+func TestSendBulkEmailWarnsAboutMissingData(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		template string
+		data     []string
+		expected []int
+	}{
+		{"all provided", "personal", []string{`{"name":"A"}`, `{"name":"B"}`}, nil},
+		{"some missing", "personal", []string{`{"name":"A"}`, "", "{ }", "null"}, []int{1, 2, 3}},
+		{"template without variables", "static", []string{"", ""}, nil},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			useSettings(t, Config{ReplacementDataCheck: ReplacementDataWarn})
+			useTemplateCache(t)
+
+			client := replacementDataClient()
+			output, err := SendBulkEmail(context.Background(), client, bulkEmailWithData(test.template, test.data...))
+
+			if err != nil {
+				t.Fatal(err)
+			} else if !reflect.DeepEqual(output.EntriesMissingData, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, output.EntriesMissingData)
+			} else if len(client.SentBulkEmails()) != 1 {
+				t.Errorf("expected the emails to be sent anyway, got %d requests", len(client.SentBulkEmails()))
+			}
+		})
+	}
+}
+
+func TestSendBulkEmailRequiresData(t *testing.T) {
+	useSettings(t, Config{ReplacementDataCheck: ReplacementDataRequire})
+	useTemplateCache(t)
+
+	client := replacementDataClient()
+	_, err := SendBulkEmail(context.Background(), client, bulkEmailWithData("personal", `{"name":"A"}`, "", ""))
+	expected := `Entries 1, 2 have no replacement template data, but template "personal" uses variables`
+
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected %q, got %v", expected, err)
+	} else if len(client.SentBulkEmails()) != 0 {
+		t.Errorf("expected nothing to be sent, got %d requests", len(client.SentBulkEmails()))
+	}
+
+	if _, err := SendBulkEmail(context.Background(), client, bulkEmailWithData("personal", `{"name":"A"}`)); err != nil {
+		t.Errorf("expected entries with data to be sent, got %v", err)
+	}
+}
+
+func TestSendBulkEmailSkipsDataCheck(t *testing.T) {
+	useSettings(t, Config{})
+	useTemplateCache(t)
+
+	client := replacementDataClient()
+
+	if output, err := SendBulkEmail(context.Background(), client, bulkEmailWithData("personal", "")); err != nil {
+		t.Fatal(err)
+	} else if output.EntriesMissingData != nil || client.templateLookups != 0 {
+		t.Errorf("expected no check, got %v after %d lookups", output.EntriesMissingData, client.templateLookups)
+	}
+}
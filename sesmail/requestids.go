@@ -0,0 +1,65 @@
+// Collection of the AWS request IDs of SES calls, for support escalations
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"sync"
+
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// Collects the request IDs of the SES responses to calls made with a context, including bulk
+// chunks, failover, and attempts retried internally by the AWS SDK
+type RequestIDs struct {
+	sync.Mutex
+	ids []string
+}
+
+// The request IDs observed so far, in the order they were returned
+func (ids *RequestIDs) IDs() []string {
+	ids.Lock()
+	defer ids.Unlock()
+
+	return append([]string(nil), ids.ids...)
+}
+
+func (ids *RequestIDs) add(id string) {
+	ids.Lock()
+	ids.ids = append(ids.ids, id)
+	ids.Unlock()
+}
+
+type requestIDsKey struct{}
+
+// Returns a context whose calls through clients with RecordRequestIDs have their request IDs
+// collected
+func WithRequestIDs(ctx context.Context, ids *RequestIDs) context.Context {
+	return context.WithValue(ctx, requestIDsKey{}, ids)
+}
+
+// Adds a middleware to an SES client which records the request ID of every response, including
+// error responses, with the RequestIDs of the call's context. Add it to the client's APIOptions.
+func RecordRequestIDs(stack *middleware.Stack) error {
+	return stack.Deserialize.Add(middleware.DeserializeMiddlewareFunc(
+		"RecordRequestIDs",
+		func(
+			ctx context.Context,
+			in middleware.DeserializeInput,
+			next middleware.DeserializeHandler,
+		) (middleware.DeserializeOutput, middleware.Metadata, error) {
+			out, metadata, err := next.HandleDeserialize(ctx, in)
+			ids, ok := ctx.Value(requestIDsKey{}).(*RequestIDs)
+
+			if response, isResponse := out.RawResponse.(*smithyhttp.Response); ok && ids != nil && isResponse {
+				if id := response.Header.Get("X-Amzn-Requestid"); id != "" {
+					ids.add(id)
+				}
+			}
+
+			return out, metadata, err
+		},
+	), middleware.After)
+}
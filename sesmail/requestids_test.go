@@ -0,0 +1,142 @@
+// Tests for collecting the AWS request IDs of SES calls
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	sesv2 "github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// Answers request n with the request ID request-n, throttling the first throttled requests and
+// accepting every email and bulk entry after them
+type requestIDTransport struct {
+	throttled int
+	requests  int
+}
+
+func (transport *requestIDTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	transport.requests++
+	body := ""
+
+	if request.Body != nil {
+		read, err := io.ReadAll(request.Body)
+
+		if err != nil {
+			return nil, err
+		}
+
+		body = string(read)
+	}
+
+	status, response := http.StatusOK, `{"MessageId":"message-id"}`
+
+	if transport.requests <= transport.throttled {
+		status, response = http.StatusTooManyRequests, `{"__type":"TooManyRequestsException","message":"Rate exceeded"}`
+	} else if strings.HasSuffix(request.URL.Path, "/outbound-bulk-emails") {
+		results := strings.Repeat(`{"Status":"SUCCESS","MessageId":"bulk-id"},`, strings.Count(body, `"Destination"`))
+		response = `{"BulkEmailEntryResults":[` + strings.TrimSuffix(results, ",") + `]}`
+	}
+
+	return &http.Response{
+		StatusCode: status,
+		Header: http.Header{
+			"Content-Type":     {"application/json"},
+			"X-Amzn-Requestid": {fmt.Sprintf("request-%d", transport.requests)},
+		},
+		Body:    io.NopCloser(strings.NewReader(response)),
+		Request: request,
+	}, nil
+}
+
+func requestIDClient(transport *requestIDTransport, retryer aws.Retryer) *sesv2.Client {
+	return sesv2.New(sesv2.Options{
+		Region:     "us-east-1",
+		HTTPClient: &http.Client{Transport: transport},
+		Retryer:    retryer,
+		APIOptions: []func(*middleware.Stack) error{RecordRequestIDs},
+		Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "test", SecretAccessKey: "test"}, nil
+		}),
+	})
+}
+
+func TestRecordRequestIDsOfRetries(t *testing.T) {
+	useSettings(t, Config{})
+
+	// The SDK retries throttled attempts itself, and the ID of each attempt is kept
+	retryer := retry.NewStandard(func(options *retry.StandardOptions) {
+		options.MaxAttempts = 3
+		options.Backoff = retry.BackoffDelayerFunc(func(int, error) (time.Duration, error) { return 0, nil })
+	})
+
+	ids := &RequestIDs{}
+	ctx := WithRequestIDs(context.Background(), ids)
+	client := requestIDClient(&requestIDTransport{throttled: 2}, retryer)
+
+	if _, err := SendEmail(ctx, client, simpleEmail("to@example.com")); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := []string{"request-1", "request-2", "request-3"}; !reflect.DeepEqual(ids.IDs(), expected) {
+		t.Errorf("expected %v, got %v", expected, ids.IDs())
+	}
+}
+
+func TestRecordRequestIDsOfFailures(t *testing.T) {
+	useSettings(t, Config{})
+
+	ids := &RequestIDs{}
+	ctx := WithRequestIDs(context.Background(), ids)
+	client := requestIDClient(&requestIDTransport{throttled: 1}, aws.NopRetryer{})
+
+	if _, err := SendEmail(ctx, client, simpleEmail("to@example.com")); err == nil {
+		t.Fatal("expected the throttled email to fail")
+	} else if expected := []string{"request-1"}; !reflect.DeepEqual(ids.IDs(), expected) {
+		t.Errorf("expected %v, got %v", expected, ids.IDs())
+	}
+}
+
+func TestRecordRequestIDsOfBulkChunks(t *testing.T) {
+	useSettings(t, Config{})
+
+	var recipients []string
+
+	for index := 0; index < maxBulkEmailEntries*2+1; index++ {
+		recipients = append(recipients, fmt.Sprintf("to%d@example.com", index))
+	}
+
+	ids := &RequestIDs{}
+	ctx := WithRequestIDs(context.Background(), ids)
+	client := requestIDClient(&requestIDTransport{}, aws.NopRetryer{})
+
+	if _, errs := sendEmailsAsBulk(ctx, client, bulkEmail(recipients...)); len(errs) > 0 {
+		t.Fatal(errs[0])
+	}
+
+	if expected := []string{"request-1", "request-2", "request-3"}; !reflect.DeepEqual(ids.IDs(), expected) {
+		t.Errorf("expected an ID for each chunk, got %v", ids.IDs())
+	}
+}
+
+func TestRecordRequestIDsWithoutCollection(t *testing.T) {
+	useSettings(t, Config{})
+
+	// Calls without collected IDs are unaffected
+	client := requestIDClient(&requestIDTransport{}, aws.NopRetryer{})
+
+	if _, err := SendEmail(context.Background(), client, simpleEmail("to@example.com")); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,199 @@
+// Machine-readable codes summarising the outcome of a send
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"errors"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// A stable code summarising the outcome of an invocation, for callers to branch on instead of
+// parsing error messages
+type ResultCode string
+
+const (
+	// Every email was accepted.
+	ResultOK ResultCode = "OK"
+
+	// Some emails were accepted and others failed.
+	ResultPartial ResultCode = "PARTIAL"
+
+	// The input was invalid, so nothing was sent.
+	ResultValidationError ResultCode = "VALIDATION_ERROR"
+
+	// The function failed for a reason other than the input or SES, such as failing to load its
+	// settings or to offload emails to S3. It may succeed when retried.
+	ResultInternalError ResultCode = "INTERNAL_ERROR"
+
+	// SES throttled the request, or the sending quota was used up.
+	ResultThrottled ResultCode = "THROTTLED"
+
+	// The account can't send, such as because it is suspended, paused, or blocked by
+	// ENFORCEMENT_CHECK, or the sender isn't verified.
+	ResultAccountError ResultCode = "ACCOUNT_ERROR"
+
+	// The template doesn't exist.
+	ResultTemplateNotFound ResultCode = "TEMPLATE_NOT_FOUND"
+
+	// SES rejected the message, or every recipient opted out.
+	ResultRejected ResultCode = "REJECTED"
+
+	// SES rejected the message because it contains a virus.
+	ResultVirusDetected ResultCode = "VIRUS_DETECTED"
+
+	// SENDING_DISABLED is set.
+	ResultSendingDisabled ResultCode = "SENDING_DISABLED"
+
+	// SES couldn't be reached, failed with a server error, or didn't answer a bulk email chunk
+	// within BULK_CHUNK_TIMEOUT.
+	ResultServiceError ResultCode = "SERVICE_ERROR"
+
+	// The invocation reached its deadline before it finished.
+	ResultTimeout ResultCode = "TIMEOUT"
+)
+
+// Result codes of SES error codes
+var errorCodeResults = map[string]ResultCode{
+	"AccountSuspendedException":          ResultAccountError,
+	"LimitExceededException":             ResultThrottled,
+	"MailFromDomainNotVerifiedException": ResultAccountError,
+	"MessageRejected":                    ResultRejected,
+	"SendingPausedException":             ResultAccountError,
+	"Throttling":                         ResultThrottled,
+	"TooManyRequestsException":           ResultThrottled,
+}
+
+// Result codes of failed bulk entry statuses
+var bulkStatusResults = map[types.BulkEmailStatus]ResultCode{
+	types.BulkEmailStatusMessageRejected:               ResultRejected,
+	types.BulkEmailStatusMailFromDomainNotVerified:     ResultAccountError,
+	types.BulkEmailStatusTemplateNotFound:              ResultTemplateNotFound,
+	types.BulkEmailStatusAccountSuspended:              ResultAccountError,
+	types.BulkEmailStatusAccountThrottled:              ResultThrottled,
+	types.BulkEmailStatusAccountDailyQuotaExceeded:     ResultThrottled,
+	types.BulkEmailStatusAccountSendingPaused:          ResultAccountError,
+	types.BulkEmailStatusConfigurationSetSendingPaused: ResultAccountError,
+	types.BulkEmailStatusTransientFailure:              ResultServiceError,
+	types.BulkEmailStatusFailed:                        ResultServiceError,
+	types.BulkEmailStatusConfigurationSetNotFound:      ResultValidationError,
+	types.BulkEmailStatusInvalidSendingPoolName:        ResultValidationError,
+	types.BulkEmailStatusInvalidParameter:              ResultValidationError,
+}
+
+// Returns the result code of an error. Invalid input, such as a ValidationError, is a validation
+// error, while other errors raised before reaching SES are internal errors.
+func ErrorResultCode(err error) ResultCode {
+	var validationErr *ValidationError
+	var apiErr smithy.APIError
+	var templateErr *ErrTemplateNotFound
+	var responseErr *awshttp.ResponseError
+	var sendErr *smithyhttp.RequestSendError
+	var entryErr *BulkEntryError
+	var virusErr *ErrVirusDetected
+
+	if err == nil {
+		return ResultOK
+	} else if errors.Is(err, ErrSendingDisabled) {
+		return ResultSendingDisabled
+	} else if errors.Is(err, ErrInvocationTimeout) {
+		return ResultTimeout
+	} else if errors.Is(err, ErrChunkTimeout) {
+		return ResultServiceError
+	} else if errors.Is(err, ErrEnforcementBlocked) {
+		return ResultAccountError
+	} else if errors.Is(err, ErrAllRecipientsOptedOut) {
+		return ResultRejected
+	} else if errors.As(err, &validationErr) || isValidationSentinel(err) {
+		return ResultValidationError
+	} else if errors.As(err, &templateErr) {
+		return ResultTemplateNotFound
+	} else if errors.As(err, &virusErr) {
+		return ResultVirusDetected
+	} else if errors.As(err, &entryErr) {
+		return bulkStatusResultCode(entryErr.Status, entryErr.Message)
+	} else if errors.As(err, &apiErr) {
+		if code, ok := errorCodeResults[apiErr.ErrorCode()]; ok {
+			return code
+		} else if apiErr.ErrorFault() == smithy.FaultServer {
+			return ResultServiceError
+		}
+
+		return ResultValidationError
+	} else if errors.As(err, &responseErr) || errors.As(err, &sendErr) {
+		return ResultServiceError
+	}
+
+	return ResultInternalError
+}
+
+// Whether an error is one of the errors returned for input which can't be sent as is
+func isValidationSentinel(err error) bool {
+	return errors.Is(err, ErrBatchValidationFailed) ||
+		errors.Is(err, ErrDuplicateEntry) ||
+		errors.Is(err, ErrRegionOverrideUnsupported) ||
+		errors.Is(err, ErrAdminOperationsDisabled)
+}
+
+// Returns the result code of sending several emails, given how many were accepted and the errors
+// of the rest. When none were accepted, the first error decides the code.
+func NewResultCode(accepted int, errs ...error) ResultCode {
+	if len(errs) == 0 {
+		return ResultOK
+	} else if accepted > 0 {
+		return ResultPartial
+	}
+
+	return ErrorResultCode(errs[0])
+}
+
+// Returns the result code of a bulk email. Chunked sends return the results of every chunk along
+// with the error of a failed one, so any accepted entry makes the send partial. When no entry was
+// accepted, the error, or else the status of the first failed entry, decides the code.
+func BulkResultCode(output *SendBulkEmailOutput, err error) ResultCode {
+	accepted := 0
+	failed := ErrorResultCode(err)
+
+	if output != nil {
+		for _, result := range output.BulkEmailEntryResults {
+			if result.Status == BulkEmailStatus(types.BulkEmailStatusSuccess) {
+				accepted++
+			} else if failed == ResultOK {
+				failed = bulkStatusResultCode(result.Status, aws.ToString(result.Error))
+			}
+		}
+	}
+
+	if failed == ResultOK {
+		return ResultOK
+	} else if accepted > 0 {
+		return ResultPartial
+	}
+
+	return failed
+}
+
+// Returns the result code of a failed bulk entry's status and error message. Unknown statuses are
+// service errors.
+func bulkStatusResultCode(status BulkEmailStatus, message string) ResultCode {
+	if status == BulkEmailStatus(types.BulkEmailStatusMessageRejected) && isVirusMessage(message) {
+		return ResultVirusDetected
+	}
+
+	if code, ok := bulkStatusResults[types.BulkEmailStatus(status)]; ok {
+		return code
+	}
+
+	return ResultServiceError
+}
+
+// Whether a failure is worth retrying unchanged, because SES throttled the request or either SES or
+// the function had a temporary issue
+func isRetryableResultCode(code ResultCode) bool {
+	return code == ResultThrottled || code == ResultServiceError || code == ResultInternalError
+}
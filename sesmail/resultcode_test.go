@@ -0,0 +1,124 @@
+// Tests for codes summarising the outcome of a send
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+func TestErrorResultCode(t *testing.T) {
+	apiError := func(code string, fault smithy.ErrorFault) error {
+		return fmt.Errorf("operation error SES: SendEmail, %w", &smithy.GenericAPIError{Code: code, Fault: fault})
+	}
+
+	for _, test := range []struct {
+		name     string
+		err      error
+		expected ResultCode
+	}{
+		{"no error", nil, ResultOK},
+		{"invalid input", invalidInput(errors.New("Content is required")), ResultValidationError},
+		{"invalid entry", fmt.Errorf("Entry 1: %w", invalidInput(errors.New("Destination is required"))), ResultValidationError},
+		{"batch validation failed", fmt.Errorf("Email 1: %w", ErrBatchValidationFailed), ResultValidationError},
+		{"duplicate entry", ErrDuplicateEntry, ResultValidationError},
+		{"schema", invalidInput(&SchemaError{Problems: []string{"Content is required"}}), ResultValidationError},
+		{"unknown error", errors.New("Failed to store payload in S3: access denied"), ResultInternalError},
+		{"opt out lookup", fmt.Errorf("Failed to check if a@example.com opted out: %w", errors.New("timeout")), ResultInternalError},
+		{"sending disabled", ErrSendingDisabled, ResultSendingDisabled},
+		{"enforcement blocked", fmt.Errorf("%w, SHUTDOWN", ErrEnforcementBlocked), ResultAccountError},
+		{"opted out", ErrAllRecipientsOptedOut, ResultRejected},
+		{"template not found", &ErrTemplateNotFound{Name: "welcome"}, ResultTemplateNotFound},
+		{"throttled", apiError("TooManyRequestsException", smithy.FaultClient), ResultThrottled},
+		{"quota exceeded", apiError("LimitExceededException", smithy.FaultClient), ResultThrottled},
+		{"suspended", apiError("AccountSuspendedException", smithy.FaultClient), ResultAccountError},
+		{"unverified", apiError("MailFromDomainNotVerifiedException", smithy.FaultClient), ResultAccountError},
+		{"rejected", apiError("MessageRejected", smithy.FaultClient), ResultRejected},
+		{"bad request", apiError("BadRequestException", smithy.FaultClient), ResultValidationError},
+		{"server fault", apiError("InternalFailure", smithy.FaultServer), ResultServiceError},
+		{"unreachable", &smithyhttp.RequestSendError{Err: errors.New("connection refused")}, ResultServiceError},
+		{"http error", responseError(503, "request-1", errors.New("unavailable")), ResultServiceError},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if code := ErrorResultCode(test.err); code != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, code)
+			}
+		})
+	}
+}
+
+func TestNewResultCode(t *testing.T) {
+	throttled := &smithy.GenericAPIError{Code: "TooManyRequestsException"}
+
+	for _, test := range []struct {
+		name     string
+		accepted int
+		errs     []error
+		expected ResultCode
+	}{
+		{"all accepted", 3, nil, ResultOK},
+		{"some failed", 2, []error{throttled}, ResultPartial},
+		{"all failed", 0, []error{throttled, invalidInput(errors.New("Content is required"))}, ResultThrottled},
+		{"all invalid", 0, []error{invalidInput(errors.New("Content is required"))}, ResultValidationError},
+		{"all failed internally", 0, []error{errors.New("Failed to queue email")}, ResultInternalError},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if code := NewResultCode(test.accepted, test.errs...); code != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, code)
+			}
+		})
+	}
+}
+
+func TestBulkResultCode(t *testing.T) {
+	output := func(statuses ...types.BulkEmailStatus) *SendBulkEmailOutput {
+		output := &SendBulkEmailOutput{}
+
+		for _, status := range statuses {
+			output.BulkEmailEntryResults = append(output.BulkEmailEntryResults, BulkEmailEntryResult{
+				Status: BulkEmailStatus(status),
+			})
+		}
+
+		return output
+	}
+
+	for _, test := range []struct {
+		name     string
+		output   *SendBulkEmailOutput
+		err      error
+		expected ResultCode
+	}{
+		{"all accepted", output(types.BulkEmailStatusSuccess, types.BulkEmailStatusSuccess), nil, ResultOK},
+		{"some failed", output(types.BulkEmailStatusSuccess, types.BulkEmailStatusMessageRejected), nil, ResultPartial},
+		{
+			"all throttled",
+			output(types.BulkEmailStatusAccountThrottled, types.BulkEmailStatusMessageRejected),
+			nil,
+			ResultThrottled,
+		},
+		{"missing template", output(types.BulkEmailStatusTemplateNotFound), nil, ResultTemplateNotFound},
+		{"unknown status", output(types.BulkEmailStatus("NEW_STATUS")), nil, ResultServiceError},
+		{"request failed", nil, ErrSendingDisabled, ResultSendingDisabled},
+		{
+			"chunk failed",
+			output(types.BulkEmailStatusSuccess, types.BulkEmailStatusFailed),
+			errors.New("Entries 50 to 99: rejected"),
+			ResultPartial,
+		},
+		{"every chunk failed", output(types.BulkEmailStatusFailed), ErrSendingDisabled, ResultSendingDisabled},
+		{"no output", nil, nil, ResultOK},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if code := BulkResultCode(test.output, test.err); code != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, code)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+// Offloading of large bulk email results to external storage
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+)
+
+// A chunk of bulk entry results written to the payload store
+type ResultChunk struct {
+
+	// Where the chunk was written, such as an s3:// URI.
+	Location string `json:"location"`
+
+	// The index of the chunk's first result among every result.
+	Start int `json:"start"`
+
+	// How many results the chunk has.
+	Count int `json:"count"`
+}
+
+// A count of bulk entry results, for callers which don't need each result
+type ResultSummary struct {
+
+	// How many results there are.
+	Total int `json:"total"`
+
+	// How many entries SES accepted.
+	Succeeded int `json:"succeeded"`
+
+	// How many entries failed.
+	Failed int `json:"failed"`
+
+	// How many results have each status.
+	Statuses map[BulkEmailStatus]int `json:"statuses"`
+}
+
+func summarizeResults(results []BulkEmailEntryResult) *ResultSummary {
+	summary := &ResultSummary{Total: len(results), Statuses: map[BulkEmailStatus]int{}}
+
+	for _, result := range results {
+		summary.Statuses[result.Status]++
+
+		if result.Status == BulkEmailStatus(types.BulkEmailStatusSuccess) {
+			summary.Succeeded++
+		} else {
+			summary.Failed++
+		}
+	}
+
+	return summary
+}
+
+// Writes the entry results of a bulk email to the payload store in chunks of ResultChunkSize when
+// there are more than ResultOffloadThreshold, replacing them in the output with where each chunk
+// was written and a summary. The output is left unchanged if any chunk fails to be written.
+func OffloadBulkResults(ctx context.Context, output *SendBulkEmailOutput) error {
+	if Offload == nil || output == nil || Settings.ResultOffloadThreshold <= 0 ||
+		len(output.BulkEmailEntryResults) <= Settings.ResultOffloadThreshold {
+		return nil
+	}
+
+	chunkSize := Settings.ResultChunkSize
+
+	if chunkSize <= 0 {
+		chunkSize = len(output.BulkEmailEntryResults)
+	}
+
+	prefix := fmt.Sprintf("results/%d", time.Now().UnixNano())
+	var chunks []ResultChunk
+
+	for start := 0; start < len(output.BulkEmailEntryResults); start += chunkSize {
+		end := start + chunkSize
+
+		if end > len(output.BulkEmailEntryResults) {
+			end = len(output.BulkEmailEntryResults)
+		}
+
+		payload, err := json.Marshal(output.BulkEmailEntryResults[start:end])
+
+		if err != nil {
+			return err
+		}
+
+		location, err := Offload.Store(ctx, fmt.Sprintf("%s/%d.json", prefix, len(chunks)), payload)
+
+		if err != nil {
+			return fmt.Errorf("Failed to offload results %d to %d: %w", start, end-1, err)
+		}
+
+		chunks = append(chunks, ResultChunk{Location: location, Start: start, Count: end - start})
+	}
+
+	output.ResultSummary = summarizeResults(output.BulkEmailEntryResults)
+	output.ResultChunks = chunks
+	output.BulkEmailEntryResults = []BulkEmailEntryResult{}
+
+	return nil
+}
@@ -0,0 +1,161 @@
+// Tests for offloading of large bulk email results to external storage
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+)
+
+// Keeps payloads in memory, failing the store of the failAt'th payload if it is set
+type resultStore struct {
+	payloads map[string][]byte
+	keys     []string
+	failAt   int
+}
+
+func (store *resultStore) Store(_ context.Context, key string, payload []byte) (string, error) {
+	store.keys = append(store.keys, key)
+
+	if len(store.keys) == store.failAt {
+		return "", errors.New("access denied")
+	}
+
+	store.payloads[key] = payload
+
+	return "memory://" + key, nil
+}
+
+func (store *resultStore) Load(_ context.Context, key string) ([]byte, error) {
+	return store.payloads[key], nil
+}
+
+// Replaces the payload store for the rest of the test
+func useResultStore(t *testing.T, store PayloadStore) {
+	previous := Offload
+	Offload = store
+	t.Cleanup(func() { Offload = previous })
+}
+
+// A bulk email output with a result for each status
+func bulkResults(statuses ...types.BulkEmailStatus) *SendBulkEmailOutput {
+	output := &SendBulkEmailOutput{}
+
+	for index, status := range statuses {
+		output.BulkEmailEntryResults = append(output.BulkEmailEntryResults, BulkEmailEntryResult{
+			Status: BulkEmailStatus(status),
+			Index:  index,
+		})
+	}
+
+	return output
+}
+
+func TestOffloadBulkResults(t *testing.T) {
+	useSettings(t, Config{ResultOffloadThreshold: 4, ResultChunkSize: 2})
+
+	store := &resultStore{payloads: map[string][]byte{}}
+	useResultStore(t, store)
+
+	success, throttled := types.BulkEmailStatusSuccess, types.BulkEmailStatusAccountThrottled
+	output := bulkResults(success, success, throttled, success, throttled)
+	results := output.BulkEmailEntryResults
+
+	if err := OffloadBulkResults(context.Background(), output); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(output.BulkEmailEntryResults) != 0 {
+		t.Errorf("expected the results to be left out, got %d", len(output.BulkEmailEntryResults))
+	}
+
+	expectedSummary := &ResultSummary{
+		Total:     5,
+		Succeeded: 3,
+		Failed:    2,
+		Statuses:  map[BulkEmailStatus]int{"SUCCESS": 3, "ACCOUNT_THROTTLED": 2},
+	}
+
+	if !reflect.DeepEqual(output.ResultSummary, expectedSummary) {
+		t.Errorf("expected %+v, got %+v", expectedSummary, output.ResultSummary)
+	}
+
+	if len(output.ResultChunks) != 3 {
+		t.Fatalf("expected 3 chunks, got %+v", output.ResultChunks)
+	}
+
+	for index, chunk := range output.ResultChunks {
+		key := strings.TrimPrefix(chunk.Location, "memory://")
+		expectedCount := 2
+
+		if index == 2 {
+			expectedCount = 1
+		}
+
+		var stored []BulkEmailEntryResult
+
+		if chunk.Start != index*2 || chunk.Count != expectedCount {
+			t.Errorf("expected chunk %d to start at %d with %d results, got %+v", index, index*2, expectedCount, chunk)
+		} else if err := json.Unmarshal(store.payloads[key], &stored); err != nil {
+			t.Errorf("expected chunk %d to be stored at %s, got %v", index, chunk.Location, err)
+		} else if !reflect.DeepEqual(stored, results[chunk.Start:chunk.Start+chunk.Count]) {
+			t.Errorf("expected chunk %d to hold its results, got %+v", index, stored)
+		}
+	}
+}
+
+func TestOffloadBulkResultsAtThreshold(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		threshold int
+		store     bool
+	}{
+		{"at the threshold", 3, true},
+		{"disabled", 0, true},
+		{"no payload store", 1, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			useSettings(t, Config{ResultOffloadThreshold: test.threshold, ResultChunkSize: 1})
+
+			store := &resultStore{payloads: map[string][]byte{}}
+
+			if test.store {
+				useResultStore(t, store)
+			} else {
+				useResultStore(t, nil)
+			}
+
+			output := bulkResults(types.BulkEmailStatusSuccess, types.BulkEmailStatusSuccess, types.BulkEmailStatusSuccess)
+
+			if err := OffloadBulkResults(context.Background(), output); err != nil {
+				t.Fatal(err)
+			} else if len(output.BulkEmailEntryResults) != 3 || output.ResultChunks != nil || len(store.keys) != 0 {
+				t.Errorf("expected the results to stay inline, got %+v", output)
+			}
+		})
+	}
+}
+
+func TestOffloadBulkResultsError(t *testing.T) {
+	useSettings(t, Config{ResultOffloadThreshold: 1, ResultChunkSize: 1})
+
+	store := &resultStore{payloads: map[string][]byte{}, failAt: 2}
+	useResultStore(t, store)
+
+	output := bulkResults(types.BulkEmailStatusSuccess, types.BulkEmailStatusSuccess, types.BulkEmailStatusSuccess)
+	err := OffloadBulkResults(context.Background(), output)
+	expected := "Failed to offload results 1 to 1: access denied"
+
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected %q, got %v", expected, err)
+	} else if len(output.BulkEmailEntryResults) != 3 || output.ResultChunks != nil || output.ResultSummary != nil {
+		t.Errorf("expected the output to be unchanged, got %+v", output)
+	}
+}
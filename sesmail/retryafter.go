@@ -0,0 +1,91 @@
+// Collection of the Retry-After hints SES returns when throttling
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// Collects the Retry-After hints of the SES responses to calls made with a context, including
+// attempts retried internally by the AWS SDK
+type RetryAfterHints struct {
+	sync.Mutex
+	hints []time.Duration
+}
+
+// The hints observed so far in seconds, in the order they were returned
+func (hints *RetryAfterHints) Seconds() []float64 {
+	hints.Lock()
+	defer hints.Unlock()
+
+	var seconds []float64
+
+	for _, hint := range hints.hints {
+		seconds = append(seconds, hint.Seconds())
+	}
+
+	return seconds
+}
+
+func (hints *RetryAfterHints) add(hint time.Duration) {
+	hints.Lock()
+	hints.hints = append(hints.hints, hint)
+	hints.Unlock()
+}
+
+type retryAfterHintsKey struct{}
+
+// Returns a context whose calls through clients with RecordRetryAfter have their Retry-After hints
+// collected
+func WithRetryAfterHints(ctx context.Context, hints *RetryAfterHints) context.Context {
+	return context.WithValue(ctx, retryAfterHintsKey{}, hints)
+}
+
+// Adds a middleware to an SES client which records the Retry-After header of every response with
+// the RetryAfterHints of the call's context. Add it to the client's APIOptions.
+func RecordRetryAfter(stack *middleware.Stack) error {
+	return stack.Deserialize.Add(middleware.DeserializeMiddlewareFunc(
+		"RecordRetryAfter",
+		func(
+			ctx context.Context,
+			in middleware.DeserializeInput,
+			next middleware.DeserializeHandler,
+		) (middleware.DeserializeOutput, middleware.Metadata, error) {
+			out, metadata, err := next.HandleDeserialize(ctx, in)
+			hints, ok := ctx.Value(retryAfterHintsKey{}).(*RetryAfterHints)
+
+			if response, isResponse := out.RawResponse.(*smithyhttp.Response); ok && hints != nil && isResponse {
+				if hint, valid := parseRetryAfter(response.Header.Get("Retry-After")); valid {
+					hints.add(hint)
+				}
+			}
+
+			return out, metadata, err
+		},
+	), middleware.After)
+}
+
+// Parses a Retry-After header, which is either a number of seconds or an HTTP date
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	} else if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	} else if date, err := http.ParseTime(value); err == nil {
+		if hint := time.Until(date); hint > 0 {
+			return hint, true
+		}
+
+		return 0, true
+	}
+
+	return 0, false
+}
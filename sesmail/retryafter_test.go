@@ -0,0 +1,121 @@
+// Tests for collecting the Retry-After hints SES returns
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	sesv2 "github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/smithy-go/middleware"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	for _, test := range []struct {
+		value    string
+		expected time.Duration
+		valid    bool
+	}{
+		{"", 0, false},
+		{"3", 3 * time.Second, true},
+		{"0", 0, true},
+		{"-1", 0, false},
+		{"soon", 0, false},
+		{"Wed, 21 Oct 2015 07:28:00 GMT", 0, true},
+	} {
+		if hint, valid := parseRetryAfter(test.value); hint != test.expected || valid != test.valid {
+			t.Errorf("expected %v and %t for %q, got %v and %t", test.expected, test.valid, test.value, hint, valid)
+		}
+	}
+
+	future := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+
+	if hint, valid := parseRetryAfter(future); !valid || hint <= 50*time.Second || hint > time.Minute {
+		t.Errorf("expected about a minute for %q, got %v", future, hint)
+	}
+}
+
+// Throttles the first requests with the given Retry-After hints, then accepts every email
+type throttlingTransport struct {
+	hints    []string
+	requests int
+}
+
+func (transport *throttlingTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	transport.requests++
+	status, body := http.StatusOK, `{"MessageId":"message-id"}`
+	header := http.Header{"Content-Type": {"application/json"}}
+
+	if transport.requests <= len(transport.hints) {
+		status, body = http.StatusTooManyRequests, `{"__type":"TooManyRequestsException","message":"Rate exceeded"}`
+		header.Set("Retry-After", transport.hints[transport.requests-1])
+	}
+
+	return &http.Response{
+		StatusCode: status,
+		Header:     header,
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    request,
+	}, nil
+}
+
+func retryAfterClient(transport *throttlingTransport, retryer aws.Retryer) *sesv2.Client {
+	return sesv2.New(sesv2.Options{
+		Region:     "us-east-1",
+		HTTPClient: &http.Client{Transport: transport},
+		Retryer:    retryer,
+		APIOptions: []func(*middleware.Stack) error{RecordRetryAfter},
+		Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "test", SecretAccessKey: "test"}, nil
+		}),
+	})
+}
+
+func TestRecordRetryAfter(t *testing.T) {
+	useSettings(t, Config{})
+
+	// The SDK retries throttled attempts itself, and the hints of each attempt are kept
+	retryer := retry.NewStandard(func(options *retry.StandardOptions) {
+		options.MaxAttempts = 3
+		options.Backoff = retry.BackoffDelayerFunc(func(int, error) (time.Duration, error) { return 0, nil })
+	})
+
+	hints := &RetryAfterHints{}
+	ctx := WithRetryAfterHints(context.Background(), hints)
+	transport := &throttlingTransport{hints: []string{"2", "5"}}
+
+	if _, err := SendEmail(ctx, retryAfterClient(transport, retryer), simpleEmail("to@example.com")); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := []float64{2, 5}; !reflect.DeepEqual(hints.Seconds(), expected) {
+		t.Errorf("expected %v, got %v", expected, hints.Seconds())
+	}
+}
+
+func TestRecordRetryAfterWithoutHints(t *testing.T) {
+	useSettings(t, Config{})
+
+	hints := &RetryAfterHints{}
+	ctx := WithRetryAfterHints(context.Background(), hints)
+	client := retryAfterClient(&throttlingTransport{}, aws.NopRetryer{})
+
+	if _, err := SendEmail(ctx, client, simpleEmail("to@example.com")); err != nil {
+		t.Fatal(err)
+	} else if seconds := hints.Seconds(); seconds != nil {
+		t.Errorf("expected no hints, got %v", seconds)
+	}
+
+	// Calls without collected hints are unaffected
+	if _, err := SendEmail(context.Background(), client, simpleEmail("to@example.com")); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,63 @@
+// Selection of failed emails worth resubmitting
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"errors"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+)
+
+// Whether an email failed because SES throttled it or had a temporary issue, so sending it again
+// unchanged may succeed
+func IsRetryable(err error) bool {
+	return err != nil && isRetryableResultCode(ErrorResultCode(err))
+}
+
+// Returns the emails whose errors are retryable, in the order of the inputs. Errors must come from
+// SendEmails, which records the email each belongs to.
+func RetryableEmails(inputs []*SendEmailInput, errs []error) []*SendEmailInput {
+	var retryable []*SendEmailInput
+
+	for _, err := range errs {
+		var emailErr *EmailError
+
+		if errors.As(err, &emailErr) && emailErr.Index < len(inputs) && IsRetryable(emailErr.Err) {
+			retryable = append(retryable, inputs[emailErr.Index])
+		}
+	}
+
+	return retryable
+}
+
+// Returns a copy of a bulk email with only the entries whose results are retryable, or the whole
+// bulk email if it failed outright with a retryable error. Returns nil if nothing is retryable.
+func RetryableBulkEmail(input *SendBulkEmailInput, output *SendBulkEmailOutput, err error) *SendBulkEmailInput {
+	if output == nil {
+		if IsRetryable(err) {
+			return input
+		}
+
+		return nil
+	}
+
+	retryInput := *input
+	retryInput.BulkEmailEntries = nil
+
+	for _, result := range output.BulkEmailEntryResults {
+		if result.Status != BulkEmailStatus(types.BulkEmailStatusSuccess) &&
+			isRetryableResultCode(bulkStatusResultCode(result.Status, aws.ToString(result.Error))) &&
+			result.Index < len(input.BulkEmailEntries) {
+
+			retryInput.BulkEmailEntries = append(retryInput.BulkEmailEntries, input.BulkEmailEntries[result.Index])
+		}
+	}
+
+	if len(retryInput.BulkEmailEntries) == 0 {
+		return nil
+	}
+
+	return &retryInput
+}
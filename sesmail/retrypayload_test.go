@@ -0,0 +1,127 @@
+// Tests for selection of failed emails worth resubmitting
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sesv2 "github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+	"github.com/aws/smithy-go"
+)
+
+func TestRetryableEmails(t *testing.T) {
+	useSettings(t, Config{})
+
+	failures := map[string]error{
+		"throttled@example.com": &smithy.GenericAPIError{Code: "TooManyRequestsException", Fault: smithy.FaultClient},
+		"rejected@example.com":  &smithy.GenericAPIError{Code: "MessageRejected", Fault: smithy.FaultClient},
+		"internal@example.com":  &smithy.GenericAPIError{Code: "InternalFailure", Fault: smithy.FaultServer},
+	}
+	client := &fakeClient{
+		sendEmail: func(ctx context.Context, params *sesv2.SendEmailInput) (*sesv2.SendEmailOutput, error) {
+			if err := failures[params.Destination.ToAddresses[0]]; err != nil {
+				return nil, err
+			}
+
+			return &sesv2.SendEmailOutput{MessageId: aws.String("id")}, nil
+		},
+	}
+	inputs := []*SendEmailInput{
+		simpleEmail("accepted@example.com"),
+		simpleEmail("throttled@example.com"),
+		simpleEmail("rejected@example.com"),
+		simpleEmail("internal@example.com"),
+		{Destination: &Destination{ToAddresses: []string{"invalid@example.com"}}},
+	}
+
+	_, errs := SendEmails(context.Background(), client, inputs)
+	retryable := RetryableEmails(inputs, errs)
+	expected := []*SendEmailInput{inputs[1], inputs[3]}
+
+	if !reflect.DeepEqual(retryable, expected) {
+		t.Errorf("expected the throttled and internal emails, got %d emails", len(retryable))
+	}
+
+	if retryable := RetryableEmails(inputs, []error{errors.New("no index")}); retryable != nil {
+		t.Errorf("expected errors without an email not to be retried, got %d emails", len(retryable))
+	}
+}
+
+func TestRetryableBulkEmail(t *testing.T) {
+	useSettings(t, Config{})
+
+	statuses := map[string]types.BulkEmailStatus{
+		"throttled@example.com": types.BulkEmailStatusAccountThrottled,
+		"rejected@example.com":  types.BulkEmailStatusMessageRejected,
+		"transient@example.com": types.BulkEmailStatusTransientFailure,
+	}
+	client := &fakeClient{
+		sendBulkEmail: func(ctx context.Context, params *sesv2.SendBulkEmailInput) (*sesv2.SendBulkEmailOutput, error) {
+			output := &sesv2.SendBulkEmailOutput{}
+
+			for _, entry := range params.BulkEmailEntries {
+				status, ok := statuses[entry.Destination.ToAddresses[0]]
+
+				if !ok {
+					status = types.BulkEmailStatusSuccess
+				}
+
+				output.BulkEmailEntryResults = append(output.BulkEmailEntryResults, types.BulkEmailEntryResult{Status: status})
+			}
+
+			return output, nil
+		},
+	}
+	// The repeated entry isn't sent, so later results don't line up with the entries by position
+	input := bulkEmail(
+		"accepted@example.com",
+		"accepted@example.com",
+		"throttled@example.com",
+		"rejected@example.com",
+		"transient@example.com",
+	)
+
+	output, err := SendBulkEmail(context.Background(), client, input)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	retryInput := RetryableBulkEmail(input, output, err)
+
+	if retryInput == nil {
+		t.Fatal("expected the retryable entries to be returned")
+	} else if expected := []BulkEmailEntry{input.BulkEmailEntries[2], input.BulkEmailEntries[4]}; !reflect.DeepEqual(retryInput.BulkEmailEntries, expected) {
+		t.Errorf("expected the throttled and transient entries, got %+v", retryInput.BulkEmailEntries)
+	} else if retryInput.FromEmailAddress != input.FromEmailAddress || len(input.BulkEmailEntries) != 5 {
+		t.Error("expected the retry input to keep the bulk email's other fields without changing it")
+	}
+}
+
+func TestRetryableBulkEmailFailedOutright(t *testing.T) {
+	input := bulkEmail("a@example.com", "b@example.com")
+	throttled := &smithy.GenericAPIError{Code: "TooManyRequestsException", Fault: smithy.FaultClient}
+
+	if retryInput := RetryableBulkEmail(input, nil, throttled); retryInput != input {
+		t.Error("expected the whole bulk email to be retried")
+	}
+
+	if retryInput := RetryableBulkEmail(input, nil, invalidInput(errors.New("Content is required"))); retryInput != nil {
+		t.Errorf("expected an invalid bulk email not to be retried, got %+v", retryInput)
+	}
+
+	accepted := &SendBulkEmailOutput{BulkEmailEntryResults: []BulkEmailEntryResult{
+		{Status: BulkEmailStatus(types.BulkEmailStatusSuccess), Index: 0},
+		{Status: BulkEmailStatus(types.BulkEmailStatusSuccess), Index: 1},
+	}}
+
+	if retryInput := RetryableBulkEmail(input, accepted, nil); retryInput != nil {
+		t.Errorf("expected nothing to retry when every entry is accepted, got %+v", retryInput)
+	}
+}
@@ -0,0 +1,107 @@
+// Checks that inputs have every field they need before they are processed
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// Every missing or conflicting field of an input, reported together so callers can fix them all at
+// once
+type SchemaError struct {
+	Problems []string
+}
+
+func (err *SchemaError) Error() string {
+	return "Invalid input: " + strings.Join(err.Problems, "; ")
+}
+
+// Returns the content modes an email sets: simple, body and subject, raw, or template
+func contentModes(content *EmailContent) []string {
+	var modes []string
+
+	if content.Simple != nil {
+		modes = append(modes, "simple")
+	}
+
+	if content.Body != nil || content.Subject != nil {
+		modes = append(modes, "body and subject")
+	}
+
+	if content.Raw != nil {
+		modes = append(modes, "raw")
+	}
+
+	if content.Template != nil {
+		modes = append(modes, "template")
+	}
+
+	return modes
+}
+
+func schemaError(problems []string) error {
+	if len(problems) == 0 {
+		return nil
+	}
+
+	return &SchemaError{Problems: problems}
+}
+
+// Checks that a single email has recipients, a From address, and exactly one content mode. Raw
+// messages may leave out the From address, since SES reads it from their headers.
+func checkSendEmailSchema(input *SendEmailInput) error {
+	var problems []string
+
+	if input.Destination == nil || recipientCount(input.Destination) == 0 {
+		problems = append(problems, "Destination must contain at least one To, CC, or BCC address")
+	}
+
+	if input.Content == nil {
+		problems = append(problems, "Content is required")
+	} else if modes := contentModes(input.Content); len(modes) == 0 {
+		problems = append(problems, "Content must specify exactly one of simple, body and subject, raw, or template")
+	} else if len(modes) > 1 {
+		problems = append(problems, fmt.Sprintf(
+			"Content must specify exactly one of simple, body and subject, raw, or template, but has %s",
+			strings.Join(modes, ", "),
+		))
+	}
+
+	if aws.ToString(input.FromEmailAddress) == "" && aws.ToString(input.FromEmailAddressIdentityArn) == "" &&
+		(input.Content == nil || input.Content.Raw == nil) {
+		problems = append(problems, "From address or identity ARN is required")
+	}
+
+	return schemaError(problems)
+}
+
+// Checks that a bulk email has a From address and entries, and that every entry has recipients
+func checkSendBulkEmailSchema(input *SendBulkEmailInput) error {
+	var problems []string
+
+	if aws.ToString(input.FromEmailAddress) == "" && aws.ToString(input.FromEmailAddressIdentityArn) == "" {
+		problems = append(problems, "From address or identity ARN is required")
+	}
+
+	if len(input.BulkEmailEntries) == 0 {
+		problems = append(problems, "At least one entry is required")
+	}
+
+	for index, entry := range input.BulkEmailEntries {
+		if entry.Destination == nil || recipientCount(entry.Destination) == 0 {
+			problems = append(problems, fmt.Sprintf(
+				"Entry %d: Destination must contain at least one To, CC, or BCC address", index,
+			))
+		}
+	}
+
+	if err := validateBulkDefaultContent(input.DefaultContent); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	return schemaError(problems)
+}
@@ -0,0 +1,186 @@
+// Tests for checking that inputs have every field they need
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestCheckSendEmailSchema(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		modify   func(input *SendEmailInput)
+		expected []string
+	}{
+		{"valid", func(input *SendEmailInput) {}, nil},
+		{
+			"everything missing",
+			func(input *SendEmailInput) {
+				input.Destination = nil
+				input.Content = nil
+				input.FromEmailAddress = nil
+			},
+			[]string{
+				"Destination must contain at least one To, CC, or BCC address",
+				"Content is required",
+				"From address or identity ARN is required",
+			},
+		},
+		{
+			"no content mode",
+			func(input *SendEmailInput) {
+				input.Destination = &Destination{}
+				input.Content = &EmailContent{}
+			},
+			[]string{
+				"Destination must contain at least one To, CC, or BCC address",
+				"Content must specify exactly one of simple, body and subject, raw, or template",
+			},
+		},
+		{
+			"several content modes",
+			func(input *SendEmailInput) {
+				input.Content.Template = &Template{TemplateName: aws.String("welcome")}
+				input.FromEmailAddress = nil
+			},
+			[]string{
+				"Content must specify exactly one of simple, body and subject, raw, or template, but has simple, template",
+				"From address or identity ARN is required",
+			},
+		},
+		{
+			"identity ARN instead of a From address",
+			func(input *SendEmailInput) {
+				input.FromEmailAddress = nil
+				input.FromEmailAddressIdentityArn = aws.String("arn:aws:ses:us-east-1:123456789012:identity/sender@example.com")
+			},
+			nil,
+		},
+		{
+			"raw message without a From address",
+			func(input *SendEmailInput) {
+				input.Content = &EmailContent{Raw: &RawMessage{Data: []byte("From: from@example.com\r\n\r\nBody")}}
+				input.FromEmailAddress = nil
+			},
+			nil,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			input := simpleEmail("to@example.com")
+			test.modify(input)
+			err := checkSendEmailSchema(input)
+
+			var schemaErr *SchemaError
+
+			if test.expected == nil {
+				if err != nil {
+					t.Errorf("expected a valid input, got %v", err)
+				}
+			} else if !errors.As(err, &schemaErr) {
+				t.Errorf("expected a schema error, got %v", err)
+			} else if !reflect.DeepEqual(schemaErr.Problems, test.expected) {
+				t.Errorf("expected %q, got %q", test.expected, schemaErr.Problems)
+			}
+		})
+	}
+}
+
+func TestCheckSendEmailSchemaContentModes(t *testing.T) {
+	simple := &Message{Subject: &Content{Data: aws.String("Subject")}, Body: &Body{Text: &Content{Data: aws.String("Body")}}}
+	raw := &RawMessage{Data: []byte("Subject: Subject\r\n\r\nBody")}
+	template := &Template{TemplateName: aws.String("welcome")}
+
+	for _, test := range []struct {
+		name     string
+		content  *EmailContent
+		expected string
+	}{
+		{"none", &EmailContent{}, "Content must specify exactly one of simple, body and subject, raw, or template"},
+		{"simple", &EmailContent{Simple: simple}, ""},
+		{"body and subject", &EmailContent{Subject: simple.Subject, Body: simple.Body}, ""},
+		{"raw", &EmailContent{Raw: raw}, ""},
+		{"template", &EmailContent{Template: template}, ""},
+		{
+			"simple and raw",
+			&EmailContent{Simple: simple, Raw: raw},
+			"Content must specify exactly one of simple, body and subject, raw, or template, but has simple, raw",
+		},
+		{
+			"body and template",
+			&EmailContent{Body: simple.Body, Template: template},
+			"Content must specify exactly one of simple, body and subject, raw, or template, but has body and subject, template",
+		},
+		{
+			"every mode",
+			&EmailContent{Simple: simple, Subject: simple.Subject, Raw: raw, Template: template},
+			"Content must specify exactly one of simple, body and subject, raw, or template, but has simple, body and subject, raw, template",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			input := simpleEmail("to@example.com")
+			input.Content = test.content
+			err := checkSendEmailSchema(input)
+
+			if test.expected == "" {
+				if err != nil {
+					t.Errorf("expected a single content mode to be valid, got %v", err)
+				}
+			} else if err == nil || err.Error() != "Invalid input: "+test.expected {
+				t.Errorf("expected %q, got %v", test.expected, err)
+			}
+		})
+	}
+}
+
+func TestCheckSendBulkEmailSchema(t *testing.T) {
+	input := bulkEmail("a@example.com", "b@example.com")
+	input.FromEmailAddress = nil
+	input.DefaultContent = nil
+	input.BulkEmailEntries[1].Destination = nil
+
+	useSettings(t, Config{})
+
+	expected := []string{
+		"From address or identity ARN is required",
+		"Entry 1: Destination must contain at least one To, CC, or BCC address",
+		"DefaultContent.Template is required",
+	}
+
+	var schemaErr *SchemaError
+
+	if err := checkSendBulkEmailSchema(input); !errors.As(err, &schemaErr) {
+		t.Fatalf("expected a schema error, got %v", err)
+	} else if !reflect.DeepEqual(schemaErr.Problems, expected) {
+		t.Errorf("expected %q, got %q", expected, schemaErr.Problems)
+	}
+
+	empty := bulkEmail()
+
+	if err := checkSendBulkEmailSchema(empty); err == nil || err.Error() != "Invalid input: At least one entry is required" {
+		t.Errorf("expected a bulk email without entries to be rejected, got %v", err)
+	}
+}
+
+func TestSendEmailReportsSchemaErrorsTogether(t *testing.T) {
+	client := &fakeClient{}
+	input := simpleEmail("to@example.com")
+	input.Destination = nil
+	input.FromEmailAddress = nil
+
+	_, err := SendEmail(context.Background(), client, input)
+
+	const expected = "Invalid input: Destination must contain at least one To, CC, or BCC address; " +
+		"From address or identity ARN is required"
+
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected %q, got %v", expected, err)
+	} else if len(client.SentEmails()) != 0 {
+		t.Error("expected the invalid email not to be sent")
+	}
+}
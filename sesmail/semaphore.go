@@ -0,0 +1,44 @@
+// Limiting of concurrent sends across every invocation sharing a process
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"sync"
+)
+
+// Slots for sends in progress, shared by every invocation in the process. Recreated when the
+// configured size changes.
+var sendSlots struct {
+	sync.Mutex
+	size  int
+	slots chan struct{}
+}
+
+// Waits for a free send slot when MAX_CONCURRENT_SENDS is set, returning a function which frees
+// it. Returns the context's error if it's done before a slot frees up.
+func acquireSendSlot(ctx context.Context) (func(), error) {
+	size := Settings.MaxConcurrentSends
+
+	if size <= 0 {
+		return func() {}, nil
+	}
+
+	sendSlots.Lock()
+
+	if sendSlots.size != size {
+		sendSlots.size = size
+		sendSlots.slots = make(chan struct{}, size)
+	}
+
+	slots := sendSlots.slots
+	sendSlots.Unlock()
+
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
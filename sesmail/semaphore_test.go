@@ -0,0 +1,138 @@
+// Tests for limiting concurrent sends across invocations
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sesv2 "github.com/aws/aws-sdk-go-v2/service/sesv2"
+)
+
+// A client which records the most sends it had in progress at once
+type concurrencyClient struct {
+	*fakeClient
+
+	mutex    sync.Mutex
+	inFlight int
+	peak     int
+}
+
+func newConcurrencyClient(delay time.Duration) *concurrencyClient {
+	client := &concurrencyClient{}
+	client.fakeClient = &fakeClient{
+		sendEmail: func(context.Context, *sesv2.SendEmailInput) (*sesv2.SendEmailOutput, error) {
+			client.mutex.Lock()
+			client.inFlight++
+
+			if client.inFlight > client.peak {
+				client.peak = client.inFlight
+			}
+
+			client.mutex.Unlock()
+			time.Sleep(delay)
+			client.mutex.Lock()
+			client.inFlight--
+			client.mutex.Unlock()
+
+			return &sesv2.SendEmailOutput{MessageId: aws.String("message-id")}, nil
+		},
+	}
+
+	return client
+}
+
+// Sends count emails at once, as separate invocations would, returning the first error
+func sendConcurrently(ctx context.Context, client Client, count int) error {
+	var (
+		group sync.WaitGroup
+		mutex sync.Mutex
+		first error
+	)
+
+	for index := 0; index < count; index++ {
+		group.Add(1)
+
+		go func(index int) {
+			defer group.Done()
+
+			_, err := SendEmail(ctx, client, simpleEmail(fmt.Sprintf("user%d@example.com", index)))
+
+			mutex.Lock()
+
+			if first == nil {
+				first = err
+			}
+
+			mutex.Unlock()
+		}(index)
+	}
+
+	group.Wait()
+
+	return first
+}
+
+func TestMaxConcurrentSendsCapsConcurrency(t *testing.T) {
+	tests := []struct {
+		name     string
+		size     int
+		expected int
+	}{
+		{"capped", 2, 2},
+		{"single", 1, 1},
+		{"unlimited", 0, 6},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useSettings(t, Config{MaxConcurrentSends: test.size})
+
+			client := newConcurrencyClient(30 * time.Millisecond)
+
+			if err := sendConcurrently(context.Background(), client, 6); err != nil {
+				t.Fatal(err)
+			}
+
+			if client.peak != test.expected {
+				t.Errorf("expected at most %d sends at once, got %d", test.expected, client.peak)
+			}
+
+			if len(client.SentEmails()) != 6 {
+				t.Errorf("expected every email to be sent, got %d", len(client.SentEmails()))
+			}
+		})
+	}
+}
+
+func TestMaxConcurrentSendsRespectsContext(t *testing.T) {
+	useSettings(t, Config{MaxConcurrentSends: 1})
+
+	release, err := acquireSendSlot(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	client := &fakeClient{}
+	_, err = SendEmail(ctx, client, simpleEmail("to@example.com"))
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected %q, got %v", context.DeadlineExceeded, err)
+	}
+
+	if len(client.SentEmails()) != 0 {
+		t.Errorf("expected no send while the slot is taken, got %d", len(client.SentEmails()))
+	}
+}
@@ -0,0 +1,1008 @@
+// Sending emails through the SESv2 API
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	sesv2 "github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// The subset of the SESv2 client used to send emails, satisfied by *sesv2.Client
+type Client interface {
+	SendEmail(
+		ctx context.Context,
+		params *sesv2.SendEmailInput,
+		optFns ...func(*sesv2.Options),
+	) (*sesv2.SendEmailOutput, error)
+
+	SendBulkEmail(
+		ctx context.Context,
+		params *sesv2.SendBulkEmailInput,
+		optFns ...func(*sesv2.Options),
+	) (*sesv2.SendBulkEmailOutput, error)
+
+	GetAccount(
+		ctx context.Context,
+		params *sesv2.GetAccountInput,
+		optFns ...func(*sesv2.Options),
+	) (*sesv2.GetAccountOutput, error)
+
+	GetSuppressedDestination(
+		ctx context.Context,
+		params *sesv2.GetSuppressedDestinationInput,
+		optFns ...func(*sesv2.Options),
+	) (*sesv2.GetSuppressedDestinationOutput, error)
+
+	CreateConfigurationSetEventDestination(
+		ctx context.Context,
+		params *sesv2.CreateConfigurationSetEventDestinationInput,
+		optFns ...func(*sesv2.Options),
+	) (*sesv2.CreateConfigurationSetEventDestinationOutput, error)
+
+	GetEmailTemplate(
+		ctx context.Context,
+		params *sesv2.GetEmailTemplateInput,
+		optFns ...func(*sesv2.Options),
+	) (*sesv2.GetEmailTemplateOutput, error)
+
+	CreateEmailTemplate(
+		ctx context.Context,
+		params *sesv2.CreateEmailTemplateInput,
+		optFns ...func(*sesv2.Options),
+	) (*sesv2.CreateEmailTemplateOutput, error)
+
+	UpdateEmailTemplate(
+		ctx context.Context,
+		params *sesv2.UpdateEmailTemplateInput,
+		optFns ...func(*sesv2.Options),
+	) (*sesv2.UpdateEmailTemplateOutput, error)
+
+	DeleteEmailTemplate(
+		ctx context.Context,
+		params *sesv2.DeleteEmailTemplateInput,
+		optFns ...func(*sesv2.Options),
+	) (*sesv2.DeleteEmailTemplateOutput, error)
+
+	PutSuppressedDestination(
+		ctx context.Context,
+		params *sesv2.PutSuppressedDestinationInput,
+		optFns ...func(*sesv2.Options),
+	) (*sesv2.PutSuppressedDestinationOutput, error)
+
+	DeleteSuppressedDestination(
+		ctx context.Context,
+		params *sesv2.DeleteSuppressedDestinationInput,
+		optFns ...func(*sesv2.Options),
+	) (*sesv2.DeleteSuppressedDestinationOutput, error)
+
+	ListSuppressedDestinations(
+		ctx context.Context,
+		params *sesv2.ListSuppressedDestinationsInput,
+		optFns ...func(*sesv2.Options),
+	) (*sesv2.ListSuppressedDestinationsOutput, error)
+
+	CreateContactList(
+		ctx context.Context,
+		params *sesv2.CreateContactListInput,
+		optFns ...func(*sesv2.Options),
+	) (*sesv2.CreateContactListOutput, error)
+
+	CreateContact(
+		ctx context.Context,
+		params *sesv2.CreateContactInput,
+		optFns ...func(*sesv2.Options),
+	) (*sesv2.CreateContactOutput, error)
+
+	UpdateContact(
+		ctx context.Context,
+		params *sesv2.UpdateContactInput,
+		optFns ...func(*sesv2.Options),
+	) (*sesv2.UpdateContactOutput, error)
+
+	DeleteContact(
+		ctx context.Context,
+		params *sesv2.DeleteContactInput,
+		optFns ...func(*sesv2.Options),
+	) (*sesv2.DeleteContactOutput, error)
+
+	ListContacts(
+		ctx context.Context,
+		params *sesv2.ListContactsInput,
+		optFns ...func(*sesv2.Options),
+	) (*sesv2.ListContactsOutput, error)
+
+	DeleteContactList(
+		ctx context.Context,
+		params *sesv2.DeleteContactListInput,
+		optFns ...func(*sesv2.Options),
+	) (*sesv2.DeleteContactListOutput, error)
+
+	CreateConfigurationSet(
+		ctx context.Context,
+		params *sesv2.CreateConfigurationSetInput,
+		optFns ...func(*sesv2.Options),
+	) (*sesv2.CreateConfigurationSetOutput, error)
+
+	DeleteConfigurationSet(
+		ctx context.Context,
+		params *sesv2.DeleteConfigurationSetInput,
+		optFns ...func(*sesv2.Options),
+	) (*sesv2.DeleteConfigurationSetOutput, error)
+
+	PutConfigurationSetSuppressionOptions(
+		ctx context.Context,
+		params *sesv2.PutConfigurationSetSuppressionOptionsInput,
+		optFns ...func(*sesv2.Options),
+	) (*sesv2.PutConfigurationSetSuppressionOptionsOutput, error)
+}
+
+// Converts tags into SES message tags, sorted by name. Every tag which breaks SES's constraints is
+// reported in a single error.
+func createEmailTags(inputTags MessageTag) ([]types.MessageTag, error) {
+	var emailTags []types.MessageTag
+	var problems []string
+
+	names := make([]string, 0, len(inputTags))
+
+	for name := range inputTags {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	if len(names) > maxTags {
+		problems = append(problems, fmt.Sprintf("%d tags exceed the %d tag limit", len(names), maxTags))
+	}
+
+	for _, name := range names {
+		value := inputTags[name]
+		problems = append(problems, validateTag(name, value)...)
+		emailTags = append(emailTags, types.MessageTag{
+			Name:  aws.String(name),
+			Value: aws.String(value),
+		})
+	}
+
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("Invalid tags: %s", strings.Join(problems, "; "))
+	}
+
+	return emailTags, nil
+}
+
+// Sends a single email through SES
+func SendEmail(ctx context.Context, client Client, input *SendEmailInput) (*SendEmailOutput, error) {
+	startTime := time.Now()
+
+	if Settings.SendingDisabled {
+		return nil, ErrSendingDisabled
+	} else if err := checkEnforcement(); err != nil {
+		return nil, err
+	} else if input == nil {
+		return nil, invalidInput(errors.New("Email is required"))
+	} else if err := validateSendEmailInput(input); err != nil {
+		return nil, invalidInput(err)
+	} else if err := validateAttachmentBudget([]*SendEmailInput{input}); err != nil {
+		return nil, invalidInput(err)
+	}
+
+	emailTags, err := createEmailTags(input.EmailTags)
+
+	if err != nil {
+		return nil, invalidInput(err)
+	}
+
+	client, err = clientForRegion(client, input.Region)
+
+	if err != nil {
+		return nil, err
+	}
+
+	from, err := resolveFromAddress(input.FromEmailAddress, input.FromEmailAddressIdentityArn)
+
+	if err != nil {
+		return nil, invalidInput(err)
+	}
+
+	destination, recipientMismatches, err := reconcileRawRecipients(input.Destination, input.Content.Raw)
+
+	if err != nil {
+		return nil, invalidInput(err)
+	}
+
+	destination, err = resolveDestination(destination)
+
+	if err != nil {
+		return nil, invalidInput(err)
+	}
+
+	destination, optedOut, err := removeOptedOutRecipients(ctx, destination)
+
+	if err != nil {
+		return nil, err
+	} else if isEmptyDestination(destination) {
+		return nil, ErrAllRecipientsOptedOut
+	}
+
+	feedback := resolveFeedbackForwarding(
+		input.FeedbackForwardingEmailAddress,
+		input.FeedbackForwardingEmailAddressIdentityArn,
+	)
+
+	functionInput := &sesv2.SendEmailInput{
+		Content: &types.EmailContent{},
+
+		ConfigurationSetName: input.ConfigurationSetName,
+
+		Destination: &types.Destination{
+			BccAddresses: destination.BccAddresses,
+			CcAddresses:  destination.CcAddresses,
+			ToAddresses:  destination.ToAddresses,
+		},
+
+		EmailTags:                      emailTags,
+		FeedbackForwardingEmailAddress: feedback.emailAddress(),
+		FeedbackForwardingEmailAddressIdentityArn: feedback.identityArn(),
+		FromEmailAddress:            from,
+		FromEmailAddressIdentityArn: input.FromEmailAddressIdentityArn,
+
+		ListManagementOptions: nil,
+
+		ReplyToAddresses: resolveReplyTo(input.ReplyToAddresses),
+	}
+
+	if input.Content.Body != nil && input.Content.Subject != nil {
+		var htmlContent *types.Content
+		var textContent *types.Content
+
+		subject, err := sanitizeSubject(input.Content.Subject)
+
+		if err != nil {
+			return nil, invalidInput(err)
+		}
+
+		if input.Content.Body.Html != nil {
+			htmlContent = &types.Content{
+				Data:    input.Content.Body.Html.Data,
+				Charset: resolveCharset(input.Content.Body.Html.Charset),
+			}
+		}
+
+		if input.Content.Body.Text != nil {
+			textContent = &types.Content{
+				Data:    input.Content.Body.Text.Data,
+				Charset: resolveCharset(input.Content.Body.Text.Charset),
+			}
+		}
+
+		functionInput.Content.Simple = &types.Message{
+			Body: &types.Body{
+				Html: htmlContent,
+				Text: textContent,
+			},
+			Subject: subject,
+		}
+	} else if input.Content.Simple != nil && input.Content.Simple.Body != nil && input.Content.Simple.Subject != nil {
+		var htmlContent *types.Content
+		var textContent *types.Content
+
+		subject, err := sanitizeSubject(input.Content.Simple.Subject)
+
+		if err != nil {
+			return nil, invalidInput(err)
+		}
+
+		if input.Content.Simple.Body.Html != nil {
+			htmlContent = &types.Content{
+				Data:    input.Content.Simple.Body.Html.Data,
+				Charset: resolveCharset(input.Content.Simple.Body.Html.Charset),
+			}
+		}
+
+		if input.Content.Simple.Body.Text != nil {
+			textContent = &types.Content{
+				Data:    input.Content.Simple.Body.Text.Data,
+				Charset: resolveCharset(input.Content.Simple.Body.Text.Charset),
+			}
+		}
+
+		functionInput.Content.Simple = &types.Message{
+			Body: &types.Body{
+				Html: htmlContent,
+				Text: textContent,
+			},
+			Subject: subject,
+		}
+	}
+
+	var mismatches []ContentTypeMismatch
+
+	if len(input.Content.Attachments) == 0 && len(input.Content.Headers) > 0 {
+		headers, err := sanitizeHeaders(input.Content.Headers)
+
+		if err != nil {
+			return nil, invalidInput(err)
+		} else if functionInput.Content.Simple == nil {
+			return nil, invalidInput(errors.New("Attachments and headers require a simple message with a subject and body"))
+		}
+
+		functionInput.Content.Simple.Headers = messageHeaders(headers)
+	} else if len(input.Content.Attachments) > 0 {
+		if err := validateAttachments(input.Content.Attachments); err != nil {
+			return nil, invalidInput(err)
+		}
+
+		mismatches, err = sniffAttachments(input.Content.Attachments)
+
+		if err != nil {
+			return nil, invalidInput(err)
+		}
+
+		headers, err := sanitizeHeaders(input.Content.Headers)
+
+		if err != nil {
+			return nil, invalidInput(err)
+		}
+
+		data, err := buildMimeMessage(functionInput, input.Content.Attachments, headers)
+
+		if err != nil {
+			return nil, invalidInput(err)
+		} else if err := validateRawMessage(&RawMessage{Data: data}); err != nil {
+			return nil, invalidInput(err)
+		}
+
+		functionInput.Content.Simple = nil
+		functionInput.Content.Raw = &types.RawMessage{Data: data}
+	}
+
+	if input.Content.Raw != nil {
+		if err := validateRawMessage(input.Content.Raw); err != nil {
+			return nil, invalidInput(err)
+		} else if err := validateRawMessageAttachments(input.Content.Raw.Data); err != nil {
+			return nil, invalidInput(err)
+		}
+
+		functionInput.Content.Raw = &types.RawMessage{
+			Data: input.Content.Raw.Data,
+		}
+	}
+
+	if input.Content.Template != nil {
+		functionInput.Content.Template = &types.Template{
+			TemplateArn:  input.Content.Template.TemplateArn,
+			TemplateData: input.Content.Template.TemplateData,
+			TemplateName: input.Content.Template.TemplateName,
+		}
+	}
+
+	if input.ListManagementOptions != nil {
+		functionInput.ListManagementOptions = &types.ListManagementOptions{
+			ContactListName: input.ListManagementOptions.ContactListName,
+			TopicName:       input.ListManagementOptions.TopicName,
+		}
+	}
+
+	suppressed := findSuppressedRecipients(ctx, client, destination)
+
+	if err := waitForDomainLimits(ctx, destination); err != nil {
+		return nil, err
+	} else if err := waitForJitter(ctx); err != nil {
+		return nil, err
+	}
+
+	release, err := acquireSendSlot(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	serviceStartTime := time.Now()
+	output, err := client.SendEmail(ctx, functionInput)
+	serviceDuration := time.Since(serviceStartTime)
+	release()
+	err = sendTemplateNotFound(ctx, client, err, functionInput.Content.Template)
+
+	if functionInput.Content.Raw != nil {
+		err = virusDetected(err, functionInput.Content.Raw.Data)
+	}
+
+	if err == nil {
+		recordMetrics(ctx, input.ConfigurationSetName, false, 1, 0, serviceDuration)
+	} else {
+		recordMetrics(ctx, input.ConfigurationSetName, false, 0, 1, serviceDuration)
+	}
+
+	logEntry := SendLogEntry{
+		Operation:            "SendEmail",
+		ConfigurationSetName: input.ConfigurationSetName,
+		DurationMillis:       serviceDuration.Milliseconds(),
+	}
+
+	if err == nil && output.MessageId != nil {
+		logEntry.MessageIds = []string{*output.MessageId}
+	}
+
+	logSend(logEntry, []*Destination{destination}, err)
+
+	receipt := &AuditReceipt{
+		Operation:            "SendEmail",
+		Error:                errorString(err),
+		FromEmailAddress:     from,
+		Destination:          destination,
+		ConfigurationSetName: input.ConfigurationSetName,
+		Timestamp:            time.Now(),
+	}
+
+	if err != nil {
+		recordAudit(ctx, receipt)
+
+		return nil, err
+	}
+
+	receipt.MessageId = output.MessageId
+	recordAudit(ctx, receipt)
+
+	convertedOutput := convertSendEmailOutput(output, destination)
+	convertedOutput.SizeBytes = contentSize(input.Content)
+	convertedOutput.SuppressedRecipients = suppressed
+	convertedOutput.OptedOutRecipients = optedOut
+	convertedOutput.ContentTypeMismatches = mismatches
+	convertedOutput.RecipientMismatches = recipientMismatches
+	convertedOutput.Fingerprint = sendEmailFingerprint(functionInput)
+	convertedOutput.TemplateUsed = templateIdentifier(functionInput.Content.Template)
+	convertedOutput.TagCapacity = tagCapacity(input.EmailTags)
+	convertedOutput.DroppedRecipients = newDroppedRecipients(optedOut, DropReasonOptedOut, nil)
+	convertedOutput.ResolvedReplyTo = functionInput.ReplyToAddresses
+	convertedOutput.FeedbackForwardingResolved = feedback
+
+	if convertedOutput.Region == "" {
+		convertedOutput.Region = aws.ToString(input.Region)
+	}
+
+	if functionInput.Content.Simple != nil {
+		convertedOutput.Charsets = messageCharsets(functionInput.Content.Simple)
+	}
+
+	convertedOutput.ServiceMillis = serviceDuration.Milliseconds()
+	convertedOutput.ProcessingMillis = (time.Since(startTime) - serviceDuration).Milliseconds()
+
+	if input.DebugMime {
+		convertedOutput.MimeTree = describeMime(functionInput.Content.Raw)
+	}
+
+	return convertedOutput, nil
+}
+
+// Sends each email individually through SES, at most MaxConcurrency at a time, collecting the outputs
+// of the accepted emails and the errors of the rest in the order of the inputs. If
+// BatchTemplatedEmails is enabled and every email uses the same template, they are sent as bulk
+// emails instead. If ValidateBatchFirst is enabled, nothing is sent unless every email is valid, and
+// nothing is sent if the emails have more recipients combined than MaxBatchRecipients allows, or
+// more attachment bytes combined than MaxAttachmentBytes allows. Every error is an EmailError
+// naming the email it belongs to, so an error which rejects the whole batch is returned for each
+// email.
+func SendEmails(ctx context.Context, client Client, inputs []*SendEmailInput) ([]*SendEmailOutput, []error) {
+	if err := validateBatchRecipientCount(inputs); err != nil {
+		return nil, batchErrors(inputs, invalidInput(err))
+	} else if err := validateAttachmentBudget(inputs); err != nil {
+		return nil, batchErrors(inputs, invalidInput(err))
+	}
+
+	if Settings.ValidateBatchFirst {
+		// Checked before converting to bulk emails too, since their chunks are sent one by one
+		if errs := validateEmails(inputs); len(errs) > 0 {
+			return nil, errs
+		}
+	}
+
+	if Settings.BatchTemplatedEmails {
+		if bulkInput := templatedEmailsAsBulk(inputs); bulkInput != nil {
+			return sendEmailsAsBulk(ctx, client, bulkInput)
+		}
+	}
+
+	results := make([]SendResult, len(inputs))
+
+	for result := range SendEmailsStream(ctx, client, inputs) {
+		results[result.Index] = result
+	}
+
+	var outputs []*SendEmailOutput
+	var errors []error
+
+	for _, result := range results {
+		if result.Err == nil {
+			outputs = append(outputs, result.Output)
+
+			continue
+		}
+
+		emailErr := &EmailError{Index: result.Index, Err: result.Err}
+
+		if input := inputs[result.Index]; input != nil {
+			emailErr.Destination = input.Destination
+		}
+
+		errors = append(errors, emailErr)
+	}
+
+	return outputs, errors
+}
+
+// Returns an error for each email of a batch which was rejected as a whole
+func batchErrors(inputs []*SendEmailInput, err error) []error {
+	errs := make([]error, 0, len(inputs))
+
+	for index, input := range inputs {
+		emailErr := &EmailError{Index: index, Err: err}
+
+		if input != nil {
+			emailErr.Destination = input.Destination
+		}
+
+		errs = append(errs, emailErr)
+	}
+
+	return errs
+}
+
+// Sends a templated email to multiple destinations through SES. Entries whose recipients all opted
+// out are skipped, and ErrAllRecipientsOptedOut is returned if that leaves none.
+func SendBulkEmail(ctx context.Context, client Client, input *SendBulkEmailInput) (*SendBulkEmailOutput, error) {
+	var bulkEmailEntries []types.BulkEmailEntry
+	var sentEntries []BulkEmailEntry
+	var sentIndexes []int
+	var optedOutEntries []OptedOutEntry
+	var dropped []DroppedRecipient
+	startTime := time.Now()
+
+	if Settings.SendingDisabled {
+		return nil, ErrSendingDisabled
+	} else if err := checkEnforcement(); err != nil {
+		return nil, err
+	} else if err := checkSendBulkEmailSchema(input); err != nil {
+		return nil, invalidInput(err)
+	}
+
+	feedback := resolveFeedbackForwarding(
+		input.FeedbackForwardingEmailAddress,
+		input.FeedbackForwardingEmailAddressIdentityArn,
+	)
+
+	if err := validateSenderAddresses(
+		input.FromEmailAddress,
+		feedback.emailAddress(),
+		resolveReplyTo(input.ReplyToAddresses),
+	); err != nil {
+		return nil, invalidInput(err)
+	}
+
+	duplicates := findDuplicateRecipients(input.BulkEmailEntries)
+	skipped := map[int]bool{}
+
+	for _, duplicate := range duplicates {
+		skipped[duplicate.Index] = duplicate.Skipped
+	}
+
+	for index, entry := range input.BulkEmailEntries {
+		replacementEmailTags, err := validateBulkEntry(input.DefaultEmailTags, entry)
+
+		if err != nil {
+			return nil, invalidInput(fmt.Errorf("Entry %d: %w", index, err))
+		}
+
+		entryIndex := index
+
+		if skipped[index] {
+			dropped = append(dropped, newDroppedRecipients(
+				destinationAddresses(entry.Destination), DropReasonDuplicateEntry, &entryIndex,
+			)...)
+
+			continue
+		}
+
+		destination, err := resolveDestination(entry.Destination)
+
+		if err != nil {
+			return nil, invalidInput(fmt.Errorf("Entry %d: %w", index, err))
+		}
+
+		destination, optedOut, err := removeOptedOutRecipients(ctx, destination)
+
+		if err != nil {
+			return nil, fmt.Errorf("Entry %d: %w", index, err)
+		} else if len(optedOut) > 0 {
+			dropped = append(dropped, newDroppedRecipients(optedOut, DropReasonOptedOut, &entryIndex)...)
+			optedOutEntries = append(optedOutEntries, OptedOutEntry{
+				Index:     index,
+				Addresses: optedOut,
+				Skipped:   isEmptyDestination(destination),
+			})
+
+			if isEmptyDestination(destination) {
+				continue
+			}
+		}
+
+		entry.Destination = destination
+
+		functionInput := &types.BulkEmailEntry{
+			Destination: &types.Destination{
+				BccAddresses: entry.Destination.BccAddresses,
+				CcAddresses:  entry.Destination.CcAddresses,
+				ToAddresses:  entry.Destination.ToAddresses,
+			},
+
+			ReplacementEmailContent: nil,
+
+			ReplacementTags: replacementEmailTags,
+		}
+
+		if entry.ReplacementEmailContent != nil &&
+			entry.ReplacementEmailContent.ReplacementTemplate != nil &&
+			entry.ReplacementEmailContent.ReplacementTemplate.ReplacementTemplateData != nil {
+
+			functionInput.ReplacementEmailContent = &types.ReplacementEmailContent{
+				ReplacementTemplate: &types.ReplacementTemplate{
+					ReplacementTemplateData: entry.ReplacementEmailContent.ReplacementTemplate.ReplacementTemplateData,
+				},
+			}
+		}
+
+		bulkEmailEntries = append(bulkEmailEntries, *functionInput)
+		sentEntries = append(sentEntries, entry)
+		sentIndexes = append(sentIndexes, index)
+	}
+
+	if len(bulkEmailEntries) == 0 {
+		// Only opting out empties every entry, since a skipped duplicate repeats an earlier entry
+		return nil, ErrAllRecipientsOptedOut
+	}
+
+	defaultEmailTags, err := createEmailTags(input.DefaultEmailTags)
+
+	if err != nil {
+		return nil, invalidInput(err)
+	}
+
+	client, err = clientForRegion(client, input.Region)
+
+	if err != nil {
+		return nil, err
+	}
+
+	from, err := resolveFromAddress(input.FromEmailAddress, input.FromEmailAddressIdentityArn)
+
+	if err != nil {
+		return nil, invalidInput(err)
+	}
+
+	functionInput := &sesv2.SendBulkEmailInput{
+		BulkEmailEntries: bulkEmailEntries,
+
+		DefaultContent: &types.BulkEmailContent{},
+
+		ConfigurationSetName:                      input.ConfigurationSetName,
+		DefaultEmailTags:                          defaultEmailTags,
+		FeedbackForwardingEmailAddress:            feedback.emailAddress(),
+		FeedbackForwardingEmailAddressIdentityArn: feedback.identityArn(),
+		FromEmailAddress:                          from,
+		FromEmailAddressIdentityArn:               input.FromEmailAddressIdentityArn,
+		ReplyToAddresses:                          resolveReplyTo(input.ReplyToAddresses),
+	}
+	if input.DefaultContent != nil && input.DefaultContent.Template != nil {
+		functionInput.DefaultContent.Template = &types.Template{
+			TemplateArn:  input.DefaultContent.Template.TemplateArn,
+			TemplateData: input.DefaultContent.Template.TemplateData,
+			TemplateName: input.DefaultContent.Template.TemplateName,
+		}
+	} else {
+		functionInput.DefaultContent.Template = &types.Template{
+			TemplateName: aws.String(Settings.DefaultBulkTemplate),
+		}
+	}
+
+	missingData, err := findEntriesMissingData(ctx, client, functionInput.DefaultContent.Template, input.BulkEmailEntries)
+
+	if err != nil {
+		log.Printf("failed to check entries for replacement template data, %v", err)
+	} else if len(missingData) > 0 && Settings.ReplacementDataCheck == ReplacementDataRequire {
+		return nil, invalidInput(fmt.Errorf(
+			"Entries %s have no replacement template data, but template %q uses variables",
+			joinInts(missingData), aws.ToString(functionInput.DefaultContent.Template.TemplateName),
+		))
+	}
+
+	var suppressed [][]SuppressedRecipient
+	var destinations []*Destination
+
+	for _, entry := range sentEntries {
+		suppressed = append(suppressed, findSuppressedRecipients(ctx, client, entry.Destination))
+		destinations = append(destinations, entry.Destination)
+	}
+
+	if err := waitForDomainLimits(ctx, destinations...); err != nil {
+		return nil, err
+	}
+
+	serviceStartTime := time.Now()
+	output, err := sendBulkEmailChunks(ctx, client, functionInput)
+	serviceDuration := time.Since(serviceStartTime)
+	err = sendTemplateNotFound(ctx, client, err, functionInput.DefaultContent.Template)
+	timestamp := time.Now()
+	sent := 0
+
+	if output != nil {
+		for _, result := range output.BulkEmailEntryResults {
+			if result.Status == types.BulkEmailStatusSuccess {
+				sent++
+			}
+		}
+	}
+
+	recordMetrics(ctx, input.ConfigurationSetName, true, sent, len(bulkEmailEntries)-sent, serviceDuration)
+
+	logEntry := SendLogEntry{
+		Operation:            "SendBulkEmail",
+		ConfigurationSetName: input.ConfigurationSetName,
+		DurationMillis:       serviceDuration.Milliseconds(),
+	}
+	var logDestinations []*Destination
+
+	for index, entry := range sentEntries {
+		logDestinations = append(logDestinations, entry.Destination)
+
+		if output != nil && index < len(output.BulkEmailEntryResults) &&
+			output.BulkEmailEntryResults[index].MessageId != nil {
+			logEntry.MessageIds = append(logEntry.MessageIds, *output.BulkEmailEntryResults[index].MessageId)
+		}
+	}
+
+	logSend(logEntry, logDestinations, err)
+
+	for index, entry := range sentEntries {
+		receipt := &AuditReceipt{
+			Operation:            "SendBulkEmail",
+			Error:                errorString(err),
+			FromEmailAddress:     from,
+			Destination:          entry.Destination,
+			ConfigurationSetName: input.ConfigurationSetName,
+			Timestamp:            timestamp,
+		}
+
+		if output != nil && index < len(output.BulkEmailEntryResults) {
+			result := output.BulkEmailEntryResults[index]
+			receipt.MessageId = result.MessageId
+			receipt.Error = result.Error
+		}
+
+		recordAudit(ctx, receipt)
+	}
+
+	convertedOutput := convertSendBulkEmailOutput(output, functionInput.DefaultContent.Template)
+
+	if convertedOutput != nil {
+		for index, entry := range sentEntries {
+			if index < len(convertedOutput.BulkEmailEntryResults) {
+				convertedOutput.BulkEmailEntryResults[index].SizeBytes = bulkEntrySize(functionInput, entry)
+				convertedOutput.BulkEmailEntryResults[index].Index = sentIndexes[index]
+				convertedOutput.BulkEmailEntryResults[index].Recipients = entry.Destination
+				convertedOutput.BulkEmailEntryResults[index].SuppressedRecipients = suppressed[index]
+				convertedOutput.BulkEmailEntryResults[index].TagCapacity = tagCapacity(
+					input.DefaultEmailTags,
+					entry.ReplacementTags,
+				)
+			}
+		}
+
+		convertedOutput.DuplicateRecipients = duplicates
+		convertedOutput.EntriesMissingData = missingData
+		convertedOutput.OptedOutEntries = optedOutEntries
+		convertedOutput.DroppedRecipients = dropped
+		convertedOutput.ResolvedReplyTo = functionInput.ReplyToAddresses
+		convertedOutput.FeedbackForwardingResolved = feedback
+
+		if convertedOutput.Region == "" {
+			convertedOutput.Region = aws.ToString(input.Region)
+		}
+
+		convertedOutput.Fingerprint = sendBulkEmailFingerprint(functionInput)
+		convertedOutput.TemplateUsed = templateIdentifier(functionInput.DefaultContent.Template)
+		convertedOutput.ServiceMillis = serviceDuration.Milliseconds()
+		convertedOutput.ProcessingMillis = (time.Since(startTime) - serviceDuration).Milliseconds()
+	}
+
+	return convertedOutput, err
+}
+
+// Sends a bulk email in chunks of at most 50 entries, since SES rejects larger requests, retrying
+// failed entries of each chunk. The results of every chunk are merged in the order of the entries,
+// with the entries of chunks which failed outright reported as failed, and the errors of failed
+// chunks combined into one.
+func sendBulkEmailChunks(
+	ctx context.Context,
+	client Client,
+	functionInput *sesv2.SendBulkEmailInput,
+) (*sesv2.SendBulkEmailOutput, error) {
+	if len(functionInput.BulkEmailEntries) <= maxBulkEmailEntries {
+		output, err := sendBulkEmailChunk(ctx, client, functionInput)
+
+		if err == nil {
+			output = retryBulkEmailEntries(ctx, client, functionInput, output)
+		}
+
+		return output, err
+	}
+
+	merged := &sesv2.SendBulkEmailOutput{}
+	var firstErr error
+	hasMetadata := false
+	failedChunks := 0
+	chunks := 0
+
+	for start := 0; start < len(functionInput.BulkEmailEntries); start += maxBulkEmailEntries {
+		end := start + maxBulkEmailEntries
+
+		if end > len(functionInput.BulkEmailEntries) {
+			end = len(functionInput.BulkEmailEntries)
+		}
+
+		chunks++
+		chunkInput := *functionInput
+		chunkInput.BulkEmailEntries = functionInput.BulkEmailEntries[start:end]
+		output, err := sendBulkEmailChunk(ctx, client, &chunkInput)
+
+		if err == nil {
+			output = retryBulkEmailEntries(ctx, client, &chunkInput, output)
+		} else {
+			failedChunks++
+
+			if firstErr == nil {
+				firstErr = fmt.Errorf("Entries %d to %d: %w", start, end-1, err)
+			}
+		}
+
+		if output == nil {
+			output = &sesv2.SendBulkEmailOutput{}
+
+			for range chunkInput.BulkEmailEntries {
+				output.BulkEmailEntryResults = append(output.BulkEmailEntryResults, types.BulkEmailEntryResult{
+					Error:  errorString(err),
+					Status: types.BulkEmailStatusFailed,
+				})
+			}
+		} else if err == nil && !hasMetadata {
+			merged.ResultMetadata = output.ResultMetadata
+			hasMetadata = true
+		}
+
+		merged.BulkEmailEntryResults = append(merged.BulkEmailEntryResults, output.BulkEmailEntryResults...)
+	}
+
+	if failedChunks > 1 {
+		return merged, fmt.Errorf("%d of %d bulk email chunks failed, first: %w", failedChunks, chunks, firstErr)
+	}
+
+	return merged, firstErr
+}
+
+// Sends a single SendBulkEmail request, cancelling it once the configured chunk timeout elapses.
+// A chunk which times out has each of its entries reported as failed.
+func sendBulkEmailChunk(
+	ctx context.Context,
+	client Client,
+	functionInput *sesv2.SendBulkEmailInput,
+) (*sesv2.SendBulkEmailOutput, error) {
+	if err := waitForJitter(ctx); err != nil {
+		return nil, err
+	}
+
+	release, err := acquireSendSlot(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer release()
+
+	if Settings.BulkChunkTimeout <= 0 {
+		return client.SendBulkEmail(ctx, functionInput)
+	}
+
+	chunkContext, cancel := context.WithTimeout(ctx, Settings.BulkChunkTimeout)
+	defer cancel()
+
+	output, err := client.SendBulkEmail(chunkContext, functionInput)
+
+	if err != nil && errors.Is(chunkContext.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+		err = fmt.Errorf("%w after %s", ErrChunkTimeout, Settings.BulkChunkTimeout)
+		output = &sesv2.SendBulkEmailOutput{}
+
+		for range functionInput.BulkEmailEntries {
+			output.BulkEmailEntryResults = append(output.BulkEmailEntryResults, types.BulkEmailEntryResult{
+				Error:  aws.String(err.Error()),
+				Status: types.BulkEmailStatusFailed,
+			})
+		}
+
+		return output, err
+	}
+
+	return output, err
+}
+
+// Returns the ID of the SES request which produced an output, or an empty string if there is none
+func requestID(metadata middleware.Metadata) string {
+	id, _ := awsmiddleware.GetRequestIDMetadata(metadata)
+
+	return id
+}
+
+func convertSendEmailOutput(output *sesv2.SendEmailOutput, destination *Destination) *SendEmailOutput {
+	if output == nil {
+		return &SendEmailOutput{
+			Status:              SendStatusFailed,
+			ApiOperation:        "SendEmail",
+			ResolvedDestination: destination,
+		}
+	}
+
+	status := SendStatusAccepted
+
+	if output.MessageId == nil {
+		status = SendStatusAcceptedPendingId
+	}
+
+	return &SendEmailOutput{
+		MessageId:           output.MessageId,
+		Status:              status,
+		ApiOperation:        "SendEmail",
+		Region:              regionFromMetadata(output.ResultMetadata),
+		ResolvedDestination: destination,
+		CoveredRecipients:   destinationAddresses(destination),
+		RequestId:           requestID(output.ResultMetadata),
+		ResultMetadata:      output.ResultMetadata,
+	}
+}
+
+func convertSendBulkEmailOutput(output *sesv2.SendBulkEmailOutput, template *types.Template) *SendBulkEmailOutput {
+	if output == nil {
+		return nil
+	}
+
+	var bulkEmailEntryResults []BulkEmailEntryResult
+
+	for _, arrayItem := range output.BulkEmailEntryResults {
+		result := BulkEmailEntryResult{
+			Error:     arrayItem.Error,
+			MessageId: arrayItem.MessageId,
+			Status:    BulkEmailStatus(arrayItem.Status),
+		}
+
+		if arrayItem.Status == types.BulkEmailStatusTemplateNotFound && template != nil {
+			result.Error = aws.String(newTemplateNotFound(template, nil).Error())
+		}
+
+		bulkEmailEntryResults = append(bulkEmailEntryResults, result)
+	}
+
+	return &SendBulkEmailOutput{
+		BulkEmailEntryResults: bulkEmailEntryResults,
+		Region:                regionFromMetadata(output.ResultMetadata),
+		RequestId:             requestID(output.ResultMetadata),
+		ResultMetadata:        output.ResultMetadata,
+	}
+}
@@ -0,0 +1,524 @@
+// Tests for sending emails through SES
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	sesv2 "github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+)
+
+func TestSendBulkEmailChunkTimeout(t *testing.T) {
+	client := &fakeClient{sendBulkEmail: func(ctx context.Context, _ *sesv2.SendBulkEmailInput) (*sesv2.SendBulkEmailOutput, error) {
+		<-ctx.Done()
+
+		return nil, ctx.Err()
+	}}
+	useSettings(t, Config{BulkChunkTimeout: 50 * time.Millisecond})
+
+	start := time.Now()
+	output, err := SendBulkEmail(context.Background(), client, bulkEmail("a@example.com", "b@example.com"))
+
+	if err == nil || !strings.Contains(err.Error(), "timed out after 50ms") {
+		t.Fatalf("expected a timeout error, got %v", err)
+	} else if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("expected the chunk to be cancelled, but it took %s", elapsed)
+	} else if len(output.BulkEmailEntryResults) != 2 {
+		t.Fatalf("expected every entry to be reported, got %+v", output.BulkEmailEntryResults)
+	}
+
+	for _, result := range output.BulkEmailEntryResults {
+		if result.Status != BulkEmailStatus(types.BulkEmailStatusFailed) || !strings.Contains(*result.Error, "timed out") {
+			t.Errorf("expected a timed out failure, got %+v", result)
+		}
+	}
+
+	if !errors.Is(err, ErrChunkTimeout) {
+		t.Errorf("expected %v, got %v", ErrChunkTimeout, err)
+	} else if code := BulkResultCode(output, err); code != ResultServiceError {
+		t.Errorf("expected %q, got %v", ResultServiceError, code)
+	} else if !IsRetryable(err) {
+		t.Errorf("expected %v to be retryable", err)
+	} else if problem := NewProblem(err); problem.Status != http.StatusGatewayTimeout {
+		t.Errorf("expected status %d, got %+v", http.StatusGatewayTimeout, problem)
+	}
+}
+
+func TestSendBulkEmailWithinTimeout(t *testing.T) {
+	useSettings(t, Config{BulkChunkTimeout: 5 * time.Second})
+
+	output, err := SendBulkEmail(context.Background(), &fakeClient{}, bulkEmail("a@example.com"))
+
+	if err != nil {
+		t.Fatal(err)
+	} else if output.BulkEmailEntryResults[0].Status != BulkEmailStatus(types.BulkEmailStatusSuccess) {
+		t.Errorf("expected the entry to succeed, got %+v", output.BulkEmailEntryResults[0])
+	}
+}
+
+func TestSendEmailBuildsRequest(t *testing.T) {
+	client := &fakeClient{}
+	input := simpleEmail("to@example.com")
+	input.ConfigurationSetName = aws.String("tracking")
+	input.EmailTags = MessageTag{"campaign": "launch"}
+
+	output, err := SendEmail(context.Background(), client, input)
+
+	if err != nil {
+		t.Fatal(err)
+	} else if aws.ToString(output.MessageId) != "message-1" || output.Status != SendStatusAccepted {
+		t.Errorf("unexpected output %+v", output)
+	}
+
+	sent := client.SentEmails()
+
+	if len(sent) != 1 {
+		t.Fatalf("expected a single request, got %d", len(sent))
+	}
+
+	request := sent[0]
+
+	if aws.ToString(request.FromEmailAddress) != "from@example.com" ||
+		aws.ToString(request.ConfigurationSetName) != "tracking" ||
+		request.Destination.ToAddresses[0] != "to@example.com" ||
+		aws.ToString(request.Content.Simple.Subject.Data) != "Subject" ||
+		aws.ToString(request.Content.Simple.Body.Text.Data) != "Body" ||
+		len(request.EmailTags) != 1 || aws.ToString(request.EmailTags[0].Name) != "campaign" {
+		t.Errorf("unexpected request %+v", request)
+	}
+}
+
+func TestSendEmailBuildsBodies(t *testing.T) {
+	html := &Content{Data: aws.String("<p>Body</p>")}
+	text := &Content{Data: aws.String("Body")}
+
+	for _, test := range []struct {
+		name string
+		body Body
+	}{
+		{"html only", Body{Html: html}},
+		{"text only", Body{Text: text}},
+		{"both", Body{Html: html, Text: text}},
+	} {
+		for _, shortcut := range []bool{false, true} {
+			name := test.name
+
+			if shortcut {
+				name += " shortcut"
+			}
+
+			t.Run(name, func(t *testing.T) {
+				client := &fakeClient{}
+				input := simpleEmail("to@example.com")
+				body := test.body
+
+				if shortcut {
+					input.Content = &EmailContent{Subject: input.Content.Simple.Subject, Body: &body}
+				} else {
+					input.Content.Simple.Body = &body
+				}
+
+				if _, err := SendEmail(context.Background(), client, input); err != nil {
+					t.Fatal(err)
+				}
+
+				sent := client.SentEmails()[0].Content.Simple.Body
+
+				if (sent.Html != nil) != (test.body.Html != nil) {
+					t.Errorf("expected HTML %t, got %+v", test.body.Html != nil, sent.Html)
+				} else if (sent.Text != nil) != (test.body.Text != nil) {
+					t.Errorf("expected text %t, got %+v", test.body.Text != nil, sent.Text)
+				}
+			})
+		}
+	}
+}
+
+func TestSendEmailsCollectsErrors(t *testing.T) {
+	outputs, errs := SendEmails(context.Background(), &fakeClient{}, []*SendEmailInput{
+		simpleEmail("a@example.com"),
+		{Content: &EmailContent{}},
+		simpleEmail("b@example.com"),
+	})
+
+	if len(outputs) != 2 || len(errs) != 1 {
+		t.Errorf("expected 2 outputs and 1 error, got %d and %d", len(outputs), len(errs))
+	}
+}
+
+func TestSendingDisabledBlocksSends(t *testing.T) {
+	client := &fakeClient{}
+	useSettings(t, Config{SendingDisabled: true})
+
+	if _, err := SendEmail(context.Background(), client, simpleEmail("a@example.com")); err != ErrSendingDisabled {
+		t.Errorf("expected SendEmail to fail with %v, got %v", ErrSendingDisabled, err)
+	}
+
+	if _, errs := SendEmails(context.Background(), client, []*SendEmailInput{simpleEmail("a@example.com")}); len(errs) != 1 ||
+		!errors.Is(errs[0], ErrSendingDisabled) {
+		t.Errorf("expected SendEmails to fail with %v, got %v", ErrSendingDisabled, errs)
+	}
+
+	if _, err := SendBulkEmail(context.Background(), client, bulkEmail("a@example.com")); err != ErrSendingDisabled {
+		t.Errorf("expected SendBulkEmail to fail with %v, got %v", ErrSendingDisabled, err)
+	}
+
+	if sent := len(client.SentEmails()) + len(client.SentBulkEmails()); sent != 0 {
+		t.Errorf("expected SES not to be called, got %d calls", sent)
+	}
+}
+
+func TestSendingEnabledAllowsSends(t *testing.T) {
+	client := &fakeClient{}
+	useSettings(t, Config{})
+
+	if _, err := SendEmail(context.Background(), client, simpleEmail("a@example.com")); err != nil {
+		t.Fatal(err)
+	} else if _, err := SendBulkEmail(context.Background(), client, bulkEmail("a@example.com")); err != nil {
+		t.Fatal(err)
+	} else if len(client.SentEmails()) != 1 || len(client.SentBulkEmails()) != 1 {
+		t.Errorf("expected one email and one bulk email, got %d and %d", len(client.SentEmails()), len(client.SentBulkEmails()))
+	}
+}
+
+// Answers after a delay, as if SES were slow
+func slowClient(delay time.Duration) *fakeClient {
+	return &fakeClient{
+		sendEmail: func(context.Context, *sesv2.SendEmailInput) (*sesv2.SendEmailOutput, error) {
+			time.Sleep(delay)
+
+			return &sesv2.SendEmailOutput{MessageId: aws.String("message-id")}, nil
+		},
+		sendBulkEmail: func(_ context.Context, params *sesv2.SendBulkEmailInput) (*sesv2.SendBulkEmailOutput, error) {
+			time.Sleep(delay)
+
+			return acceptBulkEmail(params), nil
+		},
+	}
+}
+
+func TestSendEmailReportsProcessingAndServiceTime(t *testing.T) {
+	// The domain rate limit makes the second send wait 200ms after the first, about 140ms of which
+	// is left once the first send returns
+	useDomainLimits(t, map[string]float64{"example.com": 5})
+
+	client := slowClient(60 * time.Millisecond)
+
+	if _, err := SendEmail(context.Background(), client, simpleEmail("a@example.com")); err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := SendEmail(context.Background(), client, simpleEmail("b@example.com"))
+
+	if err != nil {
+		t.Fatal(err)
+	} else if output.ServiceMillis < 60 || output.ServiceMillis >= 90 {
+		t.Errorf("expected about 60ms in SES, got %dms", output.ServiceMillis)
+	} else if output.ProcessingMillis < 100 {
+		t.Errorf("expected the rate limit wait to count as processing, got %dms", output.ProcessingMillis)
+	}
+}
+
+func TestSendBulkEmailReportsServiceTime(t *testing.T) {
+	useSettings(t, Config{})
+
+	output, err := SendBulkEmail(context.Background(), slowClient(60*time.Millisecond), bulkEmail("a@example.com"))
+
+	if err != nil {
+		t.Fatal(err)
+	} else if output.ServiceMillis < 60 {
+		t.Errorf("expected about 60ms in SES, got %dms", output.ServiceMillis)
+	} else if output.ProcessingMillis >= 60 {
+		t.Errorf("expected time in SES not to count as processing, got %dms", output.ProcessingMillis)
+	}
+}
+
+func TestSendEmailReportsTemplateUsed(t *testing.T) {
+	const arn = "arn:aws:ses:us-east-1:123456789012:template/welcome"
+
+	for _, test := range []struct {
+		name     string
+		template *Template
+		expected string
+	}{
+		{"name", &Template{TemplateName: aws.String("welcome")}, "welcome"},
+		{"arn", &Template{TemplateArn: aws.String(arn)}, arn},
+		{"name and arn", &Template{TemplateName: aws.String("welcome"), TemplateArn: aws.String(arn)}, "welcome"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			useSettings(t, Config{})
+
+			input := templatedEmail("to@example.com", "")
+			input.Content.Template = test.template
+
+			if output, err := SendEmail(context.Background(), &fakeClient{}, input); err != nil {
+				t.Fatal(err)
+			} else if output.TemplateUsed != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, output.TemplateUsed)
+			}
+		})
+	}
+}
+
+func TestSendEmailReportsNoTemplateForSimpleEmails(t *testing.T) {
+	useSettings(t, Config{})
+
+	if output, err := SendEmail(context.Background(), &fakeClient{}, simpleEmail("to@example.com")); err != nil {
+		t.Fatal(err)
+	} else if output.TemplateUsed != "" {
+		t.Errorf("expected no template, got %q", output.TemplateUsed)
+	}
+}
+
+func TestSendBulkEmailReportsTemplateUsed(t *testing.T) {
+	const arn = "arn:aws:ses:us-east-1:123456789012:template/digest"
+
+	for _, test := range []struct {
+		name     string
+		content  *BulkEmailContent
+		expected string
+	}{
+		{"name", &BulkEmailContent{Template: &Template{TemplateName: aws.String("digest")}}, "digest"},
+		{"arn", &BulkEmailContent{Template: &Template{TemplateArn: aws.String(arn)}}, arn},
+		{"default", nil, "fallback"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			useSettings(t, Config{DefaultBulkTemplate: "fallback"})
+
+			input := bulkEmail("to@example.com")
+			input.DefaultContent = test.content
+
+			if output, err := SendBulkEmail(context.Background(), &fakeClient{}, input); err != nil {
+				t.Fatal(err)
+			} else if output.TemplateUsed != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, output.TemplateUsed)
+			}
+		})
+	}
+}
+
+func TestSendBulkEmailSendsFromTheFromAddress(t *testing.T) {
+	useSettings(t, Config{})
+
+	client := &fakeClient{}
+	input := bulkEmail("to@example.com")
+	input.FeedbackForwardingEmailAddress = aws.String("bounces@example.com")
+
+	if _, err := SendBulkEmail(context.Background(), client, input); err != nil {
+		t.Fatal(err)
+	}
+
+	sent := client.SentBulkEmails()[0]
+
+	if from := aws.ToString(sent.FromEmailAddress); from != "from@example.com" {
+		t.Errorf("expected from@example.com, got %q", from)
+	} else if feedback := aws.ToString(sent.FeedbackForwardingEmailAddress); feedback != "bounces@example.com" {
+		t.Errorf("expected bounces@example.com, got %q", feedback)
+	}
+}
+
+func TestOutputsReportRequestIdInsteadOfMetadata(t *testing.T) {
+	useSettings(t, Config{})
+
+	client := &fakeClient{
+		sendEmail: func(context.Context, *sesv2.SendEmailInput) (*sesv2.SendEmailOutput, error) {
+			output := &sesv2.SendEmailOutput{MessageId: aws.String("message-id")}
+			awsmiddleware.SetRequestIDMetadata(&output.ResultMetadata, "request-1")
+
+			return output, nil
+		},
+		sendBulkEmail: func(_ context.Context, params *sesv2.SendBulkEmailInput) (*sesv2.SendBulkEmailOutput, error) {
+			output := acceptBulkEmail(params)
+			awsmiddleware.SetRequestIDMetadata(&output.ResultMetadata, "request-1")
+
+			return output, nil
+		},
+	}
+
+	emailOutput, err := SendEmail(context.Background(), client, simpleEmail("to@example.com"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bulkOutput, err := SendBulkEmail(context.Background(), client, bulkEmail("to@example.com"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, output := range []interface{}{emailOutput, bulkOutput} {
+		encoded, err := json.Marshal(output)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var fields map[string]interface{}
+
+		if err := json.Unmarshal(encoded, &fields); err != nil {
+			t.Fatal(err)
+		} else if _, ok := fields["metaData"]; ok {
+			t.Errorf("expected no metadata object, got %s", encoded)
+		} else if fields["requestId"] != "request-1" {
+			t.Errorf("expected %q, got %v", "request-1", fields["requestId"])
+		}
+	}
+}
+
+func TestSendEmailsKeepsInputOrder(t *testing.T) {
+	useSettings(t, Config{MaxConcurrency: 4})
+
+	// Later emails finish first, so the results only line up if they're put back in order
+	client := &fakeClient{
+		sendEmail: func(_ context.Context, params *sesv2.SendEmailInput) (*sesv2.SendEmailOutput, error) {
+			recipient := params.Destination.ToAddresses[0]
+
+			if recipient == "fail@example.com" {
+				return nil, errors.New("rejected " + recipient)
+			}
+
+			time.Sleep(time.Duration(len(recipient)) * time.Millisecond)
+
+			return &sesv2.SendEmailOutput{MessageId: aws.String(recipient)}, nil
+		},
+	}
+
+	recipients := []string{"aaaaaaaaaaaaaaaa@example.com", "fail@example.com", "aaaaaaaa@example.com", "a@example.com"}
+	var inputs []*SendEmailInput
+
+	for _, recipient := range recipients {
+		inputs = append(inputs, simpleEmail(recipient))
+	}
+
+	outputs, errs := SendEmails(context.Background(), client, inputs)
+
+	if len(outputs) != 3 || len(errs) != 1 {
+		t.Fatalf("expected 3 outputs and 1 error, got %d and %d", len(outputs), len(errs))
+	}
+
+	for index, recipient := range []string{recipients[0], recipients[2], recipients[3]} {
+		if id := aws.ToString(outputs[index].MessageId); id != recipient {
+			t.Errorf("expected output %d to be for %s, got %s", index, recipient, id)
+		}
+	}
+}
+
+func TestSendEmailsCapsConcurrency(t *testing.T) {
+	for _, limit := range []int{1, 3} {
+		useSettings(t, Config{MaxConcurrency: limit})
+
+		client := newConcurrencyClient(20 * time.Millisecond)
+		var inputs []*SendEmailInput
+
+		for index := 0; index < 8; index++ {
+			inputs = append(inputs, simpleEmail("to@example.com"))
+		}
+
+		if outputs, errs := SendEmails(context.Background(), client, inputs); len(outputs) != 8 || len(errs) != 0 {
+			t.Fatalf("expected every email to be sent, got %d outputs and %v", len(outputs), errs)
+		} else if client.peak != limit {
+			t.Errorf("expected at most %d sends at once, got %d", limit, client.peak)
+		}
+	}
+}
+
+func TestSendBulkEmailChunksEntries(t *testing.T) {
+	for _, test := range []struct {
+		entries  int
+		requests []int
+	}{
+		{50, []int{50}},
+		{51, []int{50, 1}},
+		{120, []int{50, 50, 20}},
+	} {
+		t.Run(fmt.Sprint(test.entries), func(t *testing.T) {
+			useSettings(t, Config{})
+
+			client := &fakeClient{}
+			var recipients []string
+
+			for index := 0; index < test.entries; index++ {
+				recipients = append(recipients, fmt.Sprintf("user%d@example.com", index))
+			}
+
+			output, err := SendBulkEmail(context.Background(), client, bulkEmail(recipients...))
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var requests []int
+
+			for _, sent := range client.SentBulkEmails() {
+				requests = append(requests, len(sent.BulkEmailEntries))
+			}
+
+			if !reflect.DeepEqual(requests, test.requests) {
+				t.Errorf("expected requests of %v entries, got %v", test.requests, requests)
+			} else if len(output.BulkEmailEntryResults) != test.entries {
+				t.Fatalf("expected %d results, got %d", test.entries, len(output.BulkEmailEntryResults))
+			}
+
+			// Results stay in the order of the entries across chunks
+			for index, recipient := range recipients {
+				if id := aws.ToString(output.BulkEmailEntryResults[index].MessageId); id != "bulk-"+recipient {
+					t.Errorf("expected result %d to be for %s, got %s", index, recipient, id)
+				}
+			}
+		})
+	}
+}
+
+func TestSendBulkEmailReportsFailedChunks(t *testing.T) {
+	useSettings(t, Config{})
+
+	rejected := errors.New("rejected")
+	calls := 0
+	client := &fakeClient{sendBulkEmail: func(_ context.Context, params *sesv2.SendBulkEmailInput) (*sesv2.SendBulkEmailOutput, error) {
+		calls++
+
+		if calls == 2 {
+			return nil, rejected
+		}
+
+		return acceptBulkEmail(params), nil
+	}}
+
+	var recipients []string
+
+	for index := 0; index < 120; index++ {
+		recipients = append(recipients, fmt.Sprintf("user%d@example.com", index))
+	}
+
+	output, err := SendBulkEmail(context.Background(), client, bulkEmail(recipients...))
+
+	if !errors.Is(err, rejected) || !strings.Contains(err.Error(), "Entries 50 to 99") {
+		t.Errorf("expected the second chunk's error, got %v", err)
+	} else if output == nil || len(output.BulkEmailEntryResults) != 120 {
+		t.Fatalf("expected partial results for every entry, got %+v", output)
+	}
+
+	for index, result := range output.BulkEmailEntryResults {
+		failed := index >= 50 && index < 100
+
+		if (result.Status == BulkEmailStatus(types.BulkEmailStatusFailed)) != failed {
+			t.Errorf("expected entry %d failed to be %t, got %s", index, failed, result.Status)
+		}
+	}
+	if code := BulkResultCode(output, err); code != ResultPartial {
+		t.Errorf("expected %q, got %v", ResultPartial, code)
+	}
+}
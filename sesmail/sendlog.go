@@ -0,0 +1,127 @@
+// Structured JSON logs of the outcome of each send
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// The least severe send outcome which is logged
+type LogLevel string
+
+const (
+	// Don't log sends.
+	LogLevelOff LogLevel = ""
+
+	// Log every send.
+	LogLevelInfo LogLevel = "info"
+
+	// Only log failed sends.
+	LogLevelError LogLevel = "error"
+)
+
+// A line logged for a call to SendEmail or SendBulkEmail
+type SendLogEntry struct {
+
+	// Either info for an accepted send, or error for a failed one.
+	Level LogLevel `json:"level"`
+
+	// When the send finished.
+	Time time.Time `json:"time"`
+
+	// The SES operation, either SendEmail or SendBulkEmail.
+	Operation string `json:"operation"`
+
+	// The message IDs SES returned for the accepted emails.
+	MessageIds []string `json:"messageIds,omitempty"`
+
+	// How many To, CC, and BCC recipients the send had.
+	DestinationCount int `json:"destinationCount"`
+
+	// The recipients of the send, masked when LOG_REDACT_PII is set.
+	Recipients []string `json:"recipients"`
+
+	// The name of the configuration set the send used.
+	ConfigurationSetName *string `json:"configSetName,omitempty"`
+
+	// Milliseconds spent waiting on SES.
+	DurationMillis int64 `json:"durationMillis"`
+
+	// Why the send failed, with addresses masked when LOG_REDACT_PII is set.
+	Error string `json:"error,omitempty"`
+}
+
+// Where send logs are written. Lambda sends stdout to CloudWatch Logs.
+var SendLogOutput io.Writer = os.Stdout
+
+var sendLogMutex sync.Mutex
+
+// Matches an email address in an error message
+var emailAddressPattern = regexp.MustCompile(`[^\s<>"',;:()]+@[^\s<>"',;:()]+`)
+
+// Masks every email address in a message, such as an error
+func redactAddresses(message string) string {
+	return emailAddressPattern.ReplaceAllStringFunc(message, maskAddress)
+}
+
+// Returns an error's message for a log line, with addresses masked when LOG_REDACT_PII is set
+func LogSafeError(err error) string {
+	if err == nil {
+		return "<nil>"
+	} else if Settings.LogRedactPII {
+		return redactAddresses(err.Error())
+	}
+
+	return err.Error()
+}
+
+// Writes a send log entry if LOG_LEVEL includes its level, masking addresses when LOG_REDACT_PII is
+// set. An entry which can't be written is reported through the standard logger instead.
+func logSend(entry SendLogEntry, destinations []*Destination, err error) {
+	entry.Level = LogLevelInfo
+
+	if err != nil {
+		entry.Level = LogLevelError
+		entry.Error = err.Error()
+	}
+
+	if Settings.LogLevel == LogLevelOff || Settings.LogLevel == LogLevelError && err == nil {
+		return
+	}
+
+	entry.Time = time.Now()
+	entry.Recipients = []string{}
+
+	for _, destination := range destinations {
+		entry.Recipients = append(entry.Recipients, destinationAddresses(destination)...)
+	}
+
+	entry.DestinationCount = len(entry.Recipients)
+
+	if Settings.LogRedactPII {
+		entry.Recipients = maskAddresses(entry.Recipients)
+		entry.Error = redactAddresses(entry.Error)
+	}
+
+	encoded, marshalErr := json.Marshal(entry)
+
+	if marshalErr != nil {
+		log.Printf("failed to encode send log, %v", marshalErr)
+
+		return
+	}
+
+	sendLogMutex.Lock()
+	defer sendLogMutex.Unlock()
+
+	if _, writeErr := SendLogOutput.Write(append(encoded, '\n')); writeErr != nil {
+		log.Printf("failed to write send log, %v", writeErr)
+	}
+}
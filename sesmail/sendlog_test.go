@@ -0,0 +1,183 @@
+// Tests for structured JSON logs of the outcome of each send
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sesv2 "github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/smithy-go"
+)
+
+// Captures the send logs written during the test, returning a function which decodes them
+func captureSendLogs(t *testing.T) func() []SendLogEntry {
+	previous := SendLogOutput
+	buffer := &bytes.Buffer{}
+	SendLogOutput = buffer
+	t.Cleanup(func() { SendLogOutput = previous })
+
+	return func() []SendLogEntry {
+		var entries []SendLogEntry
+
+		for _, line := range strings.Split(strings.TrimSpace(buffer.String()), "\n") {
+			if line == "" {
+				continue
+			}
+
+			var entry SendLogEntry
+
+			if err := json.Unmarshal([]byte(line), &entry); err != nil {
+				t.Fatalf("expected a JSON line, got %q", line)
+			}
+
+			entries = append(entries, entry)
+		}
+
+		return entries
+	}
+}
+
+// Rejects emails to rejected@example.com, naming the address in the error
+func rejectingClient() *fakeClient {
+	return &fakeClient{sendEmail: func(ctx context.Context, params *sesv2.SendEmailInput) (*sesv2.SendEmailOutput, error) {
+		if params.Destination.ToAddresses[0] == "rejected@example.com" {
+			return nil, &smithy.GenericAPIError{Code: "MessageRejected", Message: "Address rejected@example.com is blocked"}
+		}
+
+		return &sesv2.SendEmailOutput{MessageId: aws.String("message-id")}, nil
+	}}
+}
+
+func TestSendEmailLogsOutcome(t *testing.T) {
+	useSettings(t, Config{LogLevel: LogLevelInfo})
+	logs := captureSendLogs(t)
+
+	input := simpleEmail("to@example.com")
+	input.Destination.CcAddresses = []string{"cc@example.com"}
+	input.ConfigurationSetName = aws.String("tracking")
+
+	if _, err := SendEmail(context.Background(), rejectingClient(), input); err != nil {
+		t.Fatal(err)
+	} else if _, err := SendEmail(context.Background(), rejectingClient(), simpleEmail("rejected@example.com")); err == nil {
+		t.Fatal("expected the email to be rejected")
+	}
+
+	entries := logs()
+
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 log lines, got %+v", entries)
+	}
+
+	accepted, failed := entries[0], entries[1]
+
+	if accepted.Level != LogLevelInfo || accepted.Operation != "SendEmail" || accepted.Error != "" {
+		t.Errorf("expected an info line for the accepted send, got %+v", accepted)
+	} else if !reflect.DeepEqual(accepted.MessageIds, []string{"message-id"}) || accepted.DestinationCount != 2 {
+		t.Errorf("expected the message ID and 2 recipients, got %+v", accepted)
+	} else if aws.ToString(accepted.ConfigurationSetName) != "tracking" || accepted.Time.IsZero() {
+		t.Errorf("expected the configuration set and time, got %+v", accepted)
+	}
+
+	if failed.Level != LogLevelError || failed.MessageIds != nil || !strings.Contains(failed.Error, "rejected@example.com is blocked") {
+		t.Errorf("expected an error line for the rejected send, got %+v", failed)
+	} else if !reflect.DeepEqual(failed.Recipients, []string{"rejected@example.com"}) {
+		t.Errorf("expected the recipient, got %v", failed.Recipients)
+	}
+}
+
+func TestSendEmailLogLevels(t *testing.T) {
+	for _, test := range []struct {
+		level    LogLevel
+		expected []LogLevel
+	}{
+		{LogLevelOff, nil},
+		{LogLevelError, []LogLevel{LogLevelError}},
+		{LogLevelInfo, []LogLevel{LogLevelInfo, LogLevelError}},
+	} {
+		t.Run(string(test.level), func(t *testing.T) {
+			useSettings(t, Config{LogLevel: test.level})
+			logs := captureSendLogs(t)
+
+			SendEmail(context.Background(), rejectingClient(), simpleEmail("to@example.com"))
+			SendEmail(context.Background(), rejectingClient(), simpleEmail("rejected@example.com"))
+
+			var levels []LogLevel
+
+			for _, entry := range logs() {
+				levels = append(levels, entry.Level)
+			}
+
+			if !reflect.DeepEqual(levels, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, levels)
+			}
+		})
+	}
+}
+
+func TestSendLogRedactsAddresses(t *testing.T) {
+	useSettings(t, Config{LogLevel: LogLevelInfo, LogRedactPII: true})
+	logs := captureSendLogs(t)
+
+	SendEmail(context.Background(), rejectingClient(), simpleEmail("rejected@example.com"))
+
+	entries := logs()
+
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 log line, got %+v", entries)
+	} else if !reflect.DeepEqual(entries[0].Recipients, []string{"r***@example.com"}) {
+		t.Errorf("expected the recipient to be masked, got %v", entries[0].Recipients)
+	} else if strings.Contains(entries[0].Error, "rejected@") || !strings.Contains(entries[0].Error, "r***@example.com") {
+		t.Errorf("expected the address in the error to be masked, got %q", entries[0].Error)
+	}
+}
+
+func TestLogSafeError(t *testing.T) {
+	err := errors.New("Recipient rejected@example.com is suppressed")
+
+	for _, test := range []struct {
+		name     string
+		redact   bool
+		err      error
+		expected string
+	}{
+		{"no error", true, nil, "<nil>"},
+		{"kept", false, err, "Recipient rejected@example.com is suppressed"},
+		{"redacted", true, err, "Recipient r***@example.com is suppressed"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			useSettings(t, Config{LogRedactPII: test.redact})
+
+			if message := LogSafeError(test.err); message != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, message)
+			}
+		})
+	}
+}
+
+func TestSendBulkEmailLogsOutcome(t *testing.T) {
+	useSettings(t, Config{LogLevel: LogLevelInfo})
+	logs := captureSendLogs(t)
+
+	if _, err := SendBulkEmail(context.Background(), &fakeClient{}, bulkEmail("a@example.com", "b@example.com")); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := logs()
+	expected := []string{"bulk-a@example.com", "bulk-b@example.com"}
+
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 log line, got %+v", entries)
+	} else if entries[0].Operation != "SendBulkEmail" || entries[0].DestinationCount != 2 {
+		t.Errorf("expected a bulk line with 2 recipients, got %+v", entries[0])
+	} else if !reflect.DeepEqual(entries[0].MessageIds, expected) {
+		t.Errorf("expected %v, got %v", expected, entries[0].MessageIds)
+	}
+}
@@ -0,0 +1,108 @@
+// Detection of attachments whose declared content type doesn't match their content
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// How attachments whose content doesn't match their declared type are handled
+type AttachmentSniffMode string
+
+const (
+	// Don't check attachment content.
+	AttachmentSniffIgnore AttachmentSniffMode = ""
+
+	// Send the email, but report mismatched attachments in the output.
+	AttachmentSniffWarn AttachmentSniffMode = "warn"
+
+	// Reject emails with mismatched attachments.
+	AttachmentSniffReject AttachmentSniffMode = "error"
+)
+
+// An attachment whose content looks like a different type than it was declared as
+type ContentTypeMismatch struct {
+
+	// The index of the attachment.
+	Index int `json:"index"`
+
+	// The name of the attachment.
+	Filename string `json:"filename"`
+
+	// The media type the attachment was declared as.
+	Declared string `json:"declared"`
+
+	// The media type detected from the attachment's content.
+	Detected string `json:"detected"`
+}
+
+func (mismatch ContentTypeMismatch) String() string {
+	return fmt.Sprintf(
+		"Attachment %d (%s) is declared as %s, but its content looks like %s",
+		mismatch.Index, mismatch.Filename, mismatch.Declared, mismatch.Detected,
+	)
+}
+
+// Finds attachments whose content doesn't match their declared type, when ATTACHMENT_SNIFF is set.
+// Returns an error for the first mismatch instead when mismatches are rejected.
+func sniffAttachments(attachments []Attachment) ([]ContentTypeMismatch, error) {
+	if Settings.AttachmentSniff == AttachmentSniffIgnore {
+		return nil, nil
+	}
+
+	var mismatches []ContentTypeMismatch
+
+	for index, attachment := range attachments {
+		declared, _, err := mime.ParseMediaType(attachment.ContentType)
+
+		if err != nil {
+			continue
+		}
+
+		detected, _, _ := mime.ParseMediaType(http.DetectContentType(attachment.Data))
+
+		if contentTypesMatch(declared, detected) {
+			continue
+		}
+
+		mismatch := ContentTypeMismatch{
+			Index:    index,
+			Filename: attachment.Filename,
+			Declared: declared,
+			Detected: detected,
+		}
+
+		if Settings.AttachmentSniff == AttachmentSniffReject {
+			return nil, fmt.Errorf("%s", mismatch)
+		}
+
+		mismatches = append(mismatches, mismatch)
+	}
+
+	return mismatches, nil
+}
+
+// Whether a detected content type is consistent with the declared one. Detection only recognises
+// a few types, so content it can't identify, plain text in a text based format, and zip archives
+// in a zip based format all match.
+func contentTypesMatch(declared string, detected string) bool {
+	switch {
+	case declared == detected, detected == "application/octet-stream":
+		return true
+	case detected == "text/plain":
+		return strings.HasPrefix(declared, "text/") ||
+			strings.HasSuffix(declared, "json") ||
+			strings.HasSuffix(declared, "xml")
+	case detected == "application/zip":
+		return strings.HasPrefix(declared, "application/vnd.openxmlformats-officedocument.") ||
+			strings.HasPrefix(declared, "application/vnd.oasis.opendocument.")
+	case detected == "text/xml":
+		return strings.HasSuffix(declared, "xml")
+	}
+
+	return false
+}
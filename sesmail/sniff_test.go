@@ -0,0 +1,96 @@
+// Tests for detecting attachments whose content doesn't match their declared type
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+var (
+	pdfData  = []byte("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	pngData  = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	zipData  = []byte("PK\x03\x04\x14\x00\x00\x00")
+	textData = []byte("Hello, world\n")
+)
+
+func TestSniffAttachments(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		contentType string
+		data        []byte
+		detected    string
+	}{
+		{"pdf", "application/pdf", pdfData, ""},
+		{"png", "image/png", pngData, ""},
+		{"text", "text/plain; charset=utf-8", textData, ""},
+		{"csv", "text/csv", textData, ""},
+		{"json", "application/json", []byte(`{"a":1}`), ""},
+		{"docx", "application/vnd.openxmlformats-officedocument.wordprocessingml.document", zipData, ""},
+		{"unrecognised content", "application/msword", []byte{0xd0, 0xcf, 0x11, 0xe0}, ""},
+		{"pdf declared as png", "image/png", pdfData, "application/pdf"},
+		{"png declared as pdf", "application/pdf", pngData, "image/png"},
+		{"text declared as pdf", "application/pdf", textData, "text/plain"},
+		{"zip declared as pdf", "application/pdf", zipData, "application/zip"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			useSettings(t, Config{AttachmentSniff: AttachmentSniffWarn})
+
+			mismatches, err := sniffAttachments([]Attachment{{Filename: "file", ContentType: test.contentType, Data: test.data}})
+
+			if err != nil {
+				t.Fatal(err)
+			} else if test.detected == "" && mismatches != nil {
+				t.Errorf("expected a match, got %+v", mismatches)
+			} else if test.detected != "" && (len(mismatches) != 1 || mismatches[0].Detected != test.detected) {
+				t.Errorf("expected %s to be detected, got %+v", test.detected, mismatches)
+			}
+		})
+	}
+}
+
+func TestSendEmailSniffsAttachments(t *testing.T) {
+	attachments := []Attachment{
+		{Filename: "report.pdf", ContentType: "application/pdf", Data: pdfData},
+		{Filename: "invoice.pdf", ContentType: "application/pdf", Data: pngData},
+	}
+	mismatch := ContentTypeMismatch{Index: 1, Filename: "invoice.pdf", Declared: "application/pdf", Detected: "image/png"}
+
+	for _, test := range []struct {
+		mode       AttachmentSniffMode
+		mismatches []ContentTypeMismatch
+		expected   string
+	}{
+		{AttachmentSniffIgnore, nil, ""},
+		{AttachmentSniffWarn, []ContentTypeMismatch{mismatch}, ""},
+		{AttachmentSniffReject, nil, mismatch.String()},
+	} {
+		t.Run(string(test.mode), func(t *testing.T) {
+			useSettings(t, Config{AllowedAttachmentTypes: defaultAllowedAttachmentTypes, AttachmentSniff: test.mode})
+
+			client := &fakeClient{}
+			input := simpleEmail("to@example.com")
+			input.Content.Attachments = attachments
+
+			output, err := SendEmail(context.Background(), client, input)
+
+			if test.expected != "" {
+				if err == nil || err.Error() != test.expected {
+					t.Errorf("expected %q, got %v", test.expected, err)
+				} else if len(client.SentEmails()) != 0 {
+					t.Errorf("expected nothing to be sent, got %d", len(client.SentEmails()))
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			} else if !reflect.DeepEqual(output.ContentTypeMismatches, test.mismatches) {
+				t.Errorf("expected %+v, got %+v", test.mismatches, output.ContentTypeMismatches)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+// Concurrent sending of emails with results streamed as they complete
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"sync"
+)
+
+// The outcome of sending one email from SendEmailsStream
+type SendResult struct {
+
+	// The index of the email in the inputs passed to SendEmailsStream.
+	Index int
+
+	// The output of the email, if SES accepted it.
+	Output *SendEmailOutput
+
+	// Why the email wasn't sent, if it wasn't.
+	Err error
+}
+
+// Sends emails concurrently, at most MaxConcurrency at a time, emitting each result as soon as it
+// completes. Results arrive in completion order, so use SendResult.Index to match them to inputs.
+// The channel is closed once every email has a result.
+func SendEmailsStream(ctx context.Context, client Client, inputs []*SendEmailInput) <-chan SendResult {
+	results := make(chan SendResult, len(inputs))
+	indices := make(chan int)
+	workers := Settings.MaxConcurrency
+
+	if workers <= 0 {
+		workers = 1
+	}
+
+	var group sync.WaitGroup
+
+	for worker := 0; worker < workers; worker++ {
+		group.Add(1)
+
+		go func() {
+			defer group.Done()
+
+			for index := range indices {
+				output, err := SendEmail(ctx, client, inputs[index])
+				results <- SendResult{Index: index, Output: output, Err: err}
+			}
+		}()
+	}
+
+	go func() {
+		for index := range inputs {
+			indices <- index
+		}
+
+		close(indices)
+		group.Wait()
+		close(results)
+	}()
+
+	return results
+}
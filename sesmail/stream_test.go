@@ -0,0 +1,88 @@
+// Tests for streaming the results of concurrent sends
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sesv2 "github.com/aws/aws-sdk-go-v2/service/sesv2"
+)
+
+func TestSendEmailsStreamEmitsEveryResult(t *testing.T) {
+	useSettings(t, Config{MaxConcurrency: 8})
+
+	// Answers with the recipient as the message ID, sleeping so results complete out of order
+	client := &fakeClient{sendEmail: func(_ context.Context, params *sesv2.SendEmailInput) (*sesv2.SendEmailOutput, error) {
+		recipient := params.Destination.ToAddresses[0]
+		time.Sleep(time.Duration(len(recipient)%5) * time.Millisecond)
+
+		return &sesv2.SendEmailOutput{MessageId: aws.String(recipient)}, nil
+	}}
+
+	var inputs []*SendEmailInput
+
+	for index := 0; index < 100; index++ {
+		if index%10 == 3 {
+			inputs = append(inputs, &SendEmailInput{Content: &EmailContent{}})
+		} else {
+			inputs = append(inputs, simpleEmail(fmt.Sprintf("%d%s@example.com", index, "abcd"[:index%4])))
+		}
+	}
+
+	seen := make(map[int]bool)
+
+	for result := range SendEmailsStream(context.Background(), client, inputs) {
+		if seen[result.Index] {
+			t.Fatalf("result %d was emitted twice", result.Index)
+		}
+
+		seen[result.Index] = true
+
+		if result.Index%10 == 3 {
+			if result.Err == nil {
+				t.Errorf("expected result %d to fail", result.Index)
+			}
+		} else if result.Err != nil {
+			t.Errorf("expected result %d to succeed, got %v", result.Index, result.Err)
+		} else if expected := inputs[result.Index].Destination.ToAddresses[0]; *result.Output.MessageId != expected {
+			t.Errorf("expected result %d to be for %s, got %s", result.Index, expected, *result.Output.MessageId)
+		}
+	}
+
+	if len(seen) != len(inputs) {
+		t.Errorf("expected %d results, got %d", len(inputs), len(seen))
+	}
+}
+
+func TestSendEmailsStreamWithoutEmails(t *testing.T) {
+	useSettings(t, Config{MaxConcurrency: 4})
+
+	for result := range SendEmailsStream(context.Background(), &fakeClient{}, nil) {
+		t.Errorf("expected no results, got %+v", result)
+	}
+}
+
+func TestSendEmailsStreamWithNilEmail(t *testing.T) {
+	useSettings(t, Config{MaxConcurrency: 2})
+
+	client := &fakeClient{}
+	inputs := []*SendEmailInput{nil, simpleEmail("to@example.com")}
+	results := make(map[int]SendResult)
+
+	for result := range SendEmailsStream(context.Background(), client, inputs) {
+		results[result.Index] = result
+	}
+
+	if err := results[0].Err; err == nil || err.Error() != "Email is required" {
+		t.Errorf("expected the nil email to be required, got %v", err)
+	} else if results[1].Err != nil || results[1].Output == nil {
+		t.Errorf("expected the valid email to be sent, got %+v", results[1])
+	} else if len(client.SentEmails()) != 1 {
+		t.Errorf("expected 1 email to be sent, got %d", len(client.SentEmails()))
+	}
+}
@@ -0,0 +1,234 @@
+// Detection of recipients on the account suppression list
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sesv2 "github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+)
+
+// A recipient on the account suppression list, which SES will likely not deliver to
+type SuppressedRecipient struct {
+
+	// The suppressed email address.
+	EmailAddress string `json:"address"`
+
+	// Why the address was suppressed, either BOUNCE or COMPLAINT.
+	Reason string `json:"reason"`
+
+	// When the address was added to the suppression list. Only set when managing the list.
+	LastUpdateTime *time.Time `json:"lastUpdateTime,omitempty"`
+}
+
+// Looks up every recipient of a destination on the account suppression list when
+// CHECK_SUPPRESSION_LIST is enabled. Lookups which fail are logged and skipped.
+func findSuppressedRecipients(ctx context.Context, client Client, destination *Destination) []SuppressedRecipient {
+	if !Settings.CheckSuppressionList {
+		return nil
+	}
+
+	var suppressed []SuppressedRecipient
+
+	for _, addresses := range [][]string{
+		destination.ToAddresses, destination.CcAddresses, destination.BccAddresses,
+	} {
+		for _, address := range addresses {
+			output, err := client.GetSuppressedDestination(ctx, &sesv2.GetSuppressedDestinationInput{
+				EmailAddress: aws.String(address),
+			})
+
+			var notFound *types.NotFoundException
+
+			if errors.As(err, &notFound) {
+				continue
+			} else if err != nil {
+				log.Printf("failed to check suppression list, %v", err)
+
+				continue
+			}
+
+			if output.SuppressedDestination != nil {
+				suppressed = append(suppressed, SuppressedRecipient{
+					EmailAddress: address,
+					Reason:       string(output.SuppressedDestination.Reason),
+				})
+			}
+		}
+	}
+
+	return suppressed
+}
+
+// What to do with the account suppression list
+type SuppressionAction string
+
+const (
+	// Add an address to the list.
+	SuppressionPut SuppressionAction = "put"
+
+	// Remove an address from the list.
+	SuppressionDelete SuppressionAction = "delete"
+
+	// Look up whether an address is on the list.
+	SuppressionGet SuppressionAction = "get"
+
+	// List the addresses on the list, a page at a time.
+	SuppressionList SuppressionAction = "list"
+)
+
+// An address to add to, remove from, or look up on the account suppression list, or a filter to
+// list it with
+type SuppressionInput struct {
+
+	// The address to add, remove, or look up. Required unless listing.
+	EmailAddress *string `json:"address"`
+
+	// Why the address is added, either BOUNCE or COMPLAINT. Required when adding an address.
+	Reason string `json:"reason"`
+
+	// Only list addresses suppressed for these reasons, BOUNCE or COMPLAINT. Lists every address
+	// when empty.
+	Reasons []string `json:"reasons"`
+
+	// The token of the page to list, from the previous page's output.
+	NextToken *string `json:"nextToken"`
+
+	// The most addresses to list in a page.
+	PageSize *int32 `json:"pageSize"`
+}
+
+// The suppressed addresses which were looked up or listed
+type SuppressionOutput struct {
+
+	// The addresses found on the list. Empty when looking up an address which isn't suppressed.
+	Recipients []SuppressedRecipient `json:"recipients"`
+
+	// The token of the next page, if there are more addresses to list.
+	NextToken *string `json:"nextToken,omitempty"`
+}
+
+func isKnownSuppressionReason(reason types.SuppressionListReason) bool {
+	for _, known := range reason.Values() {
+		if reason == known {
+			return true
+		}
+	}
+
+	return false
+}
+
+func validateSuppressionInput(action SuppressionAction, input *SuppressionInput) error {
+	switch action {
+	case SuppressionPut, SuppressionDelete, SuppressionGet:
+		if aws.ToString(input.EmailAddress) == "" {
+			return errors.New("Suppressed address is required")
+		}
+	case SuppressionList:
+	default:
+		return fmt.Errorf("Unknown suppression action %q, expected put, delete, get, or list", action)
+	}
+
+	if action == SuppressionPut && !isKnownSuppressionReason(types.SuppressionListReason(input.Reason)) {
+		return fmt.Errorf("Unknown suppression reason %q, expected BOUNCE or COMPLAINT", input.Reason)
+	}
+
+	for _, reason := range input.Reasons {
+		if !isKnownSuppressionReason(types.SuppressionListReason(reason)) {
+			return fmt.Errorf("Unknown suppression reason %q, expected BOUNCE or COMPLAINT", reason)
+		}
+	}
+
+	return nil
+}
+
+// Adds an address to, removes an address from, looks up an address on, or lists the account
+// suppression list. Only looking up and listing addresses have an output. Looking up an address
+// which isn't suppressed isn't an error.
+func ManageSuppression(
+	ctx context.Context,
+	client Client,
+	action SuppressionAction,
+	input *SuppressionInput,
+) (*SuppressionOutput, error) {
+	if err := validateSuppressionInput(action, input); err != nil {
+		return nil, invalidInput(err)
+	}
+
+	switch action {
+	case SuppressionPut:
+		_, err := client.PutSuppressedDestination(ctx, &sesv2.PutSuppressedDestinationInput{
+			EmailAddress: input.EmailAddress,
+			Reason:       types.SuppressionListReason(input.Reason),
+		})
+
+		return nil, err
+	case SuppressionDelete:
+		_, err := client.DeleteSuppressedDestination(ctx, &sesv2.DeleteSuppressedDestinationInput{
+			EmailAddress: input.EmailAddress,
+		})
+
+		return nil, err
+	case SuppressionGet:
+		output, err := client.GetSuppressedDestination(ctx, &sesv2.GetSuppressedDestinationInput{
+			EmailAddress: input.EmailAddress,
+		})
+
+		var notFound *types.NotFoundException
+
+		if errors.As(err, &notFound) {
+			return &SuppressionOutput{Recipients: []SuppressedRecipient{}}, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		suppressionOutput := &SuppressionOutput{Recipients: []SuppressedRecipient{}}
+
+		if destination := output.SuppressedDestination; destination != nil {
+			suppressionOutput.Recipients = append(suppressionOutput.Recipients, SuppressedRecipient{
+				EmailAddress:   aws.ToString(destination.EmailAddress),
+				Reason:         string(destination.Reason),
+				LastUpdateTime: destination.LastUpdateTime,
+			})
+		}
+
+		return suppressionOutput, nil
+	}
+
+	listInput := &sesv2.ListSuppressedDestinationsInput{
+		NextToken: input.NextToken,
+		PageSize:  input.PageSize,
+	}
+
+	for _, reason := range input.Reasons {
+		listInput.Reasons = append(listInput.Reasons, types.SuppressionListReason(reason))
+	}
+
+	output, err := client.ListSuppressedDestinations(ctx, listInput)
+
+	if err != nil {
+		return nil, err
+	}
+
+	suppressionOutput := &SuppressionOutput{
+		Recipients: []SuppressedRecipient{},
+		NextToken:  output.NextToken,
+	}
+
+	for _, summary := range output.SuppressedDestinationSummaries {
+		suppressionOutput.Recipients = append(suppressionOutput.Recipients, SuppressedRecipient{
+			EmailAddress:   aws.ToString(summary.EmailAddress),
+			Reason:         string(summary.Reason),
+			LastUpdateTime: summary.LastUpdateTime,
+		})
+	}
+
+	return suppressionOutput, nil
+}
@@ -0,0 +1,327 @@
+// Tests for detecting recipients on and managing the account suppression list
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sesv2 "github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+)
+
+// Keeps the suppression list of a fakeClient up to date with the addresses put on and deleted from
+// it, listing them in alphabetical order
+type suppressionClient struct {
+	fakeClient
+
+	lists []*sesv2.ListSuppressedDestinationsInput
+}
+
+func (client *suppressionClient) PutSuppressedDestination(
+	ctx context.Context,
+	params *sesv2.PutSuppressedDestinationInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.PutSuppressedDestinationOutput, error) {
+	client.suppressed[aws.ToString(params.EmailAddress)] = params.Reason
+
+	return &sesv2.PutSuppressedDestinationOutput{}, nil
+}
+
+func (client *suppressionClient) DeleteSuppressedDestination(
+	ctx context.Context,
+	params *sesv2.DeleteSuppressedDestinationInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.DeleteSuppressedDestinationOutput, error) {
+	if _, ok := client.suppressed[aws.ToString(params.EmailAddress)]; !ok {
+		return nil, &types.NotFoundException{Message: aws.String("Email address is not on the suppression list")}
+	}
+
+	delete(client.suppressed, aws.ToString(params.EmailAddress))
+
+	return &sesv2.DeleteSuppressedDestinationOutput{}, nil
+}
+
+func (client *suppressionClient) ListSuppressedDestinations(
+	ctx context.Context,
+	params *sesv2.ListSuppressedDestinationsInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.ListSuppressedDestinationsOutput, error) {
+	client.lists = append(client.lists, params)
+
+	var addresses []string
+
+	for address, reason := range client.suppressed {
+		matches := len(params.Reasons) == 0
+
+		for _, filter := range params.Reasons {
+			matches = matches || filter == reason
+		}
+
+		if matches {
+			addresses = append(addresses, address)
+		}
+	}
+
+	sort.Strings(addresses)
+
+	start, _ := strconv.Atoi(aws.ToString(params.NextToken))
+	end := len(addresses)
+	output := &sesv2.ListSuppressedDestinationsOutput{}
+
+	if params.PageSize != nil && start+int(*params.PageSize) < end {
+		end = start + int(*params.PageSize)
+		output.NextToken = aws.String(strconv.Itoa(end))
+	}
+
+	for _, address := range addresses[start:end] {
+		output.SuppressedDestinationSummaries = append(output.SuppressedDestinationSummaries, types.SuppressedDestinationSummary{
+			EmailAddress: aws.String(address),
+			Reason:       client.suppressed[address],
+		})
+	}
+
+	return output, nil
+}
+
+func newSuppressionClient() *suppressionClient {
+	return &suppressionClient{fakeClient: fakeClient{suppressed: map[string]types.SuppressionListReason{
+		"bounced@example.com":    types.SuppressionListReasonBounce,
+		"complained@example.com": types.SuppressionListReasonComplaint,
+	}}}
+}
+
+func TestSendEmailReportsSuppressedRecipients(t *testing.T) {
+	useSettings(t, Config{CheckSuppressionList: true})
+
+	client := &fakeClient{suppressed: map[string]types.SuppressionListReason{
+		"bounced@example.com":    types.SuppressionListReasonBounce,
+		"complained@example.com": types.SuppressionListReasonComplaint,
+	}}
+	input := simpleEmail("bounced@example.com")
+	input.Destination.CcAddresses = []string{"a@example.com"}
+	input.Destination.BccAddresses = []string{"complained@example.com"}
+
+	output, err := SendEmail(context.Background(), client, input)
+
+	expected := []SuppressedRecipient{
+		{EmailAddress: "bounced@example.com", Reason: "BOUNCE"},
+		{EmailAddress: "complained@example.com", Reason: "COMPLAINT"},
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(output.SuppressedRecipients, expected) {
+		t.Errorf("expected %+v, got %+v", expected, output.SuppressedRecipients)
+	}
+}
+
+func TestSendEmailWithoutSuppressedRecipients(t *testing.T) {
+	useSettings(t, Config{CheckSuppressionList: true})
+
+	client := &fakeClient{suppressed: map[string]types.SuppressionListReason{
+		"bounced@example.com": types.SuppressionListReasonBounce,
+	}}
+	output, err := SendEmail(context.Background(), client, simpleEmail("a@example.com"))
+
+	if err != nil {
+		t.Fatal(err)
+	} else if output.SuppressedRecipients != nil {
+		t.Errorf("expected no suppressed recipients, got %+v", output.SuppressedRecipients)
+	}
+}
+
+func TestSendBulkEmailReportsSuppressedRecipients(t *testing.T) {
+	useSettings(t, Config{CheckSuppressionList: true})
+
+	client := &fakeClient{suppressed: map[string]types.SuppressionListReason{
+		"bounced@example.com": types.SuppressionListReasonBounce,
+	}}
+	output, err := SendBulkEmail(context.Background(), client, bulkEmail("a@example.com", "bounced@example.com"))
+
+	expected := []SuppressedRecipient{{EmailAddress: "bounced@example.com", Reason: "BOUNCE"}}
+
+	if err != nil {
+		t.Fatal(err)
+	} else if results := output.BulkEmailEntryResults; results[0].SuppressedRecipients != nil {
+		t.Errorf("expected no suppressed recipients in the first entry, got %+v", results[0].SuppressedRecipients)
+	} else if !reflect.DeepEqual(results[1].SuppressedRecipients, expected) {
+		t.Errorf("expected %+v, got %+v", expected, results[1].SuppressedRecipients)
+	}
+}
+
+func TestSendEmailsReportsSuppressedRecipientsWhenBatched(t *testing.T) {
+	useSettings(t, Config{CheckSuppressionList: true, BatchTemplatedEmails: true})
+
+	client := &fakeClient{suppressed: map[string]types.SuppressionListReason{
+		"complained@example.com": types.SuppressionListReasonComplaint,
+	}}
+	outputs, errs := SendEmails(context.Background(), client, []*SendEmailInput{
+		templatedEmail("complained@example.com", "welcome"),
+		templatedEmail("a@example.com", "welcome"),
+	})
+
+	expected := []SuppressedRecipient{{EmailAddress: "complained@example.com", Reason: "COMPLAINT"}}
+
+	if len(errs) != 0 || len(outputs) != 2 {
+		t.Fatalf("expected 2 outputs, got %d and errors %v", len(outputs), errs)
+	} else if len(client.SentBulkEmails()) != 1 {
+		t.Fatal("expected the emails to be sent as a bulk email")
+	} else if !reflect.DeepEqual(outputs[0].SuppressedRecipients, expected) {
+		t.Errorf("expected %+v, got %+v", expected, outputs[0].SuppressedRecipients)
+	} else if outputs[1].SuppressedRecipients != nil {
+		t.Errorf("expected no suppressed recipients, got %+v", outputs[1].SuppressedRecipients)
+	}
+}
+
+func TestSuppressionListNotCheckedByDefault(t *testing.T) {
+	useSettings(t, Config{})
+
+	client := &fakeClient{suppressed: map[string]types.SuppressionListReason{
+		"bounced@example.com": types.SuppressionListReasonBounce,
+	}}
+	output, err := SendEmail(context.Background(), client, simpleEmail("bounced@example.com"))
+
+	if err != nil {
+		t.Fatal(err)
+	} else if output.SuppressedRecipients != nil {
+		t.Errorf("expected the suppression list not to be checked, got %+v", output.SuppressedRecipients)
+	}
+}
+
+func TestManageSuppressionPutAndDelete(t *testing.T) {
+	client := newSuppressionClient()
+	address := aws.String("new@example.com")
+
+	if output, err := ManageSuppression(context.Background(), client, SuppressionPut, &SuppressionInput{
+		EmailAddress: address,
+		Reason:       "BOUNCE",
+	}); err != nil || output != nil {
+		t.Fatalf("expected the address to be added without an output, got %+v and %v", output, err)
+	} else if reason := client.suppressed["new@example.com"]; reason != types.SuppressionListReasonBounce {
+		t.Errorf("expected the address to be suppressed for BOUNCE, got %q", reason)
+	}
+
+	output, err := ManageSuppression(context.Background(), client, SuppressionGet, &SuppressionInput{EmailAddress: address})
+	expected := []SuppressedRecipient{{EmailAddress: "new@example.com", Reason: "BOUNCE"}}
+
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(output.Recipients, expected) {
+		t.Errorf("expected %+v, got %+v", expected, output.Recipients)
+	}
+
+	if _, err := ManageSuppression(context.Background(), client, SuppressionDelete, &SuppressionInput{EmailAddress: address}); err != nil {
+		t.Fatal(err)
+	} else if _, ok := client.suppressed["new@example.com"]; ok {
+		t.Error("expected the address to be removed")
+	}
+
+	output, err = ManageSuppression(context.Background(), client, SuppressionGet, &SuppressionInput{EmailAddress: address})
+
+	if err != nil {
+		t.Fatal(err)
+	} else if output.Recipients == nil || len(output.Recipients) != 0 {
+		t.Errorf("expected no recipients for a removed address, got %+v", output.Recipients)
+	}
+
+	if _, err := ManageSuppression(context.Background(), client, SuppressionDelete, &SuppressionInput{EmailAddress: address}); err == nil {
+		t.Error("expected removing an address which isn't suppressed to fail")
+	}
+}
+
+func TestManageSuppressionList(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		reasons  []string
+		expected []SuppressedRecipient
+	}{
+		{
+			"every reason",
+			nil,
+			[]SuppressedRecipient{
+				{EmailAddress: "bounced@example.com", Reason: "BOUNCE"},
+				{EmailAddress: "complained@example.com", Reason: "COMPLAINT"},
+			},
+		},
+		{"bounces", []string{"BOUNCE"}, []SuppressedRecipient{{EmailAddress: "bounced@example.com", Reason: "BOUNCE"}}},
+		{"complaints", []string{"COMPLAINT"}, []SuppressedRecipient{{EmailAddress: "complained@example.com", Reason: "COMPLAINT"}}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			client := newSuppressionClient()
+			output, err := ManageSuppression(context.Background(), client, SuppressionList, &SuppressionInput{Reasons: test.reasons})
+
+			if err != nil {
+				t.Fatal(err)
+			} else if !reflect.DeepEqual(output.Recipients, test.expected) {
+				t.Errorf("expected %+v, got %+v", test.expected, output.Recipients)
+			} else if output.NextToken != nil {
+				t.Errorf("expected a single page, got next token %q", *output.NextToken)
+			}
+		})
+	}
+}
+
+func TestManageSuppressionListPages(t *testing.T) {
+	client := newSuppressionClient()
+	input := &SuppressionInput{PageSize: aws.Int32(1)}
+	var listed []string
+
+	for page := 0; page < 3; page++ {
+		output, err := ManageSuppression(context.Background(), client, SuppressionList, input)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, recipient := range output.Recipients {
+			listed = append(listed, recipient.EmailAddress)
+		}
+
+		if output.NextToken == nil {
+			break
+		}
+
+		input.NextToken = output.NextToken
+	}
+
+	if expected := []string{"bounced@example.com", "complained@example.com"}; !reflect.DeepEqual(listed, expected) {
+		t.Errorf("expected %v, got %v", expected, listed)
+	} else if len(client.lists) != 2 || aws.ToInt32(client.lists[0].PageSize) != 1 {
+		t.Errorf("expected 2 pages of 1 address, got %d lists", len(client.lists))
+	}
+}
+
+func TestManageSuppressionValidatesInput(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		action   SuppressionAction
+		input    *SuppressionInput
+		expected string
+	}{
+		{"no address", SuppressionDelete, &SuppressionInput{}, "Suppressed address is required"},
+		{
+			"unknown reason",
+			SuppressionPut,
+			&SuppressionInput{EmailAddress: aws.String("a@example.com"), Reason: "SPAM"},
+			`Unknown suppression reason "SPAM", expected BOUNCE or COMPLAINT`,
+		},
+		{"unknown filter", SuppressionList, &SuppressionInput{Reasons: []string{"BOUNCE", "spam"}}, `Unknown suppression reason "spam", expected BOUNCE or COMPLAINT`},
+		{"unknown action", "clear", &SuppressionInput{}, `Unknown suppression action "clear", expected put, delete, get, or list`},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			client := newSuppressionClient()
+
+			if _, err := ManageSuppression(context.Background(), client, test.action, test.input); err == nil || err.Error() != test.expected {
+				t.Errorf("expected %q, got %v", test.expected, err)
+			} else if len(client.suppressed) != 2 || len(client.lists) != 0 {
+				t.Error("expected an invalid input not to reach SES")
+			}
+		})
+	}
+}
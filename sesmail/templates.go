@@ -0,0 +1,109 @@
+// Management of SES email templates
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sesv2 "github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+)
+
+// What to do with a template
+type TemplateAction string
+
+const (
+	// Create a template which doesn't exist yet.
+	TemplateCreate TemplateAction = "create"
+
+	// Replace the content of an existing template.
+	TemplateUpdate TemplateAction = "update"
+
+	// Delete an existing template.
+	TemplateDelete TemplateAction = "delete"
+)
+
+// The content of a template to create or update, or the name of a template to delete
+type TemplateInput struct {
+
+	// The name of the template.
+	//
+	// This member is required.
+	TemplateName *string `json:"name"`
+
+	// The subject line of the email, which may contain replacement tags such as {{name}}.
+	Subject *string `json:"subject"`
+
+	// The HTML body of the email.
+	Html *string `json:"html"`
+
+	// The body of the email for recipients whose email clients don't display HTML.
+	Text *string `json:"text"`
+}
+
+func validateTemplateInput(action TemplateAction, input *TemplateInput) error {
+	if aws.ToString(input.TemplateName) == "" {
+		return errors.New("Template name is required")
+	}
+
+	switch action {
+	case TemplateCreate, TemplateUpdate:
+		if aws.ToString(input.Subject) == "" {
+			return errors.New("Template subject is required")
+		} else if aws.ToString(input.Html) == "" && aws.ToString(input.Text) == "" {
+			return errors.New("Template needs an HTML or text part")
+		}
+	case TemplateDelete:
+	default:
+		return fmt.Errorf("Unknown template action %q, expected create, update, or delete", action)
+	}
+
+	return nil
+}
+
+func templateContent(input *TemplateInput) *types.EmailTemplateContent {
+	return &types.EmailTemplateContent{
+		Subject: input.Subject,
+		Html:    input.Html,
+		Text:    input.Text,
+	}
+}
+
+// Creates, updates, or deletes a template. Sends looking up the template afterwards see the change,
+// rather than content cached before it.
+func ManageTemplate(ctx context.Context, client Client, action TemplateAction, input *TemplateInput) error {
+	if err := validateTemplateInput(action, input); err != nil {
+		return invalidInput(err)
+	}
+
+	var err error
+
+	switch action {
+	case TemplateCreate:
+		_, err = client.CreateEmailTemplate(ctx, &sesv2.CreateEmailTemplateInput{
+			TemplateContent: templateContent(input),
+			TemplateName:    input.TemplateName,
+		})
+	case TemplateUpdate:
+		_, err = client.UpdateEmailTemplate(ctx, &sesv2.UpdateEmailTemplateInput{
+			TemplateContent: templateContent(input),
+			TemplateName:    input.TemplateName,
+		})
+	case TemplateDelete:
+		_, err = client.DeleteEmailTemplate(ctx, &sesv2.DeleteEmailTemplateInput{
+			TemplateName: input.TemplateName,
+		})
+	}
+
+	if err == nil {
+		templateCache.Lock()
+		delete(templateCache.content, *input.TemplateName)
+		templateCache.Unlock()
+	}
+
+	return templateNotFound(err, &types.Template{TemplateName: input.TemplateName})
+}
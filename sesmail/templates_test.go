@@ -0,0 +1,170 @@
+// Tests for management of SES email templates
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sesv2 "github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+)
+
+// Records the template operations it receives, failing each with err if it is set
+type templateClient struct {
+	fakeClient
+
+	err     error
+	created []*sesv2.CreateEmailTemplateInput
+	updated []*sesv2.UpdateEmailTemplateInput
+	deleted []*sesv2.DeleteEmailTemplateInput
+}
+
+func (client *templateClient) CreateEmailTemplate(
+	ctx context.Context,
+	params *sesv2.CreateEmailTemplateInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.CreateEmailTemplateOutput, error) {
+	client.created = append(client.created, params)
+
+	return &sesv2.CreateEmailTemplateOutput{}, client.err
+}
+
+func (client *templateClient) UpdateEmailTemplate(
+	ctx context.Context,
+	params *sesv2.UpdateEmailTemplateInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.UpdateEmailTemplateOutput, error) {
+	client.updated = append(client.updated, params)
+
+	return &sesv2.UpdateEmailTemplateOutput{}, client.err
+}
+
+func (client *templateClient) DeleteEmailTemplate(
+	ctx context.Context,
+	params *sesv2.DeleteEmailTemplateInput,
+	optFns ...func(*sesv2.Options),
+) (*sesv2.DeleteEmailTemplateOutput, error) {
+	client.deleted = append(client.deleted, params)
+
+	return &sesv2.DeleteEmailTemplateOutput{}, client.err
+}
+
+func welcomeTemplate() *TemplateInput {
+	return &TemplateInput{
+		TemplateName: aws.String("welcome"),
+		Subject:      aws.String("Welcome, {{name}}"),
+		Html:         aws.String("<p>Hi {{name}}</p>"),
+		Text:         aws.String("Hi {{name}}"),
+	}
+}
+
+func TestManageTemplate(t *testing.T) {
+	content := &types.EmailTemplateContent{
+		Subject: aws.String("Welcome, {{name}}"),
+		Html:    aws.String("<p>Hi {{name}}</p>"),
+		Text:    aws.String("Hi {{name}}"),
+	}
+
+	t.Run("create", func(t *testing.T) {
+		client := &templateClient{}
+
+		if err := ManageTemplate(context.Background(), client, TemplateCreate, welcomeTemplate()); err != nil {
+			t.Fatal(err)
+		} else if len(client.created) != 1 || len(client.updated)+len(client.deleted) != 0 {
+			t.Fatalf("expected only a create, got %d, %d, and %d calls", len(client.created), len(client.updated), len(client.deleted))
+		} else if sent := client.created[0]; aws.ToString(sent.TemplateName) != "welcome" || !reflect.DeepEqual(sent.TemplateContent, content) {
+			t.Errorf("expected the welcome template, got %+v", sent.TemplateContent)
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		client := &templateClient{}
+
+		if err := ManageTemplate(context.Background(), client, TemplateUpdate, welcomeTemplate()); err != nil {
+			t.Fatal(err)
+		} else if len(client.updated) != 1 || len(client.created)+len(client.deleted) != 0 {
+			t.Fatalf("expected only an update, got %d, %d, and %d calls", len(client.created), len(client.updated), len(client.deleted))
+		} else if sent := client.updated[0]; aws.ToString(sent.TemplateName) != "welcome" || !reflect.DeepEqual(sent.TemplateContent, content) {
+			t.Errorf("expected the welcome template, got %+v", sent.TemplateContent)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		client := &templateClient{}
+
+		if err := ManageTemplate(context.Background(), client, TemplateDelete, &TemplateInput{TemplateName: aws.String("welcome")}); err != nil {
+			t.Fatal(err)
+		} else if len(client.deleted) != 1 || len(client.created)+len(client.updated) != 0 {
+			t.Fatalf("expected only a delete, got %d, %d, and %d calls", len(client.created), len(client.updated), len(client.deleted))
+		} else if name := aws.ToString(client.deleted[0].TemplateName); name != "welcome" {
+			t.Errorf("expected the welcome template to be deleted, got %q", name)
+		}
+	})
+}
+
+func TestManageTemplateValidatesInput(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		action   TemplateAction
+		input    *TemplateInput
+		expected string
+	}{
+		{"no name", TemplateDelete, &TemplateInput{}, "Template name is required"},
+		{"no subject", TemplateCreate, &TemplateInput{TemplateName: aws.String("welcome"), Text: aws.String("Hi")}, "Template subject is required"},
+		{
+			"no body",
+			TemplateUpdate,
+			&TemplateInput{TemplateName: aws.String("welcome"), Subject: aws.String("Welcome")},
+			"Template needs an HTML or text part",
+		},
+		{"unknown action", "rename", welcomeTemplate(), `Unknown template action "rename", expected create, update, or delete`},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			client := &templateClient{}
+			err := ManageTemplate(context.Background(), client, test.action, test.input)
+
+			if err == nil || err.Error() != test.expected {
+				t.Errorf("expected %q, got %v", test.expected, err)
+			} else if len(client.created)+len(client.updated)+len(client.deleted) != 0 {
+				t.Error("expected an invalid template not to reach SES")
+			}
+		})
+	}
+}
+
+func TestManageTemplateReportsMissingTemplate(t *testing.T) {
+	client := &templateClient{err: &types.NotFoundException{Message: aws.String("Template welcome does not exist.")}}
+	err := ManageTemplate(context.Background(), client, TemplateDelete, &TemplateInput{TemplateName: aws.String("welcome")})
+
+	var notFound *ErrTemplateNotFound
+
+	if !errors.As(err, &notFound) || notFound.Name != "welcome" {
+		t.Errorf("expected the welcome template not to be found, got %v", err)
+	}
+}
+
+func TestManageTemplateClearsCachedContent(t *testing.T) {
+	useSettings(t, Config{CheckTemplateText: true})
+	useTemplateCache(t)
+
+	client := &templateClient{fakeClient: fakeClient{templates: map[string]*types.EmailTemplateContent{
+		"welcome": {Html: aws.String("<p>Hi</p>")},
+	}}}
+
+	if warning, err := CheckTemplateText(context.Background(), client, "welcome"); err != nil || warning == "" {
+		t.Fatalf("expected a warning, got %q and %v", warning, err)
+	}
+
+	client.templates["welcome"] = &types.EmailTemplateContent{Html: aws.String("<p>Hi</p>"), Text: aws.String("Hi")}
+
+	if err := ManageTemplate(context.Background(), client, TemplateUpdate, welcomeTemplate()); err != nil {
+		t.Fatal(err)
+	} else if warning, err := CheckTemplateText(context.Background(), client, "welcome"); err != nil || warning != "" {
+		t.Errorf("expected the updated template to be looked up again, got %q and %v", warning, err)
+	}
+}
@@ -0,0 +1,71 @@
+// Lookups of template content, and checks on whether templates have a text part
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sesv2 "github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+)
+
+// The content of each template looked up so far. Templates rarely change, so lookups are cached
+// for the lifetime of the Lambda.
+var templateCache = struct {
+	sync.Mutex
+	content map[string]*types.EmailTemplateContent
+}{content: make(map[string]*types.EmailTemplateContent)}
+
+// Returns the content of a template, looking it up in SES the first time it's needed
+func getTemplateContent(ctx context.Context, client Client, templateName string) (*types.EmailTemplateContent, error) {
+	templateCache.Lock()
+	content, ok := templateCache.content[templateName]
+	templateCache.Unlock()
+
+	if ok {
+		return content, nil
+	}
+
+	output, err := client.GetEmailTemplate(ctx, &sesv2.GetEmailTemplateInput{
+		TemplateName: aws.String(templateName),
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	content = output.TemplateContent
+
+	if content == nil {
+		content = &types.EmailTemplateContent{}
+	}
+
+	templateCache.Lock()
+	templateCache.content[templateName] = content
+	templateCache.Unlock()
+
+	return content, nil
+}
+
+// Returns a warning if a template has no text part, since HTML only emails hurt deliverability.
+// Returns an empty string if the template has a text part or CHECK_TEMPLATE_TEXT is disabled.
+func CheckTemplateText(ctx context.Context, client Client, templateName string) (string, error) {
+	if !Settings.CheckTemplateText || templateName == "" {
+		return "", nil
+	}
+
+	content, err := getTemplateContent(ctx, client, templateName)
+
+	if err != nil {
+		return "", err
+	} else if strings.TrimSpace(aws.ToString(content.Text)) != "" {
+		return "", nil
+	}
+
+	return fmt.Sprintf("Template %q has no text part, which hurts deliverability", templateName), nil
+}
@@ -0,0 +1,100 @@
+// Tests for checking whether templates have a text part
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+)
+
+// Empties the template cache before and after the test
+func useTemplateCache(t *testing.T) {
+	reset := func() {
+		templateCache.Lock()
+		templateCache.content = make(map[string]*types.EmailTemplateContent)
+		templateCache.Unlock()
+	}
+
+	reset()
+	t.Cleanup(reset)
+}
+
+func TestCheckTemplateText(t *testing.T) {
+	useSettings(t, Config{CheckTemplateText: true})
+	useTemplateCache(t)
+
+	client := &fakeClient{templates: map[string]*types.EmailTemplateContent{
+		"with-text": {Html: aws.String("<p>Hi</p>"), Text: aws.String("Hi")},
+		"html-only": {Html: aws.String("<p>Hi</p>")},
+		"blank":     {Html: aws.String("<p>Hi</p>"), Text: aws.String("  \n")},
+	}}
+
+	for template, expected := range map[string]string{
+		"with-text": "",
+		"html-only": `Template "html-only" has no text part, which hurts deliverability`,
+		"blank":     `Template "blank" has no text part, which hurts deliverability`,
+	} {
+		if warning, err := CheckTemplateText(context.Background(), client, template); err != nil {
+			t.Fatal(err)
+		} else if warning != expected {
+			t.Errorf("expected %q for %s, got %q", expected, template, warning)
+		}
+	}
+}
+
+func TestCheckTemplateTextCachesLookups(t *testing.T) {
+	useSettings(t, Config{CheckTemplateText: true})
+	useTemplateCache(t)
+
+	client := &fakeClient{templates: map[string]*types.EmailTemplateContent{
+		"html-only": {Html: aws.String("<p>Hi</p>")},
+	}}
+
+	for attempt := 0; attempt < 3; attempt++ {
+		if warning, err := CheckTemplateText(context.Background(), client, "html-only"); err != nil || warning == "" {
+			t.Fatalf("expected a warning, got %q and %v", warning, err)
+		}
+	}
+
+	if client.templateLookups != 1 {
+		t.Errorf("expected the template to be looked up once, got %d", client.templateLookups)
+	}
+}
+
+func TestCheckTemplateTextErrors(t *testing.T) {
+	useSettings(t, Config{CheckTemplateText: true})
+	useTemplateCache(t)
+
+	client := &fakeClient{}
+	_, err := CheckTemplateText(context.Background(), client, "missing")
+
+	var notFound *types.NotFoundException
+
+	if !errors.As(err, &notFound) {
+		t.Errorf("expected the lookup error, got %v", err)
+	}
+
+	// Failed lookups aren't cached
+	CheckTemplateText(context.Background(), client, "missing")
+
+	if client.templateLookups != 2 {
+		t.Errorf("expected the failed lookup to be retried, got %d lookups", client.templateLookups)
+	}
+}
+
+func TestCheckTemplateTextDisabled(t *testing.T) {
+	useSettings(t, Config{})
+
+	client := &fakeClient{}
+
+	if warning, err := CheckTemplateText(context.Background(), client, "html-only"); warning != "" || err != nil {
+		t.Errorf("expected no warning, got %q and %v", warning, err)
+	} else if client.templateLookups != 0 {
+		t.Errorf("expected no lookups, got %d", client.templateLookups)
+	}
+}
@@ -3,7 +3,7 @@
 // Copyright 2014-2015 Stripe, Inc.
 // Copyright 2021 - 2022 Luke Zhang
 // BSD-3-Clause License
-package main
+package sesmail
 
 import "github.com/aws/smithy-go/middleware"
 
@@ -53,6 +53,10 @@ type RawMessage struct {
 	//
 	// This member is required.
 	Data []byte `json:"data"`
+
+	// Whether the data in JSON is base64 encoded. When unset, data is decoded if it's valid
+	// base64, and used as plain MIME otherwise.
+	IsBase64 *bool `json:"isBase64,omitempty"`
 }
 
 // Represents the body of the email message.
@@ -159,6 +163,15 @@ type EmailContent struct {
 
 	// The template to use for the email message.
 	Template *Template `json:"template"`
+
+	// Files to attach to a simple message. The message is sent as a multipart/mixed MIME
+	// message built from the subject, body, and attachments.
+	Attachments []Attachment `json:"attachments"`
+
+	// Custom headers of a simple message, such as X-Priority or List-Unsubscribe. They're sent as
+	// SES message headers, or included in the MIME message when there are attachments. Headers
+	// with their own fields, such as From, To, and Subject, can't be set.
+	Headers map[string]string `json:"headers"`
 }
 
 // An object that describes the recipients for an email. Amazon SES does not
@@ -286,6 +299,45 @@ type SendEmailInput struct {
 	// The "Reply-to" email addresses for the message. When the recipient replies to
 	// the message, each Reply-to address receives the reply.
 	ReplyToAddresses []string `json:"replyTo"`
+
+	// Return a description of the MIME structure of the email, without its content, for
+	// debugging. Only available for raw emails and simple emails with attachments or headers, which
+	// are sent as raw emails.
+	DebugMime bool `json:"debugMime"`
+
+	// The region to send through instead of the default region, such as eu-west-1.
+	Region *string `json:"region"`
+}
+
+// Whether SES accepted an email for sending
+type SendStatus string
+
+const (
+	// SES accepted the email and returned its message ID.
+	SendStatusAccepted SendStatus = "ACCEPTED"
+
+	// SES accepted the email, but did not return a message ID.
+	SendStatusAcceptedPendingId SendStatus = "ACCEPTED_PENDING_ID"
+
+	// The email was not accepted, either because it was invalid or SES rejected it.
+	SendStatusFailed SendStatus = "FAILED"
+
+	// The email was valid, and was queued to be sent by a later invocation.
+	SendStatusQueued SendStatus = "QUEUED"
+)
+
+// How many more tags fit on a message after its tags are applied, given SES's limits on the number
+// of tags and the length of their names and values
+type TagCapacity struct {
+
+	// How many more tags the message could have.
+	RemainingTags int `json:"remainingTags"`
+
+	// The most characters a tag name may have.
+	MaxNameLength int `json:"maxNameLength"`
+
+	// The most characters a tag value may have.
+	MaxValueLength int `json:"maxValueLength"`
 }
 
 // A unique message ID that you receive when an email is accepted for sending.
@@ -298,6 +350,81 @@ type SendEmailOutput struct {
 	// personalization content, for example.
 	MessageId *string `json:"messageId"`
 
-	// Metadata pertaining to the operation's result.
-	ResultMetadata middleware.Metadata `json:"metaData"`
+	// Whether the email was accepted. An email can be accepted without a message ID, in which
+	// case MessageId is null and the status is ACCEPTED_PENDING_ID.
+	Status SendStatus `json:"status"`
+
+	// The SES API operation the email was sent with, either SendEmail, or SendBulkEmail for
+	// templated emails batched by BATCH_TEMPLATED_EMAILS. Empty when the email never reached SES.
+	ApiOperation string `json:"apiOperation,omitempty"`
+
+	// The region SES sent the email from. Only set when a fallback region is configured or
+	// the send set a region.
+	Region string `json:"region,omitempty"`
+
+	// The recipients the email was actually sent to, with domains converted to Punycode and
+	// repeated addresses removed.
+	ResolvedDestination *Destination `json:"resolvedDestination"`
+
+	// Every To, CC, and BCC recipient of the resolved destination, which the message ID covers.
+	CoveredRecipients []string `json:"coveredRecipients,omitempty"`
+
+	// The Reply-To addresses the email was actually sent with, after defaults were applied and
+	// repeats were removed.
+	ResolvedReplyTo []string `json:"resolvedReplyTo,omitempty"`
+
+	// The feedback forwarding address and identity actually used, after defaults were applied.
+	// Empty when SES forwards feedback to the From address.
+	FeedbackForwardingResolved *FeedbackForwarding `json:"feedbackForwardingResolved,omitempty"`
+
+	// Recipients on the account suppression list, which SES will likely not deliver to. Only
+	// checked when CHECK_SUPPRESSION_LIST is enabled.
+	SuppressedRecipients []SuppressedRecipient `json:"suppressedRecipients,omitempty"`
+
+	// The character set sent for each part of a simple email.
+	Charsets *Charsets `json:"charsets,omitempty"`
+
+	// Recipients who opted out according to the configured OptOutChecker, and weren't sent to.
+	OptedOutRecipients []string `json:"optedOutRecipients,omitempty"`
+
+	// Attachments whose content looks like a different type than they were declared as. Only
+	// checked when ATTACHMENT_SNIFF is set.
+	ContentTypeMismatches []ContentTypeMismatch `json:"contentTypeMismatches,omitempty"`
+
+	// Recipients found in only one of a raw message's headers and its Destination. Only checked
+	// when RAW_RECIPIENT_CHECK is set.
+	RecipientMismatches []RecipientMismatch `json:"recipientMismatches,omitempty"`
+
+	// The name, or ARN if no name was given, of the template the email was sent with.
+	TemplateUsed string `json:"templateUsed,omitempty"`
+
+	// How many more tags the email could have had, for callers building tags dynamically.
+	TagCapacity *TagCapacity `json:"tagCapacity,omitempty"`
+
+	// A hash of what the email sent to whom, which stays the same when an identical email is sent
+	// again, regardless of the order of addresses or the formatting of template data. Store it to
+	// detect duplicate sends across invocations.
+	Fingerprint string `json:"fingerprint"`
+
+	// Every recipient left out of the email, and why.
+	DroppedRecipients []DroppedRecipient `json:"droppedRecipients,omitempty"`
+
+	// The approximate size of the email's content in bytes, as supplied by the caller.
+	SizeBytes int `json:"sizeBytes"`
+
+	// Milliseconds spent locally, such as validating the email and waiting on rate limits.
+	ProcessingMillis int64 `json:"processingMillis"`
+
+	// Milliseconds spent waiting on SES.
+	ServiceMillis int64 `json:"serviceMillis"`
+
+	// The MIME structure of the email, if DebugMime was set.
+	MimeTree *MimePart `json:"mimeTree,omitempty"`
+
+	// The ID of the SES request, for tracing the send in SES and CloudTrail.
+	RequestId string `json:"requestId,omitempty"`
+
+	// Metadata pertaining to the operation's result. It has no exported fields, so it's left out of
+	// the JSON output in favour of RequestId.
+	ResultMetadata middleware.Metadata `json:"-"`
 }
@@ -3,7 +3,7 @@
 // Copyright 2014-2015 Stripe, Inc.
 // Copyright 2021 - 2022 Luke Zhang
 // BSD-3-Clause License
-package main
+package sesmail
 
 import "github.com/aws/smithy-go/middleware"
 
@@ -120,6 +120,9 @@ type SendBulkEmailInput struct {
 	// The "Reply-to" email addresses for the message. When the recipient replies to
 	// the message, each Reply-to address receives the reply.
 	ReplyToAddresses []string `json:"replyTo"`
+
+	// The region to send through instead of the default region, such as eu-west-1.
+	Region *string `json:"region"`
 }
 
 // The result of the SendBulkEmail operation of each specified BulkEmailEntry.
@@ -187,6 +190,25 @@ type BulkEmailEntryResult struct {
 	// * FAILED: Amazon SES was unable to
 	// process your request. See the error message for additional information.
 	Status BulkEmailStatus `json:"status"`
+
+	// The approximate size of the entry's message in bytes, estimated from the default template
+	// data and the entry's replacement template data.
+	SizeBytes int `json:"sizeBytes"`
+
+	// The index of the entry in the bulk email's entries. Entries which weren't sent, such as
+	// duplicates, have no result, so this may differ from the result's own index.
+	Index int `json:"index"`
+
+	// The recipients the entry was sent to, after recipients who opted out were removed.
+	Recipients *Destination `json:"recipients,omitempty"`
+
+	// How many more tags the entry could have had after its replacement tags were merged with the
+	// default tags, for callers building tags dynamically.
+	TagCapacity *TagCapacity `json:"tagCapacity,omitempty"`
+
+	// The entry's recipients on the account suppression list, which SES will likely not deliver
+	// to. Only checked when CHECK_SUPPRESSION_LIST is enabled.
+	SuppressedRecipients []SuppressedRecipient `json:"suppressedRecipients,omitempty"`
 }
 
 // The following data is returned in JSON format by the service.
@@ -198,6 +220,58 @@ type SendBulkEmailOutput struct {
 	// This member is required.
 	BulkEmailEntryResults []BulkEmailEntryResult `json:"result"`
 
-	// Metadata pertaining to the operation's result.
-	ResultMetadata middleware.Metadata `json:"metaData"`
+	// The region SES sent the emails from. Only set when a fallback region is configured or
+	// the send set a region.
+	Region string `json:"region,omitempty"`
+
+	// Entries sent to the same first To address as an earlier entry. Skipped entries have no
+	// result, so results only line up with the entries which were sent.
+	DuplicateRecipients []DuplicateRecipient `json:"duplicateRecipients,omitempty"`
+
+	// The indices of entries without replacement template data, even though the template uses
+	// variables. Only checked when REPLACEMENT_DATA_CHECK is set.
+	EntriesMissingData []int `json:"entriesMissingData,omitempty"`
+
+	// The Reply-To addresses the emails were actually sent with, after defaults were applied and
+	// repeats were removed.
+	ResolvedReplyTo []string `json:"resolvedReplyTo,omitempty"`
+
+	// The feedback forwarding address and identity actually used, after defaults were applied.
+	// Empty when SES forwards feedback to the From address.
+	FeedbackForwardingResolved *FeedbackForwarding `json:"feedbackForwardingResolved,omitempty"`
+
+	// Entries with recipients who opted out according to the configured OptOutChecker. Entries
+	// without any other recipients are skipped, like duplicates.
+	OptedOutEntries []OptedOutEntry `json:"optedOutEntries,omitempty"`
+
+	// The name, or ARN if no name was given, of the template the emails were sent with, which is
+	// DEFAULT_BULK_TEMPLATE when no default content was given.
+	TemplateUsed string `json:"templateUsed,omitempty"`
+
+	// A hash of what the emails sent to whom, which stays the same when identical emails are sent
+	// again, regardless of the order of addresses or the formatting of template data.
+	Fingerprint string `json:"fingerprint"`
+
+	// Every recipient left out of the emails, and why.
+	DroppedRecipients []DroppedRecipient `json:"droppedRecipients,omitempty"`
+
+	// Where the entry results were written in chunks, if there were more than
+	// RESULT_OFFLOAD_THRESHOLD. The results are left out of the output when they're offloaded.
+	ResultChunks []ResultChunk `json:"resultChunks,omitempty"`
+
+	// A count of the offloaded entry results by status.
+	ResultSummary *ResultSummary `json:"resultSummary,omitempty"`
+
+	// Milliseconds spent locally, such as validating the email and waiting on rate limits.
+	ProcessingMillis int64 `json:"processingMillis"`
+
+	// Milliseconds spent waiting on SES.
+	ServiceMillis int64 `json:"serviceMillis"`
+
+	// The ID of the SES request, for tracing the send in SES and CloudTrail.
+	RequestId string `json:"requestId,omitempty"`
+
+	// Metadata pertaining to the operation's result. It has no exported fields, so it's left out of
+	// the JSON output in favour of RequestId.
+	ResultMetadata middleware.Metadata `json:"-"`
 }
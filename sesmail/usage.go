@@ -0,0 +1,122 @@
+// Estimates of SES usage for budgeting
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+)
+
+// A rough estimate of how much SES was used, counting only emails SES accepted
+type Usage struct {
+
+	// The number of messages accepted.
+	Messages int `json:"messages"`
+
+	// The number of messages multiplied by their recipients, which is what SES charges for.
+	RecipientMessages int `json:"recipientMessages"`
+
+	// The approximate size of the accepted messages, excluding anything SES adds such as
+	// headers or template content.
+	Bytes int `json:"bytes"`
+}
+
+func (usage *Usage) add(recipients int, bytes int) {
+	usage.Messages++
+	usage.RecipientMessages += recipients
+	usage.Bytes += bytes
+}
+
+// Estimates the usage of the emails accepted by SendEmail or SendEmails
+func EmailsUsage(outputs ...*SendEmailOutput) *Usage {
+	usage := &Usage{}
+
+	for _, output := range outputs {
+		if output == nil || output.Status == SendStatusFailed {
+			continue
+		}
+
+		usage.add(recipientCount(output.ResolvedDestination), output.SizeBytes)
+	}
+
+	return usage
+}
+
+// Estimates the usage of the entries of a bulk email which SES accepted
+func BulkEmailUsage(input *SendBulkEmailInput, output *SendBulkEmailOutput) *Usage {
+	usage := &Usage{}
+
+	if output == nil {
+		return usage
+	}
+
+	defaultSize := 0
+
+	if input.DefaultContent != nil && input.DefaultContent.Template != nil {
+		defaultSize = len(aws.ToString(input.DefaultContent.Template.TemplateData))
+	}
+
+	for _, result := range output.BulkEmailEntryResults {
+		if result.Status != BulkEmailStatus(types.BulkEmailStatusSuccess) ||
+			result.Index < 0 || result.Index >= len(input.BulkEmailEntries) {
+			continue
+		}
+
+		// Results name the entry they belong to, since skipped entries have no result, and the
+		// recipients left after those who opted out were removed
+		entry := input.BulkEmailEntries[result.Index]
+		destination := entry.Destination
+
+		if result.Recipients != nil {
+			destination = result.Recipients
+		}
+
+		usage.add(recipientCount(destination), defaultSize+replacementDataSize(entry))
+	}
+
+	return usage
+}
+
+func recipientCount(destination *Destination) int {
+	if destination == nil {
+		return 0
+	}
+
+	return len(destination.ToAddresses) + len(destination.CcAddresses) + len(destination.BccAddresses)
+}
+
+// Estimates the size of an email's content from the data the caller supplied
+func contentSize(content *EmailContent) int {
+	size := 0
+
+	if content.Raw != nil {
+		size += len(content.Raw.Data)
+	}
+
+	for _, message := range []*Message{{Body: content.Body, Subject: content.Subject}, content.Simple} {
+		if message == nil {
+			continue
+		}
+
+		size += contentDataSize(message.Subject)
+
+		if message.Body != nil {
+			size += contentDataSize(message.Body.Html) + contentDataSize(message.Body.Text)
+		}
+	}
+
+	if content.Template != nil {
+		size += len(aws.ToString(content.Template.TemplateData))
+	}
+
+	return size
+}
+
+func contentDataSize(content *Content) int {
+	if content == nil {
+		return 0
+	}
+
+	return len(aws.ToString(content.Data))
+}
@@ -0,0 +1,106 @@
+// Tests for estimating SES usage
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sesv2 "github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+)
+
+func TestEmailsUsageForSingleEmail(t *testing.T) {
+	input := simpleEmail("a@example.com")
+	input.Destination.CcAddresses = []string{"b@example.com"}
+
+	output, err := SendEmail(context.Background(), &fakeClient{}, input)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// "Subject" and "Body"
+	expected := Usage{Messages: 1, RecipientMessages: 2, Bytes: 11}
+
+	if usage := EmailsUsage(output); *usage != expected {
+		t.Errorf("expected %+v, got %+v", expected, *usage)
+	}
+}
+
+func TestEmailsUsageSkipsFailedEmails(t *testing.T) {
+	outputs, _ := SendEmails(context.Background(), &fakeClient{}, []*SendEmailInput{
+		simpleEmail("a@example.com"),
+		{Content: &EmailContent{}},
+		simpleEmail("b@example.com"),
+	})
+	outputs = append(outputs, nil, &SendEmailOutput{Status: SendStatusFailed, SizeBytes: 100})
+
+	expected := Usage{Messages: 2, RecipientMessages: 2, Bytes: 22}
+
+	if usage := EmailsUsage(outputs...); *usage != expected {
+		t.Errorf("expected %+v, got %+v", expected, *usage)
+	}
+}
+
+func TestBulkEmailUsage(t *testing.T) {
+	input := bulkEmail("a@example.com", "b@example.com", "c@example.com")
+	input.DefaultContent.Template.TemplateData = aws.String(`{"a":1}`)
+	input.BulkEmailEntries[0].Destination.BccAddresses = []string{"d@example.com"}
+	input.BulkEmailEntries[0].ReplacementEmailContent = &ReplacementEmailContent{
+		ReplacementTemplate: &ReplacementTemplate{ReplacementTemplateData: aws.String(`{"b":2}`)},
+	}
+
+	client := &fakeClient{sendBulkEmail: func(_ context.Context, params *sesv2.SendBulkEmailInput) (*sesv2.SendBulkEmailOutput, error) {
+		output := acceptBulkEmail(params)
+		output.BulkEmailEntryResults[2].Status = types.BulkEmailStatusFailed
+
+		return output, nil
+	}}
+
+	output, err := SendBulkEmail(context.Background(), client, input)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The failed third entry isn't counted
+	expected := Usage{Messages: 2, RecipientMessages: 3, Bytes: 21}
+
+	if usage := BulkEmailUsage(input, output); *usage != expected {
+		t.Errorf("expected %+v, got %+v", expected, *usage)
+	}
+}
+
+func TestBulkEmailUsageWithSkippedEntries(t *testing.T) {
+	useSettings(t, Config{DuplicateRecipients: DuplicateRecipientsSkip})
+	useOptOutChecker(t, fakeOptOutChecker{"b@example.com": true, "d@example.com": true})
+
+	input := bulkEmail("a@example.com", "a@example.com", "b@example.com", "c@example.com")
+	input.BulkEmailEntries[3].Destination.CcAddresses = []string{"d@example.com", "e@example.com"}
+	input.BulkEmailEntries[3].ReplacementEmailContent = &ReplacementEmailContent{
+		ReplacementTemplate: &ReplacementTemplate{ReplacementTemplateData: aws.String(`{"c":3}`)},
+	}
+
+	output, err := SendBulkEmail(context.Background(), &fakeClient{}, input)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The duplicate and opted out entries aren't counted, nor is the opted out CC recipient of the
+	// last entry
+	expected := Usage{Messages: 2, RecipientMessages: 3, Bytes: 7}
+
+	if usage := BulkEmailUsage(input, output); *usage != expected {
+		t.Errorf("expected %+v, got %+v", expected, *usage)
+	}
+}
+
+func TestBulkEmailUsageWithoutOutput(t *testing.T) {
+	if usage := BulkEmailUsage(bulkEmail("a@example.com"), nil); *usage != (Usage{}) {
+		t.Errorf("expected no usage, got %+v", *usage)
+	}
+}
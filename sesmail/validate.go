@@ -0,0 +1,442 @@
+// Validation of SESv2 inputs before they are sent
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+)
+
+// Checks a single email the way SendEmail does before sending it, without calling SES, such as to
+// acknowledge an email before sending it in the background
+func ValidateSendEmailInput(input *SendEmailInput) error {
+	if err := validateSendEmailInput(input); err != nil {
+		return invalidInput(err)
+	} else if _, err := createEmailTags(input.EmailTags); err != nil {
+		return invalidInput(err)
+	} else if err := validateAttachmentBudget([]*SendEmailInput{input}); err != nil {
+		return invalidInput(err)
+	} else if err := validateAttachments(input.Content.Attachments); err != nil {
+		return invalidInput(err)
+	} else if _, err := sniffAttachments(input.Content.Attachments); err != nil {
+		return invalidInput(err)
+	} else if _, err := sanitizeHeaders(input.Content.Headers); err != nil {
+		return invalidInput(err)
+	} else if _, _, err := reconcileRawRecipients(input.Destination, input.Content.Raw); err != nil {
+		return invalidInput(err)
+	}
+
+	_, err := resolveFromAddress(input.FromEmailAddress, input.FromEmailAddressIdentityArn)
+
+	return invalidInput(err)
+}
+
+// Checks every email of a batch, returning an error for each invalid one. If any email is invalid,
+// the valid ones get ErrBatchValidationFailed, since none of them are sent.
+func validateEmails(inputs []*SendEmailInput) []error {
+	errs := make([]error, 0, len(inputs))
+	invalid := false
+
+	for index, input := range inputs {
+		if input == nil {
+			errs = append(errs, &EmailError{Index: index, Err: invalidInput(fmt.Errorf("Email %d: Email is required", index))})
+			invalid = true
+		} else if err := ValidateSendEmailInput(input); err != nil {
+			errs = append(errs, &EmailError{
+				Index:       index,
+				Destination: input.Destination,
+				Err:         fmt.Errorf("Email %d: %w", index, err),
+			})
+			invalid = true
+		} else {
+			errs = append(errs, &EmailError{
+				Index:       index,
+				Destination: input.Destination,
+				Err:         fmt.Errorf("Email %d: %w", index, ErrBatchValidationFailed),
+			})
+		}
+	}
+
+	if !invalid {
+		return nil
+	}
+
+	return errs
+}
+
+// Checks the emails of a batch don't have more To, CC, and BCC recipients combined than
+// MAX_BATCH_RECIPIENTS allows
+func validateBatchRecipientCount(inputs []*SendEmailInput) error {
+	if Settings.MaxBatchRecipients <= 0 {
+		return nil
+	}
+
+	count := 0
+
+	for _, input := range inputs {
+		if input != nil {
+			count += recipientCount(input.Destination)
+		}
+	}
+
+	if count > Settings.MaxBatchRecipients {
+		return fmt.Errorf(
+			"Too many recipients in the batch: %d given across %d emails, but at most %d are allowed",
+			count, len(inputs), Settings.MaxBatchRecipients,
+		)
+	}
+
+	return nil
+}
+
+// Checks the emails of an invocation don't have more attachment bytes combined than
+// MAX_ATTACHMENT_BYTES allows, bounding the memory and cost of building their messages. Attachments
+// in raw messages count by their encoded size.
+func validateAttachmentBudget(inputs []*SendEmailInput) error {
+	if Settings.MaxAttachmentBytes <= 0 {
+		return nil
+	}
+
+	size := 0
+
+	for _, input := range inputs {
+		if input != nil && input.Content != nil {
+			for _, attachment := range input.Content.Attachments {
+				size += len(attachment.Data)
+			}
+
+			if input.Content.Raw != nil {
+				size += rawMessageAttachmentBytes(input.Content.Raw.Data)
+			}
+		}
+	}
+
+	if size > Settings.MaxAttachmentBytes {
+		return fmt.Errorf(
+			"Too many attachment bytes: %d given across %d emails, but at most %d are allowed",
+			size, len(inputs), Settings.MaxAttachmentBytes,
+		)
+	}
+
+	return nil
+}
+
+// Checks the fields of a single email before it is converted into an SES request
+func validateSendEmailInput(input *SendEmailInput) error {
+	if err := checkSendEmailSchema(input); err != nil {
+		return err
+	} else if input.Content == nil {
+		return errors.New("Content is required")
+	} else if err := validateDestination(input.Destination); err != nil {
+		return err
+	} else if err := validateDestinationAddresses(input.Destination); err != nil {
+		return err
+	}
+
+	return validateSenderAddresses(
+		input.FromEmailAddress,
+		resolveFeedbackForwarding(
+			input.FeedbackForwardingEmailAddress,
+			input.FeedbackForwardingEmailAddressIdentityArn,
+		).emailAddress(),
+		resolveReplyTo(input.ReplyToAddresses),
+	)
+}
+
+// Checks a bulk entry the way SendBulkEmail does, returning its replacement tags as SES takes them
+func validateBulkEntry(defaultTags MessageTag, entry BulkEmailEntry) ([]types.MessageTag, error) {
+	replacementTags, err := createEmailTags(entry.ReplacementTags)
+
+	if err != nil {
+		return nil, err
+	} else if count := len(mergedTagNames(defaultTags, entry.ReplacementTags)); count > maxTags {
+		return nil, fmt.Errorf("%d tags, including the default tags, exceed the %d tag limit", count, maxTags)
+	} else if err := validateDestination(entry.Destination); err != nil {
+		return nil, err
+	} else if err := validateDestinationAddresses(entry.Destination); err != nil {
+		return nil, err
+	} else if _, err := resolveDestination(entry.Destination); err != nil {
+		return nil, err
+	}
+
+	return replacementTags, nil
+}
+
+// Checks that a bulk email has a default template, since SES rejects bulk emails without one. A
+// missing template is allowed when DEFAULT_BULK_TEMPLATE is configured.
+func validateBulkDefaultContent(content *BulkEmailContent) error {
+	if content != nil && content.Template != nil {
+		if content.Template.TemplateName == nil && content.Template.TemplateArn == nil {
+			return errors.New("DefaultContent.Template requires a name or ARN")
+		}
+
+		return nil
+	} else if Settings.DefaultBulkTemplate == "" {
+		return errors.New("DefaultContent.Template is required")
+	}
+
+	return nil
+}
+
+// The maximum length of a line in a message, excluding the trailing CRLF, defined in RFC 5321
+const maxLineLength = 998
+
+// Checks that a raw message was decoded from valid base64 and that none of its lines is longer than
+// RFC 5321 allows. The message must already be decoded: Lambda payloads carry raw messages as
+// base64 or plain MIME, which is decoded when the payload is unmarshalled, and the SDK encodes it
+// again when calling SES.
+func validateRawMessage(raw *RawMessage) error {
+	if len(raw.Data) == 0 {
+		return errors.New("Raw message data is required")
+	} else if Settings.SkipRawMessageValidation {
+		return nil
+	} else if err := validateRawMessageEncoding(raw.Data); err != nil {
+		return err
+	}
+
+	for index, line := range bytes.Split(raw.Data, []byte("\n")) {
+		if length := len(bytes.TrimSuffix(line, []byte("\r"))); length > maxLineLength {
+			return fmt.Errorf(
+				"Line %d of the raw message is %d characters long, exceeding the %d character limit of RFC 5321",
+				index+1, length, maxLineLength,
+			)
+		}
+	}
+
+	return nil
+}
+
+// Checks that a raw message isn't still base64 encoded. A MIME message always has a header with a
+// colon, so data made only of base64 characters is either base64 which couldn't be decoded, and was
+// taken as plain MIME when isBase64 wasn't given, or a message which was encoded twice.
+func validateRawMessageEncoding(data []byte) error {
+	encoded := bytes.Map(func(char rune) rune {
+		if char == '\r' || char == '\n' || char == ' ' || char == '\t' {
+			return -1
+		}
+
+		return char
+	}, data)
+
+	for _, char := range encoded {
+		if !isBase64Character(char) {
+			return nil
+		}
+	}
+
+	if _, err := base64.StdEncoding.DecodeString(string(encoded)); err != nil {
+		return fmt.Errorf("Raw message data is not valid base64: %w", err)
+	}
+
+	return errors.New("Raw message data is base64 encoded more than once")
+}
+
+func isBase64Character(char byte) bool {
+	return char >= 'a' && char <= 'z' ||
+		char >= 'A' && char <= 'Z' ||
+		char >= '0' && char <= '9' ||
+		char == '+' || char == '/' || char == '='
+}
+
+// The maximum length of a message tag's name or value
+const maxTagLength = 256
+
+// The most message tags SES accepts on a message
+const maxTags = 50
+
+// The most Reply-To addresses SES accepts on a message
+const maxReplyToAddresses = 50
+
+// The most To, CC, and BCC recipients SES accepts on a message
+const maxRecipients = 50
+
+// Returns every way a message tag breaks SES's constraints: names and values may only contain
+// ASCII letters, numbers, underscores, and dashes, and be at most 256 characters long
+func validateTag(name string, value string) []string {
+	var problems []string
+
+	for _, field := range []struct {
+		kind  string
+		value string
+	}{{"name", name}, {"value", value}} {
+		if field.kind == "name" && field.value == "" {
+			problems = append(problems, "tag name must not be empty")
+		} else if len(field.value) > maxTagLength {
+			problems = append(problems, fmt.Sprintf(
+				"tag %q %s is %d characters long, exceeding the %d character limit",
+				name, field.kind, len(field.value), maxTagLength,
+			))
+		}
+
+		if strings.IndexFunc(field.value, isInvalidTagCharacter) != -1 {
+			problems = append(problems, fmt.Sprintf(
+				"tag %q %s may only contain ASCII letters, numbers, underscores, and dashes",
+				name, field.kind,
+			))
+		}
+	}
+
+	return problems
+}
+
+// Returns the names of every tag applied to a message, such as a bulk entry's replacement tags
+// along with the default tags, counting a name given more than once as a single tag
+func mergedTagNames(tagSets ...MessageTag) map[string]bool {
+	names := map[string]bool{}
+
+	for _, tags := range tagSets {
+		for name := range tags {
+			names[name] = true
+		}
+	}
+
+	return names
+}
+
+// Returns how many more tags fit on a message after each of its tag sets are applied
+func tagCapacity(tagSets ...MessageTag) *TagCapacity {
+	remaining := maxTags - len(mergedTagNames(tagSets...))
+
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	return &TagCapacity{
+		RemainingTags:  remaining,
+		MaxNameLength:  maxTagLength,
+		MaxValueLength: maxTagLength,
+	}
+}
+
+func isInvalidTagCharacter(char rune) bool {
+	return !(char >= 'a' && char <= 'z' ||
+		char >= 'A' && char <= 'Z' ||
+		char >= '0' && char <= '9' ||
+		char == '_' || char == '-')
+}
+
+// Checks that a destination exists and contains at least one To, CC, or BCC recipient.
+// SES rejects empty destinations, so this surfaces the problem before making a request.
+func validateDestination(destination *Destination) error {
+	if destination == nil {
+		return errors.New("Destination is required")
+	}
+
+	if recipientCount(destination) == 0 {
+		return errors.New("Destination must contain at least one To, CC, or BCC address")
+	}
+
+	return validateRecipientCount(destination)
+}
+
+// Checks a destination doesn't have more To, CC, and BCC recipients combined than SES or
+// MAX_RECIPIENTS allows
+func validateRecipientCount(destination *Destination) error {
+	limit := maxRecipients
+
+	if Settings.MaxRecipients > 0 && Settings.MaxRecipients < limit {
+		limit = Settings.MaxRecipients
+	}
+
+	if count := recipientCount(destination); count > limit {
+		return fmt.Errorf("Too many recipients: %d given, but at most %d are allowed", count, limit)
+	}
+
+	return nil
+}
+
+// Checks a header value such as a subject for CR, LF, and other control characters, which could
+// otherwise be used to inject extra headers. Depending on settings, offending characters are either
+// stripped or rejected with an error.
+func sanitizeHeaderValue(name string, value string) (string, error) {
+	if strings.IndexFunc(value, unicode.IsControl) == -1 {
+		return value, nil
+	}
+
+	if !Settings.StripControlCharacters {
+		return "", fmt.Errorf("%s must not contain control characters", name)
+	}
+
+	return strings.Map(func(char rune) rune {
+		if unicode.IsControl(char) {
+			return -1
+		}
+
+		return char
+	}, value), nil
+}
+
+func sanitizeSubject(subject *Content) (*types.Content, error) {
+	if subject.Data == nil {
+		return &types.Content{Charset: resolveCharset(subject.Charset)}, nil
+	}
+
+	data, err := sanitizeHeaderValue("Subject", *subject.Data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &types.Content{
+		Data:    aws.String(data),
+		Charset: resolveCharset(subject.Charset),
+	}, nil
+}
+
+// Checks that none of the addresses contain CR, LF, or other control characters which could break
+// out of an address header and inject new ones
+func validateAddresses(field string, addresses ...string) error {
+	for _, address := range addresses {
+		if strings.IndexFunc(address, unicode.IsControl) != -1 {
+			return fmt.Errorf("%s address %q must not contain control characters", field, address)
+		}
+	}
+
+	return nil
+}
+
+func validateDestinationAddresses(destination *Destination) error {
+	if err := validateAddresses("To", destination.ToAddresses...); err != nil {
+		return err
+	} else if err := validateAddresses("CC", destination.CcAddresses...); err != nil {
+		return err
+	}
+
+	return validateAddresses("BCC", destination.BccAddresses...)
+}
+
+// Checks the From, Reply-To, and feedback forwarding addresses shared by single and bulk sends
+func validateSenderAddresses(from *string, feedbackForwarding *string, replyTo []string) error {
+	if err := validateAddresses("From", aws.ToString(from)); err != nil {
+		return err
+	} else if err := validateAddresses("Feedback forwarding", aws.ToString(feedbackForwarding)); err != nil {
+		return err
+	} else if err := validateReplyToCount(replyTo); err != nil {
+		return err
+	}
+
+	return validateAddresses("Reply-To", replyTo...)
+}
+
+// Checks there aren't more unique Reply-To addresses than SES or MAX_REPLY_TO_ADDRESSES allows
+func validateReplyToCount(replyTo []string) error {
+	limit := maxReplyToAddresses
+
+	if Settings.MaxReplyToAddresses > 0 && Settings.MaxReplyToAddresses < limit {
+		limit = Settings.MaxReplyToAddresses
+	}
+
+	if count := len(dedupeAddresses(replyTo)); count > limit {
+		return fmt.Errorf("Too many Reply-To addresses: %d given, but at most %d are allowed", count, limit)
+	}
+
+	return nil
+}
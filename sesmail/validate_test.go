@@ -0,0 +1,778 @@
+// Tests for validation of SESv2 inputs
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestValidateDestination(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		destination *Destination
+		valid       bool
+	}{
+		{"missing", nil, false},
+		{"all empty", &Destination{}, false},
+		{"empty lists", &Destination{ToAddresses: []string{}, CcAddresses: []string{}, BccAddresses: []string{}}, false},
+		{"only to", &Destination{ToAddresses: []string{"to@example.com"}}, true},
+		{"only cc", &Destination{CcAddresses: []string{"cc@example.com"}}, true},
+		{"only bcc", &Destination{BccAddresses: []string{"bcc@example.com"}}, true},
+		{
+			"all populated",
+			&Destination{
+				ToAddresses:  []string{"to@example.com"},
+				CcAddresses:  []string{"cc@example.com"},
+				BccAddresses: []string{"bcc@example.com"},
+			},
+			true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateDestination(test.destination)
+
+			if test.valid && err != nil {
+				t.Errorf("expected a valid destination, got %v", err)
+			} else if !test.valid && err == nil {
+				t.Error("expected an error for an invalid destination")
+			}
+		})
+	}
+}
+
+func TestSendBulkEmailRejectsEmptyEntryDestination(t *testing.T) {
+	input := bulkEmail("to@example.com")
+	input.BulkEmailEntries = append(input.BulkEmailEntries, BulkEmailEntry{Destination: &Destination{}})
+	_, err := SendBulkEmail(context.Background(), &fakeClient{}, input)
+
+	if err == nil || err.Error() != "Invalid input: Entry 1: Destination must contain at least one To, CC, or BCC address" {
+		t.Errorf("expected the empty entry to be reported, got %v", err)
+	}
+}
+
+func TestValidateRecipientCount(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		limit       int
+		destination *Destination
+		expected    string
+	}{
+		{"at the SES limit", 0, &Destination{ToAddresses: addresses(50)}, ""},
+		{
+			"above the SES limit",
+			0,
+			&Destination{ToAddresses: addresses(40), CcAddresses: addresses(10), BccAddresses: addresses(1)},
+			"Too many recipients: 51 given, but at most 50 are allowed",
+		},
+		{"at the configured limit", 5, &Destination{ToAddresses: addresses(3), BccAddresses: addresses(2)}, ""},
+		{"above the configured limit", 5, &Destination{ToAddresses: addresses(6)}, "Too many recipients: 6 given, but at most 5 are allowed"},
+		{"configured above the SES limit", 100, &Destination{ToAddresses: addresses(51)}, "Too many recipients: 51 given, but at most 50 are allowed"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			useSettings(t, Config{MaxRecipients: test.limit})
+
+			err := validateDestination(test.destination)
+
+			if test.expected == "" && err != nil {
+				t.Errorf("expected no error, got %v", err)
+			} else if test.expected != "" && (err == nil || err.Error() != test.expected) {
+				t.Errorf("expected %q, got %v", test.expected, err)
+			}
+		})
+	}
+}
+
+func TestSendBulkEmailRejectsEntryWithTooManyRecipients(t *testing.T) {
+	useSettings(t, Config{})
+
+	client := &fakeClient{}
+	input := bulkEmail("to@example.com")
+	input.BulkEmailEntries = append(input.BulkEmailEntries,
+		BulkEmailEntry{Destination: &Destination{ToAddresses: addresses(50)}},
+		BulkEmailEntry{Destination: &Destination{ToAddresses: addresses(50), CcAddresses: addresses(1)}},
+	)
+
+	_, err := SendBulkEmail(context.Background(), client, input)
+	expected := "Entry 2: Too many recipients: 51 given, but at most 50 are allowed"
+
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected %q, got %v", expected, err)
+	} else if len(client.SentBulkEmails()) != 0 {
+		t.Errorf("expected nothing to be sent, got %d requests", len(client.SentBulkEmails()))
+	}
+}
+
+func TestSanitizeSubjectInjection(t *testing.T) {
+	injections := []string{
+		"Hello\r\nBcc: victim@example.com",
+		"Hello\nX-Injected: true",
+		"Hello\rReply-To: attacker@example.com",
+		"Hello\x00World",
+		"Hello\tWorld\x7f",
+	}
+
+	for _, injection := range injections {
+		useSettings(t, Config{})
+
+		if _, err := sanitizeSubject(&Content{Data: aws.String(injection)}); err == nil {
+			t.Errorf("expected %q to be rejected", injection)
+		}
+
+		useSettings(t, Config{StripControlCharacters: true})
+		subject, err := sanitizeSubject(&Content{Data: aws.String(injection)})
+
+		if err != nil {
+			t.Errorf("expected %q to be stripped, got %v", injection, err)
+		} else if data := aws.ToString(subject.Data); strings.IndexFunc(data, unicode.IsControl) != -1 {
+			t.Errorf("expected control characters to be stripped from %q, got %q", injection, data)
+		}
+	}
+}
+
+func TestSanitizeSubjectKeepsCleanSubjects(t *testing.T) {
+	subject, err := sanitizeSubject(&Content{Data: aws.String("Your receipt – order #42"), Charset: aws.String("UTF-8")})
+
+	if err != nil {
+		t.Fatal(err)
+	} else if aws.ToString(subject.Data) != "Your receipt – order #42" || aws.ToString(subject.Charset) != "UTF-8" {
+		t.Errorf("expected the subject to be unchanged, got %q", aws.ToString(subject.Data))
+	}
+}
+
+func TestValidateSendEmailInputAddressInjection(t *testing.T) {
+	const payload = "user@example.com\r\nBcc: victim@example.com"
+
+	for _, test := range []struct {
+		field  string
+		modify func(input *SendEmailInput)
+	}{
+		{"To", func(input *SendEmailInput) { input.Destination.ToAddresses = []string{payload} }},
+		{"CC", func(input *SendEmailInput) { input.Destination.CcAddresses = []string{payload} }},
+		{"BCC", func(input *SendEmailInput) { input.Destination.BccAddresses = []string{payload} }},
+		{"From", func(input *SendEmailInput) { input.FromEmailAddress = aws.String(payload) }},
+		{"Feedback forwarding", func(input *SendEmailInput) {
+			input.FeedbackForwardingEmailAddress = aws.String(payload)
+		}},
+		{"Reply-To", func(input *SendEmailInput) {
+			input.ReplyToAddresses = []string{"reply@example.com", payload}
+		}},
+	} {
+		t.Run(test.field, func(t *testing.T) {
+			input := &SendEmailInput{
+				Content:          simpleEmail("to@example.com").Content,
+				Destination:      &Destination{ToAddresses: []string{"to@example.com"}},
+				FromEmailAddress: aws.String("from@example.com"),
+			}
+
+			if err := validateSendEmailInput(input); err != nil {
+				t.Fatalf("expected the clean input to be valid, got %v", err)
+			}
+
+			test.modify(input)
+			err := validateSendEmailInput(input)
+
+			if err == nil || !strings.HasPrefix(err.Error(), test.field+" address") {
+				t.Errorf("expected the %s address to be rejected, got %v", test.field, err)
+			}
+		})
+	}
+}
+
+func TestValidateBulkDefaultContent(t *testing.T) {
+	template := &BulkEmailContent{Template: &Template{TemplateName: aws.String("template")}}
+	unnamed := &BulkEmailContent{Template: &Template{}}
+
+	for _, test := range []struct {
+		name            string
+		content         *BulkEmailContent
+		defaultTemplate string
+		valid           bool
+	}{
+		{"missing without a default", nil, "", false},
+		{"missing template without a default", &BulkEmailContent{}, "", false},
+		{"missing with a default", nil, "fallback", true},
+		{"missing template with a default", &BulkEmailContent{}, "fallback", true},
+		{"unnamed template", unnamed, "fallback", false},
+		{"named template", template, "", true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			useSettings(t, Config{DefaultBulkTemplate: test.defaultTemplate})
+			err := validateBulkDefaultContent(test.content)
+
+			if test.valid && err != nil {
+				t.Errorf("expected valid content, got %v", err)
+			} else if !test.valid && err == nil {
+				t.Error("expected an error for missing default content")
+			}
+		})
+	}
+}
+
+func TestSendBulkEmailUsesDefaultTemplate(t *testing.T) {
+	client := &fakeClient{}
+	useSettings(t, Config{DefaultBulkTemplate: "fallback"})
+
+	input := bulkEmail("to@example.com")
+	input.DefaultContent = nil
+
+	if _, err := SendBulkEmail(context.Background(), client, input); err != nil {
+		t.Fatal(err)
+	}
+
+	sent := client.SentBulkEmails()
+
+	if len(sent) != 1 || aws.ToString(sent[0].DefaultContent.Template.TemplateName) != "fallback" {
+		t.Errorf("expected the default template to be sent, got %+v", sent)
+	}
+}
+
+func TestValidateRawMessage(t *testing.T) {
+	longLine := strings.Repeat("a", maxLineLength)
+
+	for _, test := range []struct {
+		name     string
+		data     []byte
+		expected string
+	}{
+		{"compliant", rawMessage("Subject: Hello", "", "Hello"), ""},
+		{"longest allowed line", rawMessage("Subject: Hello", "", longLine), ""},
+		{"longest allowed line without CRLF", []byte("Subject: Hello\n\n" + longLine), ""},
+		{
+			"over-length line",
+			rawMessage("Subject: Hello", "", longLine+"a"),
+			"Line 3 of the raw message is 999 characters long, exceeding the 998 character limit of RFC 5321",
+		},
+		{"empty", nil, "Raw message data is required"},
+		{
+			"invalid base64",
+			[]byte("U3ViamVjdDogSGVsbG8NCg0KSGVsbG8"),
+			"Raw message data is not valid base64: illegal base64 data at input byte 28",
+		},
+		{
+			"base64 encoded twice",
+			[]byte(base64.StdEncoding.EncodeToString(rawMessage("Subject: Hello", "", "Hello"))),
+			"Raw message data is base64 encoded more than once",
+		},
+		{
+			"base64 encoded twice across lines",
+			[]byte("U3ViamVjdDogSGVs\r\nbG8NCg0KSGVsbG8=\r\n"),
+			"Raw message data is base64 encoded more than once",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateRawMessage(&RawMessage{Data: test.data})
+
+			if test.expected == "" && err != nil {
+				t.Errorf("expected no error, got %v", err)
+			} else if test.expected != "" && (err == nil || err.Error() != test.expected) {
+				t.Errorf("expected %q, got %v", test.expected, err)
+			}
+		})
+	}
+}
+
+func TestValidateRawMessageSkipped(t *testing.T) {
+	useSettings(t, Config{SkipRawMessageValidation: true})
+
+	data := rawMessage("Subject: Hello", "", strings.Repeat("a", 2000))
+
+	if err := validateRawMessage(&RawMessage{Data: data}); err != nil {
+		t.Errorf("expected validation to be skipped, got %v", err)
+	}
+}
+
+func TestCreateEmailTags(t *testing.T) {
+	long := strings.Repeat("a", maxTagLength+1)
+
+	for _, test := range []struct {
+		name     string
+		tags     MessageTag
+		expected string
+	}{
+		{"valid", MessageTag{"campaign": "launch-2022", "Team_Name": "growth"}, ""},
+		{"longest allowed value", MessageTag{"campaign": long[1:]}, ""},
+		{
+			"over-length value",
+			MessageTag{"campaign": long},
+			`Invalid tags: tag "campaign" value is 257 characters long, exceeding the 256 character limit`,
+		},
+		{
+			"300 character value",
+			MessageTag{"campaign": strings.Repeat("a", 300)},
+			`Invalid tags: tag "campaign" value is 300 characters long, exceeding the 256 character limit`,
+		},
+		{
+			"space in the value",
+			MessageTag{"campaign": "launch 2022"},
+			`Invalid tags: tag "campaign" value may only contain ASCII letters, numbers, underscores, and dashes`,
+		},
+		{
+			"invalid characters",
+			MessageTag{"campaign name": "launch 2022!"},
+			`Invalid tags: tag "campaign name" name may only contain ASCII letters, numbers, underscores, and dashes; ` +
+				`tag "campaign name" value may only contain ASCII letters, numbers, underscores, and dashes`,
+		},
+		{
+			"several invalid tags",
+			MessageTag{"b": "ok", "a": "café", "": "empty"},
+			`Invalid tags: tag name must not be empty; ` +
+				`tag "a" value may only contain ASCII letters, numbers, underscores, and dashes`,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			tags, err := createEmailTags(test.tags)
+
+			if test.expected == "" {
+				if err != nil {
+					t.Errorf("expected no error, got %v", err)
+				} else if len(tags) != len(test.tags) {
+					t.Errorf("expected %d tags, got %d", len(test.tags), len(tags))
+				}
+			} else if err == nil || err.Error() != test.expected {
+				t.Errorf("expected %q, got %v", test.expected, err)
+			}
+		})
+	}
+}
+
+func TestSendBulkEmailRejectsInvalidReplacementTags(t *testing.T) {
+	client := &fakeClient{}
+	input := bulkEmail("a@example.com", "b@example.com")
+	input.BulkEmailEntries[1].ReplacementTags = MessageTag{"campaign": "launch 2022"}
+
+	_, err := SendBulkEmail(context.Background(), client, input)
+
+	if err == nil || !strings.HasPrefix(err.Error(), "Entry 1: Invalid tags") {
+		t.Errorf("expected the entry's tags to be rejected, got %v", err)
+	} else if len(client.SentBulkEmails()) != 0 {
+		t.Errorf("expected SES not to be called")
+	}
+}
+
+// Returns count distinct addresses
+func addresses(count int) []string {
+	var list []string
+
+	for index := 0; index < count; index++ {
+		list = append(list, fmt.Sprintf("reply%d@example.com", index))
+	}
+
+	return list
+}
+
+func TestValidateReplyToCount(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		limit    int
+		replyTo  []string
+		expected string
+	}{
+		{"at the SES limit", 0, addresses(50), ""},
+		{"above the SES limit", 0, addresses(51), "Too many Reply-To addresses: 51 given, but at most 50 are allowed"},
+		{"above the SES limit with duplicates", 0, append(addresses(50), "REPLY0@example.com"), ""},
+		{"at the configured limit", 3, addresses(3), ""},
+		{"above the configured limit", 3, addresses(4), "Too many Reply-To addresses: 4 given, but at most 3 are allowed"},
+		{"configured above the SES limit", 100, addresses(51), "Too many Reply-To addresses: 51 given, but at most 50 are allowed"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			useSettings(t, Config{MaxReplyToAddresses: test.limit})
+
+			err := validateReplyToCount(test.replyTo)
+
+			if test.expected == "" && err != nil {
+				t.Errorf("expected no error, got %v", err)
+			} else if test.expected != "" && (err == nil || err.Error() != test.expected) {
+				t.Errorf("expected %q, got %v", test.expected, err)
+			}
+		})
+	}
+}
+
+func TestSendEmailDedupesReplyToAddresses(t *testing.T) {
+	client := &fakeClient{}
+	input := simpleEmail("a@example.com")
+	input.ReplyToAddresses = []string{"reply@example.com", "other@example.com", " Reply@Example.com"}
+
+	expected := []string{"reply@example.com", "other@example.com"}
+
+	if _, err := SendEmail(context.Background(), client, input); err != nil {
+		t.Fatal(err)
+	} else if replyTo := client.SentEmails()[0].ReplyToAddresses; !reflect.DeepEqual(replyTo, expected) {
+		t.Errorf("expected %v, got %v", expected, replyTo)
+	}
+}
+
+func TestSendEmailsValidatesBatchFirst(t *testing.T) {
+	invalid := simpleEmail("c@example.com")
+	invalid.Destination = nil
+
+	for _, test := range []struct {
+		name     string
+		enabled  bool
+		sent     int
+		expected []string
+	}{
+		{"enabled", true, 0, []string{
+			"Email 0: Not sent because another email in the batch failed validation",
+			"Email 1: Not sent because another email in the batch failed validation",
+			"Email 2: Invalid input: Destination must contain at least one To, CC, or BCC address",
+		}},
+		{"disabled", false, 2, []string{"Invalid input: Destination must contain at least one To, CC, or BCC address"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			useSettings(t, Config{ValidateBatchFirst: test.enabled})
+
+			client := &fakeClient{}
+			outputs, errs := SendEmails(context.Background(), client, []*SendEmailInput{
+				simpleEmail("a@example.com"),
+				simpleEmail("b@example.com"),
+				invalid,
+			})
+
+			if len(client.SentEmails()) != test.sent || len(outputs) != test.sent {
+				t.Errorf("expected %d emails to be sent, got %d", test.sent, len(client.SentEmails()))
+			} else if len(errs) != len(test.expected) {
+				t.Fatalf("expected %q, got %v", test.expected, errs)
+			}
+
+			for index, err := range errs {
+				if err.Error() != test.expected[index] {
+					t.Errorf("expected %q, got %q", test.expected[index], err)
+				}
+			}
+		})
+	}
+}
+
+func TestSendEmailsValidatesBatchFirstReportsEveryError(t *testing.T) {
+	useSettings(t, Config{ValidateBatchFirst: true})
+
+	noContent := simpleEmail("b@example.com")
+	noContent.Content = nil
+
+	client := &fakeClient{}
+	_, errs := SendEmails(context.Background(), client, []*SendEmailInput{
+		simpleEmail("a@example.com"),
+		noContent,
+		nil,
+	})
+
+	if len(errs) != 3 || !errors.Is(errs[0], ErrBatchValidationFailed) {
+		t.Errorf("expected the valid email 0 to be skipped, got %v", errs)
+	} else if !strings.HasPrefix(errs[1].Error(), "Email 1: ") || errs[2].Error() != "Email 2: Email is required" {
+		t.Errorf("expected errors for emails 1 and 2, got %v", errs)
+	} else if len(client.SentEmails()) != 0 {
+		t.Errorf("expected nothing to be sent, got %d", len(client.SentEmails()))
+	}
+}
+
+func TestSendEmailsValidatesBatchFirstBeforeBatchingTemplates(t *testing.T) {
+	useSettings(t, Config{ValidateBatchFirst: true, BatchTemplatedEmails: true})
+
+	var inputs []*SendEmailInput
+
+	for index := 0; index < 51; index++ {
+		inputs = append(inputs, templatedEmail(fmt.Sprintf("user%d@example.com", index), "welcome"))
+	}
+
+	inputs[50].Destination.ToAddresses[0] = "user50@example.com\n"
+	client := &fakeClient{}
+	outputs, errs := SendEmails(context.Background(), client, inputs)
+
+	if len(client.SentBulkEmails()) != 0 || len(client.SentEmails()) != 0 || len(outputs) != 0 {
+		t.Errorf("expected nothing to be sent, got %d bulk emails", len(client.SentBulkEmails()))
+	} else if len(errs) != 51 || !errors.Is(errs[0], ErrBatchValidationFailed) || errors.Is(errs[50], ErrBatchValidationFailed) {
+		t.Errorf("expected the 51st email to fail validation and the rest to be skipped, got %v", errs)
+	}
+}
+
+func TestSendBulkEmailRejectsInvalidLastEntry(t *testing.T) {
+	useSettings(t, Config{})
+
+	client := &fakeClient{}
+	input := bulkEmail("a@example.com", "b@example.com")
+	input.BulkEmailEntries = append(input.BulkEmailEntries, BulkEmailEntry{})
+
+	if _, err := SendBulkEmail(context.Background(), client, input); err == nil {
+		t.Error("expected the invalid entry to be reported")
+	} else if len(client.SentBulkEmails()) != 0 {
+		t.Errorf("expected nothing to be sent, got %d requests", len(client.SentBulkEmails()))
+	}
+}
+
+// Reports whether every email of a batch failed with the same error, indexed in order
+func isBatchRejection(errs []error, count int, expected string) bool {
+	if len(errs) != count {
+		return false
+	}
+
+	for index, err := range errs {
+		var emailErr *EmailError
+
+		if !errors.As(err, &emailErr) || emailErr.Index != index || err.Error() != expected {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestSendEmailsLimitsBatchRecipients(t *testing.T) {
+	batch := func(counts ...int) []*SendEmailInput {
+		var inputs []*SendEmailInput
+
+		for _, count := range counts {
+			input := simpleEmail("to@example.com")
+			input.Destination.CcAddresses = addresses(count - 1)
+			inputs = append(inputs, input)
+		}
+
+		return inputs
+	}
+
+	for _, test := range []struct {
+		name     string
+		limit    int
+		inputs   []*SendEmailInput
+		expected string
+	}{
+		{"no limit", 0, batch(50, 50, 50), ""},
+		{"at the limit", 10, batch(1, 4, 5), ""},
+		{"one above the limit", 10, batch(1, 4, 6), "Too many recipients in the batch: 11 given across 3 emails, but at most 10 are allowed"},
+		{"single email above the limit", 10, batch(11), "Too many recipients in the batch: 11 given across 1 emails, but at most 10 are allowed"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			useSettings(t, Config{MaxBatchRecipients: test.limit})
+
+			client := &fakeClient{}
+			_, errs := SendEmails(context.Background(), client, test.inputs)
+
+			if test.expected == "" {
+				for _, err := range errs {
+					if err != nil {
+						t.Errorf("expected no error, got %v", err)
+					}
+				}
+
+				if len(client.SentEmails()) != len(test.inputs) {
+					t.Errorf("expected %d emails to be sent, got %d", len(test.inputs), len(client.SentEmails()))
+				}
+			} else if !isBatchRejection(errs, len(test.inputs), test.expected) {
+				t.Errorf("expected %q for each email, got %v", test.expected, errs)
+			} else if len(client.SentEmails()) != 0 {
+				t.Errorf("expected nothing to be sent, got %d emails", len(client.SentEmails()))
+			}
+		})
+	}
+}
+
+// Returns the given number of valid tags
+func manyTags(count int) MessageTag {
+	tags := MessageTag{}
+
+	for index := 0; index < count; index++ {
+		tags[fmt.Sprintf("tag%d", index)] = "value"
+	}
+
+	return tags
+}
+
+func TestCreateEmailTagsLimitsCount(t *testing.T) {
+	if _, err := createEmailTags(manyTags(maxTags)); err != nil {
+		t.Errorf("expected %d tags to be allowed, got %v", maxTags, err)
+	}
+
+	expected := "Invalid tags: 51 tags exceed the 50 tag limit"
+
+	if _, err := createEmailTags(manyTags(maxTags + 1)); err == nil || err.Error() != expected {
+		t.Errorf("expected %q, got %v", expected, err)
+	}
+}
+
+func TestTagCapacity(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		tagSets   []MessageTag
+		remaining int
+	}{
+		{"no tags", nil, 50},
+		{"some tags", []MessageTag{{"campaign": "launch", "team": "growth", "region": "eu"}}, 47},
+		{"at the limit", []MessageTag{manyTags(maxTags)}, 0},
+		{"over the limit", []MessageTag{manyTags(maxTags + 5)}, 0},
+		{"default and replacement tags", []MessageTag{{"campaign": "launch"}, {"recipient": "a"}}, 48},
+		{"replacement tags overriding defaults", []MessageTag{{"campaign": "launch", "team": "growth"}, {"campaign": "relaunch"}}, 48},
+		{"merged past the limit", []MessageTag{manyTags(40), {"extra1": "a", "extra2": "b"}, manyTags(45)}, 3},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			expected := &TagCapacity{RemainingTags: test.remaining, MaxNameLength: maxTagLength, MaxValueLength: maxTagLength}
+
+			if capacity := tagCapacity(test.tagSets...); !reflect.DeepEqual(capacity, expected) {
+				t.Errorf("expected %+v, got %+v", expected, capacity)
+			}
+		})
+	}
+}
+
+func TestSendReportsTagCapacity(t *testing.T) {
+	useSettings(t, Config{})
+
+	input := simpleEmail("to@example.com")
+	input.EmailTags = MessageTag{"campaign": "launch", "team": "growth"}
+
+	if output, err := SendEmail(context.Background(), &fakeClient{}, input); err != nil {
+		t.Fatal(err)
+	} else if output.TagCapacity == nil || output.TagCapacity.RemainingTags != 48 {
+		t.Errorf("expected 48 remaining tags, got %+v", output.TagCapacity)
+	}
+
+	bulk := bulkEmail("a@example.com", "b@example.com", "c@example.com")
+	bulk.DefaultEmailTags = MessageTag{"campaign": "launch"}
+	bulk.BulkEmailEntries[1].ReplacementTags = MessageTag{"campaign": "relaunch"}
+	bulk.BulkEmailEntries[2].ReplacementTags = MessageTag{"recipient": "c", "team": "growth"}
+
+	output, err := SendBulkEmail(context.Background(), &fakeClient{}, bulk)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for index, expected := range []int{49, 49, 47} {
+		if capacity := output.BulkEmailEntryResults[index].TagCapacity; capacity == nil || capacity.RemainingTags != expected {
+			t.Errorf("expected entry %d to have %d remaining tags, got %+v", index, expected, capacity)
+		}
+	}
+}
+
+func TestSendBulkEmailLimitsMergedTags(t *testing.T) {
+	useSettings(t, Config{})
+
+	client := &fakeClient{}
+	input := bulkEmail("a@example.com", "b@example.com")
+	input.DefaultEmailTags = manyTags(maxTags)
+	input.BulkEmailEntries[1].ReplacementTags = MessageTag{"recipient": "b"}
+
+	_, err := SendBulkEmail(context.Background(), client, input)
+	expected := "Entry 1: 51 tags, including the default tags, exceed the 50 tag limit"
+
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected %q, got %v", expected, err)
+	} else if len(client.SentBulkEmails()) != 0 {
+		t.Errorf("expected SES not to be called")
+	}
+}
+
+func TestSendEmailRejectsInvalidTags(t *testing.T) {
+	useSettings(t, Config{})
+
+	client := &fakeClient{}
+	input := simpleEmail("to@example.com")
+	input.EmailTags = MessageTag{"campaign name": "launch"}
+
+	_, err := SendEmail(context.Background(), client, input)
+	expected := `Invalid tags: tag "campaign name" name may only contain ASCII letters, numbers, underscores, and dashes`
+
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected %q, got %v", expected, err)
+	} else if len(client.SentEmails()) != 0 {
+		t.Errorf("expected SES not to be called")
+	}
+}
+
+func TestSendEmailsLimitsAttachmentBytes(t *testing.T) {
+	batch := func(sizes ...int) []*SendEmailInput {
+		var inputs []*SendEmailInput
+
+		for _, size := range sizes {
+			input := simpleEmail("to@example.com")
+			input.Content.Attachments = []Attachment{
+				{Filename: "notes.txt", ContentType: "text/plain", Data: []byte(strings.Repeat("a", size))},
+			}
+			inputs = append(inputs, input)
+		}
+
+		return inputs
+	}
+
+	for _, test := range []struct {
+		name     string
+		limit    int
+		inputs   []*SendEmailInput
+		expected string
+	}{
+		{"no limit", 0, batch(100, 100), ""},
+		{"at the limit", 100, batch(30, 30, 40), ""},
+		{"one byte above the limit", 100, batch(30, 30, 41), "Too many attachment bytes: 101 given across 3 emails, but at most 100 are allowed"},
+		{"single email above the limit", 100, batch(101), "Too many attachment bytes: 101 given across 1 emails, but at most 100 are allowed"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			useSettings(t, Config{MaxAttachmentBytes: test.limit, AllowedAttachmentTypes: defaultAllowedAttachmentTypes})
+
+			client := &fakeClient{}
+			_, errs := SendEmails(context.Background(), client, test.inputs)
+
+			if test.expected == "" {
+				for _, err := range errs {
+					t.Errorf("expected no error, got %v", err)
+				}
+
+				if len(client.SentEmails()) != len(test.inputs) {
+					t.Errorf("expected %d emails to be sent, got %d", len(test.inputs), len(client.SentEmails()))
+				}
+			} else if !isBatchRejection(errs, len(test.inputs), test.expected) {
+				t.Errorf("expected %q for each email, got %v", test.expected, errs)
+			} else if len(client.SentEmails()) != 0 {
+				t.Errorf("expected nothing to be sent, got %d emails", len(client.SentEmails()))
+			}
+		})
+	}
+}
+
+func TestSendEmailsLimitsRawAttachmentBytes(t *testing.T) {
+	useSettings(t, Config{MaxAttachmentBytes: 10, AllowedAttachmentTypes: defaultAllowedAttachmentTypes})
+
+	raw := simpleEmail("to@example.com")
+	raw.Content = &EmailContent{Raw: &RawMessage{Data: rawMessageWithAttachment("application/pdf")}}
+	simple := simpleEmail("to@example.com")
+	simple.Content.Attachments = []Attachment{{Filename: "a.txt", ContentType: "text/plain", Data: []byte("abc")}}
+
+	client := &fakeClient{}
+	_, errs := SendEmails(context.Background(), client, []*SendEmailInput{raw, simple})
+
+	// The raw attachment's base64 body is 8 bytes, and the text part isn't an attachment
+	expected := "Too many attachment bytes: 11 given across 2 emails, but at most 10 are allowed"
+
+	if !isBatchRejection(errs, 2, expected) {
+		t.Errorf("expected %q for each email, got %v", expected, errs)
+	} else if len(client.SentEmails()) != 0 {
+		t.Errorf("expected nothing to be sent, got %d emails", len(client.SentEmails()))
+	}
+}
+
+func TestSendEmailLimitsAttachmentBytes(t *testing.T) {
+	useSettings(t, Config{MaxAttachmentBytes: 4, AllowedAttachmentTypes: defaultAllowedAttachmentTypes})
+
+	input := simpleEmail("to@example.com")
+	input.Content.Attachments = []Attachment{
+		{Filename: "a.txt", ContentType: "text/plain", Data: []byte("abc")},
+		{Filename: "b.txt", ContentType: "text/plain", Data: []byte("de")},
+	}
+
+	_, err := SendEmail(context.Background(), &fakeClient{}, input)
+	expected := "Too many attachment bytes: 5 given across 1 emails, but at most 4 are allowed"
+
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected %q, got %v", expected, err)
+	} else if err := ValidateSendEmailInput(input); err == nil || err.Error() != expected {
+		t.Errorf("expected validation to report %q, got %v", expected, err)
+	}
+}
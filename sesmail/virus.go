@@ -0,0 +1,86 @@
+// Classification of messages SES rejected for containing a virus
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/smithy-go"
+)
+
+// Returned when SES rejects a message because it contains a virus
+type ErrVirusDetected struct {
+
+	// The filenames of the message's attachments. SES doesn't say which part contains the virus,
+	// so any of them may be implicated.
+	Attachments []string
+
+	// The error returned by SES.
+	Err error
+}
+
+func (err *ErrVirusDetected) Error() string {
+	if len(err.Attachments) == 0 {
+		return "Message was rejected because it contains a virus"
+	}
+
+	return fmt.Sprintf(
+		"Message was rejected because it contains a virus, possibly in attachments %s",
+		strings.Join(err.Attachments, ", "),
+	)
+}
+
+func (err *ErrVirusDetected) Unwrap() error {
+	return err.Err
+}
+
+// Converts SES's MessageRejected error into ErrVirusDetected when it was rejected for a virus,
+// listing the attachments of the raw message that was sent
+func virusDetected(err error, raw []byte) error {
+	var apiErr smithy.APIError
+
+	if !errors.As(err, &apiErr) || apiErr.ErrorCode() != "MessageRejected" ||
+		!isVirusMessage(apiErr.ErrorMessage()) {
+		return err
+	}
+
+	return &ErrVirusDetected{Attachments: rawMessageAttachments(raw), Err: err}
+}
+
+// Whether SES's description of a rejection says the message contains a virus
+func isVirusMessage(message string) bool {
+	return strings.Contains(strings.ToLower(message), "virus")
+}
+
+// Returns the filenames of the attachments in a raw MIME message. Messages which can't be parsed
+// have none.
+func rawMessageAttachments(raw []byte) []string {
+	if raw == nil {
+		return nil
+	}
+
+	tree, err := parseMimeTree(raw)
+
+	if err != nil {
+		return nil
+	}
+
+	return mimeTreeAttachments(tree)
+}
+
+func mimeTreeAttachments(part *MimePart) []string {
+	var filenames []string
+
+	if part.Disposition == "attachment" {
+		filenames = append(filenames, part.Filename)
+	}
+
+	for _, child := range part.Parts {
+		filenames = append(filenames, mimeTreeAttachments(child)...)
+	}
+
+	return filenames
+}
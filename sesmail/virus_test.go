@@ -0,0 +1,108 @@
+// Tests for classification of messages SES rejected for containing a virus
+// Copyright 2021 - 2022 Luke Zhang
+// BSD-3-Clause License
+package sesmail
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	sesv2 "github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+	"github.com/aws/smithy-go"
+)
+
+var virusRejection = &smithy.GenericAPIError{
+	Code:    "MessageRejected",
+	Message: "Message rejected: Virus detected in the message.",
+	Fault:   smithy.FaultClient,
+}
+
+func TestVirusDetected(t *testing.T) {
+	unverified := &smithy.GenericAPIError{Code: "MessageRejected", Message: "Email address is not verified."}
+
+	for _, test := range []struct {
+		name        string
+		err         error
+		raw         []byte
+		expected    bool
+		attachments []string
+	}{
+		{"virus in an attachment", virusRejection, rawMessageWithAttachment("application/pdf"), true, []string{"file"}},
+		{"virus without attachments", virusRejection, rawMessage("Subject: Plain", "", "Hello"), true, nil},
+		{"virus in an unparsable message", virusRejection, []byte("not a message"), true, nil},
+		{"other rejection", unverified, rawMessageWithAttachment("application/pdf"), false, nil},
+		{"other error", errors.New("connection reset"), nil, false, nil},
+		{"no error", nil, nil, false, nil},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			err := virusDetected(test.err, test.raw)
+
+			var virusErr *ErrVirusDetected
+
+			if !test.expected {
+				if err != test.err {
+					t.Errorf("expected %v to be returned unchanged, got %v", test.err, err)
+				}
+
+				return
+			}
+
+			if !errors.As(err, &virusErr) {
+				t.Fatalf("expected a virus to be detected, got %v", err)
+			} else if !reflect.DeepEqual(virusErr.Attachments, test.attachments) {
+				t.Errorf("expected attachments %v, got %v", test.attachments, virusErr.Attachments)
+			} else if !errors.Is(err, test.err) {
+				t.Error("expected the SES error to be wrapped")
+			}
+		})
+	}
+}
+
+func TestSendEmailReportsVirusInAttachments(t *testing.T) {
+	useSettings(t, Config{AllowedAttachmentTypes: defaultAllowedAttachmentTypes})
+
+	client := &fakeClient{sendEmail: func(context.Context, *sesv2.SendEmailInput) (*sesv2.SendEmailOutput, error) {
+		return nil, virusRejection
+	}}
+	input := simpleEmail("to@example.com")
+	input.Content.Attachments = []Attachment{
+		{Filename: "invoice.pdf", ContentType: "application/pdf", Data: pdfData},
+		{Filename: "notes.txt", ContentType: "text/plain", Data: textData},
+	}
+
+	_, err := SendEmail(context.Background(), client, input)
+	expected := "Message was rejected because it contains a virus, possibly in attachments invoice.pdf, notes.txt"
+
+	var virusErr *ErrVirusDetected
+
+	if !errors.As(err, &virusErr) || err.Error() != expected {
+		t.Fatalf("expected %q, got %v", expected, err)
+	} else if code := ErrorResultCode(err); code != ResultVirusDetected {
+		t.Errorf("expected %s, got %s", ResultVirusDetected, code)
+	} else if problem := NewProblem(err); problem.Type != "urn:lambda-ses:problem:VirusDetected" {
+		t.Errorf("expected a virus problem, got %s", problem.Type)
+	}
+}
+
+func TestBulkStatusResultCodeDistinguishesVirus(t *testing.T) {
+	rejected := BulkEmailStatus(types.BulkEmailStatusMessageRejected)
+
+	for message, expected := range map[string]ResultCode{
+		"Message rejected: Virus detected in the message.": ResultVirusDetected,
+		"Email address is not verified.":                   ResultRejected,
+		"":                                                 ResultRejected,
+	} {
+		if code := bulkStatusResultCode(rejected, message); code != expected {
+			t.Errorf("expected %s for %q, got %s", expected, message, code)
+		}
+	}
+
+	err := &BulkEntryError{Status: rejected, Message: "Virus detected"}
+
+	if code := ErrorResultCode(err); code != ResultVirusDetected {
+		t.Errorf("expected a bulk entry with a virus to be %s, got %s", ResultVirusDetected, code)
+	}
+}